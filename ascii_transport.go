@@ -0,0 +1,213 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// start (1 char), 252 bytes of unit id, function code and payload as
+	// hex, LRC (2 chars) and CRLF (2 chars)
+	maxASCIIFrameLength	int	= 513
+)
+
+// asciiTransport implements the modbus ASCII framing over a serial link:
+// frames start with a colon, carry hex encoded bytes followed by an LRC and
+// end with CR LF.
+type asciiTransport struct {
+	logger		*logger
+	link		rtuLink
+	timeout		time.Duration
+}
+
+// Returns a new ASCII transport.
+func newASCIITransport(link rtuLink, addr string, timeout time.Duration) (at *asciiTransport) {
+	at = &asciiTransport{
+		logger:		newLogger(fmt.Sprintf("ascii-transport(%s)", addr)),
+		link:		link,
+		timeout:	timeout,
+	}
+
+	return
+}
+
+// Closes the link.
+func (at *asciiTransport) Close() (err error) {
+	err = at.link.Close()
+
+	return
+}
+
+// Runs a request across the link and returns a response.
+func (at *asciiTransport) ExecuteRequest(req *pdu) (res *pdu, err error) {
+	err	= at.link.SetDeadline(time.Now().Add(at.timeout))
+	if err != nil {
+		return
+	}
+
+	_, err	= at.link.Write(at.assembleASCIIFrame(req))
+	if err != nil {
+		return
+	}
+
+	res, err	= at.readASCIIFrame(false)
+
+	return
+}
+
+// Waits for, reads and decodes a request from the link.
+func (at *asciiTransport) ReadRequest() (req *pdu, err error) {
+	var b	[]byte
+
+	b	= make([]byte, 1)
+
+	// wait for the start of the next request: the line may stay idle for
+	// any amount of time, hence read timeouts are retried and anything
+	// preceding the colon is skipped
+	for {
+		err	= at.link.SetDeadline(time.Now().Add(at.timeout))
+		if err != nil {
+			return
+		}
+
+		_, err	= io.ReadFull(at.link, b)
+		if isTimeoutError(err) || (err == nil && b[0] != ':') {
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return
+	}
+
+	req, err	= at.readASCIIFrame(true)
+
+	return
+}
+
+// Writes a response to the link.
+func (at *asciiTransport) WriteResponse(res *pdu) (err error) {
+	err	= at.link.SetDeadline(time.Now().Add(at.timeout))
+	if err != nil {
+		return
+	}
+
+	_, err	= at.link.Write(at.assembleASCIIFrame(res))
+
+	return
+}
+
+// Writes a request to the link without waiting for a response, as required
+// for broadcast requests.
+func (at *asciiTransport) WriteRequest(req *pdu) (err error) {
+	err	= at.WriteResponse(req)
+
+	return
+}
+
+// Reads and decodes a frame from the link.
+// If startSeen is true, the leading colon is assumed to have already been
+// consumed.
+// Malformed frames are reported as ErrShortFrame (truncated or too short
+// frames), ErrProtocolError (invalid characters) or ErrBadCRC (LRC mismatch).
+func (at *asciiTransport) readASCIIFrame(startSeen bool) (p *pdu, err error) {
+	var line	[]byte
+	var frame	[]byte
+	var b		[]byte
+	var lrc		byte
+
+	b	= make([]byte, 1)
+
+	// skip anything preceding the start of the frame
+	for !startSeen {
+		_, err	= io.ReadFull(at.link, b)
+		if err != nil {
+			return
+		}
+		startSeen	= b[0] == ':'
+	}
+
+	// read up to the LF terminating the frame, allowing up to timeout
+	// between characters
+	for {
+		err	= at.link.SetDeadline(time.Now().Add(at.timeout))
+		if err != nil {
+			return
+		}
+
+		_, err	= io.ReadFull(at.link, b)
+		if err != nil {
+			if err == io.ErrUnexpectedEOF || isTimeoutError(err) {
+				err	= ErrShortFrame
+			}
+			return
+		}
+
+		if b[0] == '\n' {
+			break
+		}
+
+		line	= append(line, b[0])
+		if len(line) > maxASCIIFrameLength - 2 {
+			err	= ErrProtocolError
+			return
+		}
+	}
+
+	line	= bytes.TrimSuffix(line, []byte{'\r'})
+
+	// unit id, function code and LRC, as hex
+	if len(line) < 6 || len(line) % 2 != 0 {
+		err	= ErrShortFrame
+		return
+	}
+
+	frame	= make([]byte, len(line) / 2)
+	_, err	= hex.Decode(frame, line)
+	if err != nil {
+		err	= ErrProtocolError
+		return
+	}
+
+	for _, c := range frame {
+		lrc	+= c
+	}
+	// the LRC is the two's complement of the sum of all other bytes,
+	// hence the sum of all bytes including the LRC is zero
+	if lrc != 0 {
+		err	= ErrBadCRC
+		return
+	}
+
+	p	= &pdu{
+		unitId:		frame[0],
+		functionCode:	frame[1],
+		payload:	frame[2:len(frame) - 1],
+	}
+
+	return
+}
+
+// Turns a PDU object into an ASCII frame.
+func (at *asciiTransport) assembleASCIIFrame(p *pdu) (adu []byte) {
+	var raw	[]byte
+	var lrc	byte
+
+	raw	= append(raw, p.unitId, p.functionCode)
+	raw	= append(raw, p.payload...)
+
+	for _, c := range raw {
+		lrc	+= c
+	}
+	raw	= append(raw, -lrc)
+
+	adu	= append(adu, ':')
+	adu	= append(adu, bytes.ToUpper([]byte(hex.EncodeToString(raw)))...)
+	adu	= append(adu, '\r', '\n')
+
+	return
+}
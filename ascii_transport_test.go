@@ -0,0 +1,73 @@
+package modbus
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestASCIIClientServer(t *testing.T) {
+	var ms		*ModbusServer
+	var mc		*ModbusClient
+	var ds		*DataStore
+	var p1, p2	net.Conn
+	var regs	[]uint16
+	var err		error
+
+	ds	= NewDataStore(0, 0, 10, 0)
+
+	ms, err	= NewServer(&ServerConfiguration{
+		URL:			"ascii:///dev/ttyUSB0",
+		AcceptedUnitIds:	[]uint8{1},
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if ms.transportType != RTU_TRANSPORT || !ms.asciiFraming {
+		t.Errorf("ascii:// servers should use ASCII framing over a serial link")
+	}
+	if ms.conf.URL != "/dev/ttyUSB0" || ms.conf.Timeout != 1 * time.Second {
+		t.Errorf("unexpected url or timeout: %v, %v", ms.conf.URL, ms.conf.Timeout)
+	}
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"ascii:///dev/ttyUSB0",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if mc.transportType != ASCII_TRANSPORT || mc.conf.Timeout != 1 * time.Second {
+		t.Errorf("unexpected transport type or timeout: %v, %v",
+			 mc.transportType, mc.conf.Timeout)
+	}
+
+	// run both ends over a pipe rather than a serial port
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go ms.handleTransport(newASCIITransport(p2, "", 100 * time.Millisecond))
+	mc.transport	= newASCIITransport(p1, "", 100 * time.Millisecond)
+
+	// let the server wait through a few idle timeouts
+	time.Sleep(300 * time.Millisecond)
+
+	err	= mc.WriteRegisters(2, []uint16{0x1234, 0xabcd})
+	if err != nil {
+		t.Fatalf("WriteRegisters() should have succeeded, got: %v", err)
+	}
+
+	regs, err	= mc.ReadRegisters(2, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+	if regs[0] != 0x1234 || regs[1] != 0xabcd {
+		t.Errorf("unexpected values: %v", regs)
+	}
+
+	// out of range addresses should yield an exception response
+	_, err	= mc.ReadRegisters(9, 2, HOLDING_REGISTER)
+	if err == nil {
+		t.Errorf("ReadRegisters() should have failed")
+	}
+
+	return
+}
@@ -0,0 +1,153 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// autoDetectTransport serves requests over a serial link carrying both
+// RTU and ASCII frames, detecting the framing of every request from its
+// first byte (a colon for ASCII, anything else for RTU).
+// Responses are sent with the framing of the last request.
+type autoDetectTransport struct {
+	logger		*logger
+	link		*peekLink
+	timeout		time.Duration
+	rtu		*rtuTransport
+	ascii		*asciiTransport
+	lastWasASCII	bool
+}
+
+// peekLink is an rtuLink allowing a byte to be pushed back after being read.
+type peekLink struct {
+	rtuLink
+	pending		[]byte
+}
+
+// Returns a new modbus server serving requests on serialURL (either an
+// rtu:// URL or a bare device path), accepting both RTU and ASCII frames
+// (see ServerConfiguration for RTU settings, which also apply to ASCII).
+// The framing is detected for every request, allowing both modes to be used
+// on the same bus.
+// conf.URL is ignored.
+func NewAutoDetectServer(serialURL string, conf *ServerConfiguration, handler RequestHandler) (ms *ModbusServer, err error) {
+	var c	ServerConfiguration
+
+	c	= *conf
+	c.URL	= serialURL
+	if !strings.HasPrefix(c.URL, "rtu://") {
+		c.URL	= "rtu://" + c.URL
+	}
+
+	ms, err	= NewServer(&c, handler)
+	if err != nil {
+		return
+	}
+
+	ms.autoDetectFraming	= true
+
+	return
+}
+
+// Returns a new auto-detecting transport.
+func newAutoDetectTransport(link rtuLink, addr string, speed uint, timeout time.Duration) (adt *autoDetectTransport) {
+	var pl	*peekLink
+
+	pl	= &peekLink{rtuLink: link}
+	adt	= &autoDetectTransport{
+		logger:		newLogger(fmt.Sprintf("auto-detect-transport(%s)", addr)),
+		link:		pl,
+		timeout:	timeout,
+		rtu:		newRTUTransport(pl, addr, speed, timeout),
+		ascii:		newASCIITransport(pl, addr, timeout),
+	}
+
+	return
+}
+
+// Closes the link.
+func (adt *autoDetectTransport) Close() (err error) {
+	err	= adt.link.Close()
+
+	return
+}
+
+// Client-side requests are not supported by this transport.
+func (adt *autoDetectTransport) ExecuteRequest(req *pdu) (res *pdu, err error) {
+	err	= ErrConfigurationError
+
+	return
+}
+
+// Waits for a request, then reads and decodes it with the framing matching
+// its first byte.
+func (adt *autoDetectTransport) ReadRequest() (req *pdu, err error) {
+	var b		[]byte
+	var n		int
+
+	b	= make([]byte, 1)
+
+	// wait for the first byte of the next request, for as long as the line
+	// stays idle
+	for {
+		err	= adt.link.SetDeadline(time.Now().Add(adt.timeout))
+		if err != nil {
+			return
+		}
+
+		n, err	= io.ReadFull(adt.link, b)
+		if n == 0 && isTimeoutError(err) {
+			continue
+		}
+		break
+	}
+
+	if err != nil {
+		return
+	}
+
+	if b[0] == ':' {
+		adt.lastWasASCII	= true
+		req, err		= adt.ascii.readASCIIFrame(true)
+	} else {
+		adt.lastWasASCII	= false
+
+		// let the rtu transport read the frame from its first byte
+		adt.link.unread(b[0])
+		req, err	= adt.rtu.ReadRequest()
+	}
+
+	return
+}
+
+// Writes a response, with the framing of the last request.
+func (adt *autoDetectTransport) WriteResponse(res *pdu) (err error) {
+	if adt.lastWasASCII {
+		err	= adt.ascii.WriteResponse(res)
+	} else {
+		err	= adt.rtu.WriteResponse(res)
+	}
+
+	return
+}
+
+// Pushes back a byte, to be returned by the next Read() call.
+func (pl *peekLink) unread(b byte) {
+	pl.pending	= append(pl.pending, b)
+
+	return
+}
+
+func (pl *peekLink) Read(buf []byte) (n int, err error) {
+	if len(pl.pending) > 0 {
+		n		= copy(buf, pl.pending)
+		pl.pending	= pl.pending[n:]
+		return
+	}
+
+	n, err	= pl.rtuLink.Read(buf)
+
+	return
+}
@@ -0,0 +1,102 @@
+package modbus
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAutoDetectTransport(t *testing.T) {
+	var adt		*autoDetectTransport
+	var ct		*rtuTransport
+	var at		*asciiTransport
+	var p1, p2	net.Conn
+	var txchan	chan []byte
+	var req		*pdu
+	var res		*pdu
+	var err		error
+
+	txchan	= make(chan []byte, 4)
+	p1, p2	= net.Pipe()
+	go feedTestPipe(t, txchan, p1)
+	defer p1.Close()
+	defer p2.Close()
+
+	adt	= newAutoDetectTransport(p2, "", 19200, 100 * time.Millisecond)
+	// client side of the link, used to assemble and decode frames
+	ct	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+	at	= newASCIITransport(p1, "", 100 * time.Millisecond)
+
+	// an ASCII request (read 3 holding registers at 0x006b from unit 0x11)
+	txchan	<- []byte(":1103006B00037E\r\n")
+	req, err	= adt.ReadRequest()
+	if err != nil {
+		t.Fatalf("ReadRequest() should have succeeded, got: %v", err)
+	}
+	if req.unitId != 0x11 || req.functionCode != FC_READ_HOLDING_REGISTERS ||
+	   len(req.payload) != 4 || req.payload[1] != 0x6b || req.payload[3] != 0x03 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// the response should be ASCII framed
+	go adt.WriteResponse(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x02, 0x12, 0x34},
+	})
+	res, err	= at.readASCIIFrame(false)
+	if err != nil {
+		t.Fatalf("expected an ASCII response, got: %v", err)
+	}
+	if res.unitId != 0x11 || len(res.payload) != 3 || res.payload[1] != 0x12 {
+		t.Errorf("unexpected response: %+v", res)
+	}
+
+	// an RTU request
+	txchan	<- ct.assembleRTUFrame(&pdu{
+		unitId:		0x22,
+		functionCode:	FC_WRITE_SINGLE_REGISTER,
+		payload:	[]byte{0x00, 0x01, 0xab, 0xcd},
+	})
+	req, err	= adt.ReadRequest()
+	if err != nil {
+		t.Fatalf("ReadRequest() should have succeeded, got: %v", err)
+	}
+	if req.unitId != 0x22 || req.functionCode != FC_WRITE_SINGLE_REGISTER ||
+	   len(req.payload) != 4 || req.payload[2] != 0xab || req.payload[3] != 0xcd {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// the response should be RTU framed
+	go adt.WriteResponse(req)
+	res, err	= ct.readRTUFrame()
+	if err != nil {
+		t.Fatalf("expected an RTU response, got: %v", err)
+	}
+	if res.unitId != 0x22 || res.functionCode != FC_WRITE_SINGLE_REGISTER {
+		t.Errorf("unexpected response: %+v", res)
+	}
+
+	// an ASCII request with a bad LRC should be rejected
+	txchan	<- []byte(":1103006B00037F\r\n")
+	_, err	= adt.ReadRequest()
+	if err != ErrBadCRC {
+		t.Errorf("expected ErrBadCRC, got: %v", err)
+	}
+
+	// followed by a valid ASCII request (write single coil)
+	txchan	<- at.assembleASCIIFrame(&pdu{
+		unitId:		0x01,
+		functionCode:	FC_WRITE_SINGLE_COIL,
+		payload:	[]byte{0x00, 0x05, 0xff, 0x00},
+	})
+	req, err	= adt.ReadRequest()
+	if err != nil {
+		t.Fatalf("ReadRequest() should have succeeded, got: %v", err)
+	}
+	if req.functionCode != FC_WRITE_SINGLE_COIL || req.payload[1] != 0x05 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	return
+}
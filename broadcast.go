@@ -0,0 +1,58 @@
+package modbus
+
+// Returns true if requests with function code fc may be broadcast (i.e. are
+// writes, which need no response).
+func isBroadcastWrite(fc uint8) (ok bool) {
+	switch fc {
+	case FC_WRITE_SINGLE_COIL, FC_WRITE_SINGLE_REGISTER,
+	     FC_WRITE_MULTIPLE_COILS, FC_WRITE_MULTIPLE_REGISTERS,
+	     FC_MASK_WRITE_REGISTER, FC_WRITE_FILE_RECORD:
+		ok	= true
+	}
+
+	return
+}
+
+// Sends a broadcast write request without waiting for a response.
+// As broadcasts are never answered, returns the response a device would have
+// echoed back so that callers need not special case them.
+func (mc *ModbusClient) executeBroadcast(rw requestWriter, req *pdu) (res *pdu, err error) {
+	var echoLength	int
+
+	if mc.ctx != nil {
+		err	= mc.ctx.Err()
+		if err != nil {
+			return
+		}
+	}
+
+	err	= rw.WriteRequest(req)
+	if mc.tap != nil {
+		mc.dumpFrames()
+		mc.tap.tx, mc.tap.rx	= nil, nil
+	}
+	if err != nil {
+		return
+	}
+
+	// single writes and mask writes are echoed back in full, multiple
+	// writes up to the quantity field and file record writes in full
+	switch req.functionCode {
+	case FC_WRITE_MULTIPLE_COILS, FC_WRITE_MULTIPLE_REGISTERS:
+		echoLength	= 4
+	default:
+		echoLength	= len(req.payload)
+	}
+
+	if echoLength > len(req.payload) {
+		echoLength	= len(req.payload)
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	append([]byte{}, req.payload[0:echoLength]...),
+	}
+
+	return
+}
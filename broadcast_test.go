@@ -0,0 +1,121 @@
+package modbus
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientBroadcastWrites(t *testing.T) {
+	var client	*ModbusClient
+	var link	*writeOnlyLink
+	var err		error
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// writeOnlyLink panics on reads: writes to unit id 0 should never
+	// wait for a response
+	link			= &writeOnlyLink{}
+	client.transport	= newRTUTransport(link, "", 19200, 100 * time.Millisecond)
+	client.SetUnitId(0)
+
+	err	= client.WriteCoil(1, true)
+	if err != nil {
+		t.Errorf("WriteCoil() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegister(1, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegisters(1, []uint16{0x1234, 0x5678})
+	if err != nil {
+		t.Errorf("WriteRegisters() should have succeeded, got: %v", err)
+	}
+
+	err	= client.MaskWriteRegister(1, 0x00f2, 0x0025)
+	if err != nil {
+		t.Errorf("MaskWriteRegister() should have succeeded, got: %v", err)
+	}
+
+	if len(link.writes) != 4 {
+		t.Errorf("expected 4 writes, got: %v", len(link.writes))
+	}
+
+	for i, b := range []byte{
+		0x00, 0x06,		// unit id and function code
+		0x00, 0x01, 0x12, 0x34,	// payload
+		0xd4, 0xac,		// CRC
+	} {
+		if i >= len(link.writes[1]) || link.writes[1][i] != b {
+			t.Fatalf("unexpected frame: 0x%x", link.writes[1])
+		}
+	}
+
+	return
+}
+
+func TestServerBroadcastRequestInfo(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ih		*infoHandler
+	var info	*RequestInfo
+	var p1, p2	net.Conn
+	var err		error
+
+	ih	= &infoHandler{
+		requestHandlerAdapter:	&requestHandlerAdapter{handler: NewDataStore(0, 0, 0, 10)},
+		infos:			make(chan *RequestInfo, 1),
+	}
+
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, ih)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go server.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	// broadcasts are handled but not answered
+	client.SetUnitId(0)
+	err	= client.WriteRegister(2, 0x1234)
+	if err != nil {
+		t.Fatalf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	info	= <-ih.infos
+	if !info.Broadcast || info.UnitId != 0 {
+		t.Errorf("unexpected request info: %+v", info)
+	}
+
+	// other requests are answered
+	client.SetUnitId(1)
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	info	= <-ih.infos
+	if info.Broadcast || info.UnitId != 1 {
+		t.Errorf("unexpected request info: %+v", info)
+	}
+
+	return
+}
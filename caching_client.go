@@ -0,0 +1,327 @@
+package modbus
+
+import (
+	"sync"
+	"time"
+)
+
+// CachingClient wraps a Client and caches the results of coil, discrete
+// input and register reads (see NewCachingClient()).
+type CachingClient struct {
+	inner		Client
+	ttl		time.Duration
+	lock		sync.Mutex
+	unitId		uint8	// last unit id set through SetUnitId()
+	unitIdSet	bool
+	entries		map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	fc		uint8	// function code of the read
+	unitId		uint8
+	addr		uint16
+	quantity	uint16
+}
+
+type cacheEntry struct {
+	bools		[]bool
+	regs		[]uint16
+	expiry		time.Time
+}
+
+// Returns a client wrapping inner, which caches the results of successful
+// reads for ttl: identical reads (same unit id, object type, address and
+// quantity) made within ttl are served from the cache, without sending a
+// request to the device.
+// Writes invalidate cached reads overlapping the written addresses (on the
+// same unit id), while SetEncoding() invalidates the whole cache.
+// Reads are keyed on the unit id inner actually sends requests to, which
+// ModbusClient and ClientPool (and wrappers around them) report. Other
+// clients are only cached once their unit id has been set through the
+// caching client, with SetUnitId().
+func NewCachingClient(inner Client, ttl time.Duration) (cc *CachingClient) {
+	cc = &CachingClient{
+		inner:		inner,
+		ttl:		ttl,
+		entries:	make(map[cacheKey]*cacheEntry),
+	}
+
+	return
+}
+
+// Clears the cache.
+func (cc *CachingClient) InvalidateAll() {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	cc.entries	= make(map[cacheKey]*cacheEntry)
+
+	return
+}
+
+func (cc *CachingClient) Open() (err error) {
+	err = cc.inner.Open()
+
+	return
+}
+
+func (cc *CachingClient) Close() (err error) {
+	err = cc.inner.Close()
+
+	return
+}
+
+func (cc *CachingClient) SetUnitId(id uint8) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	err = cc.inner.SetUnitId(id)
+	if err == nil {
+		cc.unitId	= id
+		cc.unitIdSet	= true
+	}
+
+	return
+}
+
+func (cc *CachingClient) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	// cached register values were decoded with the previous encoding
+	err		= cc.inner.SetEncoding(endianness, wordOrder)
+	cc.entries	= make(map[cacheKey]*cacheEntry)
+
+	return
+}
+
+func (cc *CachingClient) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= cc.readBools(FC_READ_COILS, addr, quantity)
+
+	return
+}
+
+func (cc *CachingClient) ReadCoil(addr uint16) (value bool, err error) {
+	var values	[]bool
+
+	values, err	= cc.readBools(FC_READ_COILS, addr, 1)
+	if err == nil {
+		value	= values[0]
+	}
+
+	return
+}
+
+func (cc *CachingClient) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= cc.readBools(FC_READ_DISCRETE_INPUTS, addr, quantity)
+
+	return
+}
+
+func (cc *CachingClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	var values	[]bool
+
+	values, err	= cc.readBools(FC_READ_DISCRETE_INPUTS, addr, 1)
+	if err == nil {
+		value	= values[0]
+	}
+
+	return
+}
+
+func (cc *CachingClient) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	values, err	= cc.readRegisters(addr, quantity, regType)
+
+	return
+}
+
+func (cc *CachingClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	var values	[]uint16
+
+	values, err	= cc.readRegisters(addr, 1, regType)
+	if err == nil {
+		value	= values[0]
+	}
+
+	return
+}
+
+func (cc *CachingClient) WriteCoil(addr uint16, value bool) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	err	= cc.inner.WriteCoil(addr, value)
+	cc.invalidate(FC_READ_COILS, addr, 1)
+
+	return
+}
+
+func (cc *CachingClient) WriteCoils(addr uint16, values []bool) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	err	= cc.inner.WriteCoils(addr, values)
+	cc.invalidate(FC_READ_COILS, addr, uint16(len(values)))
+
+	return
+}
+
+func (cc *CachingClient) WriteRegister(addr uint16, value uint16) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	err	= cc.inner.WriteRegister(addr, value)
+	cc.invalidate(FC_READ_HOLDING_REGISTERS, addr, 1)
+
+	return
+}
+
+func (cc *CachingClient) WriteRegisters(addr uint16, values []uint16) (err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	err	= cc.inner.WriteRegisters(addr, values)
+	cc.invalidate(FC_READ_HOLDING_REGISTERS, addr, uint16(len(values)))
+
+	return
+}
+
+// Reads coils or discrete inputs, from the cache if possible.
+func (cc *CachingClient) readBools(fc uint8, addr uint16, quantity uint16) (values []bool, err error) {
+	var key		cacheKey
+	var entry	*cacheEntry
+	var cached	bool
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	key.unitId, cached	= cc.currentUnitId()
+	key.fc		= fc
+	key.addr	= addr
+	key.quantity	= quantity
+	if cached {
+		entry	= cc.lookup(key)
+		if entry != nil {
+			values	= append([]bool{}, entry.bools...)
+			return
+		}
+	}
+
+	if fc == FC_READ_COILS {
+		values, err	= cc.inner.ReadCoils(addr, quantity)
+	} else {
+		values, err	= cc.inner.ReadDiscreteInputs(addr, quantity)
+	}
+	if err != nil || !cached {
+		return
+	}
+
+	cc.store(key, &cacheEntry{bools: append([]bool{}, values...)})
+
+	return
+}
+
+// Reads holding or input registers, from the cache if possible.
+func (cc *CachingClient) readRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	var key		cacheKey
+	var entry	*cacheEntry
+	var cached	bool
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	key.unitId, cached	= cc.currentUnitId()
+	key.fc		= readRegistersFunctionCode(regType)
+	key.addr	= addr
+	key.quantity	= quantity
+	if cached {
+		entry	= cc.lookup(key)
+		if entry != nil {
+			values	= append([]uint16{}, entry.regs...)
+			return
+		}
+	}
+
+	values, err	= cc.inner.ReadRegisters(addr, quantity, regType)
+	if err != nil || !cached {
+		return
+	}
+
+	cc.store(key, &cacheEntry{regs: append([]uint16{}, values...)})
+
+	return
+}
+
+// Returns the cache entry matching key, or nil if there is none or if it
+// has expired.
+// Must be called with cc.lock held.
+func (cc *CachingClient) lookup(key cacheKey) (entry *cacheEntry) {
+	entry	= cc.entries[key]
+	if entry != nil && time.Now().After(entry.expiry) {
+		delete(cc.entries, key)
+		entry	= nil
+	}
+
+	return
+}
+
+// Adds an entry to the cache, evicting expired entries.
+// Must be called with cc.lock held.
+func (cc *CachingClient) store(key cacheKey, entry *cacheEntry) {
+	var now	time.Time
+
+	now	= time.Now()
+	for k, e := range cc.entries {
+		if now.After(e.expiry) {
+			delete(cc.entries, k)
+		}
+	}
+
+	entry.expiry		= now.Add(cc.ttl)
+	cc.entries[key]		= entry
+
+	return
+}
+
+// Returns the unit id reads are sent to, either reported by the inner client
+// or last set with SetUnitId(). ok is false if it is unknown, in which case
+// reads must not be cached.
+// Must be called with cc.lock held.
+func (cc *CachingClient) currentUnitId() (unitId uint8, ok bool) {
+	unitId, ok	= unitIdOf(cc.inner)
+	if !ok && cc.unitIdSet {
+		unitId, ok	= cc.unitId, true
+	}
+
+	return
+}
+
+// Returns the unit id reads are sent to (see unitIdReporter).
+func (cc *CachingClient) reportedUnitId() (unitId uint8, ok bool) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	unitId, ok	= cc.currentUnitId()
+
+	return
+}
+
+// Evicts cached reads of the current unit id (of any unit id if it is
+// unknown) overlapping quantity items starting at addr.
+// Must be called with cc.lock held.
+func (cc *CachingClient) invalidate(fc uint8, addr uint16, quantity uint16) {
+	var unitId	uint8
+	var ok		bool
+
+	unitId, ok	= cc.currentUnitId()
+
+	for k := range cc.entries {
+		if k.fc == fc && (!ok || k.unitId == unitId) &&
+		   uint32(k.addr) < uint32(addr) + uint32(quantity) &&
+		   uint32(addr) < uint32(k.addr) + uint32(k.quantity) {
+			delete(cc.entries, k)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,218 @@
+package modbus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingHandler counts holding register reads before passing them to a
+// DataStore.
+type countingHandler struct {
+	*DataStore
+	lock		sync.Mutex
+	reads		int
+}
+
+func (ch *countingHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	if !isWrite {
+		ch.lock.Lock()
+		ch.reads++
+		ch.lock.Unlock()
+	}
+
+	res, err = ch.DataStore.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (ch *countingHandler) readCount() (count int) {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+
+	count	= ch.reads
+
+	return
+}
+
+func TestCachingClient(t *testing.T) {
+	var server	*ModbusServer
+	var ch		*countingHandler
+	var mc		*ModbusClient
+	var cc		*CachingClient
+	var err		error
+	var regs	[]uint16
+
+	ch	= &countingHandler{DataStore: NewDataStore(0, 0, 16, 0)}
+	ch.SetHoldingRegister(2, 0x1234)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5522",
+	}, ch)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5522",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	cc	= NewCachingClient(mc, 200 * time.Millisecond)
+	err	= cc.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer cc.Close()
+
+	// two identical reads within the ttl should result in a single request
+	for i := 0; i < 2; i++ {
+		regs, err	= cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+		if err != nil || regs[2] != 0x1234 {
+			t.Errorf("unexpected registers: %v, %v", regs, err)
+		}
+	}
+	if ch.readCount() != 1 {
+		t.Errorf("expected 1 read, got: %v", ch.readCount())
+	}
+
+	// cached values should not be altered by callers
+	regs[2]	= 0
+	regs, _	= cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+	if regs[2] != 0x1234 || ch.readCount() != 1 {
+		t.Errorf("unexpected registers: %v (%v reads)", regs, ch.readCount())
+	}
+
+	// reads of a different range should not be served from the cache
+	cc.ReadRegisters(0, 5, HOLDING_REGISTER)
+	if ch.readCount() != 2 {
+		t.Errorf("expected 2 reads, got: %v", ch.readCount())
+	}
+
+	// writes outside of the cached ranges should not invalidate them
+	err	= cc.WriteRegister(8, 0x0001)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+	cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+	if ch.readCount() != 2 {
+		t.Errorf("expected 2 reads, got: %v", ch.readCount())
+	}
+
+	// writes overlapping a cached range should invalidate it
+	err	= cc.WriteRegisters(3, []uint16{0x1111, 0x2222})
+	if err != nil {
+		t.Errorf("WriteRegisters() should have succeeded, got: %v", err)
+	}
+	regs, err	= cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+	if err != nil || regs[3] != 0x1111 || ch.readCount() != 3 {
+		t.Errorf("unexpected registers: %v, %v (%v reads)", regs, err, ch.readCount())
+	}
+
+	// InvalidateAll() should clear the cache
+	cc.InvalidateAll()
+	cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+	if ch.readCount() != 4 {
+		t.Errorf("expected 4 reads, got: %v", ch.readCount())
+	}
+
+	// entries should expire after the ttl
+	time.Sleep(250 * time.Millisecond)
+	cc.ReadRegisters(0, 4, HOLDING_REGISTER)
+	if ch.readCount() != 5 {
+		t.Errorf("expected 5 reads, got: %v", ch.readCount())
+	}
+
+	return
+}
+
+// unitEchoHandler answers holding register reads with the unit id of the
+// request.
+type unitEchoHandler struct {
+	countingHandler
+}
+
+func (ueh *unitEchoHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	ueh.lock.Lock()
+	ueh.reads++
+	ueh.lock.Unlock()
+
+	for i := uint16(0); i < quantity; i++ {
+		res	= append(res, uint16(unitId))
+	}
+
+	return
+}
+
+func TestCachingClientConfiguredUnitId(t *testing.T) {
+	var server	*ModbusServer
+	var ueh		*unitEchoHandler
+	var mc		*ModbusClient
+	var cc		*CachingClient
+	var err		error
+	var regs	[]uint16
+
+	ueh	= &unitEchoHandler{
+		countingHandler:	countingHandler{DataStore: NewDataStore(0, 0, 0, 0)},
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5579",
+	}, ueh)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5579",
+		UnitId:	5,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	cc	= NewCachingClient(mc, time.Minute)
+	err	= cc.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer cc.Close()
+
+	// reads should be cached under the configured unit id...
+	regs, err	= cc.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil || regs[0] != 5 {
+		t.Errorf("expected unit 5 registers, got: %v, %v", regs, err)
+	}
+
+	// ...and not served to other units
+	cc.SetUnitId(1)
+	regs, err	= cc.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil || regs[0] != 1 || ueh.readCount() != 2 {
+		t.Errorf("expected unit 1 registers from unit 1, got: %v, %v (%v reads)",
+			 regs, err, ueh.readCount())
+	}
+
+	// the unit id of the inner client is followed even when set directly
+	mc.SetUnitId(5)
+	regs, err	= cc.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil || regs[0] != 5 || ueh.readCount() != 2 {
+		t.Errorf("expected cached unit 5 registers, got: %v, %v (%v reads)",
+			 regs, err, ueh.readCount())
+	}
+
+	return
+}
@@ -1,6 +1,11 @@
 package modbus
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -28,6 +33,66 @@ const (
 	LOW_WORD_FIRST		WordOrder	= 2
 )
 
+// Client is the set of coil, discrete input and 16-bit register operations
+// implemented by ModbusClient.
+// It allows client wrappers (see NewDebugClient()) to be used in place of
+// a ModbusClient object.
+type Client interface {
+	Open()			(error)
+	Close()			(error)
+	SetUnitId(uint8)	(error)
+	SetEncoding(Endianness, WordOrder)	(error)
+	ReadCoils(uint16, uint16)		([]bool, error)
+	ReadCoil(uint16)			(bool, error)
+	ReadDiscreteInputs(uint16, uint16)	([]bool, error)
+	ReadDiscreteInput(uint16)		(bool, error)
+	ReadRegisters(uint16, uint16, RegType)	([]uint16, error)
+	ReadRegister(uint16, RegType)		(uint16, error)
+	WriteCoil(uint16, bool)			(error)
+	WriteCoils(uint16, []bool)		(error)
+	WriteRegister(uint16, uint16)		(error)
+	WriteRegisters(uint16, []uint16)	(error)
+}
+
+// ContextClient is a Client also offering context-aware variants of its
+// coil, discrete input and register operations, which give up as soon as
+// the context is done.
+// It is implemented by ModbusClient and NewThrottlingClient().
+type ContextClient interface {
+	Client
+	ReadCoilsContext(context.Context, uint16, uint16)		([]bool, error)
+	ReadCoilContext(context.Context, uint16)			(bool, error)
+	ReadDiscreteInputsContext(context.Context, uint16, uint16)	([]bool, error)
+	ReadDiscreteInputContext(context.Context, uint16)		(bool, error)
+	ReadRegistersContext(context.Context, uint16, uint16, RegType)	([]uint16, error)
+	ReadRegisterContext(context.Context, uint16, RegType)		(uint16, error)
+	WriteCoilContext(context.Context, uint16, bool)			(error)
+	WriteCoilsContext(context.Context, uint16, []bool)		(error)
+	WriteRegisterContext(context.Context, uint16, uint16)		(error)
+	WriteRegistersContext(context.Context, uint16, []uint16)	(error)
+}
+
+// unitIdReporter is implemented by clients able to tell the unit id their
+// requests are currently sent to (ok is false when they cannot), letting
+// wrappers such as NewCachingClient() follow the unit id of the client they
+// wrap (see unitIdOf()).
+type unitIdReporter interface {
+	reportedUnitId()	(unitId uint8, ok bool)
+}
+
+// Returns the unit id requests made through c are sent to, if c is able to
+// report it.
+func unitIdOf(c Client) (unitId uint8, ok bool) {
+	var r	unitIdReporter
+
+	r, ok	= c.(unitIdReporter)
+	if ok {
+		unitId, ok	= r.reportedUnitId()
+	}
+
+	return
+}
+
 type ClientConfiguration struct {
 	URL		string
 	Speed		uint
@@ -35,6 +100,57 @@ type ClientConfiguration struct {
 	Parity		uint
 	StopBits	uint
 	Timeout		time.Duration
+	UnitId		uint8		// unit id of requests until SetUnitId() is
+					// called (defaults to 1 when left to 0),
+					// also used by methods taking a unit id
+					// argument when passed 0
+	StrictEchoValidation	bool	// require write responses to echo the
+					// request byte for byte (by default,
+					// only the echoed address, value or
+					// quantity are checked, see
+					// validateEcho())
+
+	// TLS only settings (tcp+tls:// URLs)
+	TLSClientCert	*tls.Certificate // client certificate and key, presented
+					// to servers requiring client authentication
+	TLSRootCAs	*x509.CertPool	// authorities the server certificate must be
+					// signed by (defaults to the system pool)
+	TLSServerName	string		// name expected in the server certificate
+					// (defaults to the host part of the URL)
+	TLSSkipHostnameVerification bool // verify the server certificate chain
+					// but not its name (e.g. for devices with
+					// self-signed certificates, to be added to
+					// TLSRootCAs)
+
+	// optional hooks called once each request completes, e.g. for protocol
+	// debugging or custom metrics (see ClientFrame): OnRequest with the
+	// request, then either OnResponse with the response (exception
+	// responses included) or OnError if no response was received.
+	// Broadcast writes (to unit id 0 over serial links), which get no
+	// response, are not reported.
+	// Hooks are called with the client lock held and must not call client
+	// methods.
+	OnRequest	func(req ClientFrame)
+	OnResponse	func(req ClientFrame, res ClientFrame, elapsed time.Duration)
+	OnError		func(req ClientFrame, err error, elapsed time.Duration)
+
+	// optional tracer starting a span around each request (see Tracer)
+	Tracer		Tracer
+
+	// optional logger receiving the log lines of the client and its
+	// transport rather than stdout (see LevelLogger and NewSlogLogger())
+	Logger		Logger
+
+	// log every ADU sent and received (broadcasts included) as a
+	// timestamped hex dump, at the info level, e.g. to diagnose devices
+	// violating the spec
+	DumpFrames	bool
+
+	// optional metrics collector receiving every request (including the
+	// exception code of exception responses), traffic and, if it
+	// implements LinkMetricsCollector, malformed responses (see
+	// CountingMetrics)
+	Metrics		MetricsCollector
 }
 
 type ModbusClient struct {
@@ -46,6 +162,21 @@ type ModbusClient struct {
 	transport	transport
 	unitId		uint8
 	transportType	transportType
+	dialer		Dialer
+	link		rtuLink
+	tlsConfig	*tls.Config
+	// binds the link to request contexts (see lockContext())
+	guard		*contextGuard
+	// context of the requests in progress, if any
+	ctx		context.Context
+	// traffic recorder for request hooks (see ClientConfiguration.OnRequest)
+	tap		*aduTap
+}
+
+// Dialer establishes TCP connections on behalf of a client
+// (see NewTCPClientWithDialer()). *net.Dialer satisfies this interface.
+type Dialer interface {
+	DialContext(ctx context.Context, network string, address string) (net.Conn, error)
 }
 
 func NewClient(conf *ClientConfiguration) (mc *ModbusClient, err error) {
@@ -54,8 +185,16 @@ func NewClient(conf *ClientConfiguration) (mc *ModbusClient, err error) {
 	}
 
 	switch {
-	case strings.HasPrefix(mc.conf.URL, "rtu://"):
-		mc.conf.URL	= strings.TrimPrefix(mc.conf.URL, "rtu://")
+	case strings.HasPrefix(mc.conf.URL, "rtu://"),
+	     strings.HasPrefix(mc.conf.URL, "ascii://"):
+		// ASCII devices use the same serial settings as RTU ones
+		if strings.HasPrefix(mc.conf.URL, "ascii://") {
+			mc.conf.URL		= strings.TrimPrefix(mc.conf.URL, "ascii://")
+			mc.transportType	= ASCII_TRANSPORT
+		} else {
+			mc.conf.URL		= strings.TrimPrefix(mc.conf.URL, "rtu://")
+			mc.transportType	= RTU_TRANSPORT
+		}
 
 		// set useful defaults
 		if mc.conf.Speed == 0 {
@@ -80,12 +219,15 @@ func NewClient(conf *ClientConfiguration) (mc *ModbusClient, err error) {
 			}
 		}
 
+		// ASCII allows up to a second between characters
+		if mc.conf.Timeout == 0 && mc.transportType == ASCII_TRANSPORT {
+			mc.conf.Timeout = 1 * time.Second
+		}
+
 		if mc.conf.Timeout == 0 {
 			mc.conf.Timeout = 300 * time.Millisecond
 		}
 
-		mc.transportType	= RTU_TRANSPORT
-
 	case strings.HasPrefix(mc.conf.URL, "rtuovertcp://"):
 		mc.conf.URL	= strings.TrimPrefix(mc.conf.URL, "rtuovertcp://")
 
@@ -104,15 +246,88 @@ func NewClient(conf *ClientConfiguration) (mc *ModbusClient, err error) {
 
 		mc.transportType	= TCP_TRANSPORT
 
+	case strings.HasPrefix(mc.conf.URL, "tcp+tls://"):
+		mc.conf.URL	= strings.TrimPrefix(mc.conf.URL, "tcp+tls://")
+
+		if mc.conf.Timeout == 0 {
+			mc.conf.Timeout = 1 * time.Second
+		}
+
+		mc.tlsConfig, err	= newClientTLSConfig(&mc.conf)
+		if err != nil {
+			mc	= nil
+			return
+		}
+
+		mc.transportType	= TCP_TRANSPORT
+
 	default:
 		err	= ErrConfigurationError
 		return
 	}
 
-	mc.unitId	= 1
+	if mc.conf.UnitId != 0 {
+		mc.unitId	= mc.conf.UnitId
+	} else {
+		mc.unitId	= 1
+	}
 	mc.endianness	= BIG_ENDIAN
 	mc.wordOrder	= HIGH_WORD_FIRST
 	mc.logger	= newLogger(fmt.Sprintf("modbus-client(%s)", mc.conf.URL))
+	mc.logger.out	= mc.conf.Logger
+
+	return
+}
+
+// Returns a new TCP (tcp:// URL) or RTU over TCP (rtuovertcp:// URL) client
+// establishing its connections with dialer rather than net.Dial, e.g. to
+// bind to a specific local address, enable keep-alives or go through a proxy.
+// dialer is used on every call to Open().
+func NewTCPClientWithDialer(conf *ClientConfiguration, dialer Dialer) (mc *ModbusClient, err error) {
+	if dialer == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	mc, err	= NewClient(conf)
+	if err != nil {
+		return
+	}
+
+	if mc.transportType == RTU_TRANSPORT || mc.transportType == ASCII_TRANSPORT {
+		mc	= nil
+		err	= ErrConfigurationError
+		return
+	}
+
+	mc.dialer	= dialer
+
+	return
+}
+
+// Returns a new RTU client talking over link instead of a serial port it
+// would open itself, e.g. to use an alternative serial library or an already
+// open file descriptor.
+// addr is only used for logging. Speed, Timeout and UnitId are taken from
+// conf as with NewClient(), conf.URL is ignored.
+// Since Close() closes link, the client cannot be re-opened once closed.
+func NewRTUClientWithLink(link rtuLink, addr string, conf *ClientConfiguration) (mc *ModbusClient, err error) {
+	var linkConf	ClientConfiguration
+
+	if link == nil || conf == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	linkConf	= *conf
+	linkConf.URL	= "rtu://" + addr
+
+	mc, err	= NewClient(&linkConf)
+	if err != nil {
+		return
+	}
+
+	mc.link	= link
 
 	return
 }
@@ -121,12 +336,30 @@ func NewClient(conf *ClientConfiguration) (mc *ModbusClient, err error) {
 func (mc *ModbusClient) Open() (err error) {
 	var spw		*serialPortWrapper
 	var sock	net.Conn
+	var gl		*guardedLink
+	var gc		*guardedConn
 
 	mc.lock.Lock()
 	defer mc.lock.Unlock()
 
+	// route transport log lines to the configured logger, if any
+	defer func() {
+		if err == nil && mc.conf.Logger != nil {
+			setTransportLogger(mc.transport, mc.conf.Logger)
+		}
+	}()
+
 	switch mc.transportType {
-	case RTU_TRANSPORT:
+	case RTU_TRANSPORT, ASCII_TRANSPORT:
+		// use the injected link as is if any, as its state is up to the caller
+		if mc.link != nil {
+			gl		= newGuardedLink(mc.link)
+			mc.guard	= gl.guard
+			mc.transport	= newRTUTransport(
+				mc.instrumentLink(gl), mc.conf.URL, mc.conf.Speed, mc.conf.Timeout)
+			return
+		}
+
 		// create a serial port wrapper object
 		spw = newSerialPortWrapper(&serialPortConfig{
 			Device:		mc.conf.URL,
@@ -145,13 +378,20 @@ func (mc *ModbusClient) Open() (err error) {
 		// discard potentially stale serial data
 		discard(spw)
 
-		// create the RTU transport
-		mc.transport = newRTUTransport(
-			spw, mc.conf.URL, mc.conf.Speed, mc.conf.Timeout)
+		// create the RTU or ASCII transport
+		gl		= newGuardedLink(spw)
+		mc.guard	= gl.guard
+		if mc.transportType == ASCII_TRANSPORT {
+			mc.transport = newASCIITransport(
+				mc.instrumentLink(gl), mc.conf.URL, mc.conf.Timeout)
+		} else {
+			mc.transport = newRTUTransport(
+				mc.instrumentLink(gl), mc.conf.URL, mc.conf.Speed, mc.conf.Timeout)
+		}
 
 	case RTU_OVER_TCP_TRANSPORT:
 		// connect to the remote host
-		sock, err	= net.DialTimeout("tcp", mc.conf.URL, 5 * time.Second)
+		sock, err	= mc.dial()
 		if err != nil {
 			return
 		}
@@ -160,18 +400,30 @@ func (mc *ModbusClient) Open() (err error) {
 		discard(sock)
 
 		// create the RTU transport
-		mc.transport = newRTUTransport(
-			sock, mc.conf.URL, mc.conf.Speed, mc.conf.Timeout)
+		gl		= newGuardedLink(sock)
+		mc.guard	= gl.guard
+		mc.transport	= newRTUTransport(
+			mc.instrumentLink(gl), mc.conf.URL, mc.conf.Speed, mc.conf.Timeout)
 
 	case TCP_TRANSPORT:
 		// connect to the remote host
-		sock, err	= net.DialTimeout("tcp", mc.conf.URL, 5 * time.Second)
+		sock, err	= mc.dial()
 		if err != nil {
 			return
 		}
 
+		// secure the connection if configured to
+		if mc.tlsConfig != nil {
+			sock, err	= mc.handshakeTLS(sock)
+			if err != nil {
+				return
+			}
+		}
+
 		// create the TCP transport
-		mc.transport = newTCPTransport(sock, mc.conf.Timeout)
+		gc		= newGuardedConn(sock)
+		mc.guard	= gc.guard
+		mc.transport	= newTCPTransport(mc.instrumentConn(gc), mc.conf.Timeout)
 
 	default:
 		// should never happen
@@ -181,6 +433,24 @@ func (mc *ModbusClient) Open() (err error) {
 	return
 }
 
+// Connects to the remote host, with the configured dialer if any.
+func (mc *ModbusClient) dial() (sock net.Conn, err error) {
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	if mc.dialer == nil {
+		sock, err	= net.DialTimeout("tcp", mc.conf.URL, 5 * time.Second)
+		return
+	}
+
+	ctx, cancel	= context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	sock, err	= mc.dialer.DialContext(ctx, "tcp", mc.conf.URL)
+
+	return
+}
+
 // Closes the underlying transport.
 func (mc *ModbusClient) Close() (err error) {
 	mc.lock.Lock()
@@ -201,6 +471,29 @@ func (mc *ModbusClient) SetUnitId(id uint8) (err error) {
 	return
 }
 
+// Returns unitId, or the unit id of the client (ClientConfiguration.UnitId or
+// the one set with SetUnitId()) if unitId is 0.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) unitIdOrDefault(unitId uint8) (id uint8) {
+	id	= unitId
+	if id == 0 {
+		id	= mc.unitId
+	}
+
+	return
+}
+
+// Returns the unit id of subsequent requests (see unitIdReporter).
+func (mc *ModbusClient) reportedUnitId() (unitId uint8, ok bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	unitId	= mc.unitId
+	ok	= true
+
+	return
+}
+
 // Sets the encoding (endianness and word ordering) of subsequent requests.
 func (mc *ModbusClient) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
 	mc.lock.Lock()
@@ -226,16 +519,30 @@ func (mc *ModbusClient) SetEncoding(endianness Endianness, wordOrder WordOrder)
 
 // Reads multiple coils (function code 01).
 func (mc *ModbusClient) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
-	values, err	= mc.readBools(addr, quantity, false)
+	values, err	= mc.ReadCoilsContext(context.Background(), addr, quantity)
+
+	return
+}
+
+// Same as ReadCoils(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadCoilsContext(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= mc.readBools(ctx, addr, quantity, false)
 
 	return
 }
 
 // Reads a single coil (function code 01).
 func (mc *ModbusClient) ReadCoil(addr uint16) (value bool, err error) {
+	value, err	= mc.ReadCoilContext(context.Background(), addr)
+
+	return
+}
+
+// Same as ReadCoil(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadCoilContext(ctx context.Context, addr uint16) (value bool, err error) {
 	var values	[]bool
 
-	values, err	= mc.readBools(addr, 1, false)
+	values, err	= mc.readBools(ctx, addr, 1, false)
 	if err == nil {
 		value = values[0]
 	}
@@ -243,18 +550,69 @@ func (mc *ModbusClient) ReadCoil(addr uint16) (value bool, err error) {
 	return
 }
 
+// Polls coil addr of unitId (function code 01) every interval until it reads
+// true, then returns nil.
+// Read errors are returned as they occur. Returns ctx.Err() if ctx is done
+// first: use a context with a deadline (e.g. context.WithTimeout()) to bound
+// the wait on devices which may never set the coil.
+// A unitId of 0 stands for the unit id of the client (ClientConfiguration.UnitId
+// or the one set with SetUnitId()), while other values override it.
+func (mc *ModbusClient) ReadCoilsUntilTrue(ctx context.Context, unitId uint8, addr uint16, interval time.Duration) (err error) {
+	var ticker	*time.Ticker
+	var values	[]bool
+
+	err	= ctx.Err()
+	if err != nil {
+		return
+	}
+
+	ticker	= time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		mc.lockContext(ctx)
+		values, err	= mc.readBoolsFrom(mc.unitIdOrDefault(unitId), addr, 1, false)
+		mc.unlockContext()
+
+		if err != nil || values[0] {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err	= ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // Reads multiple discrete inputs (function code 02).
 func (mc *ModbusClient) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
-	values, err	= mc.readBools(addr, quantity, true)
+	values, err	= mc.ReadDiscreteInputsContext(context.Background(), addr, quantity)
+
+	return
+}
+
+// Same as ReadDiscreteInputs(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadDiscreteInputsContext(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= mc.readBools(ctx, addr, quantity, true)
 
 	return
 }
 
 // Reads a single discrete input (function code 02).
 func (mc *ModbusClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	value, err	= mc.ReadDiscreteInputContext(context.Background(), addr)
+
+	return
+}
+
+// Same as ReadDiscreteInput(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadDiscreteInputContext(ctx context.Context, addr uint16) (value bool, err error) {
 	var values	[]bool
 
-	values, err	= mc.readBools(addr, 1, true)
+	values, err	= mc.readBools(ctx, addr, 1, true)
 	if err == nil {
 		value = values[0]
 	}
@@ -264,10 +622,17 @@ func (mc *ModbusClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
 
 // Reads multiple 16-bit registers (function code 03 or 04).
 func (mc *ModbusClient) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	values, err	= mc.ReadRegistersContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+// Same as ReadRegisters(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadRegistersContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
 	var mbPayload	[]byte
 
 	// read 1 uint16 register, as bytes
-	mbPayload, err	= mc.readRegisters(addr, quantity, regType)
+	mbPayload, err	= mc.readRegisters(ctx, addr, quantity, regType)
 	if err != nil {
 		return
 	}
@@ -280,9 +645,16 @@ func (mc *ModbusClient) ReadRegisters(addr uint16, quantity uint16, regType RegT
 
 // Reads a single 16-bit register (function code 03 or 04).
 func (mc *ModbusClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	value, err	= mc.ReadRegisterContext(context.Background(), addr, regType)
+
+	return
+}
+
+// Same as ReadRegister(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadRegisterContext(ctx context.Context, addr uint16, regType RegType) (value uint16, err error) {
 	var values	[]uint16
 
-	values, err	= mc.ReadRegisters(addr, 1, regType)
+	values, err	= mc.ReadRegistersContext(ctx, addr, 1, regType)
 	if err == nil {
 		value = values[0]
 	}
@@ -290,12 +662,68 @@ func (mc *ModbusClient) ReadRegister(addr uint16, regType RegType) (value uint16
 	return
 }
 
+// Reads quantity holding registers from unitId (function code 03), retrying
+// up to maxRetries times, backoff apart, while the server answers with a
+// server device busy exception (0x06).
+// Other errors are returned immediately, as is ctx.Err() if ctx is done
+// before the read succeeds.
+// A unitId of 0 stands for the unit id of the client (ClientConfiguration.UnitId
+// or the one set with SetUnitId()), while other values override it.
+func (mc *ModbusClient) ReadHoldingRegistersRetry(ctx context.Context, unitId uint8, addr uint16,
+						  quantity uint16, maxRetries int, backoff time.Duration) (values []uint16, err error) {
+	var mbPayload	[]byte
+	var timer	*time.Timer
+
+	for attempt := 0; ; attempt++ {
+		err	= ctx.Err()
+		if err != nil {
+			return
+		}
+
+		mc.lockContext(ctx)
+		mbPayload, err	= mc.readRegistersFrom(mc.unitIdOrDefault(unitId), addr, quantity,
+						     HOLDING_REGISTER)
+		mc.unlockContext()
+
+		if !errors.Is(err, ErrServerDeviceBusy) || attempt >= maxRetries {
+			break
+		}
+
+		mc.logger.Infof("server device busy, retrying in %v (%v/%v)",
+				backoff, attempt + 1, maxRetries)
+
+		timer	= time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err	= ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	values	= bytesToUint16s(mc.endianness, mbPayload)
+
+	return
+}
+
 // Reads multiple 32-bit registers.
 func (mc *ModbusClient) ReadUint32s(addr uint16, quantity uint16, regType RegType) (values []uint32, err error) {
+	values, err	= mc.ReadUint32sContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+// Same as ReadUint32s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadUint32sContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []uint32, err error) {
 	var mbPayload	[]byte
 
 	// read 2 * quantity uint16 registers, as bytes
-	mbPayload, err	= mc.readRegisters(addr, quantity * 2, regType)
+	mbPayload, err	= mc.readRegisters(ctx, addr, quantity * 2, regType)
 	if err != nil {
 		return
 	}
@@ -308,9 +736,16 @@ func (mc *ModbusClient) ReadUint32s(addr uint16, quantity uint16, regType RegTyp
 
 // Reads a single 32-bit register.
 func (mc *ModbusClient) ReadUint32(addr uint16, regType RegType) (value uint32, err error) {
+	value, err	= mc.ReadUint32Context(context.Background(), addr, regType)
+
+	return
+}
+
+// Same as ReadUint32(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadUint32Context(ctx context.Context, addr uint16, regType RegType) (value uint32, err error) {
 	var values	[]uint32
 
-	values, err	= mc.ReadUint32s(addr, 1, regType)
+	values, err	= mc.ReadUint32sContext(ctx, addr, 1, regType)
 	if err == nil {
 		value	= values[0]
 	}
@@ -320,10 +755,17 @@ func (mc *ModbusClient) ReadUint32(addr uint16, regType RegType) (value uint32,
 
 // Reads multiple 32-bit float registers.
 func (mc *ModbusClient) ReadFloat32s(addr uint16, quantity uint16, regType RegType) (values []float32, err error) {
+	values, err	= mc.ReadFloat32sContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+// Same as ReadFloat32s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFloat32sContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []float32, err error) {
 	var mbPayload	[]byte
 
 	// read 2 * quantity uint16 registers, as bytes
-	mbPayload, err	= mc.readRegisters(addr, quantity * 2, regType)
+	mbPayload, err	= mc.readRegisters(ctx, addr, quantity * 2, regType)
 	if err != nil {
 		return
 	}
@@ -336,9 +778,16 @@ func (mc *ModbusClient) ReadFloat32s(addr uint16, quantity uint16, regType RegTy
 
 // Reads a single 32-bit float register.
 func (mc *ModbusClient) ReadFloat32(addr uint16, regType RegType) (value float32, err error) {
+	value, err	= mc.ReadFloat32Context(context.Background(), addr, regType)
+
+	return
+}
+
+// Same as ReadFloat32(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFloat32Context(ctx context.Context, addr uint16, regType RegType) (value float32, err error) {
 	var values	[]float32
 
-	values, err	= mc.ReadFloat32s(addr, 1, regType)
+	values, err	= mc.ReadFloat32sContext(ctx, addr, 1, regType)
 	if err == nil {
 		value	= values[0]
 	}
@@ -348,10 +797,17 @@ func (mc *ModbusClient) ReadFloat32(addr uint16, regType RegType) (value float32
 
 // Reads multiple 64-bit registers.
 func (mc *ModbusClient) ReadUint64s(addr uint16, quantity uint16, regType RegType) (values []uint64, err error) {
+	values, err	= mc.ReadUint64sContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+// Same as ReadUint64s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadUint64sContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []uint64, err error) {
 	var mbPayload	[]byte
 
 	// read 4 * quantity uint16 registers, as bytes
-	mbPayload, err	= mc.readRegisters(addr, quantity * 4, regType)
+	mbPayload, err	= mc.readRegisters(ctx, addr, quantity * 4, regType)
 	if err != nil {
 		return
 	}
@@ -364,9 +820,16 @@ func (mc *ModbusClient) ReadUint64s(addr uint16, quantity uint16, regType RegTyp
 
 // Reads a single 64-bit register.
 func (mc *ModbusClient) ReadUint64(addr uint16, regType RegType) (value uint64, err error) {
+	value, err	= mc.ReadUint64Context(context.Background(), addr, regType)
+
+	return
+}
+
+// Same as ReadUint64(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadUint64Context(ctx context.Context, addr uint16, regType RegType) (value uint64, err error) {
 	var values	[]uint64
 
-	values, err	= mc.ReadUint64s(addr, 1, regType)
+	values, err	= mc.ReadUint64sContext(ctx, addr, 1, regType)
 	if err == nil {
 		value	= values[0]
 	}
@@ -376,10 +839,17 @@ func (mc *ModbusClient) ReadUint64(addr uint16, regType RegType) (value uint64,
 
 // Reads multiple 64-bit float registers.
 func (mc *ModbusClient) ReadFloat64s(addr uint16, quantity uint16, regType RegType) (values []float64, err error) {
+	values, err	= mc.ReadFloat64sContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+// Same as ReadFloat64s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFloat64sContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []float64, err error) {
 	var mbPayload	[]byte
 
 	// read 4 * quantity uint16 registers, as bytes
-	mbPayload, err	= mc.readRegisters(addr, quantity * 4, regType)
+	mbPayload, err	= mc.readRegisters(ctx, addr, quantity * 4, regType)
 	if err != nil {
 		return
 	}
@@ -392,9 +862,16 @@ func (mc *ModbusClient) ReadFloat64s(addr uint16, quantity uint16, regType RegTy
 
 // Reads a single 64-bit float register.
 func (mc *ModbusClient) ReadFloat64(addr uint16, regType RegType) (value float64, err error) {
+	value, err	= mc.ReadFloat64Context(context.Background(), addr, regType)
+
+	return
+}
+
+// Same as ReadFloat64(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFloat64Context(ctx context.Context, addr uint16, regType RegType) (value float64, err error) {
 	var values	[]float64
 
-	values, err	= mc.ReadFloat64s(addr, 1, regType)
+	values, err	= mc.ReadFloat64sContext(ctx, addr, 1, regType)
 	if err == nil {
 		value	= values[0]
 	}
@@ -404,11 +881,18 @@ func (mc *ModbusClient) ReadFloat64(addr uint16, regType RegType) (value float64
 
 // Writes a single coil (function code 05)
 func (mc *ModbusClient) WriteCoil(addr uint16, value bool) (err error) {
+	err	= mc.WriteCoilContext(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteCoil(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteCoilContext(ctx context.Context, addr uint16, value bool) (err error) {
 	var req		*pdu
 	var res		*pdu
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
 
 	// create and fill in the request object
 	req	= &pdu{
@@ -434,17 +918,12 @@ func (mc *ModbusClient) WriteCoil(addr uint16, value bool) (err error) {
 	// validate the response code
 	switch {
 	case res.functionCode == req.functionCode:
-		// expect 4 bytes (2 byte of address + 2 bytes of value)
-		if len(res.payload) != 4 ||
-		   // bytes 1-2 should be the coil address
-		   bytesToUint16(BIG_ENDIAN, res.payload[0:2]) != addr ||
-		   // bytes 3-4 should either be {0xff, 0x00} or {0x00, 0x00}
-		   // depending on the coil value
-		   (value == true && res.payload[2] != 0xff) ||
-		   res.payload[3] != 0x00 {
-			   err = ErrProtocolError
-			   return
-		   }
+		// expect the address and value/quantity of the request to be
+		// echoed back
+		err	= mc.validateEcho(req, res)
+		if err != nil {
+			return
+		}
 
 	case res.functionCode == (req.functionCode | 0x80):
 		if len(res.payload) != 1 {
@@ -452,7 +931,7 @@ func (mc *ModbusClient) WriteCoil(addr uint16, value bool) (err error) {
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -464,13 +943,20 @@ func (mc *ModbusClient) WriteCoil(addr uint16, value bool) (err error) {
 
 // Writes multiple coils (function code 15)
 func (mc *ModbusClient) WriteCoils(addr uint16, values []bool) (err error) {
+	err	= mc.WriteCoilsContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteCoils(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteCoilsContext(ctx context.Context, addr uint16, values []bool) (err error) {
 	var req			*pdu
 	var res			*pdu
 	var quantity		uint16
 	var encodedValues	[]byte
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
 
 	quantity	= uint16(len(values))
 	if quantity == 0 {
@@ -517,15 +1003,12 @@ func (mc *ModbusClient) WriteCoils(addr uint16, values []bool) (err error) {
 	// validate the response code
 	switch {
 	case res.functionCode == req.functionCode:
-		// expect 4 bytes (2 byte of address + 2 bytes of quantity)
-		if len(res.payload) != 4 ||
-		   // bytes 1-2 should be the base coil address
-		   bytesToUint16(BIG_ENDIAN, res.payload[0:2]) != addr ||
-		   // bytes 3-4 should be the quantity of coils
-		   bytesToUint16(BIG_ENDIAN, res.payload[2:4]) != quantity {
-			   err = ErrProtocolError
-			   return
-		   }
+		// expect the address and value/quantity of the request to be
+		// echoed back
+		err	= mc.validateEcho(req, res)
+		if err != nil {
+			return
+		}
 
 	case res.functionCode == (req.functionCode | 0x80):
 		if len(res.payload) != 1 {
@@ -533,7 +1016,7 @@ func (mc *ModbusClient) WriteCoils(addr uint16, values []bool) (err error) {
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -545,11 +1028,18 @@ func (mc *ModbusClient) WriteCoils(addr uint16, values []bool) (err error) {
 
 // Writes a single 16-bit register (function code 06).
 func (mc *ModbusClient) WriteRegister(addr uint16, value uint16) (err error) {
+	err	= mc.WriteRegisterContext(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteRegister(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteRegisterContext(ctx context.Context, addr uint16, value uint16) (err error) {
 	var req		*pdu
 	var res		*pdu
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
 
 	// create and fill in the request object
 	req	= &pdu{
@@ -571,15 +1061,12 @@ func (mc *ModbusClient) WriteRegister(addr uint16, value uint16) (err error) {
 	// validate the response code
 	switch {
 	case res.functionCode == req.functionCode:
-		// expect 4 bytes (2 byte of address + 2 bytes of value)
-		if len(res.payload) != 4 ||
-		   // bytes 1-2 should be the register address
-		   bytesToUint16(BIG_ENDIAN, res.payload[0:2]) != addr ||
-		   // bytes 3-4 should be the value
-		   bytesToUint16(mc.endianness, res.payload[2:4]) != value {
-			   err = ErrProtocolError
-			   return
-		   }
+		// expect the address and value/quantity of the request to be
+		// echoed back
+		err	= mc.validateEcho(req, res)
+		if err != nil {
+			return
+		}
 
 	case res.functionCode == (req.functionCode | 0x80):
 		if len(res.payload) != 1 {
@@ -587,7 +1074,7 @@ func (mc *ModbusClient) WriteRegister(addr uint16, value uint16) (err error) {
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -597,8 +1084,53 @@ func (mc *ModbusClient) WriteRegister(addr uint16, value uint16) (err error) {
 	return
 }
 
+// Modifies bits of a single 16-bit register (function code 22).
+// The register is set to (current value AND andMask) OR (orMask AND NOT andMask)
+// by the server.
+func (mc *ModbusClient) MaskWriteRegister(addr uint16, andMask uint16, orMask uint16) (err error) {
+	err	= mc.MaskWriteRegisterContext(context.Background(), addr, andMask, orMask)
+
+	return
+}
+
+// Same as MaskWriteRegister(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) MaskWriteRegisterContext(ctx context.Context, addr uint16, andMask uint16, orMask uint16) (err error) {
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	err	= mc.maskWriteRegisterTo(mc.unitId, addr, andMask, orMask)
+
+	return
+}
+
+// Sets the bits of a single 16-bit register selected by mask to their values
+// in bits, leaving other bits untouched (function code 22).
+// e.g. a mask of 0x000f and bits of 0x000a sets bits 3:0 to 0b1010.
+// A unitId of 0 stands for the unit id of the client (ClientConfiguration.UnitId
+// or the one set with SetUnitId()), while other values override it.
+func (mc *ModbusClient) WriteRegisterBits(ctx context.Context, unitId uint8, addr uint16, mask uint16, bits uint16) (err error) {
+	err	= ctx.Err()
+	if err != nil {
+		return
+	}
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	err	= mc.maskWriteRegisterTo(mc.unitIdOrDefault(unitId), addr, ^mask, bits & mask)
+
+	return
+}
+
 // Writes multiple 16-bit registers (function code 16).
 func (mc *ModbusClient) WriteRegisters(addr uint16, values []uint16) (err error) {
+	err	= mc.WriteRegistersContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteRegisters(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteRegistersContext(ctx context.Context, addr uint16, values []uint16) (err error) {
 	var payload	[]byte
 
 	// turn registers to bytes
@@ -606,13 +1138,117 @@ func (mc *ModbusClient) WriteRegisters(addr uint16, values []uint16) (err error)
 		payload	= append(payload, uint16ToBytes(mc.endianness, value)...)
 	}
 
-	err = mc.writeRegisters(addr, payload)
+	err = mc.writeRegisters(ctx, addr, payload)
+
+	return
+}
+
+// Writes values to consecutive holding registers starting at writeAddr, then
+// reads readQuantity holding registers starting at readAddr, in a single
+// transaction (function code 23).
+// The server performs the write before the read.
+func (mc *ModbusClient) ReadWriteMultipleRegisters(readAddr uint16, readQuantity uint16,
+						   writeAddr uint16, values []uint16) (results []uint16, err error) {
+	results, err	= mc.ReadWriteMultipleRegistersContext(context.Background(),
+							readAddr, readQuantity, writeAddr, values)
+
+	return
+}
+
+// Same as ReadWriteMultipleRegisters(), but returns ctx.Err() as soon as ctx
+// is done.
+func (mc *ModbusClient) ReadWriteMultipleRegistersContext(ctx context.Context,
+							  readAddr uint16, readQuantity uint16,
+							  writeAddr uint16, values []uint16) (results []uint16, err error) {
+	var req			*pdu
+	var res			*pdu
+	var writeQuantity	uint16
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	writeQuantity	= uint16(len(values))
+
+	if readQuantity == 0 || writeQuantity == 0 {
+		err = ErrUnexpectedParameters
+		mc.logger.Error("quantity of registers is 0")
+		return
+	}
+
+	if readQuantity > 125 || writeQuantity > 121 {
+		err = ErrUnexpectedParameters
+		mc.logger.Error("quantity of registers exceeds 125 (read) or 121 (write)")
+		return
+	}
+
+	if uint32(readAddr) + uint32(readQuantity) - 1 > 0xffff ||
+	   uint32(writeAddr) + uint32(writeQuantity) - 1 > 0xffff {
+		err = ErrUnexpectedParameters
+		mc.logger.Error("end register address is past 0xffff")
+		return
+	}
+
+	// create and fill in the request object
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_READ_WRITE_MULTILE_REGISTERS,
+	}
+
+	// read address and quantity
+	req.payload	= uint16ToBytes(BIG_ENDIAN, readAddr)
+	req.payload	= append(req.payload, uint16ToBytes(BIG_ENDIAN, readQuantity)...)
+	// write address and quantity
+	req.payload	= append(req.payload, uint16ToBytes(BIG_ENDIAN, writeAddr)...)
+	req.payload	= append(req.payload, uint16ToBytes(BIG_ENDIAN, writeQuantity)...)
+	// byte count (2 bytes per register)
+	req.payload	= append(req.payload, byte(writeQuantity * 2))
+	// registers value
+	req.payload	= append(req.payload, uint16sToBytes(mc.endianness, values)...)
+
+	// run the request across the transport and wait for a response
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	// validate the response code
+	switch {
+	case res.functionCode == req.functionCode:
+		// make sure the payload length and byte count field are what
+		// we expect (1 byte of length + 2 bytes per register)
+		if len(res.payload) != 1 + 2 * int(readQuantity) ||
+		   uint(res.payload[0]) != 2 * uint(readQuantity) {
+			err = ErrProtocolError
+			return
+		}
+
+		results	= bytesToUint16s(mc.endianness, res.payload[1:])
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
 
 	return
 }
 
 // Writes multiple 32-bit registers.
 func (mc *ModbusClient) WriteUint32s(addr uint16, values []uint32) (err error) {
+	err	= mc.WriteUint32sContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteUint32s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteUint32sContext(ctx context.Context, addr uint16, values []uint32) (err error) {
 	var payload	[]byte
 
 	// turn registers to bytes
@@ -620,20 +1256,34 @@ func (mc *ModbusClient) WriteUint32s(addr uint16, values []uint32) (err error) {
 		payload	= append(payload, uint32ToBytes(mc.endianness, mc.wordOrder, value)...)
 	}
 
-	err = mc.writeRegisters(addr, payload)
+	err = mc.writeRegisters(ctx, addr, payload)
 
 	return
 }
 
 // Writes a single 32-bit register.
 func (mc *ModbusClient) WriteUint32(addr uint16, value uint32) (err error) {
-	err = mc.writeRegisters(addr, uint32ToBytes(mc.endianness, mc.wordOrder, value))
+	err	= mc.WriteUint32Context(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteUint32(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteUint32Context(ctx context.Context, addr uint16, value uint32) (err error) {
+	err = mc.writeRegisters(ctx, addr, uint32ToBytes(mc.endianness, mc.wordOrder, value))
 
 	return
 }
 
 // Writes multiple 32-bit float registers.
 func (mc *ModbusClient) WriteFloat32s(addr uint16, values []float32) (err error) {
+	err	= mc.WriteFloat32sContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteFloat32s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteFloat32sContext(ctx context.Context, addr uint16, values []float32) (err error) {
 	var payload	[]byte
 
 	// turn registers to bytes
@@ -641,20 +1291,34 @@ func (mc *ModbusClient) WriteFloat32s(addr uint16, values []float32) (err error)
 		payload	= append(payload, float32ToBytes(mc.endianness, mc.wordOrder, value)...)
 	}
 
-	err = mc.writeRegisters(addr, payload)
+	err = mc.writeRegisters(ctx, addr, payload)
 
 	return
 }
 
 // Writes a single 32-bit float register.
 func (mc *ModbusClient) WriteFloat32(addr uint16, value float32) (err error) {
-	err = mc.writeRegisters(addr, float32ToBytes(mc.endianness, mc.wordOrder, value))
+	err	= mc.WriteFloat32Context(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteFloat32(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteFloat32Context(ctx context.Context, addr uint16, value float32) (err error) {
+	err = mc.writeRegisters(ctx, addr, float32ToBytes(mc.endianness, mc.wordOrder, value))
 
 	return
 }
 
 // Writes multiple 64-bit registers.
 func (mc *ModbusClient) WriteUint64s(addr uint16, values []uint64) (err error) {
+	err	= mc.WriteUint64sContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteUint64s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteUint64sContext(ctx context.Context, addr uint16, values []uint64) (err error) {
 	var payload	[]byte
 
 	// turn registers to bytes
@@ -662,20 +1326,34 @@ func (mc *ModbusClient) WriteUint64s(addr uint16, values []uint64) (err error) {
 		payload	= append(payload, uint64ToBytes(mc.endianness, mc.wordOrder, value)...)
 	}
 
-	err = mc.writeRegisters(addr, payload)
+	err = mc.writeRegisters(ctx, addr, payload)
 
 	return
 }
 
 // Writes a single 64-bit register.
 func (mc *ModbusClient) WriteUint64(addr uint16, value uint64) (err error) {
-	err = mc.writeRegisters(addr, uint64ToBytes(mc.endianness, mc.wordOrder, value))
+	err	= mc.WriteUint64Context(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteUint64(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteUint64Context(ctx context.Context, addr uint16, value uint64) (err error) {
+	err = mc.writeRegisters(ctx, addr, uint64ToBytes(mc.endianness, mc.wordOrder, value))
 
 	return
 }
 
 // Writes multiple 64-bit float registers.
 func (mc *ModbusClient) WriteFloat64s(addr uint16, values []float64) (err error) {
+	err	= mc.WriteFloat64sContext(context.Background(), addr, values)
+
+	return
+}
+
+// Same as WriteFloat64s(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteFloat64sContext(ctx context.Context, addr uint16, values []float64) (err error) {
 	var payload	[]byte
 
 	// turn registers to bytes
@@ -683,14 +1361,54 @@ func (mc *ModbusClient) WriteFloat64s(addr uint16, values []float64) (err error)
 		payload	= append(payload, float64ToBytes(mc.endianness, mc.wordOrder, value)...)
 	}
 
-	err = mc.writeRegisters(addr, payload)
+	err = mc.writeRegisters(ctx, addr, payload)
 
 	return
 }
 
 // Writes a single 64-bit float register.
 func (mc *ModbusClient) WriteFloat64(addr uint16, value float64) (err error) {
-	err = mc.writeRegisters(addr, float64ToBytes(mc.endianness, mc.wordOrder, value))
+	err	= mc.WriteFloat64Context(context.Background(), addr, value)
+
+	return
+}
+
+// Same as WriteFloat64(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteFloat64Context(ctx context.Context, addr uint16, value float64) (err error) {
+	err = mc.writeRegisters(ctx, addr, float64ToBytes(mc.endianness, mc.wordOrder, value))
+
+	return
+}
+
+// Sends a request to unitId without waiting for a response (function code fc,
+// payload following the function code), as required for broadcast requests
+// (unit ids 0 and 255) which are never answered by RTU devices.
+// Returns once the request is written to the wire (and, over RTU, once the
+// inter-frame delay has elapsed).
+// Only available on RTU, RTU over TCP and ASCII transports.
+func (mc *ModbusClient) Broadcast(fc uint8, unitId uint8, payload []byte) (err error) {
+	var rw	requestWriter
+	var ok	bool
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	rw, ok	= mc.transport.(requestWriter)
+	if !ok {
+		mc.logger.Errorf("broadcast requests are only supported on serial transports")
+		err	= ErrConfigurationError
+		return
+	}
+
+	err	= rw.WriteRequest(&pdu{
+		unitId:		unitId,
+		functionCode:	fc,
+		payload:	payload,
+	})
+	if mc.tap != nil {
+		mc.dumpFrames()
+		mc.tap.tx, mc.tap.rx	= nil, nil
+	}
 
 	return
 }
@@ -698,14 +1416,22 @@ func (mc *ModbusClient) WriteFloat64(addr uint16, value float64) (err error) {
 /*** unexported methods ***/
 // Reads and returns quantity booleans.
 // Digital inputs are read if di is true, otherwise coils are read.
-func (mc *ModbusClient) readBools(addr uint16, quantity uint16, di bool) (values []bool, err error) {
+func (mc *ModbusClient) readBools(ctx context.Context, addr uint16, quantity uint16, di bool) (values []bool, err error) {
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	values, err	= mc.readBoolsFrom(mc.unitId, addr, quantity, di)
+
+	return
+}
+
+// Reads and returns quantity booleans from unitId.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) readBoolsFrom(unitId uint8, addr uint16, quantity uint16, di bool) (values []bool, err error) {
 	var req		*pdu
 	var res		*pdu
 	var expectedLen	int
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
-
 	if quantity == 0 {
 		err	= ErrUnexpectedParameters
 		mc.logger.Error("quantity of coils/discrete inputs is 0")
@@ -726,7 +1452,7 @@ func (mc *ModbusClient) readBools(addr uint16, quantity uint16, di bool) (values
 
 	// create and fill in the request object
 	req	= &pdu{
-		unitId:	mc.unitId,
+		unitId:	unitId,
 	}
 
 	if di {
@@ -777,7 +1503,7 @@ func (mc *ModbusClient) readBools(addr uint16, quantity uint16, di bool) (values
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -789,16 +1515,24 @@ func (mc *ModbusClient) readBools(addr uint16, quantity uint16, di bool) (values
 
 
 // Reads and returns quantity registers of type regType, as bytes.
-func (mc *ModbusClient) readRegisters(addr uint16, quantity uint16, regType RegType) (bytes []byte, err error) {
+func (mc *ModbusClient) readRegisters(ctx context.Context, addr uint16, quantity uint16, regType RegType) (bytes []byte, err error) {
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	bytes, err	= mc.readRegistersFrom(mc.unitId, addr, quantity, regType)
+
+	return
+}
+
+// Reads and returns quantity registers of type regType from unitId, as bytes.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) readRegistersFrom(unitId uint8, addr uint16, quantity uint16, regType RegType) (bytes []byte, err error) {
 	var req		*pdu
 	var res		*pdu
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
-
 	// create and fill in the request object
 	req	= &pdu{
-		unitId:	mc.unitId,
+		unitId:	unitId,
 	}
 
 	switch regType {
@@ -863,7 +1597,7 @@ func (mc *ModbusClient) readRegisters(addr uint16, quantity uint16, regType RegT
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -875,14 +1609,14 @@ func (mc *ModbusClient) readRegisters(addr uint16, quantity uint16, regType RegT
 
 // Writes multiple registers starting from base address addr.
 // Register values are passed as bytes, each value being exactly 2 bytes.
-func (mc *ModbusClient) writeRegisters(addr uint16, values []byte) (err error) {
+func (mc *ModbusClient) writeRegisters(ctx context.Context, addr uint16, values []byte) (err error) {
 	var req			*pdu
 	var res			*pdu
 	var payloadLength	uint16
 	var quantity		uint16
 
-	mc.lock.Lock()
-	defer mc.lock.Unlock()
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
 
 	payloadLength	= uint16(len(values))
 	quantity	= payloadLength / 2
@@ -929,15 +1663,62 @@ func (mc *ModbusClient) writeRegisters(addr uint16, values []byte) (err error) {
 	// validate the response code
 	switch {
 	case res.functionCode == req.functionCode:
-		// expect 4 bytes (2 byte of address + 2 bytes of quantity)
-		if len(res.payload) != 4 ||
-		   // bytes 1-2 should be the base register address
-		   bytesToUint16(BIG_ENDIAN, res.payload[0:2]) != addr ||
-		   // bytes 3-4 should be the quantity of registers (2 bytes per register)
-		   bytesToUint16(BIG_ENDIAN, res.payload[2:4]) != quantity {
-			   err = ErrProtocolError
-			   return
-		   }
+		// expect the address and value/quantity of the request to be
+		// echoed back
+		err	= mc.validateEcho(req, res)
+		if err != nil {
+			return
+		}
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Sends a mask write register request to unitId.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) maskWriteRegisterTo(unitId uint8, addr uint16, andMask uint16, orMask uint16) (err error) {
+	var req		*pdu
+	var res		*pdu
+
+	// create and fill in the request object
+	req	= &pdu{
+		unitId:		unitId,
+		functionCode:	FC_MASK_WRITE_REGISTER,
+	}
+
+	// register address
+	req.payload	= uint16ToBytes(BIG_ENDIAN, addr)
+	// AND mask
+	req.payload	= append(req.payload, uint16ToBytes(mc.endianness, andMask)...)
+	// OR mask
+	req.payload	= append(req.payload, uint16ToBytes(mc.endianness, orMask)...)
+
+	// run the request across the transport and wait for a response
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	// validate the response code
+	switch {
+	case res.functionCode == req.functionCode:
+		// expect the address and both masks to be echoed back
+		err	= mc.validateEcho(req, res)
+		if err != nil {
+			return
+		}
 
 	case res.functionCode == (req.functionCode | 0x80):
 		if len(res.payload) != 1 {
@@ -945,7 +1726,7 @@ func (mc *ModbusClient) writeRegisters(addr uint16, values []byte) (err error) {
 			return
 		}
 
-		err	= mapExceptionCodeToError(res.payload[0])
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
 
 	default:
 		err	= ErrProtocolError
@@ -955,9 +1736,105 @@ func (mc *ModbusClient) writeRegisters(addr uint16, values []byte) (err error) {
 	return
 }
 
+// Sends a request with an arbitrary function code and payload to unitId, e.g.
+// for vendor specific function codes, and returns the payload of the response.
+// Exception responses are returned as errors (see ErrIllegalFunction, etc.).
+// As RTU frames carry no length field, only function codes supported by the
+// client can be used over RTU links.
+// A unitId of 0 stands for the unit id of the client (ClientConfiguration.UnitId
+// or the one set with SetUnitId()): use Broadcast() to address unit 0.
+func (mc *ModbusClient) ExecuteRaw(unitId uint8, functionCode uint8, payload []byte) (res []byte, err error) {
+	res, err	= mc.ExecuteRawContext(context.Background(), unitId, functionCode, payload)
+
+	return
+}
+
+// Same as ExecuteRaw(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ExecuteRawContext(ctx context.Context, unitId uint8,
+					  functionCode uint8, payload []byte) (res []byte, err error) {
+	var req		*pdu
+	var resPdu	*pdu
+
+	if functionCode == 0x00 || functionCode & 0x80 != 0 {
+		err	= ErrUnexpectedParameters
+		mc.logger.Errorf("invalid function code (0x%02x)", functionCode)
+		return
+	}
+
+	// 253 bytes, minus the function code
+	if len(payload) > 252 {
+		err	= ErrUnexpectedParameters
+		mc.logger.Errorf("payload too long (%v bytes)", len(payload))
+		return
+	}
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitIdOrDefault(unitId),
+		functionCode:	functionCode,
+		payload:	payload,
+	}
+
+	resPdu, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case resPdu.functionCode == req.functionCode:
+		res	= resPdu.payload
+
+	case resPdu.functionCode == (req.functionCode | 0x80):
+		if len(resPdu.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, resPdu.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", resPdu.functionCode)
+	}
+
+	return
+}
+
 func (mc *ModbusClient) executeRequest(req *pdu) (res *pdu, err error) {
+	var rw		requestWriter
+	var ok		bool
+	var start	time.Time
+	var endSpan	func(error)
+
+	// writes to unit id 0 are broadcast to all devices of serial buses,
+	// which never answer them
+	if req.unitId == 0x00 && isBroadcastWrite(req.functionCode) {
+		rw, ok	= mc.transport.(requestWriter)
+		if ok {
+			res, err	= mc.executeBroadcast(rw, req)
+			return
+		}
+	}
+
+	if mc.conf.Tracer != nil {
+		endSpan	= mc.startSpan(req)
+	}
+
 	// send the request over the wire, wait for and decode the response
-	res, err	= mc.transport.ExecuteRequest(req)
+	start	= time.Now()
+	if mc.hasHooks() {
+		res, err	= mc.executeHookedRequest(req, mc.executeBoundRequest)
+	} else {
+		res, err	= mc.executeBoundRequest(req)
+	}
+	if mc.conf.Metrics != nil {
+		mc.recordRequest(req, res, err, time.Since(start))
+	}
+	if endSpan != nil {
+		endSpan(responseError(res, err))
+	}
 	if err != nil {
 		return
 	}
@@ -976,3 +1853,44 @@ func (mc *ModbusClient) executeRequest(req *pdu) (res *pdu, err error) {
 
 	return
 }
+
+// Validates the response to a single/multiple coil/register write, which
+// should echo back the first 4 bytes (address and value or quantity) of the
+// request, or all 6 bytes (address, AND and OR masks) of a mask write request.
+// Malformed responses and mismatched addresses, values or quantities are
+// always rejected, but the echoed value of single coil writes turning a coil
+// off is only checked when StrictEchoValidation is set, as some devices echo
+// garbage in place of 0x0000.
+func (mc *ModbusClient) validateEcho(req *pdu, res *pdu) (err error) {
+	var echoLength	int
+	var match	bool
+
+	echoLength	= 4
+	if req.functionCode == FC_MASK_WRITE_REGISTER {
+		echoLength	= 6
+	}
+
+	if len(res.payload) != echoLength {
+		err	= ErrProtocolError
+		return
+	}
+
+	if req.functionCode == FC_WRITE_SINGLE_COIL && !mc.conf.StrictEchoValidation {
+		// bytes 1-2 should be the coil address, bytes 3-4 either
+		// {0xff, 0x00} or {0x00, 0x00} depending on the coil value
+		match	= bytes.Equal(res.payload[0:2], req.payload[0:2]) &&
+			  (req.payload[2] != 0xff || res.payload[2] == 0xff) &&
+			  res.payload[3] == 0x00
+	} else {
+		match	= bytes.Equal(res.payload, req.payload[0:echoLength])
+	}
+
+	if !match {
+		mc.logger.Warningf("echo mismatch (fc: 0x%02x, expected: 0x%x, got: 0x%x)",
+				   req.functionCode, req.payload[0:echoLength], res.payload)
+		err	= ErrProtocolError
+		return
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+package modbus
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// contextGuard sits between a transport and its link to bound requests by
+// a context: deadlines set by the transport are capped by the deadline of
+// the context, and pending reads and writes are interrupted as soon as the
+// context is done (by moving the deadline to the past).
+type contextGuard struct {
+	lock		sync.Mutex
+	setDeadline	func(time.Time) error
+	ctx		context.Context
+	done		bool
+}
+
+// guardedConn is a net.Conn whose deadlines are bound by a contextGuard.
+type guardedConn struct {
+	net.Conn
+	guard	*contextGuard
+}
+
+// guardedLink is an rtuLink whose deadlines are bound by a contextGuard.
+type guardedLink struct {
+	rtuLink
+	guard	*contextGuard
+}
+
+// Wraps conn so that its deadlines can be bound by a context.
+func newGuardedConn(conn net.Conn) (gc *guardedConn) {
+	gc	= &guardedConn{
+		Conn:	conn,
+		guard:	&contextGuard{setDeadline: conn.SetDeadline},
+	}
+
+	return
+}
+
+// Wraps link so that its deadlines can be bound by a context.
+func newGuardedLink(link rtuLink) (gl *guardedLink) {
+	gl	= &guardedLink{
+		rtuLink:	link,
+		guard:		&contextGuard{setDeadline: link.SetDeadline},
+	}
+
+	return
+}
+
+func (gc *guardedConn) SetDeadline(deadline time.Time) (err error) {
+	err	= gc.guard.SetDeadline(deadline)
+
+	return
+}
+
+func (gl *guardedLink) SetDeadline(deadline time.Time) (err error) {
+	err	= gl.guard.SetDeadline(deadline)
+
+	return
+}
+
+// Sets the deadline of the underlying link, capped by the deadline of the
+// bound context if any.
+func (cg *contextGuard) SetDeadline(deadline time.Time) (err error) {
+	var ctxDeadline	time.Time
+	var ok		bool
+
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+
+	if cg.done {
+		deadline	= time.Unix(1, 0)
+	} else if cg.ctx != nil {
+		ctxDeadline, ok	= cg.ctx.Deadline()
+		if ok && ctxDeadline.Before(deadline) {
+			deadline	= ctxDeadline
+		}
+	}
+
+	err	= cg.setDeadline(deadline)
+
+	return
+}
+
+// Binds ctx to the link until the returned function is called, interrupting
+// any pending read or write once ctx is done.
+func (cg *contextGuard) bind(ctx context.Context) (release func()) {
+	var stop	chan struct{}
+	var stopped	chan struct{}
+
+	cg.lock.Lock()
+	cg.ctx	= ctx
+	cg.done	= false
+	cg.lock.Unlock()
+
+	stop	= make(chan struct{})
+	stopped	= make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			cg.lock.Lock()
+			cg.done	= true
+			cg.setDeadline(time.Unix(1, 0))
+			cg.lock.Unlock()
+		case <-stop:
+		}
+	}()
+
+	release	= func() {
+		close(stop)
+		<-stopped
+
+		cg.lock.Lock()
+		cg.ctx	= nil
+		cg.done	= false
+		cg.lock.Unlock()
+	}
+
+	return
+}
+
+// Acquires the client lock and binds ctx to the requests made until
+// unlockContext() is called: requests are not sent if ctx is already done,
+// and requests in flight are aborted as soon as ctx is done (before the
+// configured timeout), in which case ctx.Err() is returned.
+// Note that over serial links, the response to an aborted request may still
+// arrive and be mistaken for the response to the next request.
+func (mc *ModbusClient) lockContext(ctx context.Context) {
+	mc.lock.Lock()
+	mc.ctx	= ctx
+
+	return
+}
+
+// Unbinds the context set by lockContext() and releases the client lock.
+func (mc *ModbusClient) unlockContext() {
+	mc.ctx	= nil
+	mc.lock.Unlock()
+
+	return
+}
+
+// Runs req across the transport, bound by the context set with lockContext()
+// if any.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) executeBoundRequest(req *pdu) (res *pdu, err error) {
+	var release	func()
+	var deadline	time.Time
+	var ok		bool
+
+	if mc.ctx == nil {
+		res, err	= mc.transport.ExecuteRequest(req)
+		return
+	}
+
+	err	= mc.ctx.Err()
+	if err != nil {
+		return
+	}
+
+	// contexts which can never be done need no watching
+	if mc.guard != nil && mc.ctx.Done() != nil {
+		release	= mc.guard.bind(mc.ctx)
+		defer release()
+	}
+
+	res, err	= mc.transport.ExecuteRequest(req)
+	if err != nil && mc.ctx.Err() != nil {
+		err	= mc.ctx.Err()
+	}
+
+	// the link may time out at the deadline of the context slightly before
+	// the context itself is done
+	if err != nil {
+		deadline, ok	= mc.ctx.Deadline()
+		if ok && !time.Now().Before(deadline) {
+			err	= context.DeadlineExceeded
+		}
+	}
+
+	return
+}
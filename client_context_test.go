@@ -0,0 +1,261 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientContextOverTCP(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var start	time.Time
+	var regs	[]uint16
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5567",
+	}, &slowHandler{delay: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5567",
+		Timeout:	2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// requests should not be sent with a done context
+	ctx, cancel	= context.WithCancel(context.Background())
+	cancel()
+
+	err	= client.WriteRegisterContext(ctx, 0, 0x1234)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+
+	// the deadline of the context should take precedence over the
+	// client timeout
+	ctx, cancel	= context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	start		= time.Now()
+	_, err		= client.ReadRegistersContext(ctx, 0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	if time.Since(start) > 250 * time.Millisecond {
+		t.Errorf("request should have been aborted early, took %v", time.Since(start))
+	}
+
+	// the connection should still be usable, the late response being
+	// discarded
+	regs, err	= client.ReadRegistersContext(context.Background(), 0, 2, HOLDING_REGISTER)
+	if err != nil || len(regs) != 2 {
+		t.Errorf("unexpected registers: %v (%v)", regs, err)
+	}
+
+	return
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	var client	*ModbusClient
+	var p1, p2	net.Conn
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var start	time.Time
+	var err		error
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	// swallow requests without ever answering
+	go func() {
+		var buf	[256]byte
+		var err	error
+
+		for {
+			_, err	= p2.Read(buf[:])
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	client, err	= NewRTUClientWithLink(p1, "pipe", &ClientConfiguration{
+		Timeout:	2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	ctx, cancel	= context.WithCancel(context.Background())
+	time.AfterFunc(50 * time.Millisecond, cancel)
+
+	start	= time.Now()
+	_, err	= client.ReadCoilsContext(ctx, 0, 8)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+
+	if time.Since(start) > 500 * time.Millisecond {
+		t.Errorf("request should have been aborted early, took %v", time.Since(start))
+	}
+
+	// later requests should be bound by the client timeout again
+	client.conf.Timeout	= 100 * time.Millisecond
+	client.transport.(*rtuTransport).timeout	= 100 * time.Millisecond
+
+	start	= time.Now()
+	_, err	= client.ReadCoils(0, 8)
+	if !isTimeoutError(err) {
+		t.Errorf("expected a timeout error, got: %v", err)
+	}
+
+	if time.Since(start) < 50 * time.Millisecond {
+		t.Errorf("request should have waited for the timeout, took %v", time.Since(start))
+	}
+
+	return
+}
+
+func TestClientContextFunctionCodes(t *testing.T) {
+	var client	*ModbusClient
+	var p1, p2	net.Conn
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var received	chan int
+	var start	time.Time
+	var err		error
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+
+	// swallow requests without ever answering, reporting their size
+	received	= make(chan int, 16)
+	go func() {
+		var buf	[256]byte
+		var n	int
+		var err	error
+
+		for {
+			n, err	= p2.Read(buf[:])
+			if err != nil {
+				return
+			}
+			received <- n
+		}
+	}()
+
+	client, err	= NewRTUClientWithLink(p1, "pipe", &ClientConfiguration{
+		Timeout:	2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	// requests should not be sent with a done context
+	ctx, cancel	= context.WithCancel(context.Background())
+	cancel()
+
+	for name, call := range map[string]func() error {
+		"ReadFIFOQueueContext": func() (err error) {
+			_, err	= client.ReadFIFOQueueContext(ctx, 0)
+			return
+		},
+		"ReadFileRecordContext": func() (err error) {
+			_, err	= client.ReadFileRecordContext(ctx, 1, 0, 2)
+			return
+		},
+		"WriteFileRecordContext": func() (err error) {
+			err	= client.WriteFileRecordContext(ctx, 1, 0, []uint16{0x1234})
+			return
+		},
+		"ReadDeviceIdentificationContext": func() (err error) {
+			_, err	= client.ReadDeviceIdentificationContext(ctx, READ_DEVICE_ID_BASIC, 0)
+			return
+		},
+		"ReadExceptionStatusContext": func() (err error) {
+			_, err	= client.ReadExceptionStatusContext(ctx)
+			return
+		},
+		"GetCommEventCounterContext": func() (err error) {
+			_, _, err	= client.GetCommEventCounterContext(ctx)
+			return
+		},
+		"GetCommEventLogContext": func() (err error) {
+			_, err	= client.GetCommEventLogContext(ctx)
+			return
+		},
+		"ReportServerIdContext": func() (err error) {
+			_, err	= client.ReportServerIdContext(ctx)
+			return
+		},
+		"ExecuteRawContext": func() (err error) {
+			_, err	= client.ExecuteRawContext(ctx, 0, FC_READ_HOLDING_REGISTERS,
+							   []byte{0x00, 0x00, 0x00, 0x01})
+			return
+		},
+	} {
+		err	= call()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got: %v", name, err)
+		}
+	}
+
+	select {
+	case <-received:
+		t.Errorf("no request should have been sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the deadline of the context should take precedence over the
+	// client timeout
+	ctx, cancel	= context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	start	= time.Now()
+	_, err	= client.ExecuteRawContext(ctx, 0, FC_READ_HOLDING_REGISTERS,
+					   []byte{0x00, 0x00, 0x00, 0x01})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	if time.Since(start) > 500 * time.Millisecond {
+		t.Errorf("request should have been aborted early, took %v", time.Since(start))
+	}
+
+	return
+}
@@ -0,0 +1,159 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClientGroup sends requests to a set of redundant devices, e.g. to write the
+// same values to all of them.
+type ClientGroup struct {
+	// serializes group operations, as the unit id of clients is changed
+	// on every operation
+	lock		sync.Mutex
+	clients		[]Client
+}
+
+// MultiError holds the errors of a group operation, keyed by the index of
+// the failed clients in the group.
+type MultiError struct {
+	Errors		map[int]error
+}
+
+// Returns a new client group, given a list of open clients, in priority order.
+// The group should have exclusive use of clients as their unit id is changed
+// by group operations.
+func NewClientGroup(clients []Client) (cg *ClientGroup) {
+	cg	= &ClientGroup{
+		clients:	clients,
+	}
+
+	return
+}
+
+// Writes values to holding registers of all clients of the group, in parallel
+// (function code 16).
+// Returns nil if all writes succeeded, or a MultiError holding the errors of
+// the failed writes.
+// If ctx is done before all writes complete, ctx.Err() is returned and pending
+// writes are left to complete in the background.
+func (cg *ClientGroup) WriteMultipleRegisters(ctx context.Context, unitId uint8, addr uint16, values []uint16) (err error) {
+	var wg		sync.WaitGroup
+	var errs	[]error
+	var done	chan struct{}
+	var me		*MultiError
+
+	err	= ctx.Err()
+	if err != nil {
+		return
+	}
+
+	cg.lock.Lock()
+
+	errs	= make([]error, len(cg.clients))
+	done	= make(chan struct{})
+
+	for i, client := range cg.clients {
+		wg.Add(1)
+		go func(i int, client Client) {
+			defer wg.Done()
+
+			errs[i]	= client.SetUnitId(unitId)
+			if errs[i] == nil {
+				errs[i]	= client.WriteRegisters(addr, values)
+			}
+		}(i, client)
+	}
+
+	go func() {
+		wg.Wait()
+		cg.lock.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err	= ctx.Err()
+		return
+	}
+
+	for i := range errs {
+		if errs[i] != nil {
+			if me == nil {
+				me	= &MultiError{Errors: make(map[int]error)}
+			}
+			me.Errors[i]	= errs[i]
+		}
+	}
+
+	if me != nil {
+		err	= me
+	}
+
+	return
+}
+
+// Reads holding registers from the clients of the group, in priority order
+// (function code 03), and returns the first successful result.
+// Returns a MultiError holding the errors of all clients if none succeeded.
+func (cg *ClientGroup) ReadHoldingRegisters(ctx context.Context, unitId uint8, addr uint16, quantity uint16) (values []uint16, err error) {
+	var me	*MultiError
+
+	cg.lock.Lock()
+	defer cg.lock.Unlock()
+
+	me	= &MultiError{Errors: make(map[int]error)}
+
+	for i, client := range cg.clients {
+		err	= ctx.Err()
+		if err != nil {
+			return
+		}
+
+		err	= client.SetUnitId(unitId)
+		if err == nil {
+			values, err	= client.ReadRegisters(addr, quantity, HOLDING_REGISTER)
+		}
+		if err == nil {
+			return
+		}
+
+		me.Errors[i]	= err
+	}
+
+	err	= me
+
+	return
+}
+
+func (me *MultiError) Error() (msg string) {
+	var indices	[]int
+	var parts	[]string
+
+	for i := range me.Errors {
+		indices	= append(indices, i)
+	}
+	sort.Ints(indices)
+
+	for _, i := range indices {
+		parts	= append(parts, fmt.Sprintf("client #%v: %v", i, me.Errors[i]))
+	}
+
+	msg	= fmt.Sprintf("%v client(s) failed: %s", len(me.Errors), strings.Join(parts, ", "))
+
+	return
+}
+
+// Returns the errors of all failed clients, allowing errors.Is() and
+// errors.As() to match any of them.
+func (me *MultiError) Unwrap() (errs []error) {
+	for _, err := range me.Errors {
+		errs	= append(errs, err)
+	}
+
+	return
+}
@@ -0,0 +1,111 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClientGroup(t *testing.T) {
+	var stores	[]*DataStore
+	var clients	[]Client
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var cg		*ClientGroup
+	var err		error
+	var me		*MultiError
+	var regs	[]uint16
+	var reg		uint16
+
+	// three loopback servers and clients
+	for i := 0; i < 3; i++ {
+		stores	= append(stores, NewDataStore(0, 0, 16, 0))
+		stores[i].SetHoldingRegister(0, uint16(0x1000 + i))
+
+		server, err	= NewServer(&ServerConfiguration{
+			URL:	fmt.Sprintf("tcp://localhost:%v", 5523 + i),
+		}, stores[i])
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		err	= server.Start()
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		defer server.Stop()
+
+		client, err	= NewClient(&ClientConfiguration{
+			URL:	fmt.Sprintf("tcp://localhost:%v", 5523 + i),
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		err	= client.Open()
+		if err != nil {
+			t.Fatalf("failed to open client: %v", err)
+		}
+		defer client.Close()
+
+		clients	= append(clients, client)
+	}
+
+	cg	= NewClientGroup(clients)
+
+	// writes should reach all clients
+	err	= cg.WriteMultipleRegisters(context.Background(), 1, 2, []uint16{0x1111, 0x2222})
+	if err != nil {
+		t.Errorf("WriteMultipleRegisters() should have succeeded, got: %v", err)
+	}
+	for i := range stores {
+		reg, _	= stores[i].GetHoldingRegister(3)
+		if reg != 0x2222 {
+			t.Errorf("store #%v: expected 0x2222, got: 0x%04x", i, reg)
+		}
+	}
+
+	// reads should be served by the first client
+	regs, err	= cg.ReadHoldingRegisters(context.Background(), 1, 0, 1)
+	if err != nil || regs[0] != 0x1000 {
+		t.Errorf("expected 0x1000, got: %v, %v", regs, err)
+	}
+
+	// break the transport of the first client
+	clients[0].Close()
+
+	err	= cg.WriteMultipleRegisters(context.Background(), 1, 4, []uint16{0x3333})
+	if !errors.As(err, &me) {
+		t.Fatalf("expected a MultiError, got: %v", err)
+	}
+	if len(me.Errors) != 1 || me.Errors[0] == nil {
+		t.Errorf("expected an error for client #0 only, got: %v", me)
+	}
+	for i := range stores {
+		reg, _	= stores[i].GetHoldingRegister(4)
+		if i == 0 && reg != 0 {
+			t.Errorf("store #0: expected 0, got: 0x%04x", reg)
+		}
+		if i > 0 && reg != 0x3333 {
+			t.Errorf("store #%v: expected 0x3333, got: 0x%04x", i, reg)
+		}
+	}
+
+	// reads should fall back to the next client
+	regs, err	= cg.ReadHoldingRegisters(context.Background(), 1, 0, 1)
+	if err != nil || regs[0] != 0x1001 {
+		t.Errorf("expected 0x1001, got: %v, %v", regs, err)
+	}
+
+	// exceptions should be reachable through the MultiError
+	_, err	= cg.ReadHoldingRegisters(context.Background(), 1, 20, 1)
+	if !errors.As(err, &me) || len(me.Errors) != 3 {
+		t.Errorf("expected a MultiError with 3 errors, got: %v", err)
+	}
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected the error to match ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,182 @@
+package modbus
+
+import (
+	"net"
+	"time"
+)
+
+// ClientFrame describes a request sent or a response received by a client,
+// as passed to the OnRequest, OnResponse and OnError hooks of
+// ClientConfiguration.
+type ClientFrame struct {
+	UnitId		uint8
+	FunctionCode	uint8		// with bit 0x80 set on exception responses
+	Payload		[]byte		// decoded payload, following the function code
+	ADU		[]byte		// raw bytes as sent or received on the wire
+					// (including any bytes discarded by the
+					// transport while waiting for the response)
+	Time		time.Time	// time at which the request was sent or the
+					// response received
+}
+
+// aduTap records the bytes written to and read from a link during a request,
+// along with the time at which the first of them went through.
+type aduTap struct {
+	tx	[]byte
+	rx	[]byte
+	txTime	time.Time
+	rxTime	time.Time
+}
+
+// tappedLink is an rtuLink recording traffic to an aduTap.
+type tappedLink struct {
+	rtuLink
+	tap	*aduTap
+}
+
+// tappedConn is a net.Conn recording traffic to an aduTap.
+type tappedConn struct {
+	net.Conn
+	tap	*aduTap
+}
+
+// Records bytes read from the link.
+func (at *aduTap) recordRx(buf []byte) {
+	if len(at.rx) == 0 && len(buf) > 0 {
+		at.rxTime	= time.Now()
+	}
+	at.rx	= append(at.rx, buf...)
+
+	return
+}
+
+// Records bytes written to the link.
+func (at *aduTap) recordTx(buf []byte) {
+	if len(at.tx) == 0 && len(buf) > 0 {
+		at.txTime	= time.Now()
+	}
+	at.tx	= append(at.tx, buf...)
+
+	return
+}
+
+func (tl *tappedLink) Read(buf []byte) (n int, err error) {
+	n, err	= tl.rtuLink.Read(buf)
+	tl.tap.recordRx(buf[0:n])
+
+	return
+}
+
+func (tl *tappedLink) Write(buf []byte) (n int, err error) {
+	n, err	= tl.rtuLink.Write(buf)
+	tl.tap.recordTx(buf[0:n])
+
+	return
+}
+
+func (tc *tappedConn) Read(buf []byte) (n int, err error) {
+	n, err	= tc.Conn.Read(buf)
+	tc.tap.recordRx(buf[0:n])
+
+	return
+}
+
+func (tc *tappedConn) Write(buf []byte) (n int, err error) {
+	n, err	= tc.Conn.Write(buf)
+	tc.tap.recordTx(buf[0:n])
+
+	return
+}
+
+// Returns true if any request hook is configured or frames are to be dumped.
+func (mc *ModbusClient) hasHooks() (ok bool) {
+	ok	= mc.conf.OnRequest != nil || mc.conf.OnResponse != nil ||
+		  mc.conf.OnError != nil || mc.conf.DumpFrames
+
+	return
+}
+
+// Returns link wrapped so that its traffic is counted for metrics and
+// recorded for request hooks and frame dumps, or link itself if neither is configured.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) instrumentLink(link rtuLink) (l rtuLink) {
+	l	= link
+	if mc.conf.Metrics != nil {
+		l	= &countingLink{rtuLink: l, metrics: mc.conf.Metrics}
+	}
+
+	if mc.hasHooks() {
+		mc.tap	= &aduTap{}
+		l	= &tappedLink{rtuLink: l, tap: mc.tap}
+	}
+
+	return
+}
+
+// Same as instrumentLink(), for TCP connections.
+func (mc *ModbusClient) instrumentConn(conn net.Conn) (c net.Conn) {
+	c	= conn
+	if mc.conf.Metrics != nil {
+		c	= &countingConn{Conn: c, metrics: mc.conf.Metrics}
+	}
+
+	if mc.hasHooks() {
+		mc.tap	= &aduTap{}
+		c	= &tappedConn{Conn: c, tap: mc.tap}
+	}
+
+	return
+}
+
+// Runs a request through exec, calling request hooks once it completes:
+// OnRequest first, then OnResponse if a response was received (exception
+// responses included) or OnError otherwise.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) executeHookedRequest(req *pdu,
+					    exec func(*pdu) (*pdu, error)) (res *pdu, err error) {
+	var reqFrame	ClientFrame
+	var resFrame	ClientFrame
+	var elapsed	time.Duration
+
+	if mc.tap != nil {
+		mc.tap.tx, mc.tap.rx	= nil, nil
+	}
+
+	reqFrame	= ClientFrame{
+		UnitId:		req.unitId,
+		FunctionCode:	req.functionCode,
+		Payload:	req.payload,
+		Time:		time.Now(),
+	}
+
+	res, err	= exec(req)
+	elapsed		= time.Since(reqFrame.Time)
+
+	if mc.tap != nil {
+		mc.dumpFrames()
+		reqFrame.ADU	= mc.tap.tx
+		resFrame.ADU	= mc.tap.rx
+		mc.tap.tx, mc.tap.rx	= nil, nil
+	}
+
+	if mc.conf.OnRequest != nil {
+		mc.conf.OnRequest(reqFrame)
+	}
+
+	if err != nil || res == nil {
+		if mc.conf.OnError != nil {
+			mc.conf.OnError(reqFrame, err, elapsed)
+		}
+		return
+	}
+
+	if mc.conf.OnResponse != nil {
+		resFrame.UnitId		= res.unitId
+		resFrame.FunctionCode	= res.functionCode
+		resFrame.Payload	= res.payload
+		resFrame.Time		= reqFrame.Time.Add(elapsed)
+		mc.conf.OnResponse(reqFrame, resFrame, elapsed)
+	}
+
+	return
+}
@@ -0,0 +1,150 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientHooks(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var requests	[]ClientFrame
+	var responses	[]ClientFrame
+	var errs	[]error
+	var p1, p2	net.Conn
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5573",
+	}, NewDataStore(0, 0, 4, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5573",
+		Timeout:	1 * time.Second,
+		OnRequest:	func(req ClientFrame) {
+			requests	= append(requests, req)
+		},
+		OnResponse:	func(req ClientFrame, res ClientFrame, elapsed time.Duration) {
+			responses	= append(responses, res)
+			if elapsed <= 0 || res.Time.Before(req.Time) {
+				t.Errorf("unexpected timing: %v, %v, %v", req.Time, res.Time, elapsed)
+			}
+		},
+		OnError:	func(req ClientFrame, err error, elapsed time.Duration) {
+			errs	= append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegisters(1, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	// exception responses are responses too
+	_, err	= client.ReadRegisters(3, 2, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	if len(requests) != 2 || len(responses) != 2 || len(errs) != 0 {
+		t.Fatalf("unexpected hook calls: %v requests, %v responses, %v errors",
+			 len(requests), len(responses), len(errs))
+	}
+
+	if requests[0].UnitId != 1 || requests[0].FunctionCode != FC_READ_HOLDING_REGISTERS ||
+	   !bytes.Equal(requests[0].Payload, []byte{0x00, 0x01, 0x00, 0x02}) {
+		t.Errorf("unexpected request frame: %+v", requests[0])
+	}
+
+	// MBAP header (7 bytes) followed by the PDU
+	if len(requests[0].ADU) != 12 ||
+	   !bytes.Equal(requests[0].ADU[7:], []byte{0x03, 0x00, 0x01, 0x00, 0x02}) {
+		t.Errorf("unexpected request ADU: 0x%x", requests[0].ADU)
+	}
+
+	if responses[0].FunctionCode != FC_READ_HOLDING_REGISTERS ||
+	   len(responses[0].Payload) != 5 || len(responses[0].ADU) != 13 {
+		t.Errorf("unexpected response frame: %+v", responses[0])
+	}
+
+	if responses[1].FunctionCode != 0x83 ||
+	   !bytes.Equal(responses[1].Payload, []byte{EX_ILLEGAL_DATA_ADDRESS}) {
+		t.Errorf("unexpected exception response frame: %+v", responses[1])
+	}
+
+	// requests left unanswered are reported through OnError
+	requests, responses	= nil, nil
+	p1, p2	= net.Pipe()
+	defer p2.Close()
+
+	client, err	= NewRTUClientWithLink(p1, "pipe", &ClientConfiguration{
+		Timeout:	50 * time.Millisecond,
+		OnRequest:	func(req ClientFrame) {
+			requests	= append(requests, req)
+		},
+		OnError:	func(req ClientFrame, err error, elapsed time.Duration) {
+			errs	= append(errs, err)
+			if elapsed < 50 * time.Millisecond {
+				t.Errorf("expected the timeout to have elapsed, got: %v", elapsed)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// drain requests without ever answering
+	go func() {
+		var buf	= make([]byte, 256)
+		var err	error
+
+		for err == nil {
+			_, err	= p2.Read(buf)
+		}
+	}()
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadCoils(0, 4)
+	if err == nil {
+		t.Fatalf("ReadCoils() should have failed")
+	}
+
+	if len(requests) != 1 || len(errs) != 1 || errs[0] != err {
+		t.Fatalf("unexpected hook calls: %v requests, %v errors (%v)",
+			 len(requests), len(errs), errs)
+	}
+
+	// unit id, function code, payload and CRC
+	if len(requests[0].ADU) != 8 || requests[0].ADU[0] != 0x01 ||
+	   requests[0].ADU[1] != FC_READ_COILS {
+		t.Errorf("unexpected request ADU: 0x%x", requests[0].ADU)
+	}
+
+	return
+}
@@ -0,0 +1,186 @@
+package modbus
+
+import (
+	"time"
+)
+
+// ClientMiddleware wraps a Client into another Client, e.g. to add logging,
+// metrics or retries (see NewClientWithMiddleware()).
+type ClientMiddleware func(next Client) Client
+
+// Returns inner wrapped by mws, applied outermost-first: calls go through
+// mws[0], then mws[1] and so on down to inner, and return the other way around.
+func NewClientWithMiddleware(inner Client, mws ...ClientMiddleware) (c Client) {
+	c	= inner
+	for i := len(mws) - 1; i >= 0; i-- {
+		c	= mws[i](c)
+	}
+
+	return
+}
+
+// loggingClient logs every call made to the Client it wraps.
+type loggingClient struct {
+	next	Client
+	l	Logger
+}
+
+// Returns a middleware logging every call with its arguments, duration and
+// outcome to l, e.g.
+//   ReadHoldingRegisters(addr=100, qty=2): ok (2.3ms)
+//   WriteRegister(addr=100): illegal data address (1.8ms)
+func LoggingClientMiddleware(l Logger) (mw ClientMiddleware) {
+	mw	= func(next Client) (c Client) {
+		c	= &loggingClient{
+			next:	next,
+			l:	l,
+		}
+
+		return
+	}
+
+	return
+}
+
+func (lc *loggingClient) Open() (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.Open()
+	lc.log(start, err, "Open()")
+
+	return
+}
+
+func (lc *loggingClient) Close() (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.Close()
+	lc.log(start, err, "Close()")
+
+	return
+}
+
+func (lc *loggingClient) SetUnitId(id uint8) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.SetUnitId(id)
+	lc.log(start, err, "SetUnitId(%v)", id)
+
+	return
+}
+
+func (lc *loggingClient) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.SetEncoding(endianness, wordOrder)
+	lc.log(start, err, "SetEncoding(%v, %v)", endianness, wordOrder)
+
+	return
+}
+
+func (lc *loggingClient) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
+	var start	= time.Now()
+
+	values, err	= lc.next.ReadCoils(addr, quantity)
+	lc.log(start, err, "ReadCoils(addr=%v, qty=%v)", addr, quantity)
+
+	return
+}
+
+func (lc *loggingClient) ReadCoil(addr uint16) (value bool, err error) {
+	var start	= time.Now()
+
+	value, err	= lc.next.ReadCoil(addr)
+	lc.log(start, err, "ReadCoil(addr=%v)", addr)
+
+	return
+}
+
+func (lc *loggingClient) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
+	var start	= time.Now()
+
+	values, err	= lc.next.ReadDiscreteInputs(addr, quantity)
+	lc.log(start, err, "ReadDiscreteInputs(addr=%v, qty=%v)", addr, quantity)
+
+	return
+}
+
+func (lc *loggingClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	var start	= time.Now()
+
+	value, err	= lc.next.ReadDiscreteInput(addr)
+	lc.log(start, err, "ReadDiscreteInput(addr=%v)", addr)
+
+	return
+}
+
+func (lc *loggingClient) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	var start	= time.Now()
+
+	values, err	= lc.next.ReadRegisters(addr, quantity, regType)
+	lc.log(start, err, "%s(addr=%v, qty=%v)",
+	       functionCodeName(readRegistersFunctionCode(regType)), addr, quantity)
+
+	return
+}
+
+func (lc *loggingClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	var start	= time.Now()
+
+	value, err	= lc.next.ReadRegister(addr, regType)
+	lc.log(start, err, "%s(addr=%v)",
+	       functionCodeName(readRegistersFunctionCode(regType)), addr)
+
+	return
+}
+
+func (lc *loggingClient) WriteCoil(addr uint16, value bool) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.WriteCoil(addr, value)
+	lc.log(start, err, "WriteCoil(addr=%v)", addr)
+
+	return
+}
+
+func (lc *loggingClient) WriteCoils(addr uint16, values []bool) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.WriteCoils(addr, values)
+	lc.log(start, err, "WriteCoils(addr=%v, qty=%v)", addr, len(values))
+
+	return
+}
+
+func (lc *loggingClient) WriteRegister(addr uint16, value uint16) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.WriteRegister(addr, value)
+	lc.log(start, err, "WriteRegister(addr=%v)", addr)
+
+	return
+}
+
+func (lc *loggingClient) WriteRegisters(addr uint16, values []uint16) (err error) {
+	var start	= time.Now()
+
+	err	= lc.next.WriteRegisters(addr, values)
+	lc.log(start, err, "WriteRegisters(addr=%v, qty=%v)", addr, len(values))
+
+	return
+}
+
+// Logs a call described by format and args, along with its outcome and the
+// time elapsed since start.
+func (lc *loggingClient) log(start time.Time, err error, format string, args ...interface{}) {
+	var outcome	= "ok"
+
+	if err != nil {
+		outcome	= err.Error()
+	}
+
+	lc.l.Printf(format + ": %s (%.1fms)", append(args, outcome,
+		    float64(time.Since(start)) / float64(time.Millisecond))...)
+
+	return
+}
@@ -0,0 +1,92 @@
+package modbus
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// stubClient answers ReadRegister() calls with a fixed value. Other methods
+// are not implemented.
+type stubClient struct {
+	Client
+}
+
+func (sc *stubClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	if addr > 10 {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= 0x1234
+
+	return
+}
+
+// tracingClient records calls to ReadRegister() and their return.
+type tracingClient struct {
+	Client
+	name	string
+	trace	*[]string
+}
+
+func (tc *tracingClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	*tc.trace	= append(*tc.trace, tc.name + " call")
+	value, err	= tc.Client.ReadRegister(addr, regType)
+	*tc.trace	= append(*tc.trace, tc.name + " return")
+
+	return
+}
+
+func tracingMiddleware(name string, trace *[]string) (mw ClientMiddleware) {
+	mw	= func(next Client) (c Client) {
+		c	= &tracingClient{Client: next, name: name, trace: trace}
+
+		return
+	}
+
+	return
+}
+
+func TestNewClientWithMiddleware(t *testing.T) {
+	var c		Client
+	var trace	[]string
+	var buf		bytes.Buffer
+	var lines	[]string
+	var reg		uint16
+	var err		error
+
+	c	= NewClientWithMiddleware(&stubClient{},
+		tracingMiddleware("outer", &trace),
+		tracingMiddleware("inner", &trace),
+		LoggingClientMiddleware(log.New(&buf, "", 0)))
+
+	reg, err	= c.ReadRegister(1, HOLDING_REGISTER)
+	if err != nil || reg != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x, %v", reg, err)
+	}
+
+	if strings.Join(trace, ", ") != "outer call, inner call, inner return, outer return" {
+		t.Errorf("unexpected call order: %v", trace)
+	}
+
+	_, err	= c.ReadRegister(11, INPUT_REGISTER)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	lines	= strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 ||
+	   !strings.HasPrefix(lines[0], "ReadHoldingRegisters(addr=1): ok (") ||
+	   !strings.HasPrefix(lines[1], "ReadInputRegisters(addr=11): illegal data address (") {
+		t.Errorf("unexpected log output: %q", buf.String())
+	}
+
+	// no middleware at all
+	if NewClientWithMiddleware(c) != c {
+		t.Errorf("expected the inner client to be returned as is")
+	}
+
+	return
+}
@@ -0,0 +1,369 @@
+package modbus
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ClientPool spreads requests over redundant devices or gateways (e.g. a pair
+// of TCP gateways to the same serial bus), round-robin, failing over to the
+// next client when one fails.
+type ClientPool struct {
+	lock			sync.Mutex
+	members			[]*poolMember
+	next			int
+	closed			bool
+	reconnectInterval	time.Duration
+}
+
+// ClientStats holds the statistics of a client of a pool (see Stats()).
+type ClientStats struct {
+	Healthy		bool	// false while the client is being reconnected
+	Requests	uint64	// requests sent through this client
+	Errors		uint64	// requests which failed on this client
+	LastError	error	// last error returned by this client, if any
+}
+
+type poolMember struct {
+	addr		string
+	client		*ModbusClient
+	healthy		bool
+	reconnecting	bool
+	stats		ClientStats
+}
+
+// Returns a new client pool with one client per address in addrs (e.g.
+// tcp://gw1:502), each configured from conf (conf.URL is ignored), and
+// opens them all.
+// Clients which fail to open are reconnected in the background.
+// Requests are sent to healthy clients in turn. If a request fails on a
+// client for any other reason than an exception response, the client is
+// removed from the rotation until it is reconnected and the request is
+// retried on the next healthy client. A MultiError is returned if all
+// clients fail, ErrNoHealthyClient if none is available.
+func NewClientPool(addrs []string, conf ClientConfiguration) (cp *ClientPool, err error) {
+	var client	*ModbusClient
+
+	if len(addrs) == 0 {
+		err	= ErrConfigurationError
+		return
+	}
+
+	cp	= &ClientPool{
+		reconnectInterval:	1 * time.Second,
+	}
+
+	for _, addr := range addrs {
+		conf.URL	= addr
+
+		client, err	= NewClient(&conf)
+		if err != nil {
+			cp	= nil
+			return
+		}
+
+		cp.members	= append(cp.members, &poolMember{
+			addr:	addr,
+			client:	client,
+		})
+	}
+
+	err	= cp.Open()
+
+	return
+}
+
+// Opens all clients of the pool. Clients which fail to open are reconnected
+// in the background, hence this never fails.
+func (cp *ClientPool) Open() (err error) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	cp.closed	= false
+
+	for _, m := range cp.members {
+		if m.healthy || m.reconnecting {
+			continue
+		}
+
+		if m.client.Open() == nil {
+			m.healthy	= true
+		} else {
+			m.reconnecting	= true
+			go cp.reconnect(m)
+		}
+	}
+
+	return
+}
+
+// Closes all clients of the pool and stops reconnection attempts.
+func (cp *ClientPool) Close() (err error) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	cp.closed	= true
+
+	for _, m := range cp.members {
+		if m.healthy {
+			m.client.Close()
+			m.healthy	= false
+		}
+	}
+
+	return
+}
+
+// Sets the unit id of subsequent requests, on all clients.
+func (cp *ClientPool) SetUnitId(id uint8) (err error) {
+	for _, m := range cp.members {
+		err	= m.client.SetUnitId(id)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Returns the unit id of subsequent requests, shared by all clients (see
+// unitIdReporter).
+func (cp *ClientPool) reportedUnitId() (unitId uint8, ok bool) {
+	if len(cp.members) > 0 {
+		unitId, ok	= cp.members[0].client.reportedUnitId()
+	}
+
+	return
+}
+
+// Sets the encoding of subsequent requests, on all clients.
+func (cp *ClientPool) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
+	for _, m := range cp.members {
+		err	= m.client.SetEncoding(endianness, wordOrder)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Returns per-address statistics.
+func (cp *ClientPool) Stats() (stats map[string]ClientStats) {
+	var s	ClientStats
+
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	stats	= make(map[string]ClientStats, len(cp.members))
+	for _, m := range cp.members {
+		s		= m.stats
+		s.Healthy	= m.healthy
+		stats[m.addr]	= s
+	}
+
+	return
+}
+
+func (cp *ClientPool) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		values, err	= c.ReadCoils(addr, quantity)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) ReadCoil(addr uint16) (value bool, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		value, err	= c.ReadCoil(addr)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		values, err	= c.ReadDiscreteInputs(addr, quantity)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		value, err	= c.ReadDiscreteInput(addr)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		values, err	= c.ReadRegisters(addr, quantity, regType)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		value, err	= c.ReadRegister(addr, regType)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) WriteCoil(addr uint16, value bool) (err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		err	= c.WriteCoil(addr, value)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) WriteCoils(addr uint16, values []bool) (err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		err	= c.WriteCoils(addr, values)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) WriteRegister(addr uint16, value uint16) (err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		err	= c.WriteRegister(addr, value)
+		return
+	})
+
+	return
+}
+
+func (cp *ClientPool) WriteRegisters(addr uint16, values []uint16) (err error) {
+	err	= cp.do(func(c *ModbusClient) (err error) {
+		err	= c.WriteRegisters(addr, values)
+		return
+	})
+
+	return
+}
+
+// Runs fn on healthy clients, starting with the next one in turn, until it
+// succeeds or fails with an error which another client would return as well
+// (exception responses and invalid parameters).
+func (cp *ClientPool) do(fn func(*ModbusClient) error) (err error) {
+	var m		*poolMember
+	var me		*MultiError
+	var start	int
+	var ee		ErrExceptionResponse
+
+	cp.lock.Lock()
+	start	= cp.next
+	cp.next	= (cp.next + 1) % len(cp.members)
+	cp.lock.Unlock()
+
+	for i := range cp.members {
+		m	= cp.members[(start + i) % len(cp.members)]
+
+		cp.lock.Lock()
+		if !m.healthy {
+			cp.lock.Unlock()
+			continue
+		}
+		m.stats.Requests++
+		cp.lock.Unlock()
+
+		err	= fn(m.client)
+		if err == nil {
+			return
+		}
+
+		cp.lock.Lock()
+		m.stats.Errors++
+		m.stats.LastError	= err
+		cp.lock.Unlock()
+
+		// the device answered or the request is invalid: no need to
+		// try elsewhere
+		if errors.As(err, &ee) || err == ErrUnexpectedParameters {
+			return
+		}
+
+		cp.markUnhealthy(m)
+
+		if me == nil {
+			me	= &MultiError{Errors: make(map[int]error)}
+		}
+		me.Errors[(start + i) % len(cp.members)]	= err
+	}
+
+	if me != nil {
+		err	= me
+	} else {
+		err	= ErrNoHealthyClient
+	}
+
+	return
+}
+
+// Removes a client from the rotation and starts reconnecting it.
+func (cp *ClientPool) markUnhealthy(m *poolMember) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	if !m.healthy {
+		return
+	}
+
+	m.healthy	= false
+	m.client.Close()
+
+	if !cp.closed && !m.reconnecting {
+		m.reconnecting	= true
+		go cp.reconnect(m)
+	}
+
+	return
+}
+
+// Tries to reopen a client every reconnectInterval until it succeeds or the
+// pool is closed.
+func (cp *ClientPool) reconnect(m *poolMember) {
+	var err	error
+
+	for {
+		time.Sleep(cp.reconnectInterval)
+
+		cp.lock.Lock()
+		if cp.closed {
+			m.reconnecting	= false
+			cp.lock.Unlock()
+			return
+		}
+		cp.lock.Unlock()
+
+		err	= m.client.Open()
+
+		cp.lock.Lock()
+		if err == nil {
+			if cp.closed {
+				m.client.Close()
+			} else {
+				m.healthy	= true
+			}
+			m.reconnecting	= false
+			cp.lock.Unlock()
+			return
+		}
+		m.stats.LastError	= err
+		cp.lock.Unlock()
+	}
+}
@@ -0,0 +1,91 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientPool(t *testing.T) {
+	var servers	[]*ModbusServer
+	var pool	*ClientPool
+	var c		Client
+	var stats	map[string]ClientStats
+	var reg		uint16
+	var err		error
+
+	for i, port := range []string{"5535", "5536"} {
+		var server	*ModbusServer
+		var ds		*DataStore
+
+		ds	= NewDataStore(0, 0, 1, 0)
+		ds.SetHoldingRegister(0, uint16(0x1000 + i))
+
+		server, err	= NewServer(&ServerConfiguration{
+			URL:	"tcp://localhost:" + port,
+		}, ds)
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		err	= server.Start()
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		defer server.Stop()
+
+		servers	= append(servers, server)
+	}
+
+	pool, err	= NewClientPool([]string{
+		"tcp://localhost:5535", "tcp://localhost:5536",
+	}, ClientConfiguration{Timeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer pool.Close()
+
+	// the pool should be usable as a Client
+	c	= pool
+
+	// requests should be distributed round-robin
+	for i := 0; i < 4; i++ {
+		reg, err	= c.ReadRegister(0, HOLDING_REGISTER)
+		if err != nil {
+			t.Fatalf("ReadRegister() should have succeeded, got: %v", err)
+		}
+		if reg != uint16(0x1000 + i % 2) {
+			t.Errorf("request #%v: expected 0x%04x, got: 0x%04x", i, 0x1000 + i % 2, reg)
+		}
+	}
+
+	// exception responses should be returned as is, without failing over
+	_, err	= c.ReadRegister(1, HOLDING_REGISTER)
+	if err == nil || pool.Stats()["tcp://localhost:5535"].Healthy != true {
+		t.Errorf("expected an exception response from a healthy client, got: %v", err)
+	}
+
+	// shut down the first server: requests should be routed to the second
+	// one without errors
+	servers[0].Stop()
+
+	for i := 0; i < 4; i++ {
+		reg, err	= c.ReadRegister(0, HOLDING_REGISTER)
+		if err != nil {
+			t.Fatalf("ReadRegister() should have succeeded, got: %v", err)
+		}
+		if reg != 0x1001 {
+			t.Errorf("expected 0x1001, got: 0x%04x", reg)
+		}
+	}
+
+	// the first client saw an exception response and a connection error
+	stats	= pool.Stats()
+	if stats["tcp://localhost:5535"].Healthy || stats["tcp://localhost:5535"].Errors != 2 {
+		t.Errorf("unexpected stats for the failed client: %+v", stats["tcp://localhost:5535"])
+	}
+	if !stats["tcp://localhost:5536"].Healthy || stats["tcp://localhost:5536"].Requests != 6 {
+		t.Errorf("unexpected stats for the healthy client: %+v", stats["tcp://localhost:5536"])
+	}
+
+	return
+}
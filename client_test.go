@@ -0,0 +1,906 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientConfigurationUnitId(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var th		*testHandler
+
+	// the unit id should default to 1
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5507",
+	})
+	if err != nil {
+		t.Errorf("failed to create client: %v", err)
+	}
+	if client.unitId != 1 {
+		t.Errorf("expected a default unit id of 1, got: %v", client.unitId)
+	}
+
+	th	= &testHandler{}
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5507",
+	}, th)
+	if err != nil {
+		t.Errorf("failed to create server: %v", err)
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Errorf("failed to start server: %v", err)
+	}
+
+	// the test handler only answers to unit id #9
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5507",
+		UnitId:	9,
+	})
+	if err != nil {
+		t.Errorf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Errorf("failed to open client: %v", err)
+	}
+
+	_, err	= client.ReadCoils(0, 2)
+	if err != nil {
+		t.Errorf("ReadCoils() should have succeeded, got: %v", err)
+	}
+
+	// SetUnitId() should override the configured unit id
+	client.SetUnitId(3)
+	_, err	= client.ReadCoils(0, 2)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("ReadCoils() should have returned ErrIllegalFunction, got: %v", err)
+	}
+
+	client.Close()
+	server.Stop()
+
+	return
+}
+
+func TestClientExplicitUnitIdDefault(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var uir		*unitIdRecorder
+	var err		error
+
+	uir	= &unitIdRecorder{DataStore: NewDataStore(4, 0, 4, 0)}
+	uir.SetCoil(0, true)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5581",
+	}, uir)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5581",
+		UnitId:	5,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	for _, tc := range []struct {
+		unitId		uint8
+		expected	uint8
+	}{
+		// unit id 0 should stand for the configured unit id...
+		{0, 5},
+		// ...while other unit ids override it
+		{3, 3},
+	} {
+		uir.unitIds	= nil
+
+		err	= client.ReadCoilsUntilTrue(context.Background(), tc.unitId, 0, time.Millisecond)
+		if err != nil {
+			t.Errorf("ReadCoilsUntilTrue() should have succeeded, got: %v", err)
+		}
+
+		_, err	= client.ReadHoldingRegistersRetry(context.Background(), tc.unitId, 0, 1, 0, 0)
+		if err != nil {
+			t.Errorf("ReadHoldingRegistersRetry() should have succeeded, got: %v", err)
+		}
+
+		err	= client.WriteRegisterBits(context.Background(), tc.unitId, 0, 0x000f, 0x0001)
+		if err != nil {
+			t.Errorf("WriteRegisterBits() should have succeeded, got: %v", err)
+		}
+
+		_, err	= client.ExecuteRaw(tc.unitId, FC_READ_HOLDING_REGISTERS, []byte{0x00, 0x00, 0x00, 0x01})
+		if err != nil {
+			t.Errorf("ExecuteRaw() should have succeeded, got: %v", err)
+		}
+
+		if len(uir.unitIds) < 4 {
+			t.Errorf("expected at least 4 requests, got: %v", uir.unitIds)
+		}
+		for _, unitId := range uir.unitIds {
+			if unitId != tc.expected {
+				t.Errorf("expected requests to unit id %v, got: %v", tc.expected, uir.unitIds)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func TestClientStrictEchoValidation(t *testing.T) {
+	var listener	net.Listener
+	var client	*ModbusClient
+	var err		error
+
+	// a mock server echoing back write requests to address 10 with the
+	// address incremented by one, and single coil writes to address 20 with
+	// a garbage value high byte (0x0100)
+	listener, err	= net.Listen("tcp", "localhost:5510")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		var sock	net.Conn
+		var tt		*tcpTransport
+		var req		*pdu
+		var err		error
+
+		for {
+			sock, err	= listener.Accept()
+			if err != nil {
+				return
+			}
+
+			tt	= newTCPTransport(sock, 1 * time.Second)
+			for {
+				req, err	= tt.ReadRequest()
+				if err != nil {
+					break
+				}
+
+				if req.payload[1] == 10 {
+					req.payload[1]++
+				} else {
+					req.payload[2]	= 0x01
+				}
+				err	= tt.WriteResponse(&pdu{
+					unitId:		req.unitId,
+					functionCode:	req.functionCode,
+					payload:	req.payload[0:4],
+				})
+				if err != nil {
+					break
+				}
+			}
+			tt.Close()
+		}
+	}()
+
+	for _, strict := range []bool{true, false} {
+		client, err	= NewClient(&ClientConfiguration{
+			URL:			"tcp://localhost:5510",
+			StrictEchoValidation:	strict,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		err	= client.Open()
+		if err != nil {
+			t.Fatalf("failed to open client: %v", err)
+		}
+
+		// mismatched addresses are always rejected
+		for _, write := range []func() error {
+			func() error { return client.WriteCoil(10, true) },
+			func() error { return client.WriteCoil(10, false) },
+			func() error { return client.WriteCoils(10, []bool{true, false, true}) },
+			func() error { return client.WriteRegister(10, 0x1234) },
+			func() error { return client.WriteRegisters(10, []uint16{1, 2}) },
+		} {
+			err	= write()
+			if err != ErrProtocolError {
+				t.Errorf("expected ErrProtocolError (strict: %v), got: %v", strict, err)
+			}
+		}
+
+		// garbage in the echoed value of coils turned off is only
+		// rejected in strict mode
+		err	= client.WriteCoil(20, false)
+		if strict && err != ErrProtocolError {
+			t.Errorf("expected ErrProtocolError in strict mode, got: %v", err)
+		}
+		if !strict && err != nil {
+			t.Errorf("expected no error in non-strict mode, got: %v", err)
+		}
+
+		client.Close()
+	}
+
+	return
+}
+
+func TestClientExceptionResponse(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var excErr	ErrExceptionResponse
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5513",
+	}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5513",
+		UnitId:	9,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// the test handler answers with an illegal data address exception
+	// past address 9
+	_, err	= client.ReadRegisters(20, 1, HOLDING_REGISTER)
+	if !errors.As(err, &excErr) {
+		t.Fatalf("expected an ErrExceptionResponse, got: %v", err)
+	}
+
+	if excErr.FunctionCode != FC_READ_HOLDING_REGISTERS {
+		t.Errorf("expected function code 0x03, got: 0x%02x", excErr.FunctionCode)
+	}
+
+	if excErr.ExceptionCode != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("expected exception code 0x02, got: 0x%02x", excErr.ExceptionCode)
+	}
+
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected the error to unwrap to ErrIllegalDataAddress")
+	}
+
+	if err.Error() != "modbus exception: FC=3 (ReadHoldingRegisters) " +
+			  "exception code=2 (IllegalDataAddress)" {
+		t.Errorf("unexpected error message: %q", err.Error())
+	}
+
+	// writes should carry their own function code
+	err	= client.WriteCoils(20, []bool{true})
+	if !errors.As(err, &excErr) || excErr.FunctionCode != FC_WRITE_MULTIPLE_COILS {
+		t.Errorf("expected an ErrExceptionResponse for FC15, got: %v", err)
+	}
+
+	return
+}
+
+func TestClientWriteRegisterBits(t *testing.T) {
+	var server	*ModbusServer
+	var ds		*DataStore
+	var client	*ModbusClient
+	var err		error
+	var reg		uint16
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	ds	= NewDataStore(0, 0, 4, 0)
+	err	= ds.SetHoldingRegister(0, 0xffff)
+	if err != nil {
+		t.Fatalf("SetHoldingRegister() should have succeeded, got: %v", err)
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5519",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:			"tcp://localhost:5519",
+		StrictEchoValidation:	true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// set bits 3:0 to 0b1010, leaving other bits untouched
+	err	= client.WriteRegisterBits(context.Background(), 1, 0, 0x000f, 0b1010)
+	if err != nil {
+		t.Errorf("WriteRegisterBits() should have succeeded, got: %v", err)
+	}
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 0xfffa {
+		t.Errorf("expected 0xfffa, got: 0x%04x", reg)
+	}
+
+	// bits outside of the mask should be ignored
+	err	= client.WriteRegisterBits(context.Background(), 1, 0, 0xff00, 0x12ff)
+	if err != nil {
+		t.Errorf("WriteRegisterBits() should have succeeded, got: %v", err)
+	}
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 0x12fa {
+		t.Errorf("expected 0x12fa, got: 0x%04x", reg)
+	}
+
+	// plain mask writes: (0x12fa AND 0xf0f0) OR (0x0505 AND NOT 0xf0f0)
+	err	= client.MaskWriteRegister(0, 0xf0f0, 0x0505)
+	if err != nil {
+		t.Errorf("MaskWriteRegister() should have succeeded, got: %v", err)
+	}
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 0x15f5 {
+		t.Errorf("expected 0x15f5, got: 0x%04x", reg)
+	}
+
+	// out of range addresses should be rejected by the server
+	err	= client.WriteRegisterBits(context.Background(), 1, 4, 0x0001, 0x0001)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// cancelled contexts should fail without sending the request
+	ctx, cancel	= context.WithCancel(context.Background())
+	cancel()
+	err	= client.WriteRegisterBits(ctx, 1, 0, 0xffff, 0x0000)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 0x15f5 {
+		t.Errorf("expected 0x15f5, got: 0x%04x", reg)
+	}
+
+	return
+}
+
+// writeOnlyLink is an rtuLink recording writes and panicking on reads.
+type writeOnlyLink struct {
+	writes	[][]byte
+}
+
+func (wol *writeOnlyLink) Close() (err error) {
+	return
+}
+
+func (wol *writeOnlyLink) Read(buf []byte) (n int, err error) {
+	panic("Read() should not have been called")
+}
+
+func (wol *writeOnlyLink) Write(buf []byte) (n int, err error) {
+	wol.writes	= append(wol.writes, append([]byte{}, buf...))
+	n		= len(buf)
+
+	return
+}
+
+func (wol *writeOnlyLink) SetDeadline(deadline time.Time) (err error) {
+	return
+}
+
+func TestClientBroadcast(t *testing.T) {
+	var client	*ModbusClient
+	var link	*writeOnlyLink
+	var err		error
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	link			= &writeOnlyLink{}
+	client.transport	= newRTUTransport(link, "", 19200, 100 * time.Millisecond)
+
+	// write single register 0x0001 = 0x1234 to all devices
+	err	= client.Broadcast(FC_WRITE_SINGLE_REGISTER, 0x00, []byte{0x00, 0x01, 0x12, 0x34})
+	if err != nil {
+		t.Errorf("Broadcast() should have succeeded, got: %v", err)
+	}
+
+	if len(link.writes) != 1 {
+		t.Fatalf("expected 1 write, got: %v", len(link.writes))
+	}
+
+	for i, b := range []byte{
+		0x00, 0x06,		// unit id and function code
+		0x00, 0x01, 0x12, 0x34,	// payload
+		0xd4, 0xac,		// CRC
+	} {
+		if i >= len(link.writes[0]) || link.writes[0][i] != b {
+			t.Fatalf("unexpected frame: 0x%x", link.writes[0])
+		}
+	}
+
+	// broadcasts are not supported over tcp
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:502",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Broadcast(FC_WRITE_SINGLE_REGISTER, 0x00, []byte{0x00, 0x01, 0x12, 0x34})
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
+
+// recordingDialer counts dial calls before passing them to a net.Dialer.
+type recordingDialer struct {
+	net.Dialer
+	lock		sync.Mutex
+	addrs		[]string
+}
+
+func (rd *recordingDialer) DialContext(ctx context.Context, network string, address string) (conn net.Conn, err error) {
+	rd.lock.Lock()
+	rd.addrs	= append(rd.addrs, address)
+	rd.lock.Unlock()
+
+	conn, err	= rd.Dialer.DialContext(ctx, network, address)
+
+	return
+}
+
+func TestNewTCPClientWithDialer(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ds		*DataStore
+	var rd		*recordingDialer
+	var err		error
+	var reg		uint16
+
+	ds	= NewDataStore(0, 0, 1, 0)
+	ds.SetHoldingRegister(0, 0x1234)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5527",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// serial clients don't dial
+	rd	= &recordingDialer{}
+	_, err	= NewTCPClientWithDialer(&ClientConfiguration{
+		URL:	"rtu:///dev/ttyUSB0",
+	}, rd)
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	client, err	= NewTCPClientWithDialer(&ClientConfiguration{
+		URL:	"tcp://localhost:5527",
+	}, rd)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// the dialer should be used once per connection
+	for i := 1; i <= 2; i++ {
+		err	= client.Open()
+		if err != nil {
+			t.Fatalf("failed to open client: %v", err)
+		}
+
+		reg, err	= client.ReadRegister(0, HOLDING_REGISTER)
+		if err != nil || reg != 0x1234 {
+			t.Errorf("expected 0x1234, got: 0x%04x, %v", reg, err)
+		}
+
+		client.Close()
+
+		if len(rd.addrs) != i || rd.addrs[i - 1] != "localhost:5527" {
+			t.Errorf("expected %v dial call(s) to localhost:5527, got: %v", i, rd.addrs)
+		}
+	}
+
+	return
+}
+
+// bufferLink is an rtuLink reading from rx and writing to tx.
+type bufferLink struct {
+	rx	bytes.Buffer
+	tx	bytes.Buffer
+}
+
+func (bl *bufferLink) Close() (err error) {
+	return
+}
+
+func (bl *bufferLink) Read(buf []byte) (n int, err error) {
+	n, err	= bl.rx.Read(buf)
+
+	return
+}
+
+func (bl *bufferLink) Write(buf []byte) (n int, err error) {
+	n, err	= bl.tx.Write(buf)
+
+	return
+}
+
+func (bl *bufferLink) SetDeadline(deadline time.Time) (err error) {
+	return
+}
+
+func TestNewRTUClientWithLink(t *testing.T) {
+	var client	*ModbusClient
+	var link	*bufferLink
+	var err		error
+	var regs	[]uint16
+
+	_, err	= NewRTUClientWithLink(nil, "mock", &ClientConfiguration{})
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	link	= &bufferLink{}
+	// response to a read of 2 holding registers from unit id 1
+	link.rx.Write([]byte{0x01, 0x03, 0x04, 0x12, 0x34, 0x56, 0x78, 0x81, 0x07})
+
+	client, err	= NewRTUClientWithLink(link, "mock", &ClientConfiguration{
+		Speed:		19200,
+		Timeout:	100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	regs, err	= client.ReadRegisters(0x64, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	if len(regs) != 2 || regs[0] != 0x1234 || regs[1] != 0x5678 {
+		t.Errorf("expected [0x1234, 0x5678], got: %v", regs)
+	}
+
+	if !bytes.Equal(link.tx.Bytes(), []byte{0x01, 0x03, 0x00, 0x64, 0x00, 0x02, 0x85, 0xd4}) {
+		t.Errorf("unexpected request frame: % x", link.tx.Bytes())
+	}
+
+	client.Close()
+
+	return
+}
+
+// busyHandler answers holding register reads with a server device busy
+// exception until busy reaches zero.
+type busyHandler struct {
+	testHandler
+	lock	sync.Mutex
+	busy	int
+	calls	int
+}
+
+func (bh *busyHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	bh.lock.Lock()
+	defer bh.lock.Unlock()
+
+	bh.calls++
+	if bh.busy > 0 {
+		bh.busy--
+		err	= ErrServerDeviceBusy
+		return
+	}
+
+	if addr == 99 {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	res	= []uint16{0x1234, 0x5678}[0:quantity]
+
+	return
+}
+
+func TestClientReadHoldingRegistersRetry(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var bh		*busyHandler
+	var err		error
+	var regs	[]uint16
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	bh	= &busyHandler{busy: 2}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5542",
+	}, bh)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5542",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// busy twice, then successful
+	regs, err	= client.ReadHoldingRegistersRetry(context.Background(), 1, 0, 2,
+							   5, 10 * time.Millisecond)
+	if err != nil || len(regs) != 2 || regs[0] != 0x1234 || regs[1] != 0x5678 {
+		t.Errorf("expected [0x1234 0x5678], got: %v, %v", regs, err)
+	}
+	if bh.calls != 3 {
+		t.Errorf("expected 3 calls, got: %v", bh.calls)
+	}
+
+	// other exceptions should not be retried
+	bh.calls	= 0
+	_, err	= client.ReadHoldingRegistersRetry(context.Background(), 1, 99, 1,
+						   5, 10 * time.Millisecond)
+	if !errors.Is(err, ErrIllegalDataAddress) || bh.calls != 1 {
+		t.Errorf("expected ErrIllegalDataAddress after 1 call, got: %v after %v calls",
+			 err, bh.calls)
+	}
+
+	// retries are bounded
+	bh.calls	= 0
+	bh.busy		= 10
+	_, err	= client.ReadHoldingRegistersRetry(context.Background(), 1, 0, 1,
+						   2, time.Millisecond)
+	if !errors.Is(err, ErrServerDeviceBusy) || bh.calls != 3 {
+		t.Errorf("expected ErrServerDeviceBusy after 3 calls, got: %v after %v calls",
+			 err, bh.calls)
+	}
+
+	// as is the time spent retrying
+	ctx, cancel	= context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	_, err	= client.ReadHoldingRegistersRetry(ctx, 1, 0, 1, 100, 20 * time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	return
+}
+
+func TestClientReadCoilsUntilTrue(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ds		*DataStore
+	var rl		*recordingLogger
+	var err		error
+	var start	time.Time
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	ds	= NewDataStore(4, 0, 0, 0)
+	rl	= &recordingLogger{}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5543",
+	}, NewRequestLogger(rl, ds))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5543",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// set the coil after three polling intervals
+	go func() {
+		time.Sleep(3 * 20 * time.Millisecond)
+		ds.SetCoil(2, true)
+	}()
+
+	start	= time.Now()
+	err	= client.ReadCoilsUntilTrue(context.Background(), 1, 2, 20 * time.Millisecond)
+	if err != nil {
+		t.Errorf("ReadCoilsUntilTrue() should have succeeded, got: %v", err)
+	}
+	if time.Since(start) < 60 * time.Millisecond || time.Since(start) > 500 * time.Millisecond {
+		t.Errorf("expected to return shortly after 60ms, took %v", time.Since(start))
+	}
+
+	// a done context should not cause any request
+	rl.lock.Lock()
+	rl.lines	= nil
+	rl.lock.Unlock()
+
+	ctx, cancel	= context.WithCancel(context.Background())
+	cancel()
+	err	= client.ReadCoilsUntilTrue(ctx, 1, 2, 20 * time.Millisecond)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+
+	// nor should a coil never set cause an endless wait
+	ctx, cancel	= context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	err	= client.ReadCoilsUntilTrue(ctx, 1, 3, 20 * time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	for _, line := range rl.lines {
+		if !strings.Contains(line, "addr=3") {
+			t.Errorf("unexpected request: %v", line)
+		}
+	}
+
+	return
+}
+
+func TestClientExecuteRaw(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var res		[]byte
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5566",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// vendor specific function code, answering with the unit id and payload
+	err	= server.RegisterFunctionHandler(0x65, func(unitId uint8, payload []byte) (res []byte, err error) {
+		if len(payload) == 0 {
+			err	= ErrIllegalDataValue
+			return
+		}
+
+		res	= append([]byte{unitId}, payload...)
+
+		return
+	})
+	if err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5566",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	res, err	= client.ExecuteRaw(7, 0x65, []byte{0xbe, 0xef})
+	if err != nil || !bytes.Equal(res, []byte{0x07, 0xbe, 0xef}) {
+		t.Errorf("unexpected response: % x (%v)", res, err)
+	}
+
+	// exceptions should be decoded
+	_, err	= client.ExecuteRaw(7, 0x65, nil)
+	if !errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("expected ErrIllegalDataValue, got: %v", err)
+	}
+
+	_, err	= client.ExecuteRaw(7, 0x66, nil)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	// standard function codes work too (read holding register 0)
+	res, err	= client.ExecuteRaw(1, FC_READ_HOLDING_REGISTERS, []byte{0x00, 0x00, 0x00, 0x01})
+	if err != nil || !bytes.Equal(res, []byte{0x02, 0x00, 0x00}) {
+		t.Errorf("unexpected response: % x (%v)", res, err)
+	}
+
+	_, err	= client.ExecuteRaw(1, 0x83, nil)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	return
+}
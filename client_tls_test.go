@@ -0,0 +1,113 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+func TestTCPTLSClient(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ca		tls.Certificate
+	var rogueCA	tls.Certificate
+	var serverCert	tls.Certificate
+	var clientCert	tls.Certificate
+	var pool	*x509.CertPool
+	var roguePool	*x509.CertPool
+	var reg		uint16
+	var err		error
+
+	ca		= newTestCert(t, "test-ca", true, nil)
+	rogueCA		= newTestCert(t, "rogue-ca", true, nil)
+	serverCert	= newTestCert(t, "localhost", false, &ca)
+	clientCert	= newTestCert(t, "scada-1", false, &ca)
+	pool		= x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	roguePool	= x509.NewCertPool()
+	roguePool.AddCert(rogueCA.Leaf)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp+tls://localhost:5555",
+		TLSServerCert:	&serverCert,
+		TLSClientCAs:	pool,
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	for _, tc := range []struct {
+		name		string
+		conf		ClientConfiguration
+		expectErr	bool
+	}{
+		{
+			name:		"valid certificates",
+			conf:		ClientConfiguration{
+				TLSClientCert:	&clientCert,
+				TLSRootCAs:	pool,
+			},
+		}, {
+			name:		"server name mismatch",
+			conf:		ClientConfiguration{
+				TLSClientCert:	&clientCert,
+				TLSRootCAs:	pool,
+				TLSServerName:	"plc-1.example.com",
+			},
+			expectErr:	true,
+		}, {
+			name:		"server name mismatch, hostname verification skipped",
+			conf:		ClientConfiguration{
+				TLSClientCert:			&clientCert,
+				TLSRootCAs:			pool,
+				TLSServerName:			"plc-1.example.com",
+				TLSSkipHostnameVerification:	true,
+			},
+		}, {
+			name:		"untrusted server, hostname verification skipped",
+			conf:		ClientConfiguration{
+				TLSClientCert:			&clientCert,
+				TLSRootCAs:			roguePool,
+				TLSSkipHostnameVerification:	true,
+			},
+			expectErr:	true,
+		}, {
+			name:		"no client certificate",
+			conf:		ClientConfiguration{
+				TLSRootCAs:	pool,
+			},
+			expectErr:	true,
+		},
+	} {
+		tc.conf.URL	= "tcp+tls://localhost:5555"
+
+		client, err	= NewClient(&tc.conf)
+		if err != nil {
+			t.Fatalf("%s: failed to create client: %v", tc.name, err)
+		}
+
+		// with TLS 1.3, client certificates are checked after the
+		// client handshake completes, hence errors may surface on the
+		// first request only
+		err	= client.Open()
+		if err == nil {
+			reg, err	= client.ReadRegister(0, HOLDING_REGISTER)
+			client.Close()
+		}
+
+		if tc.expectErr && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.expectErr && (err != nil || reg != 0) {
+			t.Errorf("%s: expected success, got: %v", tc.name, err)
+		}
+	}
+
+	return
+}
@@ -662,7 +662,7 @@ func performBoolScan(client *modbus.ModbusClient, isCoil bool) {
 		} else {
 			val, err	= client.ReadDiscreteInput(uint16(addr))
 		}
-		if err == modbus.ErrIllegalDataAddress || err == modbus.ErrIllegalFunction {
+		if errors.Is(err, modbus.ErrIllegalDataAddress) || errors.Is(err, modbus.ErrIllegalFunction) {
 			// the register does not exist
 			continue
 		} else if err != nil {
@@ -701,7 +701,7 @@ func performRegisterScan(client *modbus.ModbusClient, isHoldingReg bool) {
 		} else {
 			val, err	= client.ReadRegister(uint16(addr), modbus.INPUT_REGISTER)
 		}
-		if err == modbus.ErrIllegalDataAddress || err == modbus.ErrIllegalFunction {
+		if errors.Is(err, modbus.ErrIllegalDataAddress) || errors.Is(err, modbus.ErrIllegalFunction) {
 			// the register does not exist
 			continue
 		} else if err != nil {
@@ -0,0 +1,268 @@
+package modbus
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// maximum number of events held by a comm event log (function code 0x0c)
+	maxCommEvents			int	= 64
+
+	// comm event log entries: receive events have bit 7 set, send events
+	// bit 6
+	commEventReceive		byte	= 0x80
+	commEventReceiveBroadcast	byte	= 0x40
+	commEventSend			byte	= 0x40
+	commEventSendReadException	byte	= 0x01	// exception codes 1 to 3
+	commEventSendAbortException	byte	= 0x02	// exception code 4
+	commEventSendBusyException	byte	= 0x04	// exception codes 5 and 6
+)
+
+// CommEventLog holds the contents of the comm event log of a remote device,
+// as returned by GetCommEventLog().
+type CommEventLog struct {
+	// 0xffff if the device is busy processing a previous command,
+	// 0x0000 otherwise
+	Status		uint16
+	// number of requests successfully completed (see GetCommEventCounter())
+	EventCount	uint16
+	// number of requests received
+	MessageCount	uint16
+	// up to 64 event bytes, most recent first
+	Events		[]byte
+}
+
+// commEvents holds the comm event counters and log of a unit.
+type commEvents struct {
+	eventCount	uint16
+	messageCount	uint16
+	events		[]byte
+}
+
+// commEventTracker holds the comm event counters and logs of all units
+// served by a server, created on first use.
+type commEventTracker struct {
+	lock	sync.Mutex
+	units	map[uint8]*commEvents
+}
+
+// Returns the comm events of unitId, creating them if needed.
+// Must be called with cet.lock held.
+func (cet *commEventTracker) unit(unitId uint8) (ce *commEvents) {
+	var ok	bool
+
+	if cet.units == nil {
+		cet.units	= make(map[uint8]*commEvents)
+	}
+
+	ce, ok	= cet.units[unitId]
+	if !ok {
+		ce			= &commEvents{}
+		cet.units[unitId]	= ce
+	}
+
+	return
+}
+
+// Logs the receipt of a request to unitId.
+func (cet *commEventTracker) recordReceive(unitId uint8, broadcast bool) {
+	var ce		*commEvents
+	var event	byte
+
+	event	= commEventReceive
+	if broadcast {
+		event	|= commEventReceiveBroadcast
+	}
+
+	cet.lock.Lock()
+	defer cet.lock.Unlock()
+
+	ce	= cet.unit(unitId)
+	ce.messageCount++
+	ce.log(event)
+
+	return
+}
+
+// Logs the response sent to a request (if any), counting successfully
+// completed requests other than comm event fetches.
+func (cet *commEventTracker) recordCompletion(req *pdu, res *pdu, sent bool) {
+	var ce		*commEvents
+	var event	byte
+
+	event	= commEventSend
+	if res.functionCode & 0x80 != 0 && len(res.payload) == 1 {
+		switch res.payload[0] {
+		case EX_ILLEGAL_FUNCTION, EX_ILLEGAL_DATA_ADDRESS, EX_ILLEGAL_DATA_VALUE:
+			event	|= commEventSendReadException
+		case EX_SERVER_DEVICE_FAILURE:
+			event	|= commEventSendAbortException
+		case EX_ACKNOWLEDGE, EX_SERVER_DEVICE_BUSY:
+			event	|= commEventSendBusyException
+		}
+	}
+
+	cet.lock.Lock()
+	defer cet.lock.Unlock()
+
+	ce	= cet.unit(req.unitId)
+	if sent {
+		ce.log(event)
+	}
+
+	if res.functionCode & 0x80 == 0 &&
+	   req.functionCode != FC_GET_COMM_EVENT_COUNTER &&
+	   req.functionCode != FC_GET_COMM_EVENT_LOG {
+		ce.eventCount++
+	}
+
+	return
+}
+
+// Adds an event to the log, dropping the oldest one if the log is full.
+func (ce *commEvents) log(event byte) {
+	ce.events	= append([]byte{event}, ce.events...)
+	if len(ce.events) > maxCommEvents {
+		ce.events	= ce.events[:maxCommEvents]
+	}
+
+	return
+}
+
+// Reads the comm event counter of the remote device (function code 0x0b),
+// incremented for every successfully completed request (exception responses
+// and comm event fetches excluded).
+func (mc *ModbusClient) GetCommEventCounter() (status uint16, eventCount uint16, err error) {
+	status, eventCount, err	= mc.GetCommEventCounterContext(context.Background())
+
+	return
+}
+
+// Same as GetCommEventCounter(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) GetCommEventCounterContext(ctx context.Context) (status uint16, eventCount uint16, err error) {
+	var res		*pdu
+
+	res, err	= mc.executeCommEventRequest(ctx, FC_GET_COMM_EVENT_COUNTER)
+	if err != nil {
+		return
+	}
+
+	if len(res.payload) != 4 {
+		err	= ErrProtocolError
+		return
+	}
+
+	status		= bytesToUint16(BIG_ENDIAN, res.payload[0:2])
+	eventCount	= bytesToUint16(BIG_ENDIAN, res.payload[2:4])
+
+	return
+}
+
+// Reads the comm event log of the remote device (function code 0x0c).
+func (mc *ModbusClient) GetCommEventLog() (log *CommEventLog, err error) {
+	log, err	= mc.GetCommEventLogContext(context.Background())
+
+	return
+}
+
+// Same as GetCommEventLog(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) GetCommEventLogContext(ctx context.Context) (log *CommEventLog, err error) {
+	var res		*pdu
+
+	res, err	= mc.executeCommEventRequest(ctx, FC_GET_COMM_EVENT_LOG)
+	if err != nil {
+		return
+	}
+
+	// byte count, status, event count and message count fields, followed
+	// by up to 64 events
+	if len(res.payload) < 7 || int(res.payload[0]) != len(res.payload) - 1 ||
+	   len(res.payload) - 7 > maxCommEvents {
+		err	= ErrProtocolError
+		return
+	}
+
+	log	= &CommEventLog{
+		Status:		bytesToUint16(BIG_ENDIAN, res.payload[1:3]),
+		EventCount:	bytesToUint16(BIG_ENDIAN, res.payload[3:5]),
+		MessageCount:	bytesToUint16(BIG_ENDIAN, res.payload[5:7]),
+		Events:		append([]byte{}, res.payload[7:]...),
+	}
+
+	return
+}
+
+// Sends a comm event counter or log request, without payload, and returns
+// the response if it is not an exception.
+func (mc *ModbusClient) executeCommEventRequest(ctx context.Context, functionCode uint8) (res *pdu, err error) {
+	var req		*pdu
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	functionCode,
+	}
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+		} else {
+			err	= newExceptionResponseError(req.functionCode, res.payload[0])
+		}
+		res	= nil
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+		res	= nil
+	}
+
+	return
+}
+
+// Handles get comm event counter and get comm event log requests.
+func (ms *ModbusServer) processCommEvents(req *pdu) (res *pdu, err error) {
+	var ce	*commEvents
+
+	if len(req.payload) != 0 {
+		err	= ErrProtocolError
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+	}
+
+	ms.commEvents.lock.Lock()
+	defer ms.commEvents.lock.Unlock()
+
+	ce	= ms.commEvents.unit(req.unitId)
+
+	if req.functionCode == FC_GET_COMM_EVENT_LOG {
+		// byte count (status, event count, message count and events)
+		res.payload	= []byte{uint8(6 + len(ce.events))}
+	}
+
+	// status (never busy) and event count
+	res.payload	= append(res.payload, 0x00, 0x00)
+	res.payload	= append(res.payload, uint16ToBytes(BIG_ENDIAN, ce.eventCount)...)
+
+	if req.functionCode == FC_GET_COMM_EVENT_LOG {
+		res.payload	= append(res.payload, uint16ToBytes(BIG_ENDIAN, ce.messageCount)...)
+		res.payload	= append(res.payload, ce.events...)
+	}
+
+	return
+}
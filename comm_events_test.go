@@ -0,0 +1,154 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCommEventCounterAndLog(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var client	*ModbusClient
+	var p1, p2	net.Conn
+	var status	uint16
+	var eventCount	uint16
+	var log		*CommEventLog
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5563",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5563",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// one successful request and one answered with an exception
+	_, err	= client.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("failed to read registers: %v", err)
+	}
+
+	_, err	= client.ReadRegisters(9, 2, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// only the successful request should be counted
+	status, eventCount, err	= client.GetCommEventCounter()
+	if err != nil || status != 0x0000 || eventCount != 1 {
+		t.Errorf("expected status 0x0000 and 1 event, got: 0x%04x, %v (%v)",
+			 status, eventCount, err)
+	}
+
+	// comm event fetches are not counted either, but are logged
+	log, err	= client.GetCommEventLog()
+	if err != nil {
+		t.Fatalf("failed to get comm event log: %v", err)
+	}
+
+	if log.Status != 0x0000 || log.EventCount != 1 || log.MessageCount != 4 {
+		t.Errorf("unexpected log counters: %+v", log)
+	}
+
+	if len(log.Events) != 7 ||
+	   log.Events[0] != 0x80 || log.Events[1] != 0x40 || log.Events[2] != 0x80 ||
+	   log.Events[3] != 0x41 || log.Events[4] != 0x80 || log.Events[5] != 0x40 ||
+	   log.Events[6] != 0x80 {
+		t.Errorf("unexpected events: % x", log.Events)
+	}
+
+	// counters are kept per unit
+	client.SetUnitId(2)
+	_, eventCount, err	= client.GetCommEventCounter()
+	if err != nil || eventCount != 0 {
+		t.Errorf("expected 0 events, got: %v (%v)", eventCount, err)
+	}
+
+	// over RTU
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	err	= client.WriteRegister(3, 0x1234)
+	if err != nil {
+		t.Fatalf("failed to write register: %v", err)
+	}
+
+	_, eventCount, err	= client.GetCommEventCounter()
+	if err != nil || eventCount != 1 {
+		t.Errorf("expected 1 event, got: %v (%v)", eventCount, err)
+	}
+
+	log, err	= client.GetCommEventLog()
+	if err != nil || log.EventCount != 1 || log.MessageCount != 3 || len(log.Events) != 5 {
+		t.Errorf("unexpected log: %+v (%v)", log, err)
+	}
+
+	return
+}
+
+func TestCommEventLogLength(t *testing.T) {
+	var cet	commEventTracker
+	var req	*pdu
+	var res	*pdu
+
+	req	= &pdu{unitId: 1, functionCode: FC_READ_COILS}
+	res	= &pdu{unitId: 1, functionCode: FC_READ_COILS | 0x80, payload: []byte{EX_SERVER_DEVICE_BUSY}}
+
+	for i := 0; i < 40; i++ {
+		cet.recordReceive(1, false)
+		cet.recordCompletion(req, res, true)
+	}
+
+	// the log should be capped, exception responses should not be counted
+	if len(cet.units[1].events) != maxCommEvents {
+		t.Errorf("expected %v events, got: %v", maxCommEvents, len(cet.units[1].events))
+	}
+
+	if cet.units[1].events[0] != 0x44 || cet.units[1].events[1] != 0x80 {
+		t.Errorf("unexpected events: % x", cet.units[1].events[0:2])
+	}
+
+	if cet.units[1].eventCount != 0 || cet.units[1].messageCount != 40 {
+		t.Errorf("unexpected counters: %v, %v",
+			 cet.units[1].eventCount, cet.units[1].messageCount)
+	}
+
+	return
+}
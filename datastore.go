@@ -0,0 +1,802 @@
+package modbus
+
+import (
+	"sync"
+	"time"
+)
+
+type DataObjectType uint
+const (
+	COILS			DataObjectType	= 1
+	DISCRETE_INPUTS		DataObjectType	= 2
+	HOLDING_REGISTERS	DataObjectType	= 3
+	INPUT_REGISTERS		DataObjectType	= 4
+)
+
+// UnlockFunc releases a lock acquired with DataStore.Lock().
+type UnlockFunc func()
+
+// DataStore is a RequestHandler backed by in-memory coils, discrete inputs,
+// holding and input registers, answering requests to any unit id.
+// Values can be accessed from the application side with the Get/Set
+// methods, concurrently with client requests.
+type DataStore struct {
+	lock			sync.RWMutex
+	coils			[]bool
+	discreteInputs		[]bool
+	holdingRegisters	[]uint16
+	inputRegisters		[]uint16
+
+	// per-address locks (see Lock()), created lazily
+	addrLocksLock		sync.Mutex
+	addrLocks		map[addrLockKey]*sync.RWMutex
+
+	// if set, invoked with ds.lock held before any change is applied
+	// (see PersistentDataStore)
+	persist			func(DataObjectType, uint16, []uint16) error
+
+	// change subscriptions (see Subscribe()), guarded by lock
+	subscriptions		[]*subscription
+	logger			*logger
+
+	// request validator (see WithValidator()), guarded by lock
+	validator		ValidatorFunc
+
+	// named values (see NewDataStoreWithPresets()), immutable
+	addressMap		RegisterAddressMap
+
+	// per-address access counters (see GetStats()), accessed atomically
+	readCounts		map[DataObjectType][]uint64
+	writeCounts		map[DataObjectType][]uint64
+}
+
+// ValidatorFunc validates client accesses to a DataStore (see WithValidator()).
+// newVal is either a bool (coils and discrete inputs) or an uint16 (holding
+// and input registers).
+type ValidatorFunc func(dataType DataObjectType, addr uint16, isWrite bool, newVal interface{}) error
+
+type addrLockKey struct {
+	dataType	DataObjectType
+	addr		uint16
+}
+
+// Returns a new data store holding the given number of coils, discrete inputs,
+// holding and input registers, all starting at address 0 and initialized to
+// zero/false.
+func NewDataStore(coils uint16, discreteInputs uint16,
+		  holdingRegisters uint16, inputRegisters uint16) (ds *DataStore) {
+	ds = newDataStore(int(coils), int(discreteInputs),
+			  int(holdingRegisters), int(inputRegisters))
+
+	return
+}
+
+func newDataStore(coils int, discreteInputs int,
+		  holdingRegisters int, inputRegisters int) (ds *DataStore) {
+	ds = &DataStore{
+		coils:			make([]bool, coils),
+		discreteInputs:		make([]bool, discreteInputs),
+		holdingRegisters:	make([]uint16, holdingRegisters),
+		inputRegisters:		make([]uint16, inputRegisters),
+		addrLocks:		make(map[addrLockKey]*sync.RWMutex),
+		addressMap:		make(RegisterAddressMap),
+		logger:			newLogger("modbus-datastore"),
+		readCounts:		map[DataObjectType][]uint64{
+			COILS:			make([]uint64, coils),
+			DISCRETE_INPUTS:	make([]uint64, discreteInputs),
+			HOLDING_REGISTERS:	make([]uint64, holdingRegisters),
+			INPUT_REGISTERS:	make([]uint64, inputRegisters),
+		},
+		writeCounts:		map[DataObjectType][]uint64{
+			COILS:			make([]uint64, coils),
+			HOLDING_REGISTERS:	make([]uint64, holdingRegisters),
+		},
+	}
+
+	return
+}
+
+func (ds *DataStore) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var unlock	UnlockFunc
+
+	if !inRange(addr, quantity, len(ds.coils)) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	// wait for addresses locked with Lock()
+	unlock	= ds.lockRange(COILS, addr, quantity, isWrite)
+	defer unlock()
+
+	if isWrite {
+		ds.lock.Lock()
+		defer ds.lock.Unlock()
+	} else {
+		ds.lock.RLock()
+		defer ds.lock.RUnlock()
+	}
+
+	if isWrite {
+		err	= ds.validateBools(COILS, addr, true, args)
+		if err != nil {
+			return
+		}
+
+		err	= ds.writeBools(COILS, addr, args)
+		if err != nil {
+			err	= ErrServerDeviceFailure
+			return
+		}
+	} else {
+		err	= ds.validateBools(COILS, addr, false, ds.coils[addr:addr + quantity])
+		if err != nil {
+			return
+		}
+	}
+
+	ds.countAccess(COILS, addr, quantity, isWrite)
+
+	res	= make([]bool, quantity)
+	copy(res, ds.coils[addr:])
+
+	return
+}
+
+func (ds *DataStore) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	var unlock	UnlockFunc
+
+	if !inRange(addr, quantity, len(ds.discreteInputs)) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	// wait for addresses locked with Lock()
+	unlock	= ds.lockRange(DISCRETE_INPUTS, addr, quantity, false)
+	defer unlock()
+
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	err	= ds.validateBools(DISCRETE_INPUTS, addr, false,
+				   ds.discreteInputs[addr:addr + quantity])
+	if err != nil {
+		return
+	}
+
+	ds.countAccess(DISCRETE_INPUTS, addr, quantity, false)
+
+	res	= make([]bool, quantity)
+	copy(res, ds.discreteInputs[addr:])
+
+	return
+}
+
+func (ds *DataStore) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var unlock	UnlockFunc
+
+	if !inRange(addr, quantity, len(ds.holdingRegisters)) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	// wait for addresses locked with Lock()
+	unlock	= ds.lockRange(HOLDING_REGISTERS, addr, quantity, isWrite)
+	defer unlock()
+
+	if isWrite {
+		ds.lock.Lock()
+		defer ds.lock.Unlock()
+	} else {
+		ds.lock.RLock()
+		defer ds.lock.RUnlock()
+	}
+
+	if isWrite {
+		err	= ds.validateRegisters(HOLDING_REGISTERS, addr, true, args)
+		if err != nil {
+			return
+		}
+
+		err	= ds.writeRegisters(HOLDING_REGISTERS, addr, args)
+		if err != nil {
+			err	= ErrServerDeviceFailure
+			return
+		}
+	} else {
+		err	= ds.validateRegisters(HOLDING_REGISTERS, addr, false,
+					       ds.holdingRegisters[addr:addr + quantity])
+		if err != nil {
+			return
+		}
+	}
+
+	ds.countAccess(HOLDING_REGISTERS, addr, quantity, isWrite)
+
+	res	= make([]uint16, quantity)
+	copy(res, ds.holdingRegisters[addr:])
+
+	return
+}
+
+func (ds *DataStore) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	var unlock	UnlockFunc
+
+	if !inRange(addr, quantity, len(ds.inputRegisters)) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	// wait for addresses locked with Lock()
+	unlock	= ds.lockRange(INPUT_REGISTERS, addr, quantity, false)
+	defer unlock()
+
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	err	= ds.validateRegisters(INPUT_REGISTERS, addr, false,
+				       ds.inputRegisters[addr:addr + quantity])
+	if err != nil {
+		return
+	}
+
+	ds.countAccess(INPUT_REGISTERS, addr, quantity, false)
+
+	res	= make([]uint16, quantity)
+	copy(res, ds.inputRegisters[addr:])
+
+	return
+}
+
+// Sets fn as validator of client requests: before a write request is applied,
+// fn is called for each address with isWrite set and newVal set to the value
+// to be written. Reads are validated likewise, with newVal set to the current
+// value.
+// If fn returns an error for any address, the whole request is rejected:
+// modbus errors (e.g. ErrIllegalDataAddress) are returned to the client as
+// is, other errors as an illegal data value exception.
+// fn is called with the data store locked, hence must not call its methods.
+// Application-side Get and Set methods are not validated.
+// Returns ds, and removes any validator if fn is nil.
+func (ds *DataStore) WithValidator(fn ValidatorFunc) (self *DataStore) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	ds.validator	= fn
+	self		= ds
+
+	return
+}
+
+// Returns the value of a coil.
+func (ds *DataStore) GetCoil(addr uint16) (value bool, err error) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	if int(addr) >= len(ds.coils) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.coils[addr]
+
+	return
+}
+
+// Sets the value of a coil.
+func (ds *DataStore) SetCoil(addr uint16, value bool) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.coils) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	err	= ds.writeBools(COILS, addr, []bool{value})
+
+	return
+}
+
+// Returns the value of a discrete input.
+func (ds *DataStore) GetDiscreteInput(addr uint16) (value bool, err error) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	if int(addr) >= len(ds.discreteInputs) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.discreteInputs[addr]
+
+	return
+}
+
+// Sets the value of a discrete input.
+func (ds *DataStore) SetDiscreteInput(addr uint16, value bool) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.discreteInputs) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	err	= ds.writeBools(DISCRETE_INPUTS, addr, []bool{value})
+
+	return
+}
+
+// Returns the value of a holding register.
+func (ds *DataStore) GetHoldingRegister(addr uint16) (value uint16, err error) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	if int(addr) >= len(ds.holdingRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.holdingRegisters[addr]
+
+	return
+}
+
+// Sets the value of a holding register.
+func (ds *DataStore) SetHoldingRegister(addr uint16, value uint16) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.holdingRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	err	= ds.writeRegisters(HOLDING_REGISTERS, addr, []uint16{value})
+
+	return
+}
+
+// Returns the value of an input register.
+func (ds *DataStore) GetInputRegister(addr uint16) (value uint16, err error) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	if int(addr) >= len(ds.inputRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.inputRegisters[addr]
+
+	return
+}
+
+// Sets the value of an input register.
+func (ds *DataStore) SetInputRegister(addr uint16, value uint16) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.inputRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	err	= ds.writeRegisters(INPUT_REGISTERS, addr, []uint16{value})
+
+	return
+}
+
+// Returns the value of a holding register and clears it, atomically
+// (e.g. to read and reset a pulse counter without missing concurrent
+// updates).
+func (ds *DataStore) ReadAndClearRegister(addr uint16) (value uint16, err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.holdingRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.holdingRegisters[addr]
+	err	= ds.writeRegisters(HOLDING_REGISTERS, addr, []uint16{0})
+	if err != nil {
+		value	= 0
+		return
+	}
+
+	return
+}
+
+// Sets a holding register to newVal if it currently holds expected, atomically
+// with respect to request handlers and other Get/Set methods.
+// Returns true if the register was written, false if it held another value.
+func (ds *DataStore) CompareAndSwapRegister(addr uint16, expected uint16, newVal uint16) (swapped bool, err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.holdingRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	if ds.holdingRegisters[addr] != expected {
+		return
+	}
+
+	err	= ds.writeRegisters(HOLDING_REGISTERS, addr, []uint16{newVal})
+	if err != nil {
+		return
+	}
+	swapped	= true
+
+	return
+}
+
+// Adds delta to a holding register, wrapping around on overflow (as pulse
+// and energy counters do), atomically with respect to request handlers and
+// other Get/Set methods. Returns the new value of the register.
+func (ds *DataStore) Increment(addr uint16, delta int16) (value uint16, err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.holdingRegisters) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= ds.holdingRegisters[addr] + uint16(delta)
+	err	= ds.writeRegisters(HOLDING_REGISTERS, addr, []uint16{value})
+	if err != nil {
+		value	= 0
+		return
+	}
+
+	return
+}
+
+// Toggles a coil, atomically with respect to request handlers and other
+// Get/Set methods. Returns the new value of the coil.
+func (ds *DataStore) IncrementCoil(addr uint16) (value bool, err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if int(addr) >= len(ds.coils) {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	value	= !ds.coils[addr]
+	err	= ds.writeBools(COILS, addr, []bool{value})
+	if err != nil {
+		value	= false
+		return
+	}
+
+	return
+}
+
+// Clears multiple holding registers at once.
+// Either all or none of the registers are cleared: if any address is out of
+// range, ErrIllegalDataAddress is returned and no register is modified.
+func (ds *DataStore) ResetCounters(addrs []uint16) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	for _, addr := range addrs {
+		if int(addr) >= len(ds.holdingRegisters) {
+			err	= ErrIllegalDataAddress
+			return
+		}
+	}
+
+	for _, addr := range addrs {
+		err	= ds.writeRegisters(HOLDING_REGISTERS, addr, []uint16{0})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Copies count values of srcType starting at srcStart to dstType starting at
+// dstStart, atomically with respect to request handlers and Get methods.
+// Registers can only be copied to registers (holding or input) and coils or
+// discrete inputs to coils or discrete inputs: values are copied as is, with
+// no conversion. Overlapping ranges are supported.
+// Returns ErrIllegalDataAddress if either range is out of bounds, in which
+// case no value is modified.
+func (ds *DataStore) CopyRange(srcType DataObjectType, dstType DataObjectType,
+			       srcStart uint16, dstStart uint16, count uint16) (err error) {
+	var srcEnd	int
+	var dstEnd	int
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	srcEnd	= int(srcStart) + int(count)
+	dstEnd	= int(dstStart) + int(count)
+
+	switch {
+	case isBoolType(srcType) && isBoolType(dstType):
+		var src	= ds.boolTable(srcType)
+
+		if srcEnd > len(src) || dstEnd > len(ds.boolTable(dstType)) {
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		err	= ds.writeBools(dstType, dstStart,
+					append([]bool{}, src[srcStart:srcEnd]...))
+
+	case isRegisterType(srcType) && isRegisterType(dstType):
+		var src	= ds.registerTable(srcType)
+
+		if srcEnd > len(src) || dstEnd > len(ds.registerTable(dstType)) {
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		err	= ds.writeRegisters(dstType, dstStart,
+					    append([]uint16{}, src[srcStart:srcEnd]...))
+
+	default:
+		err	= ErrUnexpectedParameters
+	}
+
+	return
+}
+
+// Returns true if dataType is COILS or DISCRETE_INPUTS.
+func isBoolType(dataType DataObjectType) (ok bool) {
+	ok	= dataType == COILS || dataType == DISCRETE_INPUTS
+
+	return
+}
+
+// Returns true if dataType is HOLDING_REGISTERS or INPUT_REGISTERS.
+func isRegisterType(dataType DataObjectType) (ok bool) {
+	ok	= dataType == HOLDING_REGISTERS || dataType == INPUT_REGISTERS
+
+	return
+}
+
+// Returns the coil or discrete input table.
+func (ds *DataStore) boolTable(dataType DataObjectType) (table []bool) {
+	if dataType == DISCRETE_INPUTS {
+		table	= ds.discreteInputs
+	} else {
+		table	= ds.coils
+	}
+
+	return
+}
+
+// Returns the holding or input register table.
+func (ds *DataStore) registerTable(dataType DataObjectType) (table []uint16) {
+	if dataType == INPUT_REGISTERS {
+		table	= ds.inputRegisters
+	} else {
+		table	= ds.holdingRegisters
+	}
+
+	return
+}
+
+// Locks a single address, either for reading (shared) or writing (exclusive),
+// preventing request handlers from respectively writing or accessing it until
+// the returned unlock function is called.
+// This allows updating a group of related values without request handlers
+// observing intermediate states, using the Get/Set methods (which do not
+// wait for address locks) while holding the locks.
+// Request handlers lock addresses in ascending order: applications locking
+// several addresses should do the same to avoid deadlocks.
+func (ds *DataStore) Lock(addr uint16, dataType DataObjectType, exclusive bool) (unlock UnlockFunc, err error) {
+	var size	int
+
+	switch dataType {
+	case COILS:		size = len(ds.coils)
+	case DISCRETE_INPUTS:	size = len(ds.discreteInputs)
+	case HOLDING_REGISTERS:	size = len(ds.holdingRegisters)
+	case INPUT_REGISTERS:	size = len(ds.inputRegisters)
+	default:
+		err	= ErrUnexpectedParameters
+		return
+	}
+
+	if int(addr) >= size {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	unlock	= ds.lockRange(dataType, addr, 1, exclusive)
+
+	return
+}
+
+// Locks quantity addresses starting at addr, in ascending order, and returns
+// a function releasing them (safe to call more than once).
+func (ds *DataStore) lockRange(dataType DataObjectType, addr uint16, quantity uint16, exclusive bool) (unlock UnlockFunc) {
+	var locks	[]*sync.RWMutex
+	var once	sync.Once
+
+	locks	= make([]*sync.RWMutex, quantity)
+	for i := range locks {
+		locks[i]	= ds.addrLock(dataType, addr + uint16(i))
+		if exclusive {
+			locks[i].Lock()
+		} else {
+			locks[i].RLock()
+		}
+	}
+
+	unlock	= func() {
+		once.Do(func() {
+			for i := len(locks) - 1; i >= 0; i-- {
+				if exclusive {
+					locks[i].Unlock()
+				} else {
+					locks[i].RUnlock()
+				}
+			}
+		})
+	}
+
+	return
+}
+
+// Returns the lock of an address, creating it if needed.
+func (ds *DataStore) addrLock(dataType DataObjectType, addr uint16) (l *sync.RWMutex) {
+	var key	addrLockKey
+
+	key	= addrLockKey{dataType: dataType, addr: addr}
+
+	ds.addrLocksLock.Lock()
+	defer ds.addrLocksLock.Unlock()
+
+	l	= ds.addrLocks[key]
+	if l == nil {
+		l			= &sync.RWMutex{}
+		ds.addrLocks[key]	= l
+	}
+
+	return
+}
+
+// Writes values to a register table, starting at addr.
+// Changes are passed to the persist hook (if any) first, then applied and
+// notified to subscribers.
+// Must be called with ds.lock held.
+func (ds *DataStore) writeRegisters(dataType DataObjectType, addr uint16, values []uint16) (err error) {
+	var table	[]uint16
+	var now		time.Time
+
+	if ds.persist != nil {
+		err	= ds.persist(dataType, addr, values)
+		if err != nil {
+			return
+		}
+	}
+
+	if dataType == INPUT_REGISTERS {
+		table	= ds.inputRegisters
+	} else {
+		table	= ds.holdingRegisters
+	}
+
+	now	= time.Now()
+	for i, value := range values {
+		ds.notify(ChangeEvent{
+			DataType:	dataType,
+			Addr:		addr + uint16(i),
+			OldVal:		table[int(addr) + i],
+			NewVal:		value,
+			Timestamp:	now,
+		})
+		table[int(addr) + i]	= value
+	}
+
+	return
+}
+
+// Writes values to a coil or discrete input table, starting at addr
+// (see writeRegisters()).
+// Must be called with ds.lock held.
+func (ds *DataStore) writeBools(dataType DataObjectType, addr uint16, values []bool) (err error) {
+	var table	[]bool
+	var regs	[]uint16
+	var now		time.Time
+
+	if ds.persist != nil {
+		regs	= make([]uint16, len(values))
+		for i := range values {
+			if values[i] {
+				regs[i]	= 1
+			}
+		}
+
+		err	= ds.persist(dataType, addr, regs)
+		if err != nil {
+			return
+		}
+	}
+
+	if dataType == DISCRETE_INPUTS {
+		table	= ds.discreteInputs
+	} else {
+		table	= ds.coils
+	}
+
+	now	= time.Now()
+	for i, value := range values {
+		ds.notify(ChangeEvent{
+			DataType:	dataType,
+			Addr:		addr + uint16(i),
+			OldVal:		table[int(addr) + i],
+			NewVal:		value,
+			Timestamp:	now,
+		})
+		table[int(addr) + i]	= value
+	}
+
+	return
+}
+
+// Runs the validator (if any) on values, starting at addr.
+// Must be called with ds.lock held.
+func (ds *DataStore) validateBools(dataType DataObjectType, addr uint16, isWrite bool, values []bool) (err error) {
+	if ds.validator == nil {
+		return
+	}
+
+	for i := range values {
+		err	= ds.validator(dataType, addr + uint16(i), isWrite, values[i])
+		if err != nil {
+			err	= mapValidatorError(err)
+			return
+		}
+	}
+
+	return
+}
+
+// Runs the validator (if any) on values, starting at addr.
+// Must be called with ds.lock held.
+func (ds *DataStore) validateRegisters(dataType DataObjectType, addr uint16, isWrite bool, values []uint16) (err error) {
+	if ds.validator == nil {
+		return
+	}
+
+	for i := range values {
+		err	= ds.validator(dataType, addr + uint16(i), isWrite, values[i])
+		if err != nil {
+			err	= mapValidatorError(err)
+			return
+		}
+	}
+
+	return
+}
+
+// Returns err if it maps to a modbus exception code, ErrIllegalDataValue
+// otherwise.
+func mapValidatorError(err error) (mapped error) {
+	if err == ErrServerDeviceFailure ||
+	   mapErrorToExceptionCode(err) != EX_SERVER_DEVICE_FAILURE {
+		mapped	= err
+	} else {
+		mapped	= ErrIllegalDataValue
+	}
+
+	return
+}
+
+// Returns true if quantity items starting at addr fit in a table of size
+// items.
+func inRange(addr uint16, quantity uint16, size int) (ok bool) {
+	ok	= int(addr) + int(quantity) <= size
+
+	return
+}
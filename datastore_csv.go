@@ -0,0 +1,211 @@
+package modbus
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// csvRecord is a value parsed from a CSV file (see ImportCSV()).
+type csvRecord struct {
+	dataType	DataObjectType
+	addr		uint16
+	value		uint16
+	line		int
+}
+
+// Writes all values of the data store to w as CSV, one value per line with
+// address, table (see NewDataStoreFromFile()) and value columns, preceded
+// by a header line, e.g.
+//   address,type,value
+//   0,coils,1
+//   0,holdingRegisters,4660
+// Coils and discrete inputs are written as 0 or 1, registers as unsigned
+// decimal integers. Values are taken atomically with respect to request
+// handlers and Set methods.
+// Values read from a live device (e.g. with ModbusClient.ReadRegisters())
+// can be dumped by setting them on a data store of matching size first.
+func (ds *DataStore) ExportCSV(w io.Writer) (err error) {
+	var snapshot	DataSnapshot
+	var cw		*csv.Writer
+	var bit		string
+
+	snapshot	= ds.GetAll()
+	cw		= csv.NewWriter(w)
+
+	err	= cw.Write([]string{"address", "type", "value"})
+	if err != nil {
+		return
+	}
+
+	for _, table := range []struct {
+		dataType	DataObjectType
+		values		[]bool
+	}{
+		{COILS, snapshot.Coils},
+		{DISCRETE_INPUTS, snapshot.DiscreteInputs},
+	} {
+		for addr, value := range table.values {
+			bit	= "0"
+			if value {
+				bit	= "1"
+			}
+
+			err	= cw.Write([]string{
+				strconv.Itoa(addr), tableName(table.dataType), bit,
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for _, table := range []struct {
+		dataType	DataObjectType
+		values		[]uint16
+	}{
+		{HOLDING_REGISTERS, snapshot.HoldingRegisters},
+		{INPUT_REGISTERS, snapshot.InputRegisters},
+	} {
+		for addr, value := range table.values {
+			err	= cw.Write([]string{
+				strconv.Itoa(addr), tableName(table.dataType),
+				strconv.Itoa(int(value)),
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	cw.Flush()
+	err	= cw.Error()
+
+	return
+}
+
+// Reads values from CSV data in the format written by ExportCSV() and sets
+// them on the data store, atomically with respect to request handlers and
+// Get methods. The header line is optional, and lines may come in any order
+// and cover any subset of the data store.
+// Coils and discrete inputs accept 0/1 and true/false, registers decimal or
+// 0x-prefixed hexadecimal values.
+// If any line is malformed or out of bounds, an error (wrapping
+// ErrUnexpectedParameters or ErrIllegalDataAddress) mentioning the line
+// number is returned and no value is modified.
+func (ds *DataStore) ImportCSV(r io.Reader) (err error) {
+	var cr		*csv.Reader
+	var fields	[]string
+	var records	[]csvRecord
+	var rec		csvRecord
+	var line	int
+
+	cr			= csv.NewReader(r)
+	cr.FieldsPerRecord	= 3
+	cr.TrimLeadingSpace	= true
+
+	for line = 1; ; line++ {
+		fields, err	= cr.Read()
+		if err == io.EOF {
+			err	= nil
+			break
+		}
+		if err != nil {
+			err	= fmt.Errorf("%w: %v", ErrUnexpectedParameters, err)
+			return
+		}
+
+		// skip the header line
+		if line == 1 && fields[0] == "address" {
+			continue
+		}
+
+		rec, err	= parseCSVRecord(fields)
+		if err != nil {
+			err	= fmt.Errorf("line %v: %w", line, err)
+			return
+		}
+		rec.line	= line
+
+		records	= append(records, rec)
+	}
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	// check bounds before modifying anything
+	for _, rec := range records {
+		if int(rec.addr) >= ds.tableLength(rec.dataType) {
+			err	= fmt.Errorf("line %v: %w", rec.line, ErrIllegalDataAddress)
+			return
+		}
+	}
+
+	for _, rec := range records {
+		switch rec.dataType {
+		case COILS, DISCRETE_INPUTS:
+			err	= ds.writeBools(rec.dataType, rec.addr, []bool{rec.value != 0})
+		default:
+			err	= ds.writeRegisters(rec.dataType, rec.addr, []uint16{rec.value})
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Returns the number of items of the table holding dataType.
+// Must be called with ds.lock held.
+func (ds *DataStore) tableLength(dataType DataObjectType) (length int) {
+	switch dataType {
+	case COILS:			length = len(ds.coils)
+	case DISCRETE_INPUTS:		length = len(ds.discreteInputs)
+	case HOLDING_REGISTERS:		length = len(ds.holdingRegisters)
+	case INPUT_REGISTERS:		length = len(ds.inputRegisters)
+	}
+
+	return
+}
+
+// Decodes the address, type and value fields of a CSV line.
+func parseCSVRecord(fields []string) (rec csvRecord, err error) {
+	var addr	uint64
+	var value	uint64
+	var bit		bool
+	var ok		bool
+
+	addr, err	= strconv.ParseUint(fields[0], 0, 16)
+	if err != nil {
+		err	= fmt.Errorf("%w: invalid address %q", ErrUnexpectedParameters, fields[0])
+		return
+	}
+	rec.addr	= uint16(addr)
+
+	rec.dataType, ok	= parseTableName(fields[1])
+	if !ok {
+		err	= fmt.Errorf("%w: unknown type %q", ErrUnexpectedParameters, fields[1])
+		return
+	}
+
+	switch rec.dataType {
+	case COILS, DISCRETE_INPUTS:
+		bit, err	= strconv.ParseBool(fields[2])
+		if bit {
+			rec.value	= 1
+		}
+	default:
+		value, err	= strconv.ParseUint(fields[2], 0, 16)
+		rec.value	= uint16(value)
+	}
+
+	if err != nil {
+		err	= fmt.Errorf("%w: invalid value %q", ErrUnexpectedParameters, fields[2])
+		return
+	}
+
+	return
+}
@@ -0,0 +1,92 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDataStoreCSV(t *testing.T) {
+	var ds1, ds2	*DataStore
+	var buf		bytes.Buffer
+	var coil	bool
+	var di		bool
+	var reg		uint16
+	var err		error
+
+	ds1	= NewDataStore(2, 2, 2, 2)
+	ds1.SetCoil(1, true)
+	ds1.SetDiscreteInput(0, true)
+	ds1.SetHoldingRegister(1, 0x1234)
+	ds1.SetInputRegister(0, 0xffff)
+
+	err	= ds1.ExportCSV(&buf)
+	if err != nil {
+		t.Fatalf("ExportCSV() should have succeeded, got: %v", err)
+	}
+
+	if buf.String() != "address,type,value\n" +
+			   "0,coils,0\n1,coils,1\n" +
+			   "0,discreteInputs,1\n1,discreteInputs,0\n" +
+			   "0,holdingRegisters,0\n1,holdingRegisters,4660\n" +
+			   "0,inputRegisters,65535\n1,inputRegisters,0\n" {
+		t.Errorf("unexpected CSV output: %q", buf.String())
+	}
+
+	// replay the dump on a larger data store
+	ds2	= NewDataStore(4, 4, 4, 4)
+	err	= ds2.ImportCSV(&buf)
+	if err != nil {
+		t.Fatalf("ImportCSV() should have succeeded, got: %v", err)
+	}
+
+	coil, _	= ds2.GetCoil(1)
+	di, _	= ds2.GetDiscreteInput(0)
+	reg, _	= ds2.GetHoldingRegister(1)
+	if !coil || !di || reg != 0x1234 {
+		t.Errorf("unexpected values after ImportCSV(): %v, %v, 0x%04x", coil, di, reg)
+	}
+
+	// headerless files with hex values and boolean literals
+	err	= ds2.ImportCSV(strings.NewReader("3, coils, true\n2,inputRegisters,0xbeef\n"))
+	if err != nil {
+		t.Fatalf("ImportCSV() should have succeeded, got: %v", err)
+	}
+
+	coil, _	= ds2.GetCoil(3)
+	reg, _	= ds2.GetInputRegister(2)
+	if !coil || reg != 0xbeef {
+		t.Errorf("unexpected values after ImportCSV(): %v, 0x%04x", coil, reg)
+	}
+
+	// malformed or out of bounds lines should leave the store untouched
+	for _, tc := range []struct {
+		input	string
+		err	error
+	}{
+		{"0,coils,1\n1,registers,1\n",		ErrUnexpectedParameters},
+		{"0,holdingRegisters,70000\n",		ErrUnexpectedParameters},
+		{"0,coils,maybe\n",			ErrUnexpectedParameters},
+		{"0,coils\n",				ErrUnexpectedParameters},
+		{"0,holdingRegisters,1\n9,coils,1\n",	ErrIllegalDataAddress},
+	} {
+		err	= ds2.ImportCSV(strings.NewReader(tc.input))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%q: expected %v, got: %v", tc.input, tc.err, err)
+		}
+	}
+
+	err	= ds2.ImportCSV(strings.NewReader("address,type,value\n0,coils,1\n9,coils,1\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3, got: %v", err)
+	}
+
+	coil, _	= ds2.GetCoil(0)
+	reg, _	= ds2.GetHoldingRegister(0)
+	if coil || reg != 0 {
+		t.Errorf("failed imports should not have modified the store")
+	}
+
+	return
+}
@@ -0,0 +1,326 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dataStoreFile is the on-disk (JSON) representation of a data store layout
+// (see NewDataStoreFromFile()).
+type dataStoreFile struct {
+	Size		uint16			`json:"size"`
+	Registers	[]dataStoreFileEntry	`json:"registers"`
+}
+
+// dataStoreFileEntry describes a range of values of a data store file.
+type dataStoreFileEntry struct {
+	Name		string		`json:"name"`
+	Table		string		`json:"table"`
+	Addr		uint16		`json:"addr"`
+	Count		uint16		`json:"count"`
+	DataType	string		`json:"dataType"`
+	Value		interface{}	`json:"value"`
+	Access		string		`json:"access"`
+}
+
+// Returns a new data store laid out after the JSON file at path, e.g.
+//   {
+//     "size": 16,
+//     "registers": [
+//       { "name": "Run", "table": "coils", "addr": 0, "value": true },
+//       { "name": "Voltage", "table": "inputRegisters", "addr": 0,
+//         "dataType": "float32", "value": 230.0 },
+//       { "name": "Setpoints", "table": "holdingRegisters", "addr": 10,
+//         "count": 4, "dataType": "int16", "value": -20 },
+//       { "table": "holdingRegisters", "addr": 100, "value": 42,
+//         "access": "ro" }
+//     ]
+//   }
+// Each table holds at least size items and is grown to cover all entries.
+// Entries span count (default 1) consecutive values of dataType, all
+// initialized to value (zero/false if omitted):
+// - "coils" and "discreteInputs" entries hold booleans ("bool", default),
+// - "holdingRegisters" and "inputRegisters" entries hold "uint16" (default),
+//   "int16", "uint32", "int32", "float32", "uint64", "int64" or "float64"
+//   values, stored big-endian, high word first.
+// Named entries are added to the address map of the store (see AddressMap()).
+// Coils and holding registers of entries with access set to "ro" are
+// rejected with an illegal data address exception when written by clients,
+// while "rw" (default) entries can be freely written.
+// YAML files are not supported.
+func NewDataStoreFromFile(path string) (ds *DataStore, err error) {
+	var buf		[]byte
+	var df		dataStoreFile
+	var decoder	*json.Decoder
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err	= fmt.Errorf("%s: YAML data store files are not supported, " +
+				     "use JSON instead", path)
+		return
+	}
+
+	buf, err	= os.ReadFile(path)
+	if err != nil {
+		err	= fmt.Errorf("failed to read data store file %s: %w", path, err)
+		return
+	}
+
+	// keep numbers as strings so that 64-bit values do not lose precision
+	decoder	= json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+
+	err	= decoder.Decode(&df)
+	if err != nil {
+		err	= fmt.Errorf("%s: malformed data store file: %w", path, err)
+		return
+	}
+
+	ds, err	= newDataStoreFromFile(&df)
+	if err != nil {
+		err	= fmt.Errorf("%s: %w", path, err)
+		return
+	}
+
+	return
+}
+
+// Builds a data store out of a decoded data store file.
+func newDataStoreFromFile(df *dataStoreFile) (ds *DataStore, err error) {
+	var sizes	= map[DataObjectType]int{
+		COILS:			int(df.Size),
+		DISCRETE_INPUTS:	int(df.Size),
+		HOLDING_REGISTERS:	int(df.Size),
+		INPUT_REGISTERS:	int(df.Size),
+	}
+	var ranges	[]RegisterAddress
+	var readOnly	[]RegisterAddress
+	var values	[][]uint16
+	var ra		RegisterAddress
+	var regs	[]uint16
+	var end		int
+
+	for i, entry := range df.Registers {
+		ra, regs, err	= parseDataStoreFileEntry(&entry)
+		if err != nil {
+			err	= fmt.Errorf("%w: entry #%v (%s): %v",
+					     ErrConfigurationError, i, entry.Name, err)
+			return
+		}
+
+		end	= int(ra.Addr) + int(ra.Quantity)
+		if end > 0x10000 {
+			err	= fmt.Errorf("%w: entry #%v (%s): address range past 0xffff",
+					     ErrConfigurationError, i, entry.Name)
+			return
+		}
+
+		if end > sizes[ra.DataType] {
+			sizes[ra.DataType]	= end
+		}
+
+		ranges	= append(ranges, ra)
+		values	= append(values, regs)
+
+		if entry.Access == "ro" {
+			readOnly	= append(readOnly, ra)
+		}
+	}
+
+	ds	= newDataStore(sizes[COILS], sizes[DISCRETE_INPUTS],
+			       sizes[HOLDING_REGISTERS], sizes[INPUT_REGISTERS])
+
+	// fill initial values, repeating the encoded value over the range
+	for i, ra := range ranges {
+		for j := 0; j < int(ra.Quantity); j++ {
+			switch ra.DataType {
+			case COILS:
+				ds.coils[int(ra.Addr) + j]		= values[i][0] != 0
+			case DISCRETE_INPUTS:
+				ds.discreteInputs[int(ra.Addr) + j]	= values[i][0] != 0
+			case HOLDING_REGISTERS:
+				ds.holdingRegisters[int(ra.Addr) + j]	= values[i][j % len(values[i])]
+			case INPUT_REGISTERS:
+				ds.inputRegisters[int(ra.Addr) + j]	= values[i][j % len(values[i])]
+			}
+		}
+
+		if df.Registers[i].Name != "" {
+			ds.addressMap[df.Registers[i].Name]	= ra
+		}
+	}
+
+	if len(readOnly) > 0 {
+		ds.WithValidator(func(dataType DataObjectType, addr uint16,
+				      isWrite bool, newVal interface{}) (err error) {
+			if !isWrite {
+				return
+			}
+
+			for _, ra := range readOnly {
+				if ra.DataType == dataType && addr >= ra.Addr &&
+				   int(addr) < int(ra.Addr) + int(ra.Quantity) {
+					err	= ErrIllegalDataAddress
+					return
+				}
+			}
+
+			return
+		})
+	}
+
+	return
+}
+
+// Decodes a data store file entry into the range it covers and the registers
+// its initial value is encoded to (a single 0 or 1 for booleans).
+func parseDataStoreFileEntry(entry *dataStoreFileEntry) (ra RegisterAddress, regs []uint16, err error) {
+	var count	int
+	var width	int
+	var num		json.Number
+	var bit		bool
+	var ok		bool
+	var u		uint64
+	var i		int64
+	var f		float64
+
+	count	= int(entry.Count)
+	if count == 0 {
+		count	= 1
+	}
+
+	ra.DataType, ok	= parseTableName(entry.Table)
+	if !ok {
+		err	= fmt.Errorf("unknown table %q", entry.Table)
+		return
+	}
+
+	switch entry.Access {
+	case "", "rw", "ro":
+	default:
+		err	= fmt.Errorf("unknown access %q", entry.Access)
+		return
+	}
+
+	ra.Addr	= entry.Addr
+
+	// boolean tables
+	if ra.DataType == COILS || ra.DataType == DISCRETE_INPUTS {
+		if entry.DataType != "" && entry.DataType != "bool" {
+			err	= fmt.Errorf("unsupported data type %q", entry.DataType)
+			return
+		}
+
+		if entry.Value != nil {
+			bit, ok	= entry.Value.(bool)
+			if !ok {
+				err	= fmt.Errorf("expected a boolean value")
+				return
+			}
+		}
+
+		ra.Quantity	= uint16(count)
+		regs		= []uint16{0}
+		if bit {
+			regs[0]	= 1
+		}
+
+		return
+	}
+
+	// register tables
+	if entry.Value != nil {
+		num, ok	= entry.Value.(json.Number)
+		if !ok {
+			err	= fmt.Errorf("expected a numeric value")
+			return
+		}
+	} else {
+		num	= "0"
+	}
+
+	switch entry.DataType {
+	case "", "uint16":
+		u, err	= strconv.ParseUint(string(num), 0, 16)
+		regs	= []uint16{uint16(u)}
+	case "int16":
+		i, err	= strconv.ParseInt(string(num), 0, 16)
+		regs	= []uint16{uint16(i)}
+	case "uint32":
+		u, err	= strconv.ParseUint(string(num), 0, 32)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				uint32ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, uint32(u)))
+	case "int32":
+		i, err	= strconv.ParseInt(string(num), 0, 32)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				uint32ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, uint32(i)))
+	case "float32":
+		f, err	= strconv.ParseFloat(string(num), 32)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				float32ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, float32(f)))
+	case "uint64":
+		u, err	= strconv.ParseUint(string(num), 0, 64)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				uint64ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, u))
+	case "int64":
+		i, err	= strconv.ParseInt(string(num), 0, 64)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				uint64ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, uint64(i)))
+	case "float64":
+		f, err	= strconv.ParseFloat(string(num), 64)
+		regs	= bytesToUint16s(BIG_ENDIAN,
+				float64ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, f))
+	default:
+		err	= fmt.Errorf("unsupported data type %q", entry.DataType)
+		return
+	}
+
+	if err != nil {
+		err	= fmt.Errorf("invalid %s value %v", entry.DataType, num)
+		return
+	}
+
+	width	= len(regs)
+	if count * width > math.MaxUint16 {
+		err	= fmt.Errorf("count too large")
+		return
+	}
+	ra.Quantity	= uint16(count * width)
+
+	return
+}
+
+// Returns the data type of the named table ("coils", "discreteInputs",
+// "holdingRegisters" or "inputRegisters").
+func parseTableName(name string) (dataType DataObjectType, ok bool) {
+	ok	= true
+
+	switch name {
+	case "coils":			dataType = COILS
+	case "discreteInputs":		dataType = DISCRETE_INPUTS
+	case "holdingRegisters":	dataType = HOLDING_REGISTERS
+	case "inputRegisters":		dataType = INPUT_REGISTERS
+	default:			ok = false
+	}
+
+	return
+}
+
+// Returns the name of the table holding dataType (see parseTableName()).
+func tableName(dataType DataObjectType) (name string) {
+	switch dataType {
+	case COILS:			name = "coils"
+	case DISCRETE_INPUTS:		name = "discreteInputs"
+	case HOLDING_REGISTERS:		name = "holdingRegisters"
+	case INPUT_REGISTERS:		name = "inputRegisters"
+	}
+
+	return
+}
@@ -0,0 +1,121 @@
+package modbus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewDataStoreFromFile(t *testing.T) {
+	var ds		*DataStore
+	var dir		string
+	var path	string
+	var regs	[]uint16
+	var coils	[]bool
+	var val		uint16
+	var err		error
+
+	dir	= t.TempDir()
+
+	path	= filepath.Join(dir, "store.json")
+	err	= os.WriteFile(path, []byte(`{
+		"size": 8,
+		"registers": [
+			{ "name": "Run", "table": "coils", "addr": 1, "count": 2, "value": true },
+			{ "name": "Voltage", "table": "inputRegisters", "addr": 0,
+			  "dataType": "float32", "value": 230.5 },
+			{ "name": "Setpoints", "table": "holdingRegisters", "addr": 10,
+			  "count": 2, "dataType": "int16", "value": -20 },
+			{ "table": "holdingRegisters", "addr": 20, "count": 2,
+			  "value": 42, "access": "ro" }
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write data store file: %v", err)
+	}
+
+	ds, err	= NewDataStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("NewDataStoreFromFile() should have succeeded, got: %v", err)
+	}
+
+	// tables are grown to fit all entries
+	if len(ds.coils) != 8 || len(ds.discreteInputs) != 8 ||
+	   len(ds.holdingRegisters) != 22 || len(ds.inputRegisters) != 8 {
+		t.Errorf("unexpected table sizes: %v, %v, %v, %v", len(ds.coils),
+			 len(ds.discreteInputs), len(ds.holdingRegisters), len(ds.inputRegisters))
+	}
+
+	coils, _	= ds.HandleCoils(0, 0, 4, false, nil)
+	if coils[0] || !coils[1] || !coils[2] || coils[3] {
+		t.Errorf("unexpected coils: %v", coils)
+	}
+
+	regs, _	= ds.HandleInputRegisters(0, 0, 2)
+	if regs[0] != 0x4366 || regs[1] != 0x8000 {
+		t.Errorf("unexpected float32 encoding: 0x%04x", regs)
+	}
+
+	regs, _	= ds.HandleHoldingRegisters(0, 10, 2, false, nil)
+	if regs[0] != 0xffec || regs[1] != 0xffec {
+		t.Errorf("unexpected int16 values: 0x%04x", regs)
+	}
+
+	val, err	= ds.ReadByName("Setpoints")
+	if err != nil || val != 0xffec {
+		t.Errorf("expected 0xffec, got: 0x%04x (%v)", val, err)
+	}
+
+	// read-only entries are readable but not writable by clients
+	regs, err	= ds.HandleHoldingRegisters(0, 20, 2, false, nil)
+	if err != nil || regs[0] != 42 || regs[1] != 42 {
+		t.Errorf("unexpected read-only values: %v (%v)", regs, err)
+	}
+
+	_, err	= ds.HandleHoldingRegisters(0, 19, 2, true, []uint16{1, 2})
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	_, err	= ds.HandleHoldingRegisters(0, 10, 1, true, []uint16{7})
+	if err != nil {
+		t.Errorf("writing a read-write entry should have succeeded, got: %v", err)
+	}
+
+	// invalid files
+	for _, contents := range []string{
+		`{"registers": [{"table": "dunno", "addr": 0}]}`,
+		`{"registers": [{"table": "coils", "addr": 0, "value": 12}]}`,
+		`{"registers": [{"table": "inputRegisters", "addr": 0, "value": 70000}]}`,
+		`{"registers": [{"table": "inputRegisters", "addr": 0, "dataType": "int128"}]}`,
+		`{"registers": [{"table": "coils", "addr": 65535, "count": 2}]}`,
+		`{"registers": [{"table": "coils", "addr": 0, "access": "wo"}]}`,
+		`{"unknown": 1}`,
+	} {
+		err	= os.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			t.Fatalf("failed to write data store file: %v", err)
+		}
+
+		_, err	= NewDataStoreFromFile(path)
+		if err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("expected an error mentioning %s for %s, got: %v",
+				 path, contents, err)
+		}
+	}
+
+	_, err	= NewDataStoreFromFile(filepath.Join(dir, "store.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "YAML") {
+		t.Errorf("expected a YAML error, got: %v", err)
+	}
+
+	os.WriteFile(path, []byte(`{"registers": [{"table": "dunno"}]}`), 0644)
+	_, err	= NewDataStoreFromFile(path)
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
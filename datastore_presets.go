@@ -0,0 +1,111 @@
+package modbus
+
+import (
+	"math"
+)
+
+type DevicePreset uint
+const (
+	PRESET_GENERIC		DevicePreset	= 1
+	PRESET_ENERGY_METER	DevicePreset	= 2
+	PRESET_VFD		DevicePreset	= 3
+	PRESET_PLC		DevicePreset	= 4
+)
+
+// RegisterAddress locates a named value within a DataStore.
+// Values spanning multiple registers (e.g. 32-bit floats) are stored
+// big-endian, high word first, as expected by default by ModbusClient.
+type RegisterAddress struct {
+	DataType	DataObjectType
+	Addr		uint16
+	Quantity	uint16
+}
+
+// RegisterAddressMap maps value names to their location (see AddressMap()).
+type RegisterAddressMap map[string]RegisterAddress
+
+// Returns a new data store sized and laid out after a typical device of the
+// given class, with its address map (see AddressMap()) populated:
+// - PRESET_ENERGY_METER:	128 holding registers, with 3-phase voltages,
+//				currents, power, power factor, frequency and
+//				energy as 32-bit floats starting at address 0,
+//				initialized to NaN until first measured,
+// - PRESET_VFD:		16 coils (run, reverse, fault reset),
+//				16 discrete inputs (running, fault, at speed),
+//				64 holding registers (control word, speed
+//				reference, ramp times) and 64 input registers
+//				(status word, output frequency/current, motor
+//				speed, fault code),
+// - PRESET_PLC:		256 items of each type, without names,
+// - PRESET_GENERIC:		128 items of each type, without names.
+func NewDataStoreWithPresets(preset DevicePreset) (ds *DataStore, err error) {
+	var nan	[]uint16
+
+	switch preset {
+	case PRESET_ENERGY_METER:
+		ds	= NewDataStore(0, 0, 128, 0)
+		nan	= bytesToUint16s(BIG_ENDIAN,
+				float32ToBytes(BIG_ENDIAN, HIGH_WORD_FIRST, float32(math.NaN())))
+
+		for i, name := range []string{
+			"VoltageL1", "VoltageL2", "VoltageL3",
+			"CurrentL1", "CurrentL2", "CurrentL3",
+			"ActivePower", "ReactivePower", "ApparentPower",
+			"PowerFactor", "Frequency",
+			"ActiveEnergyImport", "ActiveEnergyExport",
+		} {
+			ds.addressMap[name] = RegisterAddress{
+				DataType:	HOLDING_REGISTERS,
+				Addr:		uint16(2 * i),
+				Quantity:	2,
+			}
+			copy(ds.holdingRegisters[2 * i:], nan)
+		}
+
+	case PRESET_VFD:
+		ds	= NewDataStore(16, 16, 64, 64)
+
+		for name, ra := range map[string]RegisterAddress{
+			"Run":			{COILS, 0, 1},
+			"Reverse":		{COILS, 1, 1},
+			"FaultReset":		{COILS, 2, 1},
+			"Running":		{DISCRETE_INPUTS, 0, 1},
+			"Fault":		{DISCRETE_INPUTS, 1, 1},
+			"AtSpeed":		{DISCRETE_INPUTS, 2, 1},
+			"ControlWord":		{HOLDING_REGISTERS, 0, 1},
+			"SpeedReference":	{HOLDING_REGISTERS, 1, 1},
+			"AccelerationTime":	{HOLDING_REGISTERS, 2, 1},
+			"DecelerationTime":	{HOLDING_REGISTERS, 3, 1},
+			"StatusWord":		{INPUT_REGISTERS, 0, 1},
+			"OutputFrequency":	{INPUT_REGISTERS, 1, 1},
+			"OutputCurrent":	{INPUT_REGISTERS, 2, 1},
+			"MotorSpeed":		{INPUT_REGISTERS, 3, 1},
+			"FaultCode":		{INPUT_REGISTERS, 4, 1},
+		} {
+			ds.addressMap[name] = ra
+		}
+
+	case PRESET_PLC:
+		ds	= NewDataStore(256, 256, 256, 256)
+
+	case PRESET_GENERIC:
+		ds	= NewDataStore(128, 128, 128, 128)
+
+	default:
+		err	= ErrConfigurationError
+		return
+	}
+
+	return
+}
+
+// Returns a copy of the address map of the data store, empty unless the store
+// was created with NewDataStoreWithPresets() or NewDataStoreWithRegisterMap().
+func (ds *DataStore) AddressMap() (am RegisterAddressMap) {
+	am	= make(RegisterAddressMap, len(ds.addressMap))
+	for name, ra := range ds.addressMap {
+		am[name]	= ra
+	}
+
+	return
+}
@@ -0,0 +1,66 @@
+package modbus
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewDataStoreWithPresets(t *testing.T) {
+	var ds		*DataStore
+	var am		RegisterAddressMap
+	var ra		RegisterAddress
+	var ok		bool
+	var regs	[]uint16
+	var values	[]float32
+	var err		error
+
+	_, err	= NewDataStoreWithPresets(DevicePreset(0))
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	ds, err	= NewDataStoreWithPresets(PRESET_ENERGY_METER)
+	if err != nil {
+		t.Fatalf("NewDataStoreWithPresets() should have succeeded, got: %v", err)
+	}
+
+	am	= ds.AddressMap()
+	ra, ok	= am["VoltageL1"]
+	if !ok || ra.DataType != HOLDING_REGISTERS || ra.Quantity != 2 {
+		t.Fatalf("unexpected VoltageL1 address: %+v (found: %v)", ra, ok)
+	}
+
+	// measurements should read as NaN until set
+	regs, err	= ds.HandleHoldingRegisters(1, ra.Addr, ra.Quantity, false, nil)
+	if err != nil {
+		t.Fatalf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+
+	values	= bytesToFloat32s(BIG_ENDIAN, HIGH_WORD_FIRST, uint16sToBytes(BIG_ENDIAN, regs))
+	if len(values) != 1 || !math.IsNaN(float64(values[0])) {
+		t.Errorf("expected NaN, got: %v", values)
+	}
+
+	// the returned map should be a copy
+	delete(am, "VoltageL1")
+	if _, ok = ds.AddressMap()["VoltageL1"]; !ok {
+		t.Errorf("modifying the returned map should not affect the store")
+	}
+
+	ds, err	= NewDataStoreWithPresets(PRESET_VFD)
+	if err != nil {
+		t.Fatalf("NewDataStoreWithPresets() should have succeeded, got: %v", err)
+	}
+
+	ra	= ds.AddressMap()["Run"]
+	_, err	= ds.HandleCoils(1, ra.Addr, ra.Quantity, true, []bool{true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+
+	if len(NewDataStore(1, 1, 1, 1).AddressMap()) != 0 {
+		t.Errorf("expected an empty address map")
+	}
+
+	return
+}
@@ -0,0 +1,120 @@
+package modbus
+
+import (
+	"fmt"
+)
+
+// Returns a new data store laid out after regMap, a register map typically
+// taken from a device specification.
+// Each table holds at least size items, and is grown to cover the highest
+// address of regMap in that table. The store answers requests like any
+// other data store, while values can be accessed by name from the
+// application side (see ReadByName() and WriteByName()).
+// With a nil regMap, the store is the same as NewDataStore(size, size,
+// size, size).
+func NewDataStoreWithRegisterMap(size uint16, regMap RegisterAddressMap) (ds *DataStore, err error) {
+	var sizes	= map[DataObjectType]int{
+		COILS:			int(size),
+		DISCRETE_INPUTS:	int(size),
+		HOLDING_REGISTERS:	int(size),
+		INPUT_REGISTERS:	int(size),
+	}
+	var end		int
+	var ok		bool
+
+	for name, ra := range regMap {
+		_, ok	= sizes[ra.DataType]
+		if !ok {
+			err	= fmt.Errorf("%w: %q: unknown data type (%v)",
+					     ErrConfigurationError, name, ra.DataType)
+			return
+		}
+
+		end	= int(ra.Addr) + int(ra.Quantity)
+		if ra.Quantity == 0 {
+			end++
+		}
+
+		if end > 0x10000 {
+			err	= fmt.Errorf("%w: %q: address range past 0xffff",
+					     ErrConfigurationError, name)
+			return
+		}
+
+		if end > sizes[ra.DataType] {
+			sizes[ra.DataType]	= end
+		}
+	}
+
+	ds	= newDataStore(sizes[COILS], sizes[DISCRETE_INPUTS],
+			       sizes[HOLDING_REGISTERS], sizes[INPUT_REGISTERS])
+	for name, ra := range regMap {
+		ds.addressMap[name]	= ra
+	}
+
+	return
+}
+
+// Returns the value found at the first address of the named entry of the
+// address map (see AddressMap()). Coils and discrete inputs read as 1 when
+// set, 0 otherwise.
+// Returns ErrUnexpectedParameters if name is not part of the address map.
+func (ds *DataStore) ReadByName(name string) (val uint16, err error) {
+	var ra		RegisterAddress
+	var ok		bool
+	var bit		bool
+
+	ra, ok	= ds.addressMap[name]
+	if !ok {
+		err	= fmt.Errorf("%w: unknown name %q", ErrUnexpectedParameters, name)
+		return
+	}
+
+	switch ra.DataType {
+	case COILS:
+		bit, err	= ds.GetCoil(ra.Addr)
+	case DISCRETE_INPUTS:
+		bit, err	= ds.GetDiscreteInput(ra.Addr)
+	case HOLDING_REGISTERS:
+		val, err	= ds.GetHoldingRegister(ra.Addr)
+	case INPUT_REGISTERS:
+		val, err	= ds.GetInputRegister(ra.Addr)
+	default:
+		err		= ErrUnexpectedParameters
+	}
+
+	if bit {
+		val	= 1
+	}
+
+	return
+}
+
+// Writes val to the first address of the named entry of the address map
+// (see AddressMap()). Coils and discrete inputs are set if val is non-zero.
+// Returns ErrUnexpectedParameters if name is not part of the address map.
+func (ds *DataStore) WriteByName(name string, val uint16) (err error) {
+	var ra	RegisterAddress
+	var ok	bool
+
+	ra, ok	= ds.addressMap[name]
+	if !ok {
+		err	= fmt.Errorf("%w: unknown name %q", ErrUnexpectedParameters, name)
+		return
+	}
+
+	switch ra.DataType {
+	case COILS:
+		err	= ds.SetCoil(ra.Addr, val != 0)
+	case DISCRETE_INPUTS:
+		err	= ds.SetDiscreteInput(ra.Addr, val != 0)
+	case HOLDING_REGISTERS:
+		err	= ds.SetHoldingRegister(ra.Addr, val)
+	case INPUT_REGISTERS:
+		err	= ds.SetInputRegister(ra.Addr, val)
+	default:
+		err	= ErrUnexpectedParameters
+	}
+
+	return
+}
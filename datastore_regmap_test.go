@@ -0,0 +1,87 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewDataStoreWithRegisterMap(t *testing.T) {
+	var ds		*DataStore
+	var err		error
+	var val		uint16
+	var coil	bool
+
+	ds, err	= NewDataStoreWithRegisterMap(10, RegisterAddressMap{
+		"Setpoint":	{HOLDING_REGISTERS, 40, 1},
+		"Temperature":	{INPUT_REGISTERS, 3, 2},
+		"Enable":	{COILS, 12, 1},
+	})
+	if err != nil {
+		t.Fatalf("NewDataStoreWithRegisterMap() should have succeeded, got: %v", err)
+	}
+
+	// tables should have grown to cover the map
+	if len(ds.holdingRegisters) != 41 || len(ds.inputRegisters) != 10 ||
+	   len(ds.coils) != 13 || len(ds.discreteInputs) != 10 {
+		t.Errorf("unexpected table sizes: %v, %v, %v, %v",
+			 len(ds.coils), len(ds.discreteInputs),
+			 len(ds.holdingRegisters), len(ds.inputRegisters))
+	}
+
+	for name, value := range map[string]uint16{
+		"Setpoint":	0x1234,
+		"Temperature":	0x5678,
+		"Enable":	1,
+	} {
+		err	= ds.WriteByName(name, value)
+		if err != nil {
+			t.Errorf("WriteByName(%q) should have succeeded, got: %v", name, err)
+		}
+
+		val, err	= ds.ReadByName(name)
+		if err != nil || val != value {
+			t.Errorf("ReadByName(%q): expected 0x%04x, got: 0x%04x, %v",
+				 name, value, val, err)
+		}
+	}
+
+	// values should be found at their address
+	val, _	= ds.GetHoldingRegister(40)
+	if val != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x", val)
+	}
+	val, _	= ds.GetInputRegister(3)
+	if val != 0x5678 {
+		t.Errorf("expected 0x5678, got: 0x%04x", val)
+	}
+	coil, _	= ds.GetCoil(12)
+	if !coil {
+		t.Errorf("expected coil 12 to be set")
+	}
+
+	_, err	= ds.ReadByName("Pressure")
+	if !errors.Is(err, ErrUnexpectedParameters) {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	err	= ds.WriteByName("Pressure", 1)
+	if !errors.Is(err, ErrUnexpectedParameters) {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	// without a map, the store should be a plain data store
+	ds, err	= NewDataStoreWithRegisterMap(5, nil)
+	if err != nil || len(ds.coils) != 5 || len(ds.inputRegisters) != 5 ||
+	   len(ds.AddressMap()) != 0 {
+		t.Errorf("expected a plain data store, got: %v", err)
+	}
+
+	_, err	= NewDataStoreWithRegisterMap(0, RegisterAddressMap{
+		"Overflow":	{HOLDING_REGISTERS, 0xffff, 2},
+	})
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
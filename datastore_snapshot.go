@@ -0,0 +1,305 @@
+package modbus
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// DataSnapshot holds a copy of all values of a DataStore (see GetAll() and
+// SetAll()), indexed by address.
+type DataSnapshot struct {
+	Coils			[]bool
+	DiscreteInputs		[]bool
+	HoldingRegisters	[]uint16
+	InputRegisters		[]uint16
+}
+
+// Returns a copy of all coils, discrete inputs, holding and input registers,
+// taken atomically with respect to request handlers and Set methods.
+// The returned snapshot does not share memory with the data store.
+func (ds *DataStore) GetAll() (snapshot DataSnapshot) {
+	ds.lock.RLock()
+	defer ds.lock.RUnlock()
+
+	snapshot	= DataSnapshot{
+		Coils:			append([]bool{}, ds.coils...),
+		DiscreteInputs:		append([]bool{}, ds.discreteInputs...),
+		HoldingRegisters:	append([]uint16{}, ds.holdingRegisters...),
+		InputRegisters:		append([]uint16{}, ds.inputRegisters...),
+	}
+
+	return
+}
+
+// Replaces all values of the data store with those of snapshot, atomically
+// with respect to request handlers and Get methods.
+// Each table of snapshot must be of the same size as that of the data store,
+// otherwise ErrUnexpectedParameters is returned and no value is modified.
+// Only values which differ are written (and notified to subscribers).
+func (ds *DataStore) SetAll(snapshot DataSnapshot) (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if len(snapshot.Coils) != len(ds.coils) ||
+	   len(snapshot.DiscreteInputs) != len(ds.discreteInputs) ||
+	   len(snapshot.HoldingRegisters) != len(ds.holdingRegisters) ||
+	   len(snapshot.InputRegisters) != len(ds.inputRegisters) {
+		err	= ErrUnexpectedParameters
+		return
+	}
+
+	err	= ds.writeChangedBools(COILS, ds.coils, snapshot.Coils)
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedBools(DISCRETE_INPUTS, ds.discreteInputs, snapshot.DiscreteInputs)
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedRegisters(HOLDING_REGISTERS, ds.holdingRegisters, snapshot.HoldingRegisters)
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedRegisters(INPUT_REGISTERS, ds.inputRegisters, snapshot.InputRegisters)
+
+	return
+}
+
+// Writes a snapshot of all values of the data store (see GetAll()) to w, as
+// JSON.
+func (ds *DataStore) SaveSnapshot(w io.Writer) (err error) {
+	err	= json.NewEncoder(w).Encode(ds.GetAll())
+
+	return
+}
+
+// Reads a snapshot written by SaveSnapshot() from r and loads it into the
+// data store (see SetAll()).
+// Returns ErrUnexpectedParameters if the snapshot was taken from a data store
+// of a different size, in which case no value is modified.
+func (ds *DataStore) LoadSnapshot(r io.Reader) (err error) {
+	var snapshot	DataSnapshot
+
+	err	= json.NewDecoder(r).Decode(&snapshot)
+	if err != nil {
+		return
+	}
+
+	err	= ds.SetAll(snapshot)
+
+	return
+}
+
+// Saves a snapshot of the data store to the file at path every interval,
+// until stop is called (which saves a last snapshot and returns the error
+// of that save, if any).
+// Snapshots are written to a temporary file first, so that path always holds
+// a complete snapshot. Failed periodic saves are logged.
+// Load the file back with LoadSnapshot() on startup to restore values.
+func (ds *DataStore) AutoSave(path string, interval time.Duration) (stop func() error) {
+	var done	chan struct{}
+	var exited	chan struct{}
+
+	done	= make(chan struct{})
+	exited	= make(chan struct{})
+
+	go func() {
+		var ticker	*time.Ticker
+		var err		error
+
+		defer close(exited)
+
+		ticker	= time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err	= ds.saveSnapshotFile(path)
+				if err != nil {
+					ds.logger.Errorf("failed to save snapshot to %s: %v", path, err)
+				}
+			}
+		}
+	}()
+
+	stop	= func() (err error) {
+		close(done)
+		<-exited
+
+		err	= ds.saveSnapshotFile(path)
+
+		return
+	}
+
+	return
+}
+
+// Writes a snapshot of the data store to path, through a temporary file.
+func (ds *DataStore) saveSnapshotFile(path string) (err error) {
+	var file	*os.File
+	var tmpPath	string
+
+	tmpPath		= path + ".tmp"
+	file, err	= os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+
+	err	= ds.SaveSnapshot(file)
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	err	= file.Close()
+	if err != nil {
+		return
+	}
+
+	err	= os.Rename(tmpPath, path)
+
+	return
+}
+
+// Writes each run of values differing from those of table.
+// Must be called with ds.lock held.
+func (ds *DataStore) writeChangedBools(dataType DataObjectType, table []bool, values []bool) (err error) {
+	var end	int
+
+	for start := 0; start < len(values); start = end {
+		if values[start] == table[start] {
+			end	= start + 1
+			continue
+		}
+
+		for end = start; end < len(values) && values[end] != table[end]; end++ {}
+
+		err	= ds.writeBools(dataType, uint16(start), values[start:end])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Writes each run of values differing from those of table.
+// Must be called with ds.lock held.
+func (ds *DataStore) writeChangedRegisters(dataType DataObjectType, table []uint16, values []uint16) (err error) {
+	var end	int
+
+	for start := 0; start < len(values); start = end {
+		if values[start] == table[start] {
+			end	= start + 1
+			continue
+		}
+
+		for end = start; end < len(values) && values[end] != table[end]; end++ {}
+
+		err	= ds.writeRegisters(dataType, uint16(start), values[start:end])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Zeroes all coils, discrete inputs, holding and input registers in place,
+// atomically with respect to request handlers and Get methods.
+// Subscriptions and validators are preserved: only values which were not
+// already zero/false are written (and notified to subscribers).
+func (ds *DataStore) Reset() (err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	err	= ds.writeChangedBools(COILS, ds.coils, make([]bool, len(ds.coils)))
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedBools(DISCRETE_INPUTS, ds.discreteInputs,
+				       make([]bool, len(ds.discreteInputs)))
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedRegisters(HOLDING_REGISTERS, ds.holdingRegisters,
+					   make([]uint16, len(ds.holdingRegisters)))
+	if err != nil {
+		return
+	}
+
+	err	= ds.writeChangedRegisters(INPUT_REGISTERS, ds.inputRegisters,
+					   make([]uint16, len(ds.inputRegisters)))
+
+	return
+}
+
+// Zeroes count values of dataType starting at start (see Reset()).
+// Returns ErrIllegalDataAddress if the range is out of bounds, in which case
+// no value is modified.
+func (ds *DataStore) ResetRange(dataType DataObjectType, start uint16, count uint16) (err error) {
+	var end	int
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	end	= int(start) + int(count)
+
+	switch dataType {
+	case COILS, DISCRETE_INPUTS:
+		var table	[]bool
+
+		table	= ds.coils
+		if dataType == DISCRETE_INPUTS {
+			table	= ds.discreteInputs
+		}
+
+		if end > len(table) {
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		// leave values before start as they are
+		var values	= append([]bool{}, table[:end]...)
+		for i := int(start); i < end; i++ {
+			values[i]	= false
+		}
+
+		err	= ds.writeChangedBools(dataType, table, values)
+
+	case HOLDING_REGISTERS, INPUT_REGISTERS:
+		var table	[]uint16
+
+		table	= ds.holdingRegisters
+		if dataType == INPUT_REGISTERS {
+			table	= ds.inputRegisters
+		}
+
+		if end > len(table) {
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		var values	= append([]uint16{}, table[:end]...)
+		for i := int(start); i < end; i++ {
+			values[i]	= 0
+		}
+
+		err	= ds.writeChangedRegisters(dataType, table, values)
+
+	default:
+		err	= ErrUnexpectedParameters
+	}
+
+	return
+}
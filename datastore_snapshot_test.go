@@ -0,0 +1,248 @@
+package modbus
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDataStoreGetAllSetAll(t *testing.T) {
+	var ds		*DataStore
+	var snap1	DataSnapshot
+	var snap2	DataSnapshot
+	var value	uint16
+	var coil	bool
+	var err		error
+
+	ds	= NewDataStore(4, 4, 4, 4)
+	ds.SetCoil(1, true)
+	ds.SetDiscreteInput(2, true)
+	ds.SetHoldingRegister(3, 0x1234)
+	ds.SetInputRegister(0, 0x5678)
+
+	snap1	= ds.GetAll()
+	snap2	= ds.GetAll()
+
+	if !snap1.Coils[1] || !snap1.DiscreteInputs[2] ||
+	   snap1.HoldingRegisters[3] != 0x1234 || snap1.InputRegisters[0] != 0x5678 {
+		t.Errorf("unexpected snapshot: %+v", snap1)
+	}
+
+	// snapshots should not share memory with each other or with the store
+	if &snap1.HoldingRegisters[0] == &snap2.HoldingRegisters[0] ||
+	   &snap1.Coils[0] == &snap2.Coils[0] {
+		t.Errorf("snapshots should not share slices")
+	}
+
+	snap1.HoldingRegisters[3]	= 0xffff
+	snap1.Coils[1]			= false
+
+	value, _	= ds.GetHoldingRegister(3)
+	coil, _		= ds.GetCoil(1)
+	if value != 0x1234 || !coil {
+		t.Errorf("modifying a snapshot should not affect the store")
+	}
+
+	// write the modified snapshot back
+	err	= ds.SetAll(snap1)
+	if err != nil {
+		t.Fatalf("SetAll() should have succeeded, got: %v", err)
+	}
+
+	value, _	= ds.GetHoldingRegister(3)
+	coil, _		= ds.GetCoil(1)
+	if value != 0xffff || coil {
+		t.Errorf("expected 0xffff and false, got: 0x%04x and %v", value, coil)
+	}
+
+	// size mismatches should be rejected without modifying anything
+	snap2.InputRegisters	= append(snap2.InputRegisters, 0)
+	err	= ds.SetAll(snap2)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	value, _	= ds.GetHoldingRegister(3)
+	if value != 0xffff {
+		t.Errorf("expected 0xffff, got: 0x%04x", value)
+	}
+
+	return
+}
+
+func TestDataStoreReset(t *testing.T) {
+	var ds		*DataStore
+	var ch		chan ChangeEvent
+	var snap	DataSnapshot
+	var ev		ChangeEvent
+	var err		error
+
+	ds	= NewDataStore(4, 4, 4, 4)
+	ds.SetCoil(1, true)
+	ds.SetDiscreteInput(3, true)
+	ds.SetHoldingRegister(0, 0x1234)
+	ds.SetHoldingRegister(2, 0x5678)
+	ds.SetInputRegister(3, 0x9abc)
+
+	ch	= make(chan ChangeEvent, 16)
+	ds.Subscribe(AddressFilter{DataType: HOLDING_REGISTERS, Start: 0, End: 3}, ch)
+
+	err	= ds.Reset()
+	if err != nil {
+		t.Fatalf("Reset() should have succeeded, got: %v", err)
+	}
+
+	snap	= ds.GetAll()
+	for i := 0; i < 4; i++ {
+		if snap.Coils[i] || snap.DiscreteInputs[i] ||
+		   snap.HoldingRegisters[i] != 0 || snap.InputRegisters[i] != 0 {
+			t.Errorf("expected all values to be zeroed, got: %+v", snap)
+			break
+		}
+	}
+
+	// only values which were not zero should have been notified
+	if len(ch) != 2 {
+		t.Fatalf("expected 2 change events, got: %v", len(ch))
+	}
+	ev	= <-ch
+	if ev.Addr != 0 || ev.OldVal != uint16(0x1234) || ev.NewVal != uint16(0) {
+		t.Errorf("unexpected change event: %+v", ev)
+	}
+	ev	= <-ch
+	if ev.Addr != 2 || ev.OldVal != uint16(0x5678) || ev.NewVal != uint16(0) {
+		t.Errorf("unexpected change event: %+v", ev)
+	}
+
+	// ResetRange() should only zero the requested range
+	ds.SetCoil(0, true)
+	ds.SetCoil(1, true)
+	ds.SetCoil(2, true)
+	ds.SetHoldingRegister(1, 1)
+	ds.SetHoldingRegister(3, 3)
+	<-ch
+	<-ch
+
+	err	= ds.ResetRange(COILS, 1, 2)
+	if err != nil {
+		t.Errorf("ResetRange() should have succeeded, got: %v", err)
+	}
+
+	err	= ds.ResetRange(HOLDING_REGISTERS, 3, 1)
+	if err != nil {
+		t.Errorf("ResetRange() should have succeeded, got: %v", err)
+	}
+
+	snap	= ds.GetAll()
+	if !snap.Coils[0] || snap.Coils[1] || snap.Coils[2] ||
+	   snap.HoldingRegisters[1] != 1 || snap.HoldingRegisters[3] != 0 {
+		t.Errorf("unexpected values after ResetRange(): %+v", snap)
+	}
+	if len(ch) != 1 {
+		t.Errorf("expected 1 change event, got: %v", len(ch))
+	}
+
+	err	= ds.ResetRange(INPUT_REGISTERS, 3, 2)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	err	= ds.ResetRange(DataObjectType(0), 0, 1)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	return
+}
+
+func TestDataStoreSaveLoadSnapshot(t *testing.T) {
+	var ds1, ds2	*DataStore
+	var buf		bytes.Buffer
+	var file	*os.File
+	var path	string
+	var stop	func() error
+	var value	uint16
+	var coil	bool
+	var err		error
+
+	ds1	= NewDataStore(4, 4, 4, 4)
+	ds1.SetCoil(3, true)
+	ds1.SetHoldingRegister(1, 0xbeef)
+	ds1.SetInputRegister(2, 0x0102)
+
+	err	= ds1.SaveSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("SaveSnapshot() should have succeeded, got: %v", err)
+	}
+
+	ds2	= NewDataStore(4, 4, 4, 4)
+	err	= ds2.LoadSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadSnapshot() should have succeeded, got: %v", err)
+	}
+
+	coil, _		= ds2.GetCoil(3)
+	value, _	= ds2.GetHoldingRegister(1)
+	if !coil || value != 0xbeef {
+		t.Errorf("unexpected values after LoadSnapshot(): %v, 0x%04x", coil, value)
+	}
+
+	// snapshots of differently sized data stores should be rejected
+	err	= NewDataStore(2, 2, 2, 2).LoadSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	err	= ds2.LoadSnapshot(bytes.NewReader([]byte("garbage")))
+	if err == nil {
+		t.Errorf("LoadSnapshot() should have failed on garbage")
+	}
+
+	// periodic saves
+	path	= filepath.Join(t.TempDir(), "store.json")
+	stop	= ds1.AutoSave(path, 10 * time.Millisecond)
+
+	ds1.SetHoldingRegister(0, 0x1111)
+	time.Sleep(50 * time.Millisecond)
+
+	file, err	= os.Open(path)
+	if err != nil {
+		t.Fatalf("expected a snapshot file, got: %v", err)
+	}
+	err	= ds2.LoadSnapshot(file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("LoadSnapshot() should have succeeded, got: %v", err)
+	}
+
+	value, _	= ds2.GetHoldingRegister(0)
+	if value != 0x1111 {
+		t.Errorf("expected 0x1111, got: 0x%04x", value)
+	}
+
+	// stopping should save a last snapshot
+	ds1.SetHoldingRegister(0, 0x2222)
+	err	= stop()
+	if err != nil {
+		t.Fatalf("stop() should have succeeded, got: %v", err)
+	}
+
+	file, err	= os.Open(path)
+	if err != nil {
+		t.Fatalf("expected a snapshot file, got: %v", err)
+	}
+	err	= ds2.LoadSnapshot(file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("LoadSnapshot() should have succeeded, got: %v", err)
+	}
+
+	value, _	= ds2.GetHoldingRegister(0)
+	if value != 0x2222 {
+		t.Errorf("expected 0x2222, got: 0x%04x", value)
+	}
+
+	return
+}
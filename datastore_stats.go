@@ -0,0 +1,90 @@
+package modbus
+
+import (
+	"sync/atomic"
+)
+
+// DataStoreStats holds client access counts of a DataStore (see GetStats()),
+// keyed by address. Accesses to all tables are counted together: e.g. reads
+// of coil 10 and of holding register 10 both count as reads of address 10.
+type DataStoreStats struct {
+	ReadCountPerAddress	map[uint16]uint64
+	WriteCountPerAddress	map[uint16]uint64
+	MostReadAddr		uint16	// lowest address of the most read ones
+	MostWrittenAddr		uint16	// lowest address of the most written ones
+}
+
+// Returns a snapshot of the number of times each address was read or written
+// by request handlers since the data store was created or ResetStats() was
+// last called. Addresses never accessed are left out.
+// Accesses made through the application side Get/Set methods are not counted.
+func (ds *DataStore) GetStats() (stats DataStoreStats) {
+	stats.ReadCountPerAddress	= sumAccessCounts(ds.readCounts)
+	stats.WriteCountPerAddress	= sumAccessCounts(ds.writeCounts)
+	stats.MostReadAddr		= mostAccessedAddr(stats.ReadCountPerAddress)
+	stats.MostWrittenAddr		= mostAccessedAddr(stats.WriteCountPerAddress)
+
+	return
+}
+
+// Zeroes all access counters.
+func (ds *DataStore) ResetStats() {
+	for _, counts := range []map[DataObjectType][]uint64{ds.readCounts, ds.writeCounts} {
+		for _, table := range counts {
+			for i := range table {
+				atomic.StoreUint64(&table[i], 0)
+			}
+		}
+	}
+
+	return
+}
+
+// Counts an access to quantity addresses of dataType, starting at addr.
+// Safe to call without ds.lock held.
+func (ds *DataStore) countAccess(dataType DataObjectType, addr uint16, quantity uint16, isWrite bool) {
+	var table	[]uint64
+
+	if isWrite {
+		table	= ds.writeCounts[dataType]
+	} else {
+		table	= ds.readCounts[dataType]
+	}
+
+	for i := int(addr); i < int(addr) + int(quantity) && i < len(table); i++ {
+		atomic.AddUint64(&table[i], 1)
+	}
+
+	return
+}
+
+// Returns the non-zero counts of all tables, summed by address.
+func sumAccessCounts(counts map[DataObjectType][]uint64) (sums map[uint16]uint64) {
+	var count	uint64
+
+	sums	= make(map[uint16]uint64)
+	for _, table := range counts {
+		for i := range table {
+			count	= atomic.LoadUint64(&table[i])
+			if count > 0 {
+				sums[uint16(i)]	+= count
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the lowest address with the highest count (0 if counts is empty).
+func mostAccessedAddr(counts map[uint16]uint64) (addr uint16) {
+	var max	uint64
+
+	for a, count := range counts {
+		if count > max || (count == max && a < addr) {
+			max	= count
+			addr	= a
+		}
+	}
+
+	return
+}
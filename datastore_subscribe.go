@@ -0,0 +1,83 @@
+package modbus
+
+import (
+	"time"
+)
+
+// AddressFilter selects a range of addresses of a data store table, from
+// Start to End (inclusive).
+type AddressFilter struct {
+	DataType	DataObjectType
+	Start		uint16
+	End		uint16
+}
+
+// ChangeEvent describes a write to a single data store address.
+type ChangeEvent struct {
+	DataType	DataObjectType
+	Addr		uint16
+	OldVal		interface{}	// bool for coils and discrete inputs,
+	NewVal		interface{}	// uint16 for registers
+	Timestamp	time.Time
+}
+
+type subscription struct {
+	filter		AddressFilter
+	ch		chan<- ChangeEvent
+}
+
+// Registers ch to receive a ChangeEvent for every write to an address
+// matching filter, whether by a request handler or by a Set method (writes
+// leaving the value unchanged included).
+// Events are sent without blocking: they are dropped (and a warning is
+// logged) if ch is full, hence ch should be buffered.
+// A channel may be subscribed more than once, with different filters.
+func (ds *DataStore) Subscribe(filter AddressFilter, ch chan<- ChangeEvent) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	ds.subscriptions	= append(ds.subscriptions, &subscription{
+		filter:	filter,
+		ch:	ch,
+	})
+
+	return
+}
+
+// Removes all subscriptions of ch.
+// No event is sent to ch once Unsubscribe returns.
+func (ds *DataStore) Unsubscribe(ch chan<- ChangeEvent) {
+	var subs	[]*subscription
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	for _, sub := range ds.subscriptions {
+		if sub.ch != ch {
+			subs	= append(subs, sub)
+		}
+	}
+	ds.subscriptions	= subs
+
+	return
+}
+
+// Sends an event to matching subscribers.
+// Must be called with ds.lock held.
+func (ds *DataStore) notify(ev ChangeEvent) {
+	for _, sub := range ds.subscriptions {
+		if sub.filter.DataType != ev.DataType ||
+		   ev.Addr < sub.filter.Start || ev.Addr > sub.filter.End {
+			continue
+		}
+
+		select {
+		case sub.ch <- ev:
+		default:
+			ds.logger.Warningf("subscriber channel full, dropping change " +
+					   "event (type: %v, addr: %v)", ev.DataType, ev.Addr)
+		}
+	}
+
+	return
+}
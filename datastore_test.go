@@ -0,0 +1,615 @@
+package modbus
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDataStore(t *testing.T) {
+	var ds		*DataStore
+	var err		error
+	var regs	[]uint16
+	var bools	[]bool
+	var reg		uint16
+	var coil	bool
+
+	ds	= NewDataStore(4, 4, 8, 8)
+
+	// application-side accessors
+	err	= ds.SetHoldingRegister(7, 0x1234)
+	if err != nil {
+		t.Errorf("SetHoldingRegister() should have succeeded, got: %v", err)
+	}
+	err	= ds.SetHoldingRegister(8, 0x1234)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+	err	= ds.SetInputRegister(0, 0x5678)
+	if err != nil {
+		t.Errorf("SetInputRegister() should have succeeded, got: %v", err)
+	}
+	err	= ds.SetDiscreteInput(3, true)
+	if err != nil {
+		t.Errorf("SetDiscreteInput() should have succeeded, got: %v", err)
+	}
+
+	// handler side
+	regs, err	= ds.HandleHoldingRegisters(1, 6, 2, false, nil)
+	if err != nil || len(regs) != 2 || regs[0] != 0 || regs[1] != 0x1234 {
+		t.Errorf("unexpected holding registers: %v, %v", regs, err)
+	}
+	_, err		= ds.HandleHoldingRegisters(1, 7, 2, false, nil)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+	regs, err	= ds.HandleInputRegisters(200, 0, 1)
+	if err != nil || regs[0] != 0x5678 {
+		t.Errorf("unexpected input registers: %v, %v", regs, err)
+	}
+	bools, err	= ds.HandleDiscreteInputs(1, 2, 2)
+	if err != nil || bools[0] || !bools[1] {
+		t.Errorf("unexpected discrete inputs: %v, %v", bools, err)
+	}
+
+	_, err		= ds.HandleCoils(1, 1, 2, true, []bool{true, true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+	coil, err	= ds.GetCoil(2)
+	if err != nil || !coil {
+		t.Errorf("expected coil 2 to be set, got: %v, %v", coil, err)
+	}
+
+	_, err		= ds.HandleHoldingRegisters(1, 0, 1, true, []uint16{0xbeef})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	reg, err	= ds.GetHoldingRegister(0)
+	if err != nil || reg != 0xbeef {
+		t.Errorf("expected 0xbeef, got: 0x%04x, %v", reg, err)
+	}
+
+	return
+}
+
+func TestDataStoreReadAndClearRegister(t *testing.T) {
+	var ds		*DataStore
+	var wg		sync.WaitGroup
+	var stop	chan struct{}
+	var done	chan uint64
+	var total	uint64
+	var value	uint16
+	var err		error
+
+	ds	= NewDataStore(0, 0, 4, 0)
+
+	// increments holding register #1 under the data store lock
+	increment := func() {
+		ds.lock.Lock()
+		ds.holdingRegisters[1]++
+		ds.lock.Unlock()
+	}
+
+	// read and clear the counter until told to stop
+	stop	= make(chan struct{})
+	done	= make(chan uint64)
+	go func() {
+		var sum	uint64
+
+		for {
+			select {
+			case <-stop:
+				done <- sum
+				return
+			default:
+			}
+
+			value, err := ds.ReadAndClearRegister(1)
+			if err != nil {
+				t.Errorf("ReadAndClearRegister() should have succeeded, got: %v", err)
+			}
+			sum	+= uint64(value)
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			for j := 0; j < 5000; j++ {
+				increment()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	total	= <-done
+
+	// collect the last pulses
+	value, err	= ds.ReadAndClearRegister(1)
+	if err != nil {
+		t.Errorf("ReadAndClearRegister() should have succeeded, got: %v", err)
+	}
+	total	+= uint64(value)
+
+	if total != 8 * 5000 {
+		t.Errorf("expected %v pulses, got %v", 8 * 5000, total)
+	}
+
+	_, err		= ds.ReadAndClearRegister(4)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// ResetCounters() should be all or nothing
+	ds.SetHoldingRegister(0, 10)
+	ds.SetHoldingRegister(2, 20)
+	err	= ds.ResetCounters([]uint16{0, 2, 4})
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+	value, _	= ds.GetHoldingRegister(0)
+	if value != 10 {
+		t.Errorf("register 0 should not have been cleared, got: %v", value)
+	}
+
+	err	= ds.ResetCounters([]uint16{0, 2})
+	if err != nil {
+		t.Errorf("ResetCounters() should have succeeded, got: %v", err)
+	}
+	for _, addr := range []uint16{0, 2} {
+		value, _	= ds.GetHoldingRegister(addr)
+		if value != 0 {
+			t.Errorf("register %v should have been cleared, got: %v", addr, value)
+		}
+	}
+
+	return
+}
+
+func TestDataStoreLock(t *testing.T) {
+	var ds		*DataStore
+	var unlock	UnlockFunc
+	var err		error
+	var done	chan []uint16
+	var regs	[]uint16
+
+	ds	= NewDataStore(0, 0, 4, 0)
+
+	_, err	= ds.Lock(4, HOLDING_REGISTERS, true)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+	_, err	= ds.Lock(0, COILS, true)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	unlock, err	= ds.Lock(0, HOLDING_REGISTERS, true)
+	if err != nil {
+		t.Fatalf("Lock() should have succeeded, got: %v", err)
+	}
+
+	// reads of other addresses should not be affected
+	regs, err	= ds.HandleHoldingRegisters(1, 1, 3, false, nil)
+	if err != nil || len(regs) != 3 {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v, %v", regs, err)
+	}
+
+	// reads covering register 0 should block until it is unlocked
+	done	= make(chan []uint16)
+	go func() {
+		regs, _ := ds.HandleHoldingRegisters(1, 0, 2, false, nil)
+		done <- regs
+	}()
+
+	// update the register while holding the lock
+	ds.SetHoldingRegister(0, 0x1234)
+
+	select {
+	case <-done:
+		t.Fatalf("read should have blocked while register 0 is locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	// unlocking twice should be harmless
+	unlock()
+
+	select {
+	case regs = <-done:
+		if regs[0] != 0x1234 {
+			t.Errorf("expected 0x1234, got 0x%04x", regs[0])
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("read should have completed after unlock")
+	}
+
+	// shared locks should not block reads
+	unlock, err	= ds.Lock(0, HOLDING_REGISTERS, false)
+	if err != nil {
+		t.Fatalf("Lock() should have succeeded, got: %v", err)
+	}
+	_, err	= ds.HandleHoldingRegisters(1, 0, 1, false, nil)
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	unlock()
+
+	return
+}
+
+func TestDataStoreSubscribe(t *testing.T) {
+	var ds		*DataStore
+	var ch		chan ChangeEvent
+	var full	chan ChangeEvent
+	var ev		ChangeEvent
+	var err		error
+
+	ds	= NewDataStore(16, 0, 16, 0)
+	ch	= make(chan ChangeEvent, 4)
+	full	= make(chan ChangeEvent)
+
+	ds.Subscribe(AddressFilter{DataType: HOLDING_REGISTERS, Start: 0, End: 9}, ch)
+	// unbuffered, hence always full: events should be dropped without
+	// blocking writers
+	ds.Subscribe(AddressFilter{DataType: HOLDING_REGISTERS, Start: 0, End: 9}, full)
+
+	_, err	= ds.HandleHoldingRegisters(1, 5, 1, true, []uint16{0x1234})
+	if err != nil {
+		t.Fatalf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+
+	select {
+	case ev = <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a change event")
+	}
+
+	if ev.DataType != HOLDING_REGISTERS || ev.Addr != 5 ||
+	   ev.OldVal != uint16(0) || ev.NewVal != uint16(0x1234) || ev.Timestamp.IsZero() {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	// writes outside of the filter should not be notified
+	ds.SetHoldingRegister(10, 0x0001)
+	ds.SetCoil(5, true)
+
+	// application-side writes should be notified
+	ds.SetHoldingRegister(9, 0x0002)
+	ev	= <-ch
+	if ev.Addr != 9 || ev.OldVal != uint16(0) || ev.NewVal != uint16(0x0002) {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	if len(ch) != 0 {
+		t.Errorf("expected no further events, got: %v", len(ch))
+	}
+
+	// no event should be sent once unsubscribed
+	ds.Unsubscribe(ch)
+	ds.SetHoldingRegister(5, 0x0003)
+	if len(ch) != 0 {
+		t.Errorf("expected no event after Unsubscribe()")
+	}
+
+	return
+}
+
+func TestDataStoreWithValidator(t *testing.T) {
+	var ds		*DataStore
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ee		ErrExceptionResponse
+	var reg		uint16
+	var err		error
+
+	ds	= NewDataStore(0, 0, 2, 0).WithValidator(
+		func(dataType DataObjectType, addr uint16, isWrite bool, newVal interface{}) (err error) {
+			switch {
+			// setpoint register 0 must be between 0 and 100
+			case dataType == HOLDING_REGISTERS && addr == 0 && isWrite &&
+			     newVal.(uint16) > 100:
+				err	= errors.New("setpoint out of range")
+			// register 1 is write-only
+			case dataType == HOLDING_REGISTERS && addr == 1 && !isWrite:
+				err	= ErrIllegalDataAddress
+			}
+
+			return
+		})
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5532",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5532",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	err	= client.WriteRegister(0, 100)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegister(0, 101)
+	if !errors.As(err, &ee) || ee.ExceptionCode != EX_ILLEGAL_DATA_VALUE {
+		t.Errorf("expected an illegal data value exception, got: %v", err)
+	}
+
+	// rejected writes should leave the register untouched
+	reg, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil || reg != 100 {
+		t.Errorf("expected 100, got: %v, %v", reg, err)
+	}
+
+	// the whole request should be rejected if any value is
+	err	= client.WriteRegisters(0, []uint16{101, 7})
+	if !errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("expected ErrIllegalDataValue, got: %v", err)
+	}
+
+	reg, _	= ds.GetHoldingRegister(1)
+	if reg != 0 {
+		t.Errorf("expected 0, got: %v", reg)
+	}
+
+	// modbus errors should be passed through
+	_, err	= client.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
+
+func TestDataStoreCopyRange(t *testing.T) {
+	var ds		*DataStore
+	var err		error
+	var value	uint16
+	var coil	bool
+
+	ds	= NewDataStore(4, 4, 20, 20)
+	for i := uint16(10); i < 15; i++ {
+		ds.SetHoldingRegister(i, 0x100 + i)
+	}
+
+	err	= ds.CopyRange(HOLDING_REGISTERS, INPUT_REGISTERS, 10, 10, 5)
+	if err != nil {
+		t.Fatalf("CopyRange() should have succeeded, got: %v", err)
+	}
+
+	// input registers should keep the copied values
+	for i := uint16(10); i < 15; i++ {
+		ds.SetHoldingRegister(i, 0)
+	}
+
+	for i := uint16(10); i < 15; i++ {
+		value, err	= ds.GetInputRegister(i)
+		if err != nil || value != 0x100 + i {
+			t.Errorf("input register %v: expected 0x%04x, got: 0x%04x, %v",
+				 i, 0x100 + i, value, err)
+		}
+	}
+
+	// overlapping ranges within the same table
+	err	= ds.CopyRange(INPUT_REGISTERS, INPUT_REGISTERS, 10, 11, 5)
+	if err != nil {
+		t.Errorf("CopyRange() should have succeeded, got: %v", err)
+	}
+	value, _	= ds.GetInputRegister(15)
+	if value != 0x10e {
+		t.Errorf("expected 0x010e, got: 0x%04x", value)
+	}
+
+	ds.SetDiscreteInput(3, true)
+	err	= ds.CopyRange(DISCRETE_INPUTS, COILS, 3, 0, 1)
+	coil, _	= ds.GetCoil(0)
+	if err != nil || !coil {
+		t.Errorf("expected coil 0 to be set, got: %v, %v", coil, err)
+	}
+
+	// out of bounds ranges should be rejected
+	err	= ds.CopyRange(HOLDING_REGISTERS, INPUT_REGISTERS, 16, 0, 5)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	err	= ds.CopyRange(HOLDING_REGISTERS, INPUT_REGISTERS, 0, 16, 5)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// no conversion between bools and registers
+	err	= ds.CopyRange(COILS, HOLDING_REGISTERS, 0, 0, 1)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	return
+}
+
+func TestDataStoreStats(t *testing.T) {
+	var ds		*DataStore
+	var stats	DataStoreStats
+	var err		error
+
+	ds	= NewDataStore(10, 10, 10, 10)
+
+	// 3 reads of holding registers 2-3, 1 read of input register 3
+	for i := 0; i < 3; i++ {
+		_, err	= ds.HandleHoldingRegisters(1, 2, 2, false, nil)
+		if err != nil {
+			t.Fatalf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+		}
+	}
+	ds.HandleInputRegisters(1, 3, 1)
+
+	// 2 writes to holding register 5, 1 write to coils 5-6
+	ds.HandleHoldingRegisters(1, 5, 1, true, []uint16{1})
+	ds.HandleHoldingRegisters(1, 5, 1, true, []uint16{2})
+	ds.HandleCoils(1, 5, 2, true, []bool{true, true})
+
+	// failed requests and application side accesses are not counted
+	ds.HandleHoldingRegisters(1, 9, 2, false, nil)
+	ds.SetHoldingRegister(7, 1)
+	ds.GetHoldingRegister(7)
+
+	stats	= ds.GetStats()
+	if len(stats.ReadCountPerAddress) != 2 ||
+	   stats.ReadCountPerAddress[2] != 3 || stats.ReadCountPerAddress[3] != 4 {
+		t.Errorf("unexpected read counts: %v", stats.ReadCountPerAddress)
+	}
+	if len(stats.WriteCountPerAddress) != 2 ||
+	   stats.WriteCountPerAddress[5] != 3 || stats.WriteCountPerAddress[6] != 1 {
+		t.Errorf("unexpected write counts: %v", stats.WriteCountPerAddress)
+	}
+	if stats.MostReadAddr != 3 || stats.MostWrittenAddr != 5 {
+		t.Errorf("expected most read/written addresses of 3/5, got: %v/%v",
+			 stats.MostReadAddr, stats.MostWrittenAddr)
+	}
+
+	ds.ResetStats()
+	stats	= ds.GetStats()
+	if len(stats.ReadCountPerAddress) != 0 || len(stats.WriteCountPerAddress) != 0 {
+		t.Errorf("expected all counters to be reset, got: %+v", stats)
+	}
+
+	return
+}
+
+func TestDataStoreCompareAndSwapRegister(t *testing.T) {
+	var ds		*DataStore
+	var wg		sync.WaitGroup
+	var winners	uint32
+	var reg		uint16
+	var swapped	bool
+	var err		error
+
+	ds	= NewDataStore(0, 0, 2, 0)
+
+	// goroutines race to swap register 0 from 0 to their id (1 to 100)
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(id uint16) {
+			defer wg.Done()
+
+			swapped, err := ds.CompareAndSwapRegister(0, 0, id)
+			if err != nil {
+				t.Errorf("CompareAndSwapRegister() should have succeeded, got: %v", err)
+			}
+			if swapped {
+				atomic.AddUint32(&winners, 1)
+			}
+		}(uint16(i))
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("expected exactly 1 winner, got: %v", winners)
+	}
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg == 0 || reg > 100 {
+		t.Errorf("expected the id of the winner, got: %v", reg)
+	}
+
+	// mismatches should leave the register untouched
+	swapped, err	= ds.CompareAndSwapRegister(0, 0, 0xffff)
+	if err != nil || swapped {
+		t.Errorf("expected no swap, got: %v, %v", swapped, err)
+	}
+	if r, _ := ds.GetHoldingRegister(0); r != reg {
+		t.Errorf("expected %v, got: %v", reg, r)
+	}
+
+	_, err	= ds.CompareAndSwapRegister(2, 0, 1)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
+
+func TestDataStoreIncrement(t *testing.T) {
+	var ds		*DataStore
+	var wg		sync.WaitGroup
+	var reg		uint16
+	var coil	bool
+	var err		error
+
+	ds	= NewDataStore(1, 0, 2, 0)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := ds.Increment(0, 1)
+			if err != nil {
+				t.Errorf("Increment() should have succeeded, got: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 100 {
+		t.Errorf("expected 100, got: %v", reg)
+	}
+
+	// negative deltas and overflows should wrap around
+	reg, err	= ds.Increment(1, -1)
+	if err != nil || reg != 0xffff {
+		t.Errorf("expected 0xffff, got: 0x%04x, %v", reg, err)
+	}
+
+	reg, err	= ds.Increment(1, 3)
+	if err != nil || reg != 2 {
+		t.Errorf("expected 2, got: %v, %v", reg, err)
+	}
+
+	_, err	= ds.Increment(2, 1)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	coil, err	= ds.IncrementCoil(0)
+	if err != nil || !coil {
+		t.Errorf("expected true, got: %v, %v", coil, err)
+	}
+
+	coil, err	= ds.IncrementCoil(0)
+	if err != nil || coil {
+		t.Errorf("expected false, got: %v, %v", coil, err)
+	}
+
+	_, err	= ds.IncrementCoil(1)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,270 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugClient wraps a Client and traces every request and response
+// to an io.Writer, in human-readable form.
+type debugClient struct {
+	inner		Client
+	w		io.Writer
+	lock		sync.Mutex
+	unitId		uint8	// last unit id set through SetUnitId()
+	unitIdSet	bool
+}
+
+// Returns a client wrapping inner, which prints every request and response
+// to w. Request lines look like
+//   → FC=ReadHoldingRegisters unitId=1 addr=100 qty=2
+// and response lines like
+//   ← [1234, 5678] (2.3ms)
+// or, when the request failed,
+//   ← ERR: illegal data address (2.3ms)
+// Values and errors returned by inner are passed to the caller unchanged.
+// The unit id is the one reported by inner (ModbusClient, ClientPool and
+// wrappers around them) or, for other clients, the one last set through the
+// debug client with SetUnitId(). It is left out when unknown.
+// This is intended as a development aid.
+func NewDebugClient(inner Client, w io.Writer) (c Client) {
+	c = &debugClient{
+		inner:	inner,
+		w:	w,
+	}
+
+	return
+}
+
+func (dc *debugClient) Open() (err error) {
+	err = dc.inner.Open()
+
+	return
+}
+
+func (dc *debugClient) Close() (err error) {
+	err = dc.inner.Close()
+
+	return
+}
+
+func (dc *debugClient) SetUnitId(id uint8) (err error) {
+	err = dc.inner.SetUnitId(id)
+	if err == nil {
+		dc.lock.Lock()
+		dc.unitId	= id
+		dc.unitIdSet	= true
+		dc.lock.Unlock()
+	}
+
+	return
+}
+
+func (dc *debugClient) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
+	err = dc.inner.SetEncoding(endianness, wordOrder)
+
+	return
+}
+
+func (dc *debugClient) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(FC_READ_COILS, addr, quantity, nil)
+	values, err	= dc.inner.ReadCoils(addr, quantity)
+	dc.traceResponse(start, values, err)
+
+	return
+}
+
+func (dc *debugClient) ReadCoil(addr uint16) (value bool, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(FC_READ_COILS, addr, 1, nil)
+	value, err	= dc.inner.ReadCoil(addr)
+	dc.traceResponse(start, []bool{value}, err)
+
+	return
+}
+
+func (dc *debugClient) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(FC_READ_DISCRETE_INPUTS, addr, quantity, nil)
+	values, err	= dc.inner.ReadDiscreteInputs(addr, quantity)
+	dc.traceResponse(start, values, err)
+
+	return
+}
+
+func (dc *debugClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(FC_READ_DISCRETE_INPUTS, addr, 1, nil)
+	value, err	= dc.inner.ReadDiscreteInput(addr)
+	dc.traceResponse(start, []bool{value}, err)
+
+	return
+}
+
+func (dc *debugClient) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(readRegistersFunctionCode(regType), addr, quantity, nil)
+	values, err	= dc.inner.ReadRegisters(addr, quantity, regType)
+	dc.traceResponse(start, values, err)
+
+	return
+}
+
+func (dc *debugClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	var start	time.Time
+
+	start		= dc.traceRequest(readRegistersFunctionCode(regType), addr, 1, nil)
+	value, err	= dc.inner.ReadRegister(addr, regType)
+	dc.traceResponse(start, []uint16{value}, err)
+
+	return
+}
+
+func (dc *debugClient) WriteCoil(addr uint16, value bool) (err error) {
+	var start	time.Time
+
+	start	= dc.traceRequest(FC_WRITE_SINGLE_COIL, addr, 1, []bool{value})
+	err	= dc.inner.WriteCoil(addr, value)
+	dc.traceResponse(start, nil, err)
+
+	return
+}
+
+func (dc *debugClient) WriteCoils(addr uint16, values []bool) (err error) {
+	var start	time.Time
+
+	start	= dc.traceRequest(FC_WRITE_MULTIPLE_COILS, addr, uint16(len(values)), values)
+	err	= dc.inner.WriteCoils(addr, values)
+	dc.traceResponse(start, nil, err)
+
+	return
+}
+
+func (dc *debugClient) WriteRegister(addr uint16, value uint16) (err error) {
+	var start	time.Time
+
+	start	= dc.traceRequest(FC_WRITE_SINGLE_REGISTER, addr, 1, []uint16{value})
+	err	= dc.inner.WriteRegister(addr, value)
+	dc.traceResponse(start, nil, err)
+
+	return
+}
+
+func (dc *debugClient) WriteRegisters(addr uint16, values []uint16) (err error) {
+	var start	time.Time
+
+	start	= dc.traceRequest(FC_WRITE_MULTIPLE_REGISTERS, addr, uint16(len(values)), values)
+	err	= dc.inner.WriteRegisters(addr, values)
+	dc.traceResponse(start, nil, err)
+
+	return
+}
+
+// Prints a request line and returns the request start time.
+func (dc *debugClient) traceRequest(functionCode uint8, addr uint16, quantity uint16,
+				    values interface{}) (start time.Time) {
+	var line	string
+	var unitId	uint8
+	var ok		bool
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	line	= fmt.Sprintf("→ FC=%s", functionCodeName(functionCode))
+	unitId, ok	= dc.currentUnitId()
+	if ok {
+		line += fmt.Sprintf(" unitId=%v", unitId)
+	}
+	line += fmt.Sprintf(" addr=%v qty=%v", addr, quantity)
+	if values != nil {
+		line += fmt.Sprintf(" values=%s", formatValues(values))
+	}
+	fmt.Fprintln(dc.w, line)
+
+	start	= time.Now()
+
+	return
+}
+
+// Returns the unit id requests are sent to, either reported by the inner
+// client or last set with SetUnitId(). ok is false if it is unknown.
+// Must be called with dc.lock held.
+func (dc *debugClient) currentUnitId() (unitId uint8, ok bool) {
+	unitId, ok	= unitIdOf(dc.inner)
+	if !ok && dc.unitIdSet {
+		unitId, ok	= dc.unitId, true
+	}
+
+	return
+}
+
+// Returns the unit id requests are sent to (see unitIdReporter).
+func (dc *debugClient) reportedUnitId() (unitId uint8, ok bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	unitId, ok	= dc.currentUnitId()
+
+	return
+}
+
+// Prints a response line, including the time elapsed since start.
+func (dc *debugClient) traceResponse(start time.Time, values interface{}, err error) {
+	var elapsed	string
+
+	elapsed	= fmt.Sprintf("%.1fms", float64(time.Since(start)) / float64(time.Millisecond))
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	switch {
+	case err != nil:
+		fmt.Fprintf(dc.w, "← ERR: %v (%s)\n", err, elapsed)
+	case values != nil:
+		fmt.Fprintf(dc.w, "← %s (%s)\n", formatValues(values), elapsed)
+	default:
+		fmt.Fprintf(dc.w, "← OK (%s)\n", elapsed)
+	}
+
+	return
+}
+
+// Returns the read function code matching regType.
+func readRegistersFunctionCode(regType RegType) (functionCode uint8) {
+	if regType == INPUT_REGISTER {
+		functionCode	= FC_READ_INPUT_REGISTERS
+	} else {
+		functionCode	= FC_READ_HOLDING_REGISTERS
+	}
+
+	return
+}
+
+// Formats a slice of bools or uint16s as a comma-separated list.
+func formatValues(values interface{}) (out string) {
+	var items	[]string
+
+	switch v := values.(type) {
+	case []bool:
+		for i := range v {
+			items = append(items, fmt.Sprintf("%v", v[i]))
+		}
+	case []uint16:
+		for i := range v {
+			items = append(items, fmt.Sprintf("%v", v[i]))
+		}
+	}
+
+	out	= "[" + strings.Join(items, ", ") + "]"
+
+	return
+}
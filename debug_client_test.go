@@ -0,0 +1,158 @@
+package modbus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugClient(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var buf		bytes.Buffer
+	var client	*ModbusClient
+	var dc		Client
+	var regs	[]uint16
+	var th		*testHandler
+	var lines	[]string
+
+	th = &testHandler{}
+	th.holding[0]	= 1234
+	th.holding[1]	= 5678
+
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5505",
+		MaxClients:	1,
+	}, th)
+	if err != nil {
+		t.Errorf("failed to create server: %v", err)
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Errorf("failed to start server: %v", err)
+	}
+
+	client, err = NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5505",
+	})
+	if err != nil {
+		t.Errorf("failed to create client: %v", err)
+	}
+
+	dc	= NewDebugClient(client, &buf)
+
+	err	= dc.Open()
+	if err != nil {
+		t.Errorf("failed to open client: %v", err)
+	}
+	dc.SetUnitId(9)
+
+	// a successful read
+	regs, err	= dc.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+	if len(regs) != 2 || regs[0] != 1234 || regs[1] != 5678 {
+		t.Errorf("expected {1234, 5678}, got: %v", regs)
+	}
+
+	// a failed read (past the end of the test handler's register space)
+	_, err		= dc.ReadRegisters(20, 1, HOLDING_REGISTER)
+	if err == nil {
+		t.Errorf("ReadRegisters() should have failed")
+	}
+
+	lines	= strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 trace lines, got %v: %q", len(lines), buf.String())
+	}
+
+	if lines[0] != "→ FC=ReadHoldingRegisters unitId=9 addr=0 qty=2" {
+		t.Errorf("unexpected request line: %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "← [1234, 5678] (") ||
+	   !strings.HasSuffix(lines[1], "ms)") {
+		t.Errorf("unexpected response line: %q", lines[1])
+	}
+	if lines[2] != "→ FC=ReadHoldingRegisters unitId=9 addr=20 qty=1" {
+		t.Errorf("unexpected request line: %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "← ERR: modbus exception: FC=3 (ReadHoldingRegisters) " +
+				"exception code=2 (IllegalDataAddress) (") {
+		t.Errorf("unexpected response line: %q", lines[3])
+	}
+
+	dc.Close()
+	server.Stop()
+
+	return
+}
+
+func TestDebugClientUnitId(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var buf		bytes.Buffer
+	var client	*ModbusClient
+	var dc		Client
+	var lines	[]string
+
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5580",
+	}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err = NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5580",
+		UnitId:		7,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// the unit id configured on the inner client should be traced, even
+	// through another wrapper
+	NewDebugClient(client, &buf).ReadRegister(0, HOLDING_REGISTER)
+	NewDebugClient(NewCachingClient(client, time.Second), &buf).ReadRegister(1, HOLDING_REGISTER)
+
+	// and so should unit ids set directly on the inner client
+	dc	= NewDebugClient(client, &buf)
+	client.SetUnitId(8)
+	dc.ReadRegister(2, HOLDING_REGISTER)
+
+	// unit ids of clients unable to report them should be left out
+	NewDebugClient(&stubClient{}, &buf).ReadRegister(3, HOLDING_REGISTER)
+
+	lines	= strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("expected 8 trace lines, got %v: %q", len(lines), buf.String())
+	}
+
+	for i, expected := range []string{
+		"→ FC=ReadHoldingRegisters unitId=7 addr=0 qty=1",
+		"→ FC=ReadHoldingRegisters unitId=7 addr=1 qty=1",
+		"→ FC=ReadHoldingRegisters unitId=8 addr=2 qty=1",
+		"→ FC=ReadHoldingRegisters addr=3 qty=1",
+	} {
+		if lines[2 * i] != expected {
+			t.Errorf("expected request line %q, got: %q", expected, lines[2 * i])
+		}
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package modbus
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Returns a new modbus server listening at addr (e.g. tcp://localhost:5502,
+// or simply localhost:5502 for TCP), logging every request and response to
+// os.Stderr along with a hex dump of their PDUs.
+// This is meant as a development aid: a warning is printed when the server
+// is started if the ENV environment variable is set to "production".
+func NewDebugServer(addr string, handler RequestHandler) (ms *ModbusServer, err error) {
+	if !strings.Contains(addr, "://") {
+		addr	= "tcp://" + addr
+	}
+
+	ms, err	= NewServer(&ServerConfiguration{URL: addr}, handler)
+	if err != nil {
+		return
+	}
+
+	NewLoggingServer(ms, os.Stderr, LOG_LEVEL_INFO)
+	ms.requestLogger.hexDump	= true
+	ms.debugOut			= os.Stderr
+
+	return
+}
+
+// Prints a warning to the traffic log output of debug servers if the ENV
+// environment variable is set to "production".
+// Must be called with ms.lock held.
+func (ms *ModbusServer) warnIfDebugInProduction() {
+	if ms.debugOut == nil || os.Getenv("ENV") != "production" {
+		return
+	}
+
+	fmt.Fprintf(ms.debugOut,
+		    "**************************************************************\n" +
+		    "WARNING: modbus debug server (%s) running in production,\n" +
+		    "         all traffic is being logged\n" +
+		    "**************************************************************\n",
+		    ms.conf.URL)
+
+	return
+}
@@ -0,0 +1,106 @@
+package modbus
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDebugServer(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var stderr	*os.File
+	var r		*os.File
+	var w		*os.File
+	var buf		syncBuffer
+	var copied	chan struct{}
+	var out		string
+	var err		error
+
+	t.Setenv("ENV", "production")
+
+	// capture stderr, which the debug server logs to
+	r, w, err	= os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+
+	copied	= make(chan struct{})
+	go func() {
+		io.Copy(&buf, r)
+		close(copied)
+	}()
+
+	stderr		= os.Stderr
+	os.Stderr	= w
+	defer func() {
+		os.Stderr	= stderr
+		w.Close()
+		<-copied
+		r.Close()
+	}()
+
+	server, err	= NewDebugServer("localhost:5534", NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// the warning should only be printed once the server is started
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(buf.String(), "WARNING: modbus debug server") {
+		t.Errorf("no warning should be printed before Start(), got: %q", buf.String())
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "WARNING"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(buf.String(), "WARNING: modbus debug server (localhost:5534)") {
+		t.Errorf("expected a production warning, got: %q", buf.String())
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5534",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	// the response may be logged after the client gets it
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "tx pdu"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	out	= buf.String()
+	for _, expected := range []string{
+		"rx unitId=1 fc=ReadHoldingRegisters addr=0-0",
+		"rx pdu: 01 03 00 00 00 01",
+		"tx unitId=1 fc=ReadHoldingRegisters addr=0-0 status=OK",
+		"tx pdu: 01 03 02 00 00",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in output, got: %q", expected, out)
+		}
+	}
+
+	return
+}
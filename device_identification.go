@@ -0,0 +1,396 @@
+package modbus
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+const (
+	// read device identification (encapsulated interface transport,
+	// MEI type 0x0e)
+	FC_READ_DEVICE_IDENTIFICATION	uint8	= 0x2b
+	MEI_READ_DEVICE_IDENTIFICATION	uint8	= 0x0e
+
+	// read device id codes
+	READ_DEVICE_ID_BASIC		uint8	= 0x01	// objects 0x00 to 0x02
+	READ_DEVICE_ID_REGULAR		uint8	= 0x02	// objects 0x00 to 0x7f
+	READ_DEVICE_ID_EXTENDED		uint8	= 0x03	// objects 0x00 to 0xff
+	READ_DEVICE_ID_SPECIFIC		uint8	= 0x04	// a single object
+
+	// standard object ids
+	DEVICE_ID_VENDOR_NAME		uint8	= 0x00
+	DEVICE_ID_PRODUCT_CODE		uint8	= 0x01
+	DEVICE_ID_MAJOR_MINOR_REVISION	uint8	= 0x02
+	DEVICE_ID_VENDOR_URL		uint8	= 0x03
+	DEVICE_ID_PRODUCT_NAME		uint8	= 0x04
+	DEVICE_ID_MODEL_NAME		uint8	= 0x05
+	DEVICE_ID_USER_APPLICATION_NAME	uint8	= 0x06
+
+	// length of the response header (MEI type, read device id code,
+	// conformity level, more follows, next object id and number of objects)
+	deviceIdHeaderLength		int	= 6
+	// room left for objects in a response PDU (253 bytes, minus the
+	// function code and the response header)
+	maxDeviceIdObjectsLength	int	= 253 - 1 - deviceIdHeaderLength
+)
+
+// The DeviceIdentificationHandler interface can optionally be implemented by
+// request handlers to answer read device identification (0x2b/0x0e) requests.
+// Servers whose handler does not implement it answer such requests with an
+// illegal function exception, unless objects were set with
+// SetDeviceIdentification().
+type DeviceIdentificationHandler interface {
+	// HandleDeviceIdentification returns all identification objects of the
+	// unit, keyed by object id (see DEVICE_ID_* for standard ids, 0x80 to
+	// 0xff are vendor specific).
+	// Responses are built (and split across multiple responses if needed)
+	// by the server.
+	HandleDeviceIdentification(unitId uint8) (objects map[uint8]string, err error)
+}
+
+// Sets the identification objects returned to read device identification
+// (0x2b/0x0e) requests, keyed by object id (see DEVICE_ID_* for standard
+// ids, 0x80 to 0xff are vendor specific), for all unit ids.
+// Takes precedence over the handler if it implements
+// DeviceIdentificationHandler. Passing nil restores the default behaviour.
+// Responses are split across multiple responses as needed ("more follows").
+func (ms *ModbusServer) SetDeviceIdentification(objects map[uint8]string) {
+	var copied	map[uint8]string
+
+	if objects != nil {
+		copied	= make(map[uint8]string, len(objects))
+		for id, value := range objects {
+			copied[id]	= value
+		}
+	}
+
+	ms.lock.Lock()
+	ms.deviceIdObjects	= copied
+	ms.lock.Unlock()
+
+	return
+}
+
+// Reads device identification objects (function code 0x2b, MEI type 0x0e).
+// With readDeviceIdCode set to READ_DEVICE_ID_BASIC, READ_DEVICE_ID_REGULAR or
+// READ_DEVICE_ID_EXTENDED, all objects of the category are read starting at
+// objectId (usually 0), issuing as many requests as the server needs to
+// stream them.
+// With READ_DEVICE_ID_SPECIFIC, only objectId is read.
+func (mc *ModbusClient) ReadDeviceIdentification(readDeviceIdCode uint8, objectId uint8) (objects map[uint8]string, err error) {
+	objects, err	= mc.ReadDeviceIdentificationContext(context.Background(), readDeviceIdCode, objectId)
+
+	return
+}
+
+// Same as ReadDeviceIdentification(), but returns ctx.Err() as soon as ctx is
+// done, including between the requests of a stream.
+func (mc *ModbusClient) ReadDeviceIdentificationContext(ctx context.Context,
+							readDeviceIdCode uint8, objectId uint8) (objects map[uint8]string, err error) {
+	var req		*pdu
+	var res		*pdu
+	var moreFollows	bool
+	var nextId	uint8
+
+	if readDeviceIdCode < READ_DEVICE_ID_BASIC || readDeviceIdCode > READ_DEVICE_ID_SPECIFIC {
+		err = ErrUnexpectedParameters
+		mc.logger.Errorf("unexpected read device id code (%v)", readDeviceIdCode)
+		return
+	}
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	objects	= make(map[uint8]string)
+
+	for {
+		req	= &pdu{
+			unitId:		mc.unitId,
+			functionCode:	FC_READ_DEVICE_IDENTIFICATION,
+			payload:	[]byte{
+				MEI_READ_DEVICE_IDENTIFICATION, readDeviceIdCode, objectId,
+			},
+		}
+
+		res, err	= mc.executeRequest(req)
+		if err != nil {
+			objects	= nil
+			return
+		}
+
+		switch {
+		case res.functionCode == req.functionCode:
+			moreFollows, nextId, err = decodeDeviceIdentification(
+				res.payload, readDeviceIdCode, objects)
+
+		case res.functionCode == (req.functionCode | 0x80):
+			if len(res.payload) != 1 {
+				err	= ErrProtocolError
+				break
+			}
+
+			err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+		default:
+			err	= ErrProtocolError
+			mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+		}
+
+		if err != nil {
+			objects	= nil
+			return
+		}
+
+		if !moreFollows || readDeviceIdCode == READ_DEVICE_ID_SPECIFIC {
+			break
+		}
+
+		// the stream should only ever move forward
+		if nextId <= objectId {
+			mc.logger.Warningf("next object id (0x%02x) does not follow 0x%02x",
+					   nextId, objectId)
+			objects	= nil
+			err	= ErrProtocolError
+			return
+		}
+		objectId	= nextId
+	}
+
+	return
+}
+
+// Decodes the payload of a read device identification response into objects.
+// Returns the more follows and next object id fields.
+func decodeDeviceIdentification(payload []byte, readDeviceIdCode uint8,
+				objects map[uint8]string) (moreFollows bool, nextId uint8, err error) {
+	var objectCount	int
+	var offset	int
+	var length	int
+
+	if len(payload) < deviceIdHeaderLength ||
+	   payload[0] != MEI_READ_DEVICE_IDENTIFICATION ||
+	   payload[1] != readDeviceIdCode {
+		err	= ErrProtocolError
+		return
+	}
+
+	moreFollows	= payload[3] == 0xff
+	nextId		= payload[4]
+	objectCount	= int(payload[5])
+	offset		= deviceIdHeaderLength
+
+	for i := 0; i < objectCount; i++ {
+		if offset + 2 > len(payload) {
+			err	= ErrProtocolError
+			return
+		}
+
+		length	= int(payload[offset + 1])
+		if offset + 2 + length > len(payload) {
+			err	= ErrProtocolError
+			return
+		}
+
+		objects[payload[offset]] = string(payload[offset + 2:offset + 2 + length])
+		offset	+= 2 + length
+	}
+
+	if offset != len(payload) {
+		err	= ErrProtocolError
+		return
+	}
+
+	return
+}
+
+// Handles a read device identification request, building the response out of
+// the objects returned by the device identification handler.
+// Objects which do not fit in a single response are left for a follow-up
+// request, starting at the next object id.
+func (ms *ModbusServer) processDeviceIdentification(req *pdu) (res *pdu, err error) {
+	var handler	DeviceIdentificationHandler
+	var ok		bool
+	var objects	map[uint8]string
+	var ids		[]int
+	var lastId	uint8
+	var conformity	uint8
+	var start	int
+	var value	string
+	var objectCount	uint8
+	var length	int
+
+	ms.lock.Lock()
+	objects	= ms.deviceIdObjects
+	ms.lock.Unlock()
+
+	handler, ok	= ms.userHandler().(DeviceIdentificationHandler)
+	if !ok && objects == nil {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	if len(req.payload) != 3 {
+		err	= ErrProtocolError
+		return
+	}
+
+	if req.payload[0] != MEI_READ_DEVICE_IDENTIFICATION {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	switch req.payload[1] {
+	case READ_DEVICE_ID_BASIC:	lastId = DEVICE_ID_MAJOR_MINOR_REVISION
+	case READ_DEVICE_ID_REGULAR:	lastId = 0x7f
+	case READ_DEVICE_ID_EXTENDED,
+	     READ_DEVICE_ID_SPECIFIC:	lastId = 0xff
+	default:
+		err	= ErrIllegalDataValue
+		return
+	}
+
+	// objects set with SetDeviceIdentification() take precedence over
+	// the handler
+	if objects == nil {
+		objects, err	= handler.HandleDeviceIdentification(req.unitId)
+		if err != nil {
+			return
+		}
+	}
+
+	// sort object ids and figure out our conformity level (all levels
+	// support individual access)
+	conformity	= 0x81
+	for id := range objects {
+		ids	= append(ids, int(id))
+
+		if id > 0x7f {
+			conformity	= 0x83
+		} else if id > DEVICE_ID_MAJOR_MINOR_REVISION && conformity < 0x82 {
+			conformity	= 0x82
+		}
+	}
+	sort.Ints(ids)
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	[]byte{
+			MEI_READ_DEVICE_IDENTIFICATION, req.payload[1], conformity,
+			0x00, 0x00, 0x00,
+		},
+	}
+
+	if req.payload[1] == READ_DEVICE_ID_SPECIFIC {
+		value, ok	= objects[req.payload[2]]
+		if !ok {
+			res	= nil
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		res.payload[5]	= 1
+		res.payload	= appendDeviceIdObject(res.payload, req.payload[2], value)
+		return
+	}
+
+	// start at the requested object if known, restart from the beginning
+	// of the category otherwise
+	if _, ok = objects[req.payload[2]]; ok && req.payload[2] <= lastId {
+		start	= int(req.payload[2])
+	}
+
+	for _, id := range ids {
+		if id < start || id > int(lastId) {
+			continue
+		}
+
+		// leave objects which do not fit for the next request, unless
+		// the object would not fit in any response (it is then truncated)
+		length	= 2 + len(objects[uint8(id)])
+		if len(res.payload) - deviceIdHeaderLength + length > maxDeviceIdObjectsLength &&
+		   objectCount > 0 {
+			res.payload[3]	= 0xff
+			res.payload[4]	= uint8(id)
+			break
+		}
+
+		res.payload	= appendDeviceIdObject(res.payload, uint8(id), objects[uint8(id)])
+		objectCount++
+	}
+	res.payload[5]	= objectCount
+
+	return
+}
+
+// Appends an object (id, length and value) to a device identification
+// response payload, truncating values which would not fit in a response.
+func appendDeviceIdObject(payload []byte, id uint8, value string) (out []byte) {
+	if len(value) > maxDeviceIdObjectsLength - 2 {
+		value	= value[0:maxDeviceIdObjectsLength - 2]
+	}
+
+	out	= append(payload, id, uint8(len(value)))
+	out	= append(out, value...)
+
+	return
+}
+
+// Reads the rest of a device identification response from the rtu link into
+// rxbuf, past the unit id, function code and MEI type fields (offset 3).
+// As these responses carry no byte count field, objects are read one by one.
+// Returns the offset of the trailing CRC in rxbuf.
+func (rt *rtuTransport) readDeviceIdentificationFrame(rxbuf []byte) (offset int, err error) {
+	var objectCount	int
+
+	// read device id code, conformity level, more follows, next object id
+	// and number of objects
+	offset		= 3
+	offset, err	= rt.readRTUBytes(rxbuf, offset, deviceIdHeaderLength - 1)
+	if err != nil {
+		return
+	}
+
+	objectCount	= int(rxbuf[offset - 1])
+	for i := 0; i < objectCount; i++ {
+		// object id and length
+		offset, err	= rt.readRTUBytes(rxbuf, offset, 2)
+		if err != nil {
+			return
+		}
+
+		// object value
+		offset, err	= rt.readRTUBytes(rxbuf, offset, int(rxbuf[offset - 1]))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Reads count bytes from the rtu link into rxbuf at offset, leaving room for
+// a trailing CRC. Returns the offset past the bytes read.
+func (rt *rtuTransport) readRTUBytes(rxbuf []byte, offset int, count int) (next int, err error) {
+	var byteCount	int
+
+	if offset + count + 2 > len(rxbuf) {
+		err	= ErrProtocolError
+		return
+	}
+
+	byteCount, err	= io.ReadFull(rt.link, rxbuf[offset:offset + count])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return
+	}
+	if byteCount != count {
+		rt.logger.Warningf("expected %v bytes, received %v", count, byteCount)
+		err	= ErrShortFrame
+		return
+	}
+
+	next	= offset + count
+
+	return
+}
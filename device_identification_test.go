@@ -0,0 +1,250 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deviceIdHandler is a DataStore answering device identification requests.
+type deviceIdHandler struct {
+	*DataStore
+	objects	map[uint8]string
+}
+
+func (dih *deviceIdHandler) HandleDeviceIdentification(unitId uint8) (objects map[uint8]string, err error) {
+	objects	= dih.objects
+
+	return
+}
+
+func TestReadDeviceIdentification(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var handler	*deviceIdHandler
+	var objects	map[uint8]string
+	var err		error
+
+	handler	= &deviceIdHandler{
+		DataStore:	NewDataStore(0, 0, 0, 0),
+		objects:	map[uint8]string{
+			DEVICE_ID_VENDOR_NAME:		"ACME",
+			DEVICE_ID_PRODUCT_CODE:		"RTU-42",
+			DEVICE_ID_MAJOR_MINOR_REVISION:	"1.2",
+			DEVICE_ID_PRODUCT_NAME:		"Remote I/O",
+		},
+	}
+
+	// add ~600 bytes worth of vendor specific objects, which cannot fit
+	// in a single response
+	for id := 0x80; id < 0x94; id++ {
+		handler.objects[uint8(id)] = fmt.Sprintf("object 0x%02x %s", id, strings.Repeat("x", 18))
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5529",
+	}, handler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5529",
+		Timeout:	1 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// basic objects only
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_BASIC, 0)
+	if err != nil {
+		t.Fatalf("ReadDeviceIdentification() should have succeeded, got: %v", err)
+	}
+	if len(objects) != 3 || objects[DEVICE_ID_VENDOR_NAME] != "ACME" ||
+	   objects[DEVICE_ID_PRODUCT_CODE] != "RTU-42" ||
+	   objects[DEVICE_ID_MAJOR_MINOR_REVISION] != "1.2" {
+		t.Errorf("unexpected basic objects: %v", objects)
+	}
+
+	// all objects, streamed across multiple responses
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_EXTENDED, 0)
+	if err != nil {
+		t.Fatalf("ReadDeviceIdentification() should have succeeded, got: %v", err)
+	}
+	if len(objects) != len(handler.objects) {
+		t.Errorf("expected %v objects, got: %v", len(handler.objects), len(objects))
+	}
+	for id, value := range handler.objects {
+		if objects[id] != value {
+			t.Errorf("object 0x%02x: expected '%s', got: '%s'", id, value, objects[id])
+		}
+	}
+
+	// a single object
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_SPECIFIC, 0x90)
+	if err != nil {
+		t.Fatalf("ReadDeviceIdentification() should have succeeded, got: %v", err)
+	}
+	if len(objects) != 1 || objects[0x90] != handler.objects[0x90] {
+		t.Errorf("unexpected objects: %v", objects)
+	}
+
+	// an unknown object
+	_, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_SPECIFIC, 0x10)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
+
+func TestDeviceIdentificationRTUFraming(t *testing.T) {
+	var server	*ModbusServer
+	var rt		*rtuTransport
+	var link	*bufferLink
+	var res		*pdu
+	var frame	*pdu
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{URL: "tcp://localhost:5502"},
+				    &deviceIdHandler{
+		DataStore:	NewDataStore(0, 0, 0, 0),
+		objects:	map[uint8]string{
+			DEVICE_ID_VENDOR_NAME:	"ACME",
+			0x80:			strings.Repeat("y", 200),
+			0x81:			strings.Repeat("z", 200),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	res, err	= server.processDeviceIdentification(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_READ_DEVICE_IDENTIFICATION,
+		payload:	[]byte{MEI_READ_DEVICE_IDENTIFICATION, READ_DEVICE_ID_EXTENDED, 0x00},
+	})
+	if err != nil {
+		t.Fatalf("processDeviceIdentification() should have succeeded, got: %v", err)
+	}
+
+	// the second vendor object should be left for a follow-up request
+	if len(res.payload) > 252 || res.payload[3] != 0xff || res.payload[4] != 0x81 ||
+	   res.payload[5] != 2 {
+		t.Errorf("unexpected response header: % x", res.payload[0:6])
+	}
+
+	// the response should survive a round trip over an rtu link
+	link	= &bufferLink{}
+	rt	= newRTUTransport(link, "", 19200, 100 * time.Millisecond)
+	link.rx.Write(rt.assembleRTUFrame(res))
+
+	frame, err	= rt.readRTUFrame()
+	if err != nil {
+		t.Fatalf("readRTUFrame() should have succeeded, got: %v", err)
+	}
+	if frame.unitId != 0x11 || frame.functionCode != FC_READ_DEVICE_IDENTIFICATION ||
+	   string(frame.payload) != string(res.payload) {
+		t.Errorf("unexpected frame: %+v", frame)
+	}
+
+	return
+}
+
+func TestServerSetDeviceIdentification(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var objects	map[uint8]string
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5560",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5560",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// without objects, requests should be rejected
+	_, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_BASIC, 0)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	objects	= map[uint8]string{
+		DEVICE_ID_VENDOR_NAME:		"ACME",
+		DEVICE_ID_PRODUCT_CODE:		"PLC-7",
+		DEVICE_ID_MAJOR_MINOR_REVISION:	"3.1",
+		DEVICE_ID_MODEL_NAME:		"PLC-7/24V",
+	}
+	// add vendor specific objects which cannot fit in a single response
+	for id := 0x80; id < 0x90; id++ {
+		objects[uint8(id)]	= strings.Repeat("y", 40)
+	}
+	server.SetDeviceIdentification(objects)
+
+	// changes to the map should not affect the server
+	objects[DEVICE_ID_VENDOR_NAME]	= "changed"
+
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_BASIC, 0)
+	if err != nil {
+		t.Fatalf("ReadDeviceIdentification() should have succeeded, got: %v", err)
+	}
+	if len(objects) != 3 || objects[DEVICE_ID_VENDOR_NAME] != "ACME" ||
+	   objects[DEVICE_ID_PRODUCT_CODE] != "PLC-7" ||
+	   objects[DEVICE_ID_MAJOR_MINOR_REVISION] != "3.1" {
+		t.Errorf("unexpected basic objects: %v", objects)
+	}
+
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_REGULAR, 0)
+	if err != nil || len(objects) != 4 || objects[DEVICE_ID_MODEL_NAME] != "PLC-7/24V" {
+		t.Errorf("unexpected regular objects: %v (%v)", objects, err)
+	}
+
+	objects, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_EXTENDED, 0)
+	if err != nil || len(objects) != 4 + 16 {
+		t.Errorf("expected 20 extended objects, got: %v (%v)", len(objects), err)
+	}
+
+	// clearing objects should restore the default behaviour
+	server.SetDeviceIdentification(nil)
+	_, err	= client.ReadDeviceIdentification(READ_DEVICE_ID_BASIC, 0)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	return
+}
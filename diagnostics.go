@@ -0,0 +1,142 @@
+package modbus
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// diagnostics (function code 0x08) sub-function codes
+	DIAG_RETURN_QUERY_DATA			uint16	= 0x0000
+	DIAG_RETURN_DIAGNOSTIC_REGISTER		uint16	= 0x0002
+	DIAG_CLEAR_COUNTERS			uint16	= 0x000a
+	DIAG_RETURN_BUS_MESSAGE_COUNT		uint16	= 0x000b
+	DIAG_RETURN_BUS_COMM_ERROR_COUNT	uint16	= 0x000c
+	DIAG_RETURN_BUS_EXCEPTION_ERROR_COUNT	uint16	= 0x000d
+	DIAG_RETURN_SERVER_MESSAGE_COUNT	uint16	= 0x000e
+	DIAG_RETURN_SERVER_NO_RESPONSE_COUNT	uint16	= 0x000f
+)
+
+// DiagnosticCounters holds the counters returned by the diagnostics function
+// (0x08). As per the spec, counters are 16-bit wide and wrap around.
+type DiagnosticCounters struct {
+	// requests received by the server, addressed to it or not
+	BusMessages		uint16
+	// frames dropped because of a CRC/LRC mismatch (serial links only)
+	BusCommErrors		uint16
+	// exception responses sent
+	BusExceptionErrors	uint16
+	// requests addressed to the server (including broadcasts)
+	ServerMessages		uint16
+	// requests left unanswered (broadcasts)
+	ServerNoResponses	uint16
+}
+
+// diagnosticCounters holds the counters of a server, updated atomically.
+type diagnosticCounters struct {
+	busMessages		uint32
+	busCommErrors		uint32
+	busExceptionErrors	uint32
+	serverMessages		uint32
+	serverNoResponses	uint32
+	diagnosticRegister	uint32
+}
+
+// Returns the diagnostic counters of the server, as returned by the
+// diagnostics function (0x08).
+func (ms *ModbusServer) DiagnosticCounters() (counters DiagnosticCounters) {
+	counters	= DiagnosticCounters{
+		BusMessages:		uint16(atomic.LoadUint32(&ms.diag.busMessages)),
+		BusCommErrors:		uint16(atomic.LoadUint32(&ms.diag.busCommErrors)),
+		BusExceptionErrors:	uint16(atomic.LoadUint32(&ms.diag.busExceptionErrors)),
+		ServerMessages:		uint16(atomic.LoadUint32(&ms.diag.serverMessages)),
+		ServerNoResponses:	uint16(atomic.LoadUint32(&ms.diag.serverNoResponses)),
+	}
+
+	return
+}
+
+// Sets the value of the diagnostic register, as returned by the return
+// diagnostic register sub-function (0x0002) and cleared by the clear counters
+// sub-function (0x000a).
+func (ms *ModbusServer) SetDiagnosticRegister(value uint16) {
+	atomic.StoreUint32(&ms.diag.diagnosticRegister, uint32(value))
+
+	return
+}
+
+// Clears all counters and the diagnostic register.
+func (ms *ModbusServer) clearDiagnosticCounters() {
+	atomic.StoreUint32(&ms.diag.busMessages, 0)
+	atomic.StoreUint32(&ms.diag.busCommErrors, 0)
+	atomic.StoreUint32(&ms.diag.busExceptionErrors, 0)
+	atomic.StoreUint32(&ms.diag.serverMessages, 0)
+	atomic.StoreUint32(&ms.diag.serverNoResponses, 0)
+	atomic.StoreUint32(&ms.diag.diagnosticRegister, 0)
+
+	return
+}
+
+// Handles a diagnostics request.
+// Responses to the return query data sub-function echo the request (over
+// RTU, query data must be 2 bytes long for the frame to be delimited), other
+// sub-functions expect a 2-byte data field (0x0000) and answer with the
+// requested counter in place of it.
+func (ms *ModbusServer) processDiagnostics(req *pdu) (res *pdu, err error) {
+	var subFunction	uint16
+	var value	uint32
+
+	if len(req.payload) < 2 {
+		err	= ErrProtocolError
+		return
+	}
+
+	subFunction	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+
+	if subFunction == DIAG_RETURN_QUERY_DATA {
+		res	= &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+			payload:	append([]byte{}, req.payload...),
+		}
+		return
+	}
+
+	if len(req.payload) != 4 {
+		err	= ErrProtocolError
+		return
+	}
+
+	if bytesToUint16(BIG_ENDIAN, req.payload[2:4]) != 0x0000 {
+		err	= ErrIllegalDataValue
+		return
+	}
+
+	switch subFunction {
+	case DIAG_RETURN_DIAGNOSTIC_REGISTER:
+		value	= atomic.LoadUint32(&ms.diag.diagnosticRegister)
+	case DIAG_CLEAR_COUNTERS:
+		ms.clearDiagnosticCounters()
+	case DIAG_RETURN_BUS_MESSAGE_COUNT:
+		value	= atomic.LoadUint32(&ms.diag.busMessages)
+	case DIAG_RETURN_BUS_COMM_ERROR_COUNT:
+		value	= atomic.LoadUint32(&ms.diag.busCommErrors)
+	case DIAG_RETURN_BUS_EXCEPTION_ERROR_COUNT:
+		value	= atomic.LoadUint32(&ms.diag.busExceptionErrors)
+	case DIAG_RETURN_SERVER_MESSAGE_COUNT:
+		value	= atomic.LoadUint32(&ms.diag.serverMessages)
+	case DIAG_RETURN_SERVER_NO_RESPONSE_COUNT:
+		value	= atomic.LoadUint32(&ms.diag.serverNoResponses)
+	default:
+		err	= ErrIllegalFunction
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	uint16ToBytes(BIG_ENDIAN, subFunction),
+	}
+	res.payload	= append(res.payload, uint16ToBytes(BIG_ENDIAN, uint16(value))...)
+
+	return
+}
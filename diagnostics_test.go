@@ -0,0 +1,186 @@
+package modbus
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerDiagnostics(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var sock	net.Conn
+	var tt		*tcpTransport
+	var rt		*rtuTransport
+	var p1, p2	net.Conn
+	var res		*pdu
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5561",
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	sock, err	= net.Dial("tcp", "localhost:5561")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	tt	= newTCPTransport(sock, 1 * time.Second)
+	defer tt.Close()
+
+	for _, tc := range []struct {
+		desc		string
+		setup		func()
+		fc		uint8
+		payload		[]byte
+		expectedFC	uint8
+		expectedPayload	[]byte
+	}{
+		{
+			desc:			"loopback",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x00, 0xa5, 0x37, 0x42},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x00, 0xa5, 0x37, 0x42},
+		}, {
+			desc:			"exception response",
+			fc:			FC_READ_HOLDING_REGISTERS,
+			payload:		[]byte{0x00, 0x01, 0x00, 0x01},
+			expectedFC:		FC_READ_HOLDING_REGISTERS | 0x80,
+			expectedPayload:	[]byte{EX_ILLEGAL_DATA_ADDRESS},
+		}, {
+			desc:			"bus message count",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x0b, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x0b, 0x00, 0x03},
+		}, {
+			desc:			"bus exception error count",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x0d, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x0d, 0x00, 0x01},
+		}, {
+			desc:			"server message count",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x0e, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x0e, 0x00, 0x05},
+		}, {
+			desc:			"diagnostic register",
+			setup:			func() { server.SetDiagnosticRegister(0xbeef) },
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x02, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x02, 0xbe, 0xef},
+		}, {
+			desc:			"clear counters",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x0a, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x0a, 0x00, 0x00},
+		}, {
+			desc:			"cleared diagnostic register",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x02, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS,
+			expectedPayload:	[]byte{0x00, 0x02, 0x00, 0x00},
+		}, {
+			desc:			"non-zero data field",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x0b, 0x00, 0x01},
+			expectedFC:		FC_DIAGNOSTICS | 0x80,
+			expectedPayload:	[]byte{EX_ILLEGAL_DATA_VALUE},
+		}, {
+			desc:			"unsupported sub-function",
+			fc:			FC_DIAGNOSTICS,
+			payload:		[]byte{0x00, 0x14, 0x00, 0x00},
+			expectedFC:		FC_DIAGNOSTICS | 0x80,
+			expectedPayload:	[]byte{EX_ILLEGAL_FUNCTION},
+		},
+	} {
+		if tc.setup != nil {
+			tc.setup()
+		}
+
+		res, err	= tt.ExecuteRequest(&pdu{
+			unitId:		1,
+			functionCode:	tc.fc,
+			payload:		tc.payload,
+		})
+		if err != nil {
+			t.Fatalf("%s: ExecuteRequest() should have succeeded, got: %v", tc.desc, err)
+		}
+		if res.functionCode != tc.expectedFC || !bytes.Equal(res.payload, tc.expectedPayload) {
+			t.Errorf("%s: expected fc 0x%02x and payload % x, got: %+v",
+				 tc.desc, tc.expectedFC, tc.expectedPayload, res)
+		}
+	}
+
+	// 3 requests since counters were cleared, 2 of which were exceptions
+	if server.DiagnosticCounters() != (DiagnosticCounters{
+		BusMessages:		3,
+		BusExceptionErrors:	2,
+		ServerMessages:		3,
+	}) {
+		t.Errorf("unexpected counters: %+v", server.DiagnosticCounters())
+	}
+
+	// over RTU, frames with a bad CRC should be counted as communication
+	// errors and broadcasts as unanswered requests
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	rt	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	err	= rt.WriteRequest(&pdu{
+		unitId:		0,
+		functionCode:	FC_WRITE_SINGLE_REGISTER,
+		payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+	})
+	if err != nil {
+		t.Fatalf("failed to write to pipe: %v", err)
+	}
+
+	_, err	= p1.Write([]byte{0x01, 0x08, 0x00, 0x00, 0x12, 0x34, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("failed to write to pipe: %v", err)
+	}
+
+	// let the server discard what is left of the bad frame
+	time.Sleep(20 * time.Millisecond)
+
+	res, err	= rt.ExecuteRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_DIAGNOSTICS,
+		payload:	[]byte{0x00, 0x0c, 0x00, 0x00},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteRequest() should have succeeded, got: %v", err)
+	}
+	if !bytes.Equal(res.payload, []byte{0x00, 0x0c, 0x00, 0x01}) {
+		t.Errorf("expected a bus communication error count of 1, got: % x", res.payload)
+	}
+
+	if rtuServer.DiagnosticCounters().ServerNoResponses != 1 {
+		t.Errorf("expected 1 unanswered request, got: %+v", rtuServer.DiagnosticCounters())
+	}
+
+	return
+}
@@ -0,0 +1,97 @@
+package modbus
+
+import (
+	"context"
+)
+
+// The ExceptionStatusHandler interface can optionally be implemented by
+// request handlers to answer read exception status (0x07) requests.
+// Servers whose handler does not implement it answer such requests with an
+// illegal function exception.
+type ExceptionStatusHandler interface {
+	// HandleExceptionStatus returns the 8 exception status outputs of the
+	// unit, as a bitmap (the meaning of each bit is device specific).
+	HandleExceptionStatus(unitId uint8) (status uint8, err error)
+}
+
+// Reads the 8 exception status outputs of the remote device, as a bitmap
+// (function code 0x07).
+func (mc *ModbusClient) ReadExceptionStatus() (status uint8, err error) {
+	status, err	= mc.ReadExceptionStatusContext(context.Background())
+
+	return
+}
+
+// Same as ReadExceptionStatus(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadExceptionStatusContext(ctx context.Context) (status uint8, err error) {
+	var req		*pdu
+	var res		*pdu
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_READ_EXCEPTION_STATUS,
+	}
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		status	= res.payload[0]
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Handles a read exception status request.
+func (ms *ModbusServer) processExceptionStatus(req *pdu) (res *pdu, err error) {
+	var handler	ExceptionStatusHandler
+	var ok		bool
+	var status	uint8
+
+	handler, ok	= ms.userHandler().(ExceptionStatusHandler)
+	if !ok {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	if len(req.payload) != 0 {
+		err	= ErrProtocolError
+		return
+	}
+
+	status, err	= handler.HandleExceptionStatus(req.unitId)
+	if err != nil {
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	[]byte{status},
+	}
+
+	return
+}
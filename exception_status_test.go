@@ -0,0 +1,107 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// exceptionStatusHandler is a DataStore answering read exception status
+// requests.
+type exceptionStatusHandler struct {
+	*DataStore
+	status	uint8
+}
+
+func (esh *exceptionStatusHandler) HandleExceptionStatus(unitId uint8) (status uint8, err error) {
+	if unitId != 1 {
+		err	= ErrServerDeviceBusy
+		return
+	}
+
+	status	= esh.status
+
+	return
+}
+
+func TestReadExceptionStatus(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var client	*ModbusClient
+	var p1, p2	net.Conn
+	var status	uint8
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5562",
+	}, &exceptionStatusHandler{DataStore: NewDataStore(0, 0, 0, 0), status: 0x6d})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5562",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	status, err	= client.ReadExceptionStatus()
+	if err != nil || status != 0x6d {
+		t.Errorf("expected 0x6d, got: 0x%02x (%v)", status, err)
+	}
+
+	// handler errors should be mapped to exceptions
+	client.SetUnitId(2)
+	_, err	= client.ReadExceptionStatus()
+	if !errors.Is(err, ErrServerDeviceBusy) {
+		t.Errorf("expected ErrServerDeviceBusy, got: %v", err)
+	}
+
+	// over RTU, with a handler not implementing ExceptionStatusHandler
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	_, err	= client.ReadExceptionStatus()
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	// with a handler implementing it
+	rtuServer.handler	= &exceptionStatusHandler{DataStore: NewDataStore(0, 0, 0, 0), status: 0x81}
+	status, err	= client.ReadExceptionStatus()
+	if err != nil || status != 0x81 {
+		t.Errorf("expected 0x81, got: 0x%02x (%v)", status, err)
+	}
+
+	return
+}
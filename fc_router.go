@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"sync"
+)
+
+// FunctionCodeRouter is a request handler delegating requests to other
+// handlers depending on their function code, e.g. to serve reads from
+// an in-memory cache while writes go to persistent storage.
+//
+// As the server invokes handlers by object type rather than by function code,
+// write requests are routed by quantity: single item writes go to the
+// handler registered for the single write function code (0x05 or 0x06) and
+// multiple item writes to the one registered for the multiple write function
+// code (0x0f or 0x10), falling back to the other write function code if only
+// one of them is registered. Multiple writes of a single item hence reach the
+// single write handler when both are registered.
+// Mask write register requests (0x16) are handled as a read (0x03) followed by
+// a single register write (0x06).
+type FunctionCodeRouter struct {
+	lock		sync.RWMutex
+	handlers	map[uint8]RequestHandler
+	defaultHandler	RequestHandler
+}
+
+// Returns a new, empty function code router.
+func NewFunctionCodeRouter() (fcr *FunctionCodeRouter) {
+	fcr	= &FunctionCodeRouter{
+		handlers:	make(map[uint8]RequestHandler),
+	}
+
+	return
+}
+
+// Routes requests with function code fc to h.
+func (fcr *FunctionCodeRouter) Register(fc uint8, h RequestHandler) {
+	fcr.lock.Lock()
+	defer fcr.lock.Unlock()
+
+	fcr.handlers[fc]	= h
+
+	return
+}
+
+// Routes requests with function codes without a registered handler to h.
+// Such requests are answered with an illegal function exception if no
+// default handler is set.
+func (fcr *FunctionCodeRouter) RegisterDefault(h RequestHandler) {
+	fcr.lock.Lock()
+	defer fcr.lock.Unlock()
+
+	fcr.defaultHandler	= h
+
+	return
+}
+
+func (fcr *FunctionCodeRouter) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var h	RequestHandler
+
+	if isWrite {
+		h, err	= fcr.lookupWrite(quantity, FC_WRITE_SINGLE_COIL, FC_WRITE_MULTIPLE_COILS)
+	} else {
+		h, err	= fcr.lookup(FC_READ_COILS)
+	}
+	if err != nil {
+		return
+	}
+
+	res, err	= h.HandleCoils(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (fcr *FunctionCodeRouter) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	var h	RequestHandler
+
+	h, err	= fcr.lookup(FC_READ_DISCRETE_INPUTS)
+	if err != nil {
+		return
+	}
+
+	res, err	= h.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (fcr *FunctionCodeRouter) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var h	RequestHandler
+
+	if isWrite {
+		h, err	= fcr.lookupWrite(quantity, FC_WRITE_SINGLE_REGISTER, FC_WRITE_MULTIPLE_REGISTERS)
+	} else {
+		h, err	= fcr.lookup(FC_READ_HOLDING_REGISTERS)
+	}
+	if err != nil {
+		return
+	}
+
+	res, err	= h.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (fcr *FunctionCodeRouter) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	var h	RequestHandler
+
+	h, err	= fcr.lookup(FC_READ_INPUT_REGISTERS)
+	if err != nil {
+		return
+	}
+
+	res, err	= h.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
+
+// Returns the handler registered for fc, or the default handler.
+func (fcr *FunctionCodeRouter) lookup(fc uint8) (h RequestHandler, err error) {
+	fcr.lock.RLock()
+	defer fcr.lock.RUnlock()
+
+	h	= fcr.handlers[fc]
+	if h == nil {
+		h	= fcr.defaultHandler
+	}
+
+	if h == nil {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	return
+}
+
+// Returns the handler of a write of quantity items (see FunctionCodeRouter).
+func (fcr *FunctionCodeRouter) lookupWrite(quantity uint16, singleFc uint8, multipleFc uint8) (h RequestHandler, err error) {
+	fcr.lock.RLock()
+	defer fcr.lock.RUnlock()
+
+	if quantity == 1 {
+		h	= fcr.handlers[singleFc]
+		if h == nil {
+			h	= fcr.handlers[multipleFc]
+		}
+	} else {
+		h	= fcr.handlers[multipleFc]
+		if h == nil {
+			h	= fcr.handlers[singleFc]
+		}
+	}
+
+	if h == nil {
+		h	= fcr.defaultHandler
+	}
+
+	if h == nil {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	return
+}
@@ -0,0 +1,100 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFunctionCodeRouter(t *testing.T) {
+	var fcr		*FunctionCodeRouter
+	var reader	*DataStore
+	var writer	*DataStore
+	var fallback	*DataStore
+	var err		error
+	var regs	[]uint16
+	var bools	[]bool
+	var reg		uint16
+	var coil	bool
+
+	reader		= NewDataStore(4, 4, 4, 4)
+	writer		= NewDataStore(4, 4, 4, 4)
+	fallback	= NewDataStore(4, 4, 4, 4)
+
+	reader.SetHoldingRegister(0, 0x1111)
+	fallback.SetHoldingRegister(0, 0x3333)
+	fallback.SetInputRegister(0, 0x4444)
+
+	fcr	= NewFunctionCodeRouter()
+
+	// nothing registered: all requests should be rejected
+	_, err	= fcr.HandleHoldingRegisters(1, 0, 1, false, nil)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	fcr.Register(FC_READ_HOLDING_REGISTERS, reader)
+	fcr.Register(FC_READ_COILS, reader)
+	fcr.Register(FC_WRITE_MULTIPLE_REGISTERS, writer)
+	fcr.Register(FC_WRITE_SINGLE_COIL, writer)
+
+	// reads should reach the reader
+	regs, err	= fcr.HandleHoldingRegisters(1, 0, 1, false, nil)
+	if err != nil || regs[0] != 0x1111 {
+		t.Errorf("expected 0x1111 from the reader, got: %v, %v", regs, err)
+	}
+
+	// writes should reach the writer, whatever the quantity
+	_, err	= fcr.HandleHoldingRegisters(1, 1, 2, true, []uint16{0x2222, 0x2223})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	_, err	= fcr.HandleHoldingRegisters(1, 3, 1, true, []uint16{0x2224})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	for addr, expected := range []uint16{0x0000, 0x2222, 0x2223, 0x2224} {
+		reg, _	= writer.GetHoldingRegister(uint16(addr))
+		if reg != expected {
+			t.Errorf("writer: expected 0x%04x at %v, got: 0x%04x", expected, addr, reg)
+		}
+		reg, _	= reader.GetHoldingRegister(uint16(addr))
+		if addr > 0 && reg != 0 {
+			t.Errorf("reader: expected 0 at %v, got: 0x%04x", addr, reg)
+		}
+	}
+
+	_, err	= fcr.HandleCoils(1, 2, 1, true, []bool{true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+	coil, _	= writer.GetCoil(2)
+	if !coil {
+		t.Errorf("expected coil #2 to be set on the writer")
+	}
+	bools, err	= fcr.HandleCoils(1, 2, 1, false, nil)
+	if err != nil || bools[0] {
+		t.Errorf("expected coil #2 to be read from the reader, got: %v, %v", bools, err)
+	}
+
+	// unregistered function codes should be rejected until a default
+	// handler is set
+	_, err	= fcr.HandleInputRegisters(1, 0, 1)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	fcr.RegisterDefault(fallback)
+
+	regs, err	= fcr.HandleInputRegisters(1, 0, 1)
+	if err != nil || regs[0] != 0x4444 {
+		t.Errorf("expected 0x4444 from the default handler, got: %v, %v", regs, err)
+	}
+
+	// registered function codes should not reach the default handler
+	regs, err	= fcr.HandleHoldingRegisters(1, 0, 1, false, nil)
+	if err != nil || regs[0] != 0x1111 {
+		t.Errorf("expected 0x1111 from the reader, got: %v, %v", regs, err)
+	}
+
+	return
+}
@@ -0,0 +1,146 @@
+package modbus
+
+import (
+	"context"
+)
+
+const (
+	// maximum number of registers in a FIFO queue (function code 0x18)
+	maxFIFOQueueCount	int	= 31
+)
+
+// The FIFOQueueHandler interface can optionally be implemented by request
+// handlers to answer read FIFO queue (0x18) requests.
+// Servers whose handler does not implement it answer such requests with an
+// illegal function exception.
+type FIFOQueueHandler interface {
+	// HandleFIFOQueue returns the registers queued at addr (the FIFO
+	// pointer address), oldest first.
+	// Queues of more than 31 registers are answered with an illegal data
+	// value exception, as mandated by the spec.
+	HandleFIFOQueue(unitId uint8, addr uint16) (values []uint16, err error)
+}
+
+// Reads the contents of the FIFO queue at addr (function code 0x18).
+// Returns up to 31 registers, oldest first.
+func (mc *ModbusClient) ReadFIFOQueue(addr uint16) (values []uint16, err error) {
+	values, err	= mc.ReadFIFOQueueContext(context.Background(), addr)
+
+	return
+}
+
+// Same as ReadFIFOQueue(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFIFOQueueContext(ctx context.Context, addr uint16) (values []uint16, err error) {
+	var req		*pdu
+	var res		*pdu
+	var byteCount	int
+	var fifoCount	int
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_READ_FIFO_QUEUE,
+		payload:	uint16ToBytes(BIG_ENDIAN, addr),
+	}
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+		// byte count (2 bytes) and FIFO count (2 bytes), followed by
+		// 2 bytes per register
+		if len(res.payload) < 4 {
+			err	= ErrProtocolError
+			return
+		}
+
+		byteCount	= int(bytesToUint16(BIG_ENDIAN, res.payload[0:2]))
+		fifoCount	= int(bytesToUint16(BIG_ENDIAN, res.payload[2:4]))
+		if fifoCount > maxFIFOQueueCount || byteCount != 2 + 2 * fifoCount ||
+		   len(res.payload) != 2 + byteCount {
+			err	= ErrProtocolError
+			return
+		}
+
+		values	= bytesToUint16s(mc.endianness, res.payload[4:])
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Handles a read FIFO queue request, building the response out of the
+// registers returned by the FIFO queue handler.
+func (ms *ModbusServer) processFIFOQueue(req *pdu) (res *pdu, err error) {
+	var handler	FIFOQueueHandler
+	var ok		bool
+	var values	[]uint16
+
+	handler, ok	= ms.userHandler().(FIFOQueueHandler)
+	if !ok {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	if len(req.payload) != 2 {
+		err	= ErrProtocolError
+		return
+	}
+
+	values, err	= handler.HandleFIFOQueue(
+		req.unitId, bytesToUint16(BIG_ENDIAN, req.payload[0:2]))
+	if err != nil {
+		return
+	}
+
+	if len(values) > maxFIFOQueueCount {
+		ms.logger.Warningf("FIFO queue holds %v registers, more than %v",
+				   len(values), maxFIFOQueueCount)
+		err	= ErrIllegalDataValue
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+	}
+
+	// byte count (FIFO count + values) and FIFO count
+	res.payload	= uint16ToBytes(BIG_ENDIAN, uint16(2 + 2 * len(values)))
+	res.payload	= append(res.payload, uint16ToBytes(BIG_ENDIAN, uint16(len(values)))...)
+	res.payload	= append(res.payload, uint16sToBytes(BIG_ENDIAN, values)...)
+
+	return
+}
+
+// Reads the low byte of the byte count field of a read FIFO queue response
+// from the rtu link into rxbuf, past the unit id, function code and high byte
+// of the byte count (offset 3).
+// Returns the offset of the FIFO count field and the number of bytes left
+// to read, excluding the CRC.
+func (rt *rtuTransport) readFIFOQueueFrame(rxbuf []byte) (offset int, bytesNeeded int, err error) {
+	offset, err	= rt.readRTUBytes(rxbuf, 3, 1)
+	if err != nil {
+		return
+	}
+
+	bytesNeeded	= int(bytesToUint16(BIG_ENDIAN, rxbuf[2:4]))
+
+	return
+}
@@ -0,0 +1,148 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fifoHandler is a DataStore answering read FIFO queue requests.
+type fifoHandler struct {
+	*DataStore
+	queues	map[uint16][]uint16
+}
+
+func (fh *fifoHandler) HandleFIFOQueue(unitId uint8, addr uint16) (values []uint16, err error) {
+	var ok	bool
+
+	values, ok	= fh.queues[addr]
+	if !ok {
+		err	= ErrIllegalDataAddress
+	}
+
+	return
+}
+
+func TestReadFIFOQueue(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var client	*ModbusClient
+	var handler	*fifoHandler
+	var p1, p2	net.Conn
+	var values	[]uint16
+	var err		error
+
+	handler	= &fifoHandler{
+		DataStore:	NewDataStore(0, 0, 0, 0),
+		queues:		map[uint16][]uint16{
+			0x04de:	{0x01b8, 0x1284},
+			0x0500:	{},
+			0x0600:	make([]uint16, 32),
+		},
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5558",
+	}, handler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5558",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	values, err	= client.ReadFIFOQueue(0x04de)
+	if err != nil {
+		t.Fatalf("ReadFIFOQueue() should have succeeded, got: %v", err)
+	}
+	if len(values) != 2 || values[0] != 0x01b8 || values[1] != 0x1284 {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	values, err	= client.ReadFIFOQueue(0x0500)
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected an empty queue, got: %v (%v)", values, err)
+	}
+
+	// queues of more than 31 registers should be rejected
+	_, err	= client.ReadFIFOQueue(0x0600)
+	if !errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("expected ErrIllegalDataValue, got: %v", err)
+	}
+
+	_, err	= client.ReadFIFOQueue(0x0700)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// RTU framing should cope with the 2-byte byte count of responses
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, handler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	values, err	= client.ReadFIFOQueue(0x04de)
+	if err != nil {
+		t.Fatalf("ReadFIFOQueue() should have succeeded, got: %v", err)
+	}
+	if len(values) != 2 || values[0] != 0x01b8 || values[1] != 0x1284 {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	_, err	= client.ReadFIFOQueue(0x0600)
+	if !errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("expected ErrIllegalDataValue, got: %v", err)
+	}
+
+	// handlers not implementing FIFOQueueHandler should yield an illegal
+	// function exception
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	_, err	= client.ReadFIFOQueue(0x04de)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,315 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+)
+
+const (
+	// reference type of file record sub-requests (function codes 0x14
+	// and 0x15)
+	fileRecordReferenceType		uint8	= 0x06
+	// length of a file record sub-request header (reference type, file
+	// number, record number and record length)
+	fileRecordHeaderLength		int	= 7
+	// highest record number of a file
+	maxFileRecordNumber		uint16	= 0x270f
+	// maximum number of registers read or written by a single
+	// sub-request, for the response/request to fit in a PDU
+	maxFileRecordReadLength		uint16	= 124
+	maxFileRecordWriteLength	uint16	= 122
+)
+
+// The FileRecordHandler interface can optionally be implemented by request
+// handlers to answer read file record (0x14) and write file record (0x15)
+// requests.
+// Servers whose handler does not implement it answer such requests with an
+// illegal function exception.
+type FileRecordHandler interface {
+	// HandleFileRecord handles a single file record sub-request.
+	// Arguments passed to the handler:
+	// - unitId:		the unit id (slave id) requested,
+	// - fileNumber:	the file number (1 to 0xffff),
+	// - recordNumber:	the first record (register) requested, within
+	//			the file (0 to 9999),
+	// - length:		the number of consecutive records covered by the
+	//			sub-request,
+	// - isWrite:		true if the request is a write, false if a read,
+	// - args:		the values to write (length of them) on writes,
+	//			nil on reads.
+	// Reads must return exactly length values.
+	HandleFileRecord(unitId uint8, fileNumber uint16, recordNumber uint16,
+			 length uint16, isWrite bool, args []uint16) (res []uint16, err error)
+}
+
+// Reads length records (16-bit registers) of file fileNumber, starting at
+// record recordNumber (function code 0x14).
+func (mc *ModbusClient) ReadFileRecord(fileNumber uint16, recordNumber uint16, length uint16) (values []uint16, err error) {
+	values, err	= mc.ReadFileRecordContext(context.Background(), fileNumber, recordNumber, length)
+
+	return
+}
+
+// Same as ReadFileRecord(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReadFileRecordContext(ctx context.Context, fileNumber uint16,
+					      recordNumber uint16, length uint16) (values []uint16, err error) {
+	var req		*pdu
+	var res		*pdu
+
+	err	= validateFileRecord(fileNumber, recordNumber, length, maxFileRecordReadLength)
+	if err != nil {
+		mc.logger.Error("invalid file number, record number or quantity of records")
+		return
+	}
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_READ_FILE_RECORD,
+		payload:	[]byte{uint8(fileRecordHeaderLength)},
+	}
+	req.payload	= appendFileRecordHeader(req.payload, fileNumber, recordNumber, length)
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+		// response data length (1 byte), then file response length
+		// (1 byte), reference type (1 byte) and 2 bytes per record
+		if len(res.payload) != 3 + 2 * int(length) ||
+		   int(res.payload[0]) != 2 + 2 * int(length) ||
+		   int(res.payload[1]) != 1 + 2 * int(length) ||
+		   res.payload[2] != fileRecordReferenceType {
+			err	= ErrProtocolError
+			return
+		}
+
+		values	= bytesToUint16s(mc.endianness, res.payload[3:])
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Writes values to consecutive records (16-bit registers) of file fileNumber,
+// starting at record recordNumber (function code 0x15).
+func (mc *ModbusClient) WriteFileRecord(fileNumber uint16, recordNumber uint16, values []uint16) (err error) {
+	err	= mc.WriteFileRecordContext(context.Background(), fileNumber, recordNumber, values)
+
+	return
+}
+
+// Same as WriteFileRecord(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) WriteFileRecordContext(ctx context.Context, fileNumber uint16,
+					       recordNumber uint16, values []uint16) (err error) {
+	var req		*pdu
+	var res		*pdu
+
+	if len(values) > int(maxFileRecordWriteLength) {
+		err	= ErrUnexpectedParameters
+		mc.logger.Errorf("quantity of records exceeds %v", maxFileRecordWriteLength)
+		return
+	}
+
+	err	= validateFileRecord(fileNumber, recordNumber, uint16(len(values)),
+				     maxFileRecordWriteLength)
+	if err != nil {
+		mc.logger.Error("invalid file number, record number or quantity of records")
+		return
+	}
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_WRITE_FILE_RECORD,
+		payload:	[]byte{uint8(fileRecordHeaderLength + 2 * len(values))},
+	}
+	req.payload	= appendFileRecordHeader(req.payload, fileNumber, recordNumber,
+						 uint16(len(values)))
+	req.payload	= append(req.payload, uint16sToBytes(mc.endianness, values)...)
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+		// the response is an echo of the request
+		if !bytes.Equal(res.payload, req.payload) {
+			err	= ErrProtocolError
+			return
+		}
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Handles read and write file record requests, passing each sub-request to
+// the file record handler.
+func (ms *ModbusServer) processFileRecord(req *pdu) (res *pdu, err error) {
+	var handler		FileRecordHandler
+	var ok			bool
+	var offset		int
+	var fileNumber		uint16
+	var recordNumber	uint16
+	var length		uint16
+	var values		[]uint16
+	var data		[]byte
+
+	handler, ok	= ms.userHandler().(FileRecordHandler)
+	if !ok {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	// validate the byte count field, which should cover at least one
+	// sub-request
+	if len(req.payload) < 1 + fileRecordHeaderLength ||
+	   int(req.payload[0]) != len(req.payload) - 1 {
+		err	= ErrProtocolError
+		return
+	}
+
+	// responses start with a data length field, filled in below
+	data	= []byte{0}
+
+	for offset = 1; offset < len(req.payload); {
+		if offset + fileRecordHeaderLength > len(req.payload) {
+			err	= ErrProtocolError
+			return
+		}
+
+		if req.payload[offset] != fileRecordReferenceType {
+			err	= ErrIllegalDataValue
+			return
+		}
+
+		fileNumber	= bytesToUint16(BIG_ENDIAN, req.payload[offset + 1:offset + 3])
+		recordNumber	= bytesToUint16(BIG_ENDIAN, req.payload[offset + 3:offset + 5])
+		length		= bytesToUint16(BIG_ENDIAN, req.payload[offset + 5:offset + 7])
+
+		if req.functionCode == FC_READ_FILE_RECORD {
+			err	= validateFileRecord(fileNumber, recordNumber, length,
+						     maxFileRecordReadLength)
+		} else {
+			err	= validateFileRecord(fileNumber, recordNumber, length,
+						     maxFileRecordWriteLength)
+		}
+		if err != nil {
+			err	= ErrIllegalDataAddress
+			return
+		}
+
+		if req.functionCode == FC_READ_FILE_RECORD {
+			offset	+= fileRecordHeaderLength
+
+			values, err	= handler.HandleFileRecord(
+				req.unitId, fileNumber, recordNumber, length, false, nil)
+			if err != nil {
+				return
+			}
+
+			if len(values) != int(length) {
+				ms.logger.Errorf("handler returned %v 16-bit values, " +
+						 "expected %v", len(values), length)
+				err	= ErrServerDeviceFailure
+				return
+			}
+
+			// file response length, reference type and records
+			data	= append(data, uint8(1 + 2 * len(values)), fileRecordReferenceType)
+			data	= append(data, uint16sToBytes(BIG_ENDIAN, values)...)
+
+			// make sure the response fits in a PDU
+			if len(data) > 252 {
+				err	= ErrIllegalDataValue
+				return
+			}
+		} else {
+			if offset + fileRecordHeaderLength + 2 * int(length) > len(req.payload) {
+				err	= ErrProtocolError
+				return
+			}
+
+			_, err	= handler.HandleFileRecord(
+				req.unitId, fileNumber, recordNumber, length, true,
+				bytesToUint16s(BIG_ENDIAN, req.payload[
+					offset + fileRecordHeaderLength:
+					offset + fileRecordHeaderLength + 2 * int(length)]))
+			if err != nil {
+				return
+			}
+
+			offset	+= fileRecordHeaderLength + 2 * int(length)
+		}
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+	}
+
+	if req.functionCode == FC_READ_FILE_RECORD {
+		data[0]		= uint8(len(data) - 1)
+		res.payload	= data
+	} else {
+		// write responses are an echo of the request
+		res.payload	= req.payload
+	}
+
+	return
+}
+
+// Checks that a file record sub-request addresses a valid file and range of
+// records.
+func validateFileRecord(fileNumber uint16, recordNumber uint16, length uint16,
+			maxLength uint16) (err error) {
+	if fileNumber == 0 || length == 0 || length > maxLength ||
+	   uint32(recordNumber) + uint32(length) - 1 > uint32(maxFileRecordNumber) {
+		err	= ErrUnexpectedParameters
+	}
+
+	return
+}
+
+// Appends a file record sub-request header to payload.
+func appendFileRecordHeader(payload []byte, fileNumber uint16, recordNumber uint16,
+			    length uint16) (out []byte) {
+	out	= append(payload, fileRecordReferenceType)
+	out	= append(out, uint16ToBytes(BIG_ENDIAN, fileNumber)...)
+	out	= append(out, uint16ToBytes(BIG_ENDIAN, recordNumber)...)
+	out	= append(out, uint16ToBytes(BIG_ENDIAN, length)...)
+
+	return
+}
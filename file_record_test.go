@@ -0,0 +1,184 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fileHandler is a DataStore answering file record requests out of files
+// of 10000 records.
+type fileHandler struct {
+	*DataStore
+	lock	sync.Mutex
+	files	map[uint16][]uint16
+}
+
+func (fh *fileHandler) HandleFileRecord(unitId uint8, fileNumber uint16, recordNumber uint16,
+					length uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var file	[]uint16
+	var ok		bool
+
+	fh.lock.Lock()
+	defer fh.lock.Unlock()
+
+	file, ok	= fh.files[fileNumber]
+	if !ok {
+		err	= ErrIllegalDataAddress
+		return
+	}
+
+	if isWrite {
+		copy(file[recordNumber:], args)
+		return
+	}
+
+	res	= append(res, file[recordNumber:recordNumber + length]...)
+
+	return
+}
+
+func TestFileRecords(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var client	*ModbusClient
+	var handler	*fileHandler
+	var p1, p2	net.Conn
+	var values	[]uint16
+	var res		*pdu
+	var err		error
+
+	handler	= &fileHandler{
+		DataStore:	NewDataStore(0, 0, 0, 0),
+		files:		map[uint16][]uint16{
+			4:	make([]uint16, 10000),
+			5:	make([]uint16, 10000),
+		},
+	}
+	handler.files[4][1]	= 0x0df5
+	handler.files[4][2]	= 0x0df6
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5559",
+	}, handler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5559",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	values, err	= client.ReadFileRecord(4, 1, 2)
+	if err != nil {
+		t.Fatalf("ReadFileRecord() should have succeeded, got: %v", err)
+	}
+	if len(values) != 2 || values[0] != 0x0df5 || values[1] != 0x0df6 {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	err	= client.WriteFileRecord(5, 9997, []uint16{0x06af, 0x04be, 0x100d})
+	if err != nil {
+		t.Fatalf("WriteFileRecord() should have succeeded, got: %v", err)
+	}
+
+	values, err	= client.ReadFileRecord(5, 9996, 4)
+	if err != nil {
+		t.Fatalf("ReadFileRecord() should have succeeded, got: %v", err)
+	}
+	if len(values) != 4 || values[0] != 0 || values[1] != 0x06af ||
+	   values[2] != 0x04be || values[3] != 0x100d {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	// unknown files should yield an exception
+	_, err	= client.ReadFileRecord(6, 0, 1)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// file 0 and records past 9999 should be rejected client-side
+	_, err	= client.ReadFileRecord(0, 0, 1)
+	if !errors.Is(err, ErrUnexpectedParameters) {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	err	= client.WriteFileRecord(5, 9999, []uint16{1, 2})
+	if !errors.Is(err, ErrUnexpectedParameters) {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	// the server should answer requests holding several sub-requests
+	res, err	= server.processRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_READ_FILE_RECORD,
+		payload:	[]byte{
+			0x0e,
+			0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02,
+			0x06, 0x00, 0x05, 0x27, 0x0f, 0x00, 0x01,
+		},
+	})
+	if err != nil {
+		t.Fatalf("processRequest() should have succeeded, got: %v", err)
+	}
+	if !bytes.Equal(res.payload, []byte{
+		0x0a,
+		0x05, 0x06, 0x0d, 0xf5, 0x0d, 0xf6,
+		0x03, 0x06, 0x10, 0x0d,
+	}) {
+		t.Errorf("unexpected response payload: % x", res.payload)
+	}
+
+	// RTU framing should cope with file record requests and responses
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, handler)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	err	= client.WriteFileRecord(4, 100, []uint16{0x1234})
+	if err != nil {
+		t.Fatalf("WriteFileRecord() should have succeeded, got: %v", err)
+	}
+
+	values, err	= client.ReadFileRecord(4, 100, 1)
+	if err != nil {
+		t.Fatalf("ReadFileRecord() should have succeeded, got: %v", err)
+	}
+	if len(values) != 1 || values[0] != 0x1234 {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	return
+}
@@ -0,0 +1,97 @@
+package modbus
+
+import (
+	"time"
+)
+
+// frameDumpTransport is a proxy transport logging every request read from
+// and every response written to the wrapped transport as a hex dump of the
+// bytes seen on the wire (see the DumpFrames setting of ServerConfiguration).
+type frameDumpTransport struct {
+	transport
+	tap		*aduTap
+	logger		*logger
+	transportName	string
+}
+
+// Returns a new frame dump transport wrapping t, whose link traffic is
+// recorded to tap.
+func newFrameDumpTransport(t transport, tap *aduTap, l *logger,
+			   transportName string) (fdt *frameDumpTransport) {
+	fdt = &frameDumpTransport{
+		transport:	t,
+		tap:		tap,
+		logger:		l,
+		transportName:	transportName,
+	}
+
+	return
+}
+
+// Reads a request from the wrapped transport, then dumps the bytes it was
+// read from, including those of frames rejected by the transport.
+func (fdt *frameDumpTransport) ReadRequest() (req *pdu, err error) {
+	req, err	= fdt.transport.ReadRequest()
+
+	dumpFrame(fdt.logger, "rx", fdt.transportName, fdt.tap.rxTime, fdt.tap.rx)
+	fdt.tap.rx	= nil
+
+	return
+}
+
+// Writes a response to the wrapped transport, then dumps the bytes written.
+func (fdt *frameDumpTransport) WriteResponse(res *pdu) (err error) {
+	err	= fdt.transport.WriteResponse(res)
+
+	dumpFrame(fdt.logger, "tx", fdt.transportName, fdt.tap.txTime, fdt.tap.tx)
+	fdt.tap.tx	= nil
+
+	return
+}
+
+// Logs the ADU frame sent (tx) or received (rx) at t over transportName as
+// a hex dump, e.g.
+//   2024-01-02T15:04:05.123456Z tx rtu (8 bytes): 01 03 00 00 00 02 c4 0b
+// Empty frames are not logged.
+func dumpFrame(l *logger, direction string, transportName string, t time.Time, frame []byte) {
+	if len(frame) == 0 {
+		return
+	}
+
+	l.Infof("%s %s %s (%v bytes): % x",
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		direction, transportName, len(frame), frame)
+
+	return
+}
+
+// Dumps the frames recorded by the tap since the last call, if frame dumps
+// are enabled.
+// Must be called with mc.lock held.
+func (mc *ModbusClient) dumpFrames() {
+	if !mc.conf.DumpFrames || mc.tap == nil {
+		return
+	}
+
+	dumpFrame(mc.logger, "tx", mc.transportName(), mc.tap.txTime, mc.tap.tx)
+	dumpFrame(mc.logger, "rx", mc.transportName(), mc.tap.rxTime, mc.tap.rx)
+
+	return
+}
+
+// Returns the name of the transport of the client ("tcp", "tcp+tls",
+// "rtuovertcp", "rtu" or "ascii").
+func (mc *ModbusClient) transportName() (name string) {
+	switch mc.transportType {
+	case TCP_TRANSPORT:
+		name	= "tcp"
+		if mc.tlsConfig != nil {
+			name	= "tcp+tls"
+		}
+	case RTU_OVER_TCP_TRANSPORT:	name = "rtuovertcp"
+	case RTU_TRANSPORT:		name = "rtu"
+	case ASCII_TRANSPORT:		name = "ascii"
+	}
+
+	return
+}
@@ -0,0 +1,122 @@
+package modbus
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// Returns the lines logged to rl matching re, waiting for count of them.
+func waitForLines(rl *recordingLogger, re *regexp.Regexp, count int) (lines []string) {
+	for i := 0; i < 100; i++ {
+		rl.lock.Lock()
+		lines	= nil
+		for _, line := range rl.lines {
+			if re.MatchString(line) {
+				lines	= append(lines, line)
+			}
+		}
+		rl.lock.Unlock()
+
+		if len(lines) >= count {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return
+}
+
+func TestFrameDumps(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var sl, cl	*recordingLogger
+	var link	*writeOnlyLink
+	var lines	[]string
+	var dump	*regexp.Regexp
+	var err		error
+
+	dump	= regexp.MustCompile(` \[info\]: \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z (rx|tx) `)
+
+	sl		= &recordingLogger{}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5577",
+		Logger:		sl,
+		DumpFrames:	true,
+	}, NewDataStore(0, 0, 4, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	cl		= &recordingLogger{}
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5577",
+		Logger:		cl,
+		DumpFrames:	true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegisters(1, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	// MBAP header (transaction id, protocol id, length) followed by the PDU
+	lines	= waitForLines(cl, dump, 2)
+	if len(lines) != 2 ||
+	   !regexp.MustCompile(`tx tcp \(12 bytes\): [0-9a-f]{2} [0-9a-f]{2} 00 00 00 06 01 03 00 01 00 02$`).MatchString(lines[0]) ||
+	   !regexp.MustCompile(`rx tcp \(13 bytes\): [0-9a-f]{2} [0-9a-f]{2} 00 00 00 07 01 03 04 00 00 00 00$`).MatchString(lines[1]) {
+		t.Errorf("unexpected client dumps: %v", lines)
+	}
+
+	lines	= waitForLines(sl, dump, 2)
+	if len(lines) != 2 ||
+	   !regexp.MustCompile(`rx tcp \(12 bytes\): .* 01 03 00 01 00 02$`).MatchString(lines[0]) ||
+	   !regexp.MustCompile(`tx tcp \(13 bytes\): .* 01 03 04 00 00 00 00$`).MatchString(lines[1]) {
+		t.Errorf("unexpected server dumps: %v", lines)
+	}
+
+	// broadcasts are dumped as well
+	link		= &writeOnlyLink{}
+	cl		= &recordingLogger{}
+	client, err	= NewRTUClientWithLink(link, "test", &ClientConfiguration{
+		Speed:		19200,
+		Logger:		cl,
+		DumpFrames:	true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	err	= client.Broadcast(FC_WRITE_SINGLE_REGISTER, 0x00, []byte{0x00, 0x01, 0x00, 0x02})
+	if err != nil {
+		t.Fatalf("Broadcast() should have succeeded, got: %v", err)
+	}
+
+	lines	= waitForLines(cl, dump, 1)
+	if len(lines) != 1 ||
+	   !regexp.MustCompile(`tx rtu \(8 bytes\): 00 06 00 01 00 02 [0-9a-f]{2} [0-9a-f]{2}$`).MatchString(lines[0]) {
+		t.Errorf("unexpected client dumps: %v", lines)
+	}
+
+	return
+}
@@ -0,0 +1,78 @@
+package modbus
+
+// FunctionHandler is the signature of custom function code handlers (see
+// RegisterFunctionHandler()). The handler receives the request payload
+// (following the function code) and returns the response payload, or an
+// error mapped to an exception response (see ErrIllegalDataAddress,
+// ErrIllegalDataValue, etc.).
+type FunctionHandler func(unitId uint8, payload []byte) (res []byte, err error)
+
+const (
+	// maximum length of a response payload (253 bytes, minus the function
+	// code)
+	maxResponsePayloadLength	int	= 253 - 1
+)
+
+// Registers h to serve requests with function code fc, e.g. vendor specific
+// function codes in the user defined ranges (0x41 to 0x48 and 0x64 to 0x6e).
+// Registered handlers take precedence over the function codes natively
+// supported by the server. Passing a nil handler unregisters fc.
+// As RTU frames carry no length field, requests with custom function codes
+// cannot be delimited on RTU (and RTU over TCP) links: they are only served
+// over TCP and ASCII links.
+func (ms *ModbusServer) RegisterFunctionHandler(fc uint8, h FunctionHandler) (err error) {
+	if fc == 0x00 || fc & 0x80 != 0 {
+		err	= ErrUnexpectedParameters
+		ms.logger.Errorf("invalid function code (0x%02x)", fc)
+		return
+	}
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if h == nil {
+		delete(ms.functionHandlers, fc)
+		return
+	}
+
+	if ms.functionHandlers == nil {
+		ms.functionHandlers	= make(map[uint8]FunctionHandler)
+	}
+	ms.functionHandlers[fc]	= h
+
+	return
+}
+
+// Returns the custom handler registered for fc, if any.
+func (ms *ModbusServer) functionHandler(fc uint8) (h FunctionHandler) {
+	ms.lock.Lock()
+	h	= ms.functionHandlers[fc]
+	ms.lock.Unlock()
+
+	return
+}
+
+// Handles a request with a custom function handler.
+func (ms *ModbusServer) processCustomFunction(h FunctionHandler, req *pdu) (res *pdu, err error) {
+	var payload	[]byte
+
+	payload, err	= h(req.unitId, req.payload)
+	if err != nil {
+		return
+	}
+
+	if len(payload) > maxResponsePayloadLength {
+		ms.logger.Errorf("response to function code 0x%02x too long (%v bytes)",
+				 req.functionCode, len(payload))
+		err	= ErrServerDeviceFailure
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	payload,
+	}
+
+	return
+}
@@ -0,0 +1,117 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterFunctionHandler(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var req		*pdu
+	var res		*pdu
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5565",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.RegisterFunctionHandler(0x80, func(uint8, []byte) ([]byte, error) {
+		return nil, nil
+	})
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	// echo the payload in reverse order, unit 2 is busy
+	err	= server.RegisterFunctionHandler(0x41, func(unitId uint8, payload []byte) (res []byte, err error) {
+		if unitId == 2 {
+			err	= ErrServerDeviceBusy
+			return
+		}
+
+		for i := len(payload) - 1; i >= 0; i-- {
+			res	= append(res, payload[i])
+		}
+
+		return
+	})
+	if err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5565",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	req	= &pdu{
+		unitId:		1,
+		functionCode:	0x41,
+		payload:	[]byte{0x01, 0x02, 0x03},
+	}
+
+	res, err	= client.executeRequest(req)
+	if err != nil {
+		t.Fatalf("failed to execute request: %v", err)
+	}
+
+	if res.functionCode != 0x41 || len(res.payload) != 3 ||
+	   res.payload[0] != 0x03 || res.payload[1] != 0x02 || res.payload[2] != 0x01 {
+		t.Errorf("unexpected response: %v", res)
+	}
+
+	// handler errors should be mapped to exceptions
+	req.unitId	= 2
+	res, err	= client.executeRequest(req)
+	if err != nil || res.functionCode != 0xc1 || len(res.payload) != 1 ||
+	   res.payload[0] != EX_SERVER_DEVICE_BUSY {
+		t.Errorf("unexpected response: %v (%v)", res, err)
+	}
+
+	// once unregistered, the function code should no longer be served
+	err	= server.RegisterFunctionHandler(0x41, nil)
+	if err != nil {
+		t.Fatalf("failed to unregister handler: %v", err)
+	}
+
+	req.unitId	= 1
+	res, err	= client.executeRequest(req)
+	if err != nil || res.functionCode != 0xc1 || len(res.payload) != 1 ||
+	   res.payload[0] != EX_ILLEGAL_FUNCTION {
+		t.Errorf("unexpected response: %v (%v)", res, err)
+	}
+
+	// built-in function codes can be overridden
+	err	= server.RegisterFunctionHandler(FC_READ_HOLDING_REGISTERS,
+		func(uint8, []byte) ([]byte, error) {
+			return nil, ErrIllegalDataAddress
+		})
+	if err != nil {
+		t.Fatalf("failed to register handler: %v", err)
+	}
+
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,247 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GatewayRoute maps one or more unit ids to a serial (RTU) bus.
+type GatewayRoute struct {
+	UnitIds		[]uint8			// unit ids of the devices on the bus
+	RTUDevice	string			// serial device, e.g. /dev/ttyUSB0
+	RTUConfig	ClientConfiguration	// serial settings (speed, parity, etc.)
+						// if RTUConfig.URL is set, it takes
+						// precedence over RTUDevice and must be
+						// an rtu://, ascii:// or rtuovertcp://
+						// (e.g. remote serial port) URL
+}
+
+// Gateway is a modbus TCP server forwarding requests to RTU devices,
+// depending on their unit id.
+type Gateway struct {
+	server		*ModbusServer
+	logger		*logger
+	routes		[]*gatewayRoute
+}
+
+// gatewayRoute holds the client connection to a bus.
+// As the client holds its lock for the duration of each request, concurrent
+// requests to the same bus are serialized while other buses are left free.
+type gatewayRoute struct {
+	client		*ModbusClient
+	proxy		RequestHandler
+	url		string
+}
+
+// gatewayHandler is a request handler forwarding requests to the
+// route matching their unit id.
+type gatewayHandler struct {
+	routes		map[uint8]*gatewayRoute
+}
+
+// Returns a new TCP to RTU gateway listening on tcpAddr (either a
+// tcp://host:port URL or a bare host:port address).
+// Requests to unit ids not covered by any route are answered with a gateway
+// path unavailable exception, while requests failing on the RTU side are
+// answered with a gateway target device failed to respond exception.
+func NewGateway(tcpAddr string, routes []GatewayRoute) (gw *Gateway, err error) {
+	var g		*Gateway
+	var gh		*gatewayHandler
+	var gr		*gatewayRoute
+	var conf	ClientConfiguration
+
+	if len(routes) == 0 {
+		err	= fmt.Errorf("%w: no gateway route", ErrConfigurationError)
+		return
+	}
+
+	if !strings.Contains(tcpAddr, "://") {
+		tcpAddr	= "tcp://" + tcpAddr
+	}
+
+	g	= &Gateway{
+		logger:	newLogger(fmt.Sprintf("modbus-gateway(%s)", tcpAddr)),
+	}
+	gh	= &gatewayHandler{
+		routes:	make(map[uint8]*gatewayRoute),
+	}
+
+	for i, route := range routes {
+		if len(route.UnitIds) == 0 {
+			err	= fmt.Errorf("%w: route #%v has no unit id",
+					     ErrConfigurationError, i)
+			return
+		}
+
+		conf	= route.RTUConfig
+		if conf.URL == "" {
+			if route.RTUDevice == "" {
+				err	= fmt.Errorf("%w: route #%v has no device",
+						     ErrConfigurationError, i)
+				return
+			}
+			conf.URL	= "rtu://" + route.RTUDevice
+		}
+
+		if !strings.HasPrefix(conf.URL, "rtu://") &&
+		   !strings.HasPrefix(conf.URL, "ascii://") &&
+		   !strings.HasPrefix(conf.URL, "rtuovertcp://") {
+			err	= fmt.Errorf("%w: route #%v: %s is not a serial bus URL",
+					     ErrConfigurationError, i, conf.URL)
+			return
+		}
+
+		gr	= &gatewayRoute{
+			url:	conf.URL,
+		}
+
+		gr.client, err	= NewClient(&conf)
+		if err != nil {
+			err	= fmt.Errorf("route #%v: %w", i, err)
+			return
+		}
+		gr.proxy	= NewProxyHandler(gr.client)
+
+		for _, unitId := range route.UnitIds {
+			if gh.routes[unitId] != nil {
+				err	= fmt.Errorf("%w: unit id %v is covered by more than one route",
+						     ErrConfigurationError, unitId)
+				return
+			}
+			gh.routes[unitId]	= gr
+		}
+
+		g.routes	= append(g.routes, gr)
+	}
+
+	g.server, err	= NewServer(&ServerConfiguration{
+		URL:	tcpAddr,
+	}, gh)
+	if err != nil {
+		return
+	}
+
+	gw	= g
+
+	return
+}
+
+// Opens all serial buses then starts accepting TCP connections.
+func (gw *Gateway) Start() (err error) {
+	for i, gr := range gw.routes {
+		err	= gr.client.Open()
+		if err != nil {
+			gw.logger.Errorf("failed to open %s: %v", gr.url, err)
+
+			// close buses opened so far
+			for _, opened := range gw.routes[0:i] {
+				opened.client.Close()
+			}
+			return
+		}
+	}
+
+	err	= gw.server.Start()
+	if err != nil {
+		for _, gr := range gw.routes {
+			gr.client.Close()
+		}
+		return
+	}
+
+	return
+}
+
+// Stops accepting TCP connections and closes all serial buses.
+func (gw *Gateway) Stop() (err error) {
+	err	= gw.server.Stop()
+
+	for _, gr := range gw.routes {
+		gr.client.Close()
+	}
+
+	return
+}
+
+func (gh *gatewayHandler) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var gr	*gatewayRoute
+
+	gr, err	= gh.lookup(unitId)
+	if err != nil {
+		return
+	}
+
+	res, err	= gr.proxy.HandleCoils(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (gh *gatewayHandler) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	var gr	*gatewayRoute
+
+	gr, err	= gh.lookup(unitId)
+	if err != nil {
+		return
+	}
+
+	res, err	= gr.proxy.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (gh *gatewayHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var gr	*gatewayRoute
+
+	gr, err	= gh.lookup(unitId)
+	if err != nil {
+		return
+	}
+
+	res, err	= gr.proxy.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (gh *gatewayHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	var gr	*gatewayRoute
+
+	gr, err	= gh.lookup(unitId)
+	if err != nil {
+		return
+	}
+
+	res, err	= gr.proxy.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
+
+// Returns the route covering unitId.
+func (gh *gatewayHandler) lookup(unitId uint8) (gr *gatewayRoute, err error) {
+	gr	= gh.routes[unitId]
+	if gr == nil {
+		err	= ErrGWPathUnavailable
+		return
+	}
+
+	return
+}
+
+// Maps errors returned by the downstream client to errors relayed back to
+// the TCP client: exceptions raised by the target device are passed through
+// while any other error (e.g. a timeout) is reported as the target failing
+// to respond.
+func mapGatewayError(in error) (err error) {
+	var excErr	ErrExceptionResponse
+
+	switch {
+	case in == nil:
+		err	= nil
+	case errors.As(in, &excErr):
+		err	= mapExceptionCodeToError(excErr.ExceptionCode)
+	default:
+		err	= ErrGWTargetFailedToRespond
+	}
+
+	return
+}
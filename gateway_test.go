@@ -0,0 +1,196 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGateway(t *testing.T) {
+	var gw		*Gateway
+	var targetA	*ModbusServer
+	var targetB	*ModbusServer
+	var thA		*testHandler
+	var thB		*testHandler
+	var client	*ModbusClient
+	var err		error
+	var regs	[]uint16
+	var wg		sync.WaitGroup
+	var errs	= make(chan error, 40)
+
+	// overlapping routes should be rejected
+	_, err	= NewGateway("localhost:5516", []GatewayRoute{
+		{UnitIds: []uint8{1, 2}, RTUDevice: "/dev/ttyUSB0"},
+		{UnitIds: []uint8{2}, RTUDevice: "/dev/ttyUSB1"},
+	})
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	// so should non-serial targets
+	_, err	= NewGateway("localhost:5516", []GatewayRoute{
+		{UnitIds: []uint8{1}, RTUConfig: ClientConfiguration{URL: "tcp://localhost:5514"}},
+	})
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	// two loopback RTU buses (RTU framing over TCP)
+	thA	= &testHandler{}
+	thA.holding[0]	= 0xaaaa
+	targetA, err	= NewServer(&ServerConfiguration{
+		URL:	"rtuovertcp://localhost:5514",
+	}, &remapHandler{th: thA})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	thB	= &testHandler{}
+	thB.holding[0]	= 0xbbbb
+	targetB, err	= NewServer(&ServerConfiguration{
+		URL:	"rtuovertcp://localhost:5515",
+	}, &remapHandler{th: thB})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	for _, target := range []*ModbusServer{targetA, targetB} {
+		err	= target.Start()
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		defer target.Stop()
+	}
+
+	gw, err	= NewGateway("localhost:5516", []GatewayRoute{
+		{
+			UnitIds:	[]uint8{1, 3},
+			RTUConfig:	ClientConfiguration{URL: "rtuovertcp://localhost:5514"},
+		},
+		{
+			UnitIds:	[]uint8{2},
+			RTUConfig:	ClientConfiguration{URL: "rtuovertcp://localhost:5515"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+
+	err	= gw.Start()
+	if err != nil {
+		t.Fatalf("failed to start gateway: %v", err)
+	}
+	defer gw.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5516",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// unit ids 1 and 3 should be routed to A, 2 to B
+	for _, tc := range []struct {
+		unitId		uint8
+		expected	uint16
+	}{
+		{1, 0xaaaa},
+		{2, 0xbbbb},
+		{3, 0xaaaa},
+	} {
+		client.SetUnitId(tc.unitId)
+		regs, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+		if err != nil || regs[0] != tc.expected {
+			t.Errorf("unit %v: expected 0x%04x, got: %v, %v",
+				 tc.unitId, tc.expected, regs, err)
+		}
+	}
+
+	// concurrent requests from multiple TCP clients to the same bus should
+	// be serialized on the RTU side
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(unitId uint8) {
+			var c		*ModbusClient
+			var r		[]uint16
+			var err		error
+
+			defer wg.Done()
+
+			c, err	= NewClient(&ClientConfiguration{
+				URL:	"tcp://localhost:5516",
+				UnitId:	unitId,
+			})
+			if err == nil {
+				err	= c.Open()
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer c.Close()
+
+			for j := 0; j < 10; j++ {
+				r, err	= c.ReadRegisters(0, 1, HOLDING_REGISTER)
+				if err == nil && r[0] != 0xaaaa {
+					err	= fmt.Errorf("unit %v: expected 0xaaaa, got: 0x%04x",
+							     unitId, r[0])
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(uint8(1 + 2 * (i % 2)))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err = range errs {
+		t.Errorf("concurrent request failed: %v", err)
+	}
+
+	// writes should be forwarded as well
+	client.SetUnitId(2)
+	err	= client.WriteRegisters(1, []uint16{0x1234, 0x5678})
+	if err != nil {
+		t.Errorf("WriteRegisters() should have succeeded, got: %v", err)
+	}
+	if thB.holding[1] != 0x1234 || thB.holding[2] != 0x5678 || thA.holding[1] != 0 {
+		t.Errorf("unexpected register values: A: %v, B: %v", thA.holding, thB.holding)
+	}
+
+	err	= client.WriteCoil(4, true)
+	if err != nil || !thB.coils[4] {
+		t.Errorf("WriteCoil() should have succeeded, got: %v", err)
+	}
+
+	// exceptions raised by targets should be relayed
+	_, err	= client.ReadRegisters(20, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	// unit ids without a route should be rejected
+	client.SetUnitId(4)
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrGWPathUnavailable) {
+		t.Errorf("expected ErrGWPathUnavailable, got: %v", err)
+	}
+
+	// unreachable targets should be reported as such
+	targetB.Stop()
+	client.SetUnitId(2)
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrGWTargetFailedToRespond) {
+		t.Errorf("expected ErrGWTargetFailedToRespond, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,56 @@
+package modbus
+
+// TransportInterceptor holds hooks called around the operations of an
+// intercepting transport (see NewInterceptingTransport()), to inject faults
+// or alter traffic in tests. A nil hook passes results through unmodified.
+type TransportInterceptor struct {
+	// OnReadRequest is called with the request (or error) read from the
+	// wrapped transport and returns the request (or error) to hand over
+	// to the caller.
+	OnReadRequest	func(req *pdu, err error) (*pdu, error)
+	// OnWriteResponse is called once the response has been written to the
+	// wrapped transport, with the outcome of the write, and returns the
+	// error to report to the caller.
+	OnWriteResponse	func(res *pdu, err error) error
+}
+
+// interceptingTransport is a proxy transport calling interceptor hooks
+// around requests and responses of the wrapped transport.
+type interceptingTransport struct {
+	transport
+	interceptor	TransportInterceptor
+}
+
+// Returns a new transport wrapping inner, calling the hooks of interceptor
+// around every request read and every response written.
+// Other operations (Close(), ExecuteRequest()) are passed through.
+func NewInterceptingTransport(inner transport, interceptor TransportInterceptor) (t transport) {
+	t = &interceptingTransport{
+		transport:	inner,
+		interceptor:	interceptor,
+	}
+
+	return
+}
+
+// Reads a request from the wrapped transport and runs it through the
+// OnReadRequest hook.
+func (it *interceptingTransport) ReadRequest() (req *pdu, err error) {
+	req, err	= it.transport.ReadRequest()
+	if it.interceptor.OnReadRequest != nil {
+		req, err	= it.interceptor.OnReadRequest(req, err)
+	}
+
+	return
+}
+
+// Writes a response to the wrapped transport and runs the outcome through
+// the OnWriteResponse hook.
+func (it *interceptingTransport) WriteResponse(res *pdu) (err error) {
+	err	= it.transport.WriteResponse(res)
+	if it.interceptor.OnWriteResponse != nil {
+		err	= it.interceptor.OnWriteResponse(res, err)
+	}
+
+	return
+}
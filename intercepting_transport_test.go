@@ -0,0 +1,118 @@
+package modbus
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// queueTransport is a transport serving requests from a queue (then io.EOF)
+// and recording responses.
+type queueTransport struct {
+	requests	[]*pdu
+	responses	[]*pdu
+}
+
+func (qt *queueTransport) Close() (err error) {
+	return
+}
+
+func (qt *queueTransport) ExecuteRequest(req *pdu) (res *pdu, err error) {
+	err	= ErrIllegalFunction
+
+	return
+}
+
+func (qt *queueTransport) ReadRequest() (req *pdu, err error) {
+	if len(qt.requests) == 0 {
+		err	= io.EOF
+		return
+	}
+
+	req		= qt.requests[0]
+	qt.requests	= qt.requests[1:]
+
+	return
+}
+
+func (qt *queueTransport) WriteResponse(res *pdu) (err error) {
+	qt.responses	= append(qt.responses, res)
+
+	return
+}
+
+func TestInterceptingTransport(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var qt		*queueTransport
+	var it		transport
+	var buf		syncBuffer
+	var writes	int
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5537",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	qt	= &queueTransport{}
+	for i := 0; i < 6; i++ {
+		qt.requests	= append(qt.requests, &pdu{
+			unitId:		1,
+			functionCode:	FC_READ_HOLDING_REGISTERS,
+			payload:	[]byte{0x00, 0x00, 0x00, 0x02},
+		})
+	}
+
+	// fail every third response with a CRC error
+	it	= NewInterceptingTransport(qt, TransportInterceptor{
+		OnWriteResponse:	func(res *pdu, err error) error {
+			writes++
+			if writes % 3 == 0 {
+				return ErrBadCRC
+			}
+			return err
+		},
+	})
+
+	// log write errors as seen by the server
+	server.handleTransport(newLoggingTransport(it, &requestLogger{
+		w:	&buf,
+		level:	LOG_LEVEL_ERROR,
+	}, "test"))
+
+	// all requests should have been served, despite write errors
+	if len(qt.requests) != 0 || len(qt.responses) != 6 || writes != 6 {
+		t.Errorf("expected 6 requests to be served, got %v requests left, %v responses, %v writes",
+			 len(qt.requests), len(qt.responses), writes)
+	}
+
+	if strings.Count(buf.String(), "tx error: " + ErrBadCRC.Error()) != 2 {
+		t.Errorf("expected 2 write errors, got: %q", buf.String())
+	}
+
+	// nil hooks should pass through, read hooks should be able to replace
+	// requests and errors
+	qt	= &queueTransport{
+		requests:	[]*pdu{{unitId: 1, functionCode: FC_READ_HOLDING_REGISTERS}},
+	}
+	it	= NewInterceptingTransport(qt, TransportInterceptor{})
+	if _, err = it.ReadRequest(); err != nil {
+		t.Errorf("ReadRequest() should have succeeded, got: %v", err)
+	}
+	if err = it.WriteResponse(&pdu{}); err != nil || len(qt.responses) != 1 {
+		t.Errorf("WriteResponse() should have succeeded, got: %v", err)
+	}
+
+	it	= NewInterceptingTransport(qt, TransportInterceptor{
+		OnReadRequest:	func(req *pdu, err error) (*pdu, error) {
+			return &pdu{unitId: 9}, nil
+		},
+	})
+	if req, err := it.ReadRequest(); err != nil || req.unitId != 9 {
+		t.Errorf("expected the replaced request, got: %v, %v", req, err)
+	}
+
+	return
+}
@@ -7,6 +7,8 @@ import (
 
 type logger struct {
 	prefix	string
+	// if set, lines are passed to out rather than written to stdout/stderr
+	out	Logger
 }
 
 func newLogger(prefix string) (l *logger) {
@@ -18,37 +20,37 @@ func newLogger(prefix string) (l *logger) {
 }
 
 func (l *logger) Info(msg string) {
-	l.write(false, fmt.Sprintf("%s [info]: %s\n", l.prefix, msg))
+	l.log(LOG_LEVEL_INFO, msg)
 
 	return
 }
 
 func (l *logger) Infof(format string, msg ...interface{}) {
-	l.write(false, fmt.Sprintf("%s [info]: %s\n", l.prefix, fmt.Sprintf(format, msg...)))
+	l.log(LOG_LEVEL_INFO, fmt.Sprintf(format, msg...))
 
 	return
 }
 
 func (l *logger) Warning(msg string) {
-	l.write(false, fmt.Sprintf("%s [warn]: %s\n", l.prefix, msg))
+	l.log(LOG_LEVEL_WARNING, msg)
 
 	return
 }
 
 func (l *logger) Warningf(format string, msg ...interface{}) {
-	l.write(false, fmt.Sprintf("%s [warn]: %s\n", l.prefix, fmt.Sprintf(format, msg...)))
+	l.log(LOG_LEVEL_WARNING, fmt.Sprintf(format, msg...))
 
 	return
 }
 
 func (l *logger) Error(msg string) {
-	l.write(false, fmt.Sprintf("%s [error]: %s\n", l.prefix, msg))
+	l.log(LOG_LEVEL_ERROR, msg)
 
 	return
 }
 
 func (l *logger) Errorf(format string, msg ...interface{}) {
-	l.write(false, fmt.Sprintf("%s [error]: %s\n", l.prefix, fmt.Sprintf(format, msg...)))
+	l.log(LOG_LEVEL_ERROR, fmt.Sprintf(format, msg...))
 
 	return
 }
@@ -67,11 +69,76 @@ func (l *logger) Fatalf(format string, msg ...interface{}) {
 	return
 }
 
-func (l *logger) write(stderr bool, msg string) {
-	if stderr {
-		os.Stderr.WriteString(msg)
-	} else {
-		os.Stdout.WriteString(msg)
+// Passes msg to the output logger if any (with its level and source if it
+// implements LevelLogger), writes it to stdout otherwise.
+func (l *logger) log(level LogLevel, msg string) {
+	var ll	LevelLogger
+	var ok	bool
+
+	if l.out == nil {
+		os.Stdout.WriteString(fmt.Sprintf("%s [%s]: %s\n", l.prefix, level, msg))
+		return
+	}
+
+	ll, ok	= l.out.(LevelLogger)
+	if ok {
+		ll.Log(level, l.prefix, msg)
+		return
+	}
+
+	l.out.Printf("%s [%s]: %s", l.prefix, level, msg)
+
+	return
+}
+
+type LogLevel uint
+const (
+	LOG_LEVEL_INFO		LogLevel	= 1
+	LOG_LEVEL_WARNING	LogLevel	= 2
+	LOG_LEVEL_ERROR		LogLevel	= 3
+)
+
+func (ll LogLevel) String() (s string) {
+	switch ll {
+	case LOG_LEVEL_INFO:	s = "info"
+	case LOG_LEVEL_WARNING:	s = "warn"
+	case LOG_LEVEL_ERROR:	s = "error"
+	default:		s = fmt.Sprintf("level(%d)", uint(ll))
+	}
+
+	return
+}
+
+// Logger is the interface of application-provided loggers (see
+// LoggingClientMiddleware() and the Logger fields of ClientConfiguration
+// and ServerConfiguration). *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// The LevelLogger interface can optionally be implemented by Loggers set in
+// ClientConfiguration or ServerConfiguration to receive the level and source
+// (e.g. "modbus-server(localhost:502)") of library log lines as separate
+// fields rather than as a formatted line, e.g. to feed a structured logging
+// pipeline (see NewSlogLogger()).
+type LevelLogger interface {
+	Logger
+	Log(level LogLevel, source string, msg string)
+}
+
+// Routes the log lines of t, and of the transports it wraps, to out.
+func setTransportLogger(t transport, out Logger) {
+	switch tt := t.(type) {
+	case *tcpTransport:
+		tt.logger.out	= out
+	case *rtuTransport:
+		tt.logger.out	= out
+	case *asciiTransport:
+		tt.logger.out	= out
+	case *autoDetectTransport:
+		tt.logger.out	= out
+		setTransportLogger(tt.rtu, out)
+		setTransportLogger(tt.ascii, out)
 	}
 
 	return
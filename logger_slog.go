@@ -0,0 +1,66 @@
+//go:build go1.21
+
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// slogLogger is a LevelLogger passing log lines to a slog.Handler.
+type slogLogger struct {
+	handler	slog.Handler
+}
+
+// Returns a Logger passing library log lines to handler as records with the
+// matching slog level (info, warn or error) and a "component" attribute
+// holding their source (e.g. "modbus-client(localhost:502)"), e.g.
+//   client, err = modbus.NewClient(&modbus.ClientConfiguration{
+//       URL:    "tcp://localhost:502",
+//       Logger: modbus.NewSlogLogger(slog.Default().Handler()),
+//   })
+func NewSlogLogger(handler slog.Handler) (l Logger) {
+	l	= &slogLogger{
+		handler:	handler,
+	}
+
+	return
+}
+
+// Logs a formatted line at the info level, without a component attribute.
+func (sl *slogLogger) Printf(format string, v ...interface{}) {
+	sl.write(slog.LevelInfo, "", fmt.Sprintf(format, v...))
+
+	return
+}
+
+// Logs msg at the slog level matching level.
+func (sl *slogLogger) Log(level LogLevel, source string, msg string) {
+	switch level {
+	case LOG_LEVEL_INFO:	sl.write(slog.LevelInfo, source, msg)
+	case LOG_LEVEL_WARNING:	sl.write(slog.LevelWarn, source, msg)
+	default:		sl.write(slog.LevelError, source, msg)
+	}
+
+	return
+}
+
+func (sl *slogLogger) write(level slog.Level, source string, msg string) {
+	var record	slog.Record
+
+	if !sl.handler.Enabled(context.Background(), level) {
+		return
+	}
+
+	record	= slog.NewRecord(time.Now(), level, msg, 0)
+	if source != "" {
+		record.AddAttrs(slog.String("component", source))
+	}
+
+	// errors from the handler have nowhere to go
+	sl.handler.Handle(context.Background(), record)
+
+	return
+}
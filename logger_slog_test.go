@@ -0,0 +1,132 @@
+//go:build go1.21
+
+package modbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	lock	sync.Mutex
+	buf	bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (n int, err error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	n, err	= lb.buf.Write(p)
+
+	return
+}
+
+// Returns the JSON records written so far.
+func (lb *lockedBuffer) records() (records []map[string]interface{}) {
+	var record	map[string]interface{}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	for _, line := range strings.Split(strings.TrimSpace(lb.buf.String()), "\n") {
+		if json.Unmarshal([]byte(line), &record) == nil {
+			records	= append(records, record)
+			record	= nil
+		}
+	}
+
+	return
+}
+
+func TestLoggers(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var out		*lockedBuffer
+	var rl		*recordingLogger
+	var sock	net.Conn
+	var records	[]map[string]interface{}
+	var err		error
+
+	out		= &lockedBuffer{}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5576",
+		Logger:	NewSlogLogger(slog.NewJSONHandler(out, nil)),
+	}, NewDataStore(0, 0, 4, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// server log lines
+	server.Pause()
+	server.Resume()
+
+	// transport log lines, with a request carrying protocol id 0x0001
+	sock, err	= net.Dial("tcp", "localhost:5576")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer sock.Close()
+
+	_, err	= sock.Write([]byte{
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x06,
+		0x01, 0x03, 0x00, 0x00, 0x00, 0x01,
+	})
+	if err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+
+	for i := 0; i < 100 && len(records) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		records	= out.records()
+	}
+
+	if len(records) < 2 {
+		t.Fatalf("expected at least 2 records, got: %v", records)
+	}
+
+	if records[0]["level"] != "INFO" || records[0]["msg"] != "paused" ||
+	   records[0]["component"] != "modbus-server(localhost:5576)" {
+		t.Errorf("unexpected record: %v", records[0])
+	}
+
+	if records[len(records) - 1]["level"] != "WARN" ||
+	   records[len(records) - 1]["msg"] != "received unexpected protocol id 0x0001" ||
+	   !strings.HasPrefix(records[len(records) - 1]["component"].(string), "tcp-transport(") {
+		t.Errorf("unexpected record: %v", records[len(records) - 1])
+	}
+
+	// plain Loggers get formatted lines
+	rl		= &recordingLogger{}
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5576",
+		Logger:	rl,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	_, err	= client.ReadCoils(0, 0)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	if len(rl.lines) != 1 ||
+	   rl.lines[0] != "modbus-client(localhost:5576) [error]: quantity of coils/discrete inputs is 0" {
+		t.Errorf("unexpected lines: %v", rl.lines)
+	}
+
+	return
+}
@@ -0,0 +1,177 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// requestLogger writes formatted request/response lines to an io.Writer.
+// It is shared by all client connections of a server.
+type requestLogger struct {
+	lock	sync.Mutex
+	w	io.Writer
+	level	LogLevel
+	hexDump	bool	// also log PDUs in hex (see NewDebugServer())
+}
+
+// loggingTransport is a proxy transport logging every request read from
+// and every response written to the wrapped transport.
+type loggingTransport struct {
+	transport
+	rl		*requestLogger
+	remoteAddr	string
+	lastReq		*pdu
+}
+
+// Enables request logging on inner and returns it.
+// Every request/response pair handled by the server is written to w as two
+// lines (rx: request, tx: response), including a timestamp, the remote
+// address, unit id, function code name, address range and response status.
+// level sets the verbosity:
+// - LOG_LEVEL_INFO logs every request and response,
+// - LOG_LEVEL_WARNING only logs exception responses and transport errors,
+// - LOG_LEVEL_ERROR only logs transport errors.
+// The internal logger of the server is left untouched.
+// Request logging applies to client connections accepted and to serial
+// (rtu:// and ascii://) servers started after this call, whose log lines
+// carry the serial device in place of the remote address.
+func NewLoggingServer(inner *ModbusServer, w io.Writer, level LogLevel) (ms *ModbusServer) {
+	ms	= inner
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.requestLogger	= &requestLogger{
+		w:	w,
+		level:	level,
+	}
+
+	return
+}
+
+// Returns a new logging transport wrapping t.
+func newLoggingTransport(t transport, rl *requestLogger, remoteAddr string) (lt *loggingTransport) {
+	lt = &loggingTransport{
+		transport:	t,
+		rl:		rl,
+		remoteAddr:	remoteAddr,
+	}
+
+	return
+}
+
+// Reads a request from the wrapped transport and logs it.
+func (lt *loggingTransport) ReadRequest() (req *pdu, err error) {
+	req, err	= lt.transport.ReadRequest()
+	if err != nil {
+		// connections closing (either end) are not worth logging
+		if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			lt.rl.log(LOG_LEVEL_ERROR, lt.remoteAddr,
+				  fmt.Sprintf("rx error: %v", err))
+		}
+		return
+	}
+
+	lt.lastReq	= req
+	lt.rl.log(LOG_LEVEL_INFO, lt.remoteAddr, "rx " + describeRequest(req))
+	if lt.rl.hexDump {
+		lt.rl.log(LOG_LEVEL_INFO, lt.remoteAddr, "rx pdu: " + hexDumpPDU(req))
+	}
+
+	return
+}
+
+// Logs a response, then writes it to the wrapped transport.
+func (lt *loggingTransport) WriteResponse(res *pdu) (err error) {
+	var line	string
+	var level	LogLevel
+
+	if lt.lastReq != nil {
+		line	= "tx " + describeRequest(lt.lastReq)
+	} else {
+		line	= fmt.Sprintf("tx unitId=%v fc=%s",
+				      res.unitId, functionCodeName(res.functionCode & 0x7f))
+	}
+
+	if res.functionCode & 0x80 == 0x80 && len(res.payload) == 1 {
+		level	= LOG_LEVEL_WARNING
+		line	+= fmt.Sprintf(" status=exception(0x%02x: %v)",
+				       res.payload[0], mapExceptionCodeToError(res.payload[0]))
+	} else {
+		level	= LOG_LEVEL_INFO
+		line	+= " status=OK"
+	}
+	lt.rl.log(level, lt.remoteAddr, line)
+	if lt.rl.hexDump {
+		lt.rl.log(LOG_LEVEL_INFO, lt.remoteAddr, "tx pdu: " + hexDumpPDU(res))
+	}
+
+	err	= lt.transport.WriteResponse(res)
+	if err != nil {
+		lt.rl.log(LOG_LEVEL_ERROR, lt.remoteAddr,
+			  fmt.Sprintf("tx error: %v", err))
+	}
+
+	return
+}
+
+// Writes a log line if level is at or above the configured level.
+func (rl *requestLogger) log(level LogLevel, remoteAddr string, msg string) {
+	if level < rl.level {
+		return
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	fmt.Fprintf(rl.w, "%s [%s] %s %s\n",
+		    time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		    level, remoteAddr, msg)
+
+	return
+}
+
+// Returns a short description of a request (unit id, function code name and
+// address range, when applicable).
+func describeRequest(req *pdu) (desc string) {
+	var addr	uint16
+	var quantity	uint16
+
+	desc	= fmt.Sprintf("unitId=%v fc=%s", req.unitId, functionCodeName(req.functionCode))
+
+	switch req.functionCode {
+	case FC_READ_COILS, FC_READ_DISCRETE_INPUTS,
+	     FC_READ_HOLDING_REGISTERS, FC_READ_INPUT_REGISTERS,
+	     FC_WRITE_MULTIPLE_COILS, FC_WRITE_MULTIPLE_REGISTERS:
+		if len(req.payload) < 4 {
+			return
+		}
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		if quantity == 0 {
+			return
+		}
+		desc	+= fmt.Sprintf(" addr=%v-%v", addr, uint32(addr) + uint32(quantity) - 1)
+
+	case FC_WRITE_SINGLE_COIL, FC_WRITE_SINGLE_REGISTER:
+		if len(req.payload) < 2 {
+			return
+		}
+		addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		desc	+= fmt.Sprintf(" addr=%v", addr)
+	}
+
+	return
+}
+
+// Returns the unit id, function code and payload of a PDU as space-separated
+// hex bytes.
+func hexDumpPDU(p *pdu) (dump string) {
+	dump	= fmt.Sprintf("% x", append([]byte{p.unitId, p.functionCode}, p.payload...))
+
+	return
+}
@@ -0,0 +1,198 @@
+package modbus
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	lock	sync.Mutex
+	buf	bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (n int, err error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	n, err = sb.buf.Write(p)
+
+	return
+}
+
+func (sb *syncBuffer) String() (s string) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	s = sb.buf.String()
+
+	return
+}
+
+func TestLoggingServer(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var buf		syncBuffer
+	var client	*ModbusClient
+	var th		*testHandler
+	var lines	[]string
+
+	th = &testHandler{}
+
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5506",
+		MaxClients:	1,
+	}, th)
+	if err != nil {
+		t.Errorf("failed to create server: %v", err)
+	}
+
+	if NewLoggingServer(server, &buf, LOG_LEVEL_INFO) != server {
+		t.Errorf("NewLoggingServer() should have returned the inner server")
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Errorf("failed to start server: %v", err)
+	}
+
+	client, err = NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5506",
+	})
+	if err != nil {
+		t.Errorf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Errorf("failed to open client: %v", err)
+	}
+	client.SetUnitId(9)
+
+	// a successful read
+	_, err	= client.ReadRegisters(2, 3, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	// a failed write
+	err	= client.WriteRegisters(20, []uint16{1, 2})
+	if err == nil {
+		t.Errorf("WriteRegisters() should have failed")
+	}
+
+	client.Close()
+	server.Stop()
+
+	lines	= strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 log lines, got %v: %q", len(lines), buf.String())
+	}
+
+	for i, expected := range []string{
+		"[info] 127.0.0.1:",
+		"[info] 127.0.0.1:",
+		"[info] 127.0.0.1:",
+		"[warn] 127.0.0.1:",
+	} {
+		if !strings.Contains(lines[i], expected) {
+			t.Errorf("expected line %v to contain %q, got: %q", i, expected, lines[i])
+		}
+	}
+
+	for i, expected := range []string{
+		" rx unitId=9 fc=ReadHoldingRegisters addr=2-4",
+		" tx unitId=9 fc=ReadHoldingRegisters addr=2-4 status=OK",
+		" rx unitId=9 fc=WriteMultipleRegisters addr=20-21",
+		" tx unitId=9 fc=WriteMultipleRegisters addr=20-21 " +
+			"status=exception(0x02: illegal data address)",
+	} {
+		if !strings.HasSuffix(lines[i], expected) {
+			t.Errorf("expected line %v to end with %q, got: %q", i, expected, lines[i])
+		}
+	}
+
+	// the level should filter out successful requests
+	buf	= syncBuffer{}
+	rl	:= &requestLogger{w: &buf, level: LOG_LEVEL_WARNING}
+	rl.log(LOG_LEVEL_INFO, "remote", "should not appear")
+	rl.log(LOG_LEVEL_WARNING, "remote", "should appear")
+	if strings.Contains(buf.String(), "should not appear") ||
+	   !strings.Contains(buf.String(), "[warn] remote should appear") {
+		t.Errorf("unexpected log output: %q", buf.String())
+	}
+
+	return
+}
+
+func TestLoggingServerRTU(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var buf		syncBuffer
+	var p1, p2	net.Conn
+	var done	chan struct{}
+	var lines	[]string
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/ttyUSB0",
+	}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	NewLoggingServer(server, &buf, LOG_LEVEL_INFO)
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// run both ends over a pipe rather than a serial port
+	p1, p2	= net.Pipe()
+	done	= make(chan struct{})
+	go func() {
+		server.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+		close(done)
+	}()
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+	client.SetUnitId(9)
+
+	_, err	= client.ReadRegisters(2, 3, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegisters(20, []uint16{1, 2})
+	if err == nil {
+		t.Errorf("WriteRegisters() should have failed")
+	}
+
+	p1.Close()
+	<-done
+
+	// closing the pipe may be logged as well
+	lines	= strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("expected at least 4 log lines, got %v: %q", len(lines), buf.String())
+	}
+
+	for i, expected := range []string{
+		"[info] /dev/ttyUSB0 rx unitId=9 fc=ReadHoldingRegisters addr=2-4",
+		"[info] /dev/ttyUSB0 tx unitId=9 fc=ReadHoldingRegisters addr=2-4 status=OK",
+		"[info] /dev/ttyUSB0 rx unitId=9 fc=WriteMultipleRegisters addr=20-21",
+		"[warn] /dev/ttyUSB0 tx unitId=9 fc=WriteMultipleRegisters addr=20-21 " +
+			"status=exception(0x02: illegal data address)",
+	} {
+		if !strings.HasSuffix(lines[i], expected) {
+			t.Errorf("expected line %v to end with %q, got: %q", i, expected, lines[i])
+		}
+	}
+
+	return
+}
@@ -0,0 +1,430 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type ConnectionMetric uint
+const (
+	// time from the connection being accepted to its first request
+	CONNECTION_FIRST_BYTE	ConnectionMetric	= 1
+	// time from the connection being accepted to it being closed
+	CONNECTION_LIFETIME	ConnectionMetric	= 2
+)
+
+// MetricsCollector receives server metrics (see NewServerWithMetrics()) or
+// client metrics (see ClientConfiguration.Metrics).
+// Methods are called from client session goroutines, hence must be safe for
+// concurrent use.
+type MetricsCollector interface {
+	// RecordRequest is called once per processed request, with the time
+	// taken to process it and the resulting error (nil on success).
+	RecordRequest(unitId uint8, functionCode uint8, duration time.Duration, err error)
+	// RecordBytesRead and RecordBytesWritten are called with the number of
+	// bytes of each read from and write to client connections or serial
+	// links.
+	RecordBytesRead(n int)
+	RecordBytesWritten(n int)
+	// RecordConnection is called with the timings of TCP client
+	// connections: CONNECTION_FIRST_BYTE once the first request is
+	// received (if any), and CONNECTION_LIFETIME once the connection
+	// is closed.
+	RecordConnection(metric ConnectionMetric, duration time.Duration)
+}
+
+// LinkMetricsCollector can optionally be implemented by metrics collectors
+// to receive link level events on top of those of MetricsCollector.
+type LinkMetricsCollector interface {
+	// RecordFrameError is called for each malformed frame received over a
+	// serial link (ErrBadCRC, ErrShortFrame or ErrProtocolError).
+	RecordFrameError(err error)
+	// RecordActiveConnections is called with the number of open TCP
+	// client connections whenever it changes (servers only).
+	RecordActiveConnections(count int)
+}
+
+// Upper bounds of the request latency histogram buckets of CountingMetrics.
+var latencyBuckets	= []time.Duration{
+	1 * time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, 1 * time.Second,
+	2500 * time.Millisecond, 5 * time.Second,
+}
+
+// CountingMetrics is a MetricsCollector and LinkMetricsCollector keeping
+// counters of requests (by function code), exceptions (by exception code),
+// timeouts, frame errors and traffic, along with a request latency
+// histogram. It can be used by both clients and servers, and exposes its
+// counters to Prometheus (see ServeHTTP()).
+// The zero value is ready for use.
+type CountingMetrics struct {
+	lock		sync.Mutex
+	requests	uint64
+	errors		uint64
+	bytesRead	uint64
+	bytesWritten	uint64
+	connections	uint64
+	requestsByFC	map[uint8]uint64
+	exceptions	map[uint8]uint64
+	timeouts	uint64
+	frameErrors	uint64
+	activeConns	int
+	// latency histogram: counts per bucket (see latencyBuckets, the last
+	// one counting requests past the highest bound) and sum
+	latencyCounts	[]uint64
+	latencySum	time.Duration
+}
+
+func (cm *CountingMetrics) RecordRequest(unitId uint8, functionCode uint8, duration time.Duration, err error) {
+	var code	uint8
+	var ok		bool
+	var bucket	int
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	if cm.requestsByFC == nil {
+		cm.requestsByFC		= make(map[uint8]uint64)
+		cm.exceptions		= make(map[uint8]uint64)
+		cm.latencyCounts	= make([]uint64, len(latencyBuckets) + 1)
+	}
+
+	cm.requests++
+	cm.requestsByFC[functionCode]++
+	if err != nil {
+		cm.errors++
+	}
+
+	code, ok	= exceptionCodeOf(err)
+	if ok {
+		cm.exceptions[code]++
+	}
+
+	if isTimeout(err) {
+		cm.timeouts++
+	}
+
+	for bucket = 0; bucket < len(latencyBuckets); bucket++ {
+		if duration <= latencyBuckets[bucket] {
+			break
+		}
+	}
+	cm.latencyCounts[bucket]++
+	cm.latencySum	+= duration
+
+	return
+}
+
+func (cm *CountingMetrics) RecordFrameError(err error) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	cm.frameErrors++
+
+	return
+}
+
+func (cm *CountingMetrics) RecordActiveConnections(count int) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	cm.activeConns	= count
+
+	return
+}
+
+func (cm *CountingMetrics) RecordBytesRead(n int) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	cm.bytesRead	+= uint64(n)
+
+	return
+}
+
+func (cm *CountingMetrics) RecordBytesWritten(n int) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	cm.bytesWritten	+= uint64(n)
+
+	return
+}
+
+func (cm *CountingMetrics) RecordConnection(metric ConnectionMetric, duration time.Duration) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	if metric == CONNECTION_LIFETIME {
+		cm.connections++
+	}
+
+	return
+}
+
+// Returns the number of requests processed.
+func (cm *CountingMetrics) Requests() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.requests
+
+	return
+}
+
+// Returns the number of requests which failed (answered with an exception
+// or dropped).
+func (cm *CountingMetrics) Errors() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.errors
+
+	return
+}
+
+// Returns the number of bytes read.
+func (cm *CountingMetrics) BytesRead() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.bytesRead
+
+	return
+}
+
+// Returns the number of bytes written.
+func (cm *CountingMetrics) BytesWritten() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.bytesWritten
+
+	return
+}
+
+// Returns the number of client connections closed.
+func (cm *CountingMetrics) Connections() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.connections
+
+	return
+}
+
+// Returns the number of requests processed, by function code.
+func (cm *CountingMetrics) RequestsByFunctionCode() (counts map[uint8]uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	counts	= make(map[uint8]uint64, len(cm.requestsByFC))
+	for fc, count := range cm.requestsByFC {
+		counts[fc]	= count
+	}
+
+	return
+}
+
+// Returns the number of exception responses, by exception code (see EX_*).
+func (cm *CountingMetrics) Exceptions() (counts map[uint8]uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	counts	= make(map[uint8]uint64, len(cm.exceptions))
+	for code, count := range cm.exceptions {
+		counts[code]	= count
+	}
+
+	return
+}
+
+// Returns the number of requests which timed out.
+func (cm *CountingMetrics) Timeouts() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.timeouts
+
+	return
+}
+
+// Returns the number of malformed frames received (e.g. CRC errors).
+func (cm *CountingMetrics) FrameErrors() (count uint64) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.frameErrors
+
+	return
+}
+
+// Returns the number of open TCP client connections.
+func (cm *CountingMetrics) ActiveConnections() (count int) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	count	= cm.activeConns
+
+	return
+}
+
+// Returns the exception code carried by err, if err is an exception (as
+// returned by the client on exception responses, or by request handlers).
+func exceptionCodeOf(err error) (code uint8, ok bool) {
+	var ee	ErrExceptionResponse
+
+	if err == nil {
+		return
+	}
+
+	if errors.As(err, &ee) {
+		code, ok	= ee.ExceptionCode, true
+		return
+	}
+
+	for _, sentinel := range []error{
+		ErrIllegalFunction, ErrIllegalDataAddress, ErrIllegalDataValue,
+		ErrServerDeviceFailure, ErrAcknowledge, ErrServerDeviceBusy,
+		ErrMemoryParityError, ErrGWPathUnavailable, ErrGWTargetFailedToRespond,
+	} {
+		if errors.Is(err, sentinel) {
+			code, ok	= mapErrorToExceptionCode(sentinel), true
+			return
+		}
+	}
+
+	return
+}
+
+// Returns true if err denotes a timeout (of the link or of the request
+// context).
+func isTimeout(err error) (ok bool) {
+	ok	= err != nil && (errors.Is(err, ErrRequestTimedOut) ||
+		  errors.Is(err, context.DeadlineExceeded) || isTimeoutError(err))
+
+	return
+}
+
+// Returns a new modbus server reporting request and traffic metrics to
+// collector. Other than that, it behaves like a server returned by NewServer().
+func NewServerWithMetrics(conf *ServerConfiguration, handler RequestHandler,
+			  collector MetricsCollector) (ms *ModbusServer, err error) {
+	if collector == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ms, err	= NewServer(conf, handler)
+	if err != nil {
+		return
+	}
+
+	ms.metrics	= collector
+
+	return
+}
+
+// countingConn is a net.Conn reporting the number of bytes read and written
+// to a metrics collector.
+type countingConn struct {
+	net.Conn
+	metrics	MetricsCollector
+}
+
+func (cc *countingConn) Read(buf []byte) (n int, err error) {
+	n, err	= cc.Conn.Read(buf)
+	if n > 0 {
+		cc.metrics.RecordBytesRead(n)
+	}
+
+	return
+}
+
+func (cc *countingConn) Write(buf []byte) (n int, err error) {
+	n, err	= cc.Conn.Write(buf)
+	if n > 0 {
+		cc.metrics.RecordBytesWritten(n)
+	}
+
+	return
+}
+
+// countingLink is an rtuLink reporting the number of bytes read and written
+// to a metrics collector.
+type countingLink struct {
+	rtuLink
+	metrics	MetricsCollector
+}
+
+func (cl *countingLink) Read(buf []byte) (n int, err error) {
+	n, err	= cl.rtuLink.Read(buf)
+	if n > 0 {
+		cl.metrics.RecordBytesRead(n)
+	}
+
+	return
+}
+
+func (cl *countingLink) Write(buf []byte) (n int, err error) {
+	n, err	= cl.rtuLink.Write(buf)
+	if n > 0 {
+		cl.metrics.RecordBytesWritten(n)
+	}
+
+	return
+}
+
+// Reports a malformed frame to the metrics collector, if it implements
+// LinkMetricsCollector.
+func (ms *ModbusServer) recordFrameError(err error) {
+	var lmc	LinkMetricsCollector
+	var ok	bool
+
+	lmc, ok	= ms.metrics.(LinkMetricsCollector)
+	if ok {
+		lmc.RecordFrameError(err)
+	}
+
+	return
+}
+
+// Reports the number of open TCP client connections to the metrics
+// collector, if it implements LinkMetricsCollector.
+func (ms *ModbusServer) recordActiveConnections(count int) {
+	var lmc	LinkMetricsCollector
+	var ok	bool
+
+	lmc, ok	= ms.metrics.(LinkMetricsCollector)
+	if ok {
+		lmc.RecordActiveConnections(count)
+	}
+
+	return
+}
+
+// Reports a request and its outcome to the metrics collector of the client.
+// Exception responses are reported as ErrExceptionResponse errors, and
+// malformed responses as frame errors if the collector implements
+// LinkMetricsCollector.
+func (mc *ModbusClient) recordRequest(req *pdu, res *pdu, err error, duration time.Duration) {
+	var lmc	LinkMetricsCollector
+	var ok	bool
+
+	err	= responseError(res, err)
+
+	mc.conf.Metrics.RecordRequest(req.unitId, req.functionCode, duration, err)
+
+	if err == ErrBadCRC || err == ErrShortFrame {
+		lmc, ok	= mc.conf.Metrics.(LinkMetricsCollector)
+		if ok {
+			lmc.RecordFrameError(err)
+		}
+	}
+
+	return
+}
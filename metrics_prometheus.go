@@ -0,0 +1,103 @@
+package modbus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// Writes all counters to w in the Prometheus text exposition format, with
+// metric names prefixed by "modbus_":
+// - requests_total{function_code}:	requests processed,
+// - exceptions_total{exception_code}:	exception responses,
+// - errors_total:			failed requests (exceptions included),
+// - timeouts_total:			requests which timed out,
+// - frame_errors_total:		malformed frames (e.g. CRC errors),
+// - bytes_read_total, bytes_written_total: traffic,
+// - active_connections:		open TCP client connections,
+// - request_duration_seconds:		request latency histogram.
+func (cm *CountingMetrics) WritePrometheus(w io.Writer) (err error) {
+	var bw		*bufio.Writer
+	var codes	[]int
+	var cumulative	uint64
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	bw	= bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# HELP modbus_requests_total Requests processed, by function code.\n")
+	fmt.Fprintf(bw, "# TYPE modbus_requests_total counter\n")
+	codes	= sortedCodes(cm.requestsByFC)
+	for _, fc := range codes {
+		fmt.Fprintf(bw, "modbus_requests_total{function_code=\"0x%02x\"} %v\n",
+			    fc, cm.requestsByFC[uint8(fc)])
+	}
+
+	fmt.Fprintf(bw, "# HELP modbus_exceptions_total Exception responses, by exception code.\n")
+	fmt.Fprintf(bw, "# TYPE modbus_exceptions_total counter\n")
+	codes	= sortedCodes(cm.exceptions)
+	for _, code := range codes {
+		fmt.Fprintf(bw, "modbus_exceptions_total{exception_code=\"0x%02x\"} %v\n",
+			    code, cm.exceptions[uint8(code)])
+	}
+
+	for _, counter := range []struct {
+		name	string
+		help	string
+		value	uint64
+	}{
+		{"errors_total", "Failed requests, exceptions included.", cm.errors},
+		{"timeouts_total", "Requests which timed out.", cm.timeouts},
+		{"frame_errors_total", "Malformed frames received.", cm.frameErrors},
+		{"bytes_read_total", "Bytes read from links.", cm.bytesRead},
+		{"bytes_written_total", "Bytes written to links.", cm.bytesWritten},
+	} {
+		fmt.Fprintf(bw, "# HELP modbus_%s %s\n", counter.name, counter.help)
+		fmt.Fprintf(bw, "# TYPE modbus_%s counter\n", counter.name)
+		fmt.Fprintf(bw, "modbus_%s %v\n", counter.name, counter.value)
+	}
+
+	fmt.Fprintf(bw, "# HELP modbus_active_connections Open TCP client connections.\n")
+	fmt.Fprintf(bw, "# TYPE modbus_active_connections gauge\n")
+	fmt.Fprintf(bw, "modbus_active_connections %v\n", cm.activeConns)
+
+	fmt.Fprintf(bw, "# HELP modbus_request_duration_seconds Request latency.\n")
+	fmt.Fprintf(bw, "# TYPE modbus_request_duration_seconds histogram\n")
+	for i, bound := range latencyBuckets {
+		if cm.latencyCounts != nil {
+			cumulative	+= cm.latencyCounts[i]
+		}
+		fmt.Fprintf(bw, "modbus_request_duration_seconds_bucket{le=\"%v\"} %v\n",
+			    bound.Seconds(), cumulative)
+	}
+	fmt.Fprintf(bw, "modbus_request_duration_seconds_bucket{le=\"+Inf\"} %v\n", cm.requests)
+	fmt.Fprintf(bw, "modbus_request_duration_seconds_sum %v\n", cm.latencySum.Seconds())
+	fmt.Fprintf(bw, "modbus_request_duration_seconds_count %v\n", cm.requests)
+
+	err	= bw.Flush()
+
+	return
+}
+
+// Serves all counters in the Prometheus text exposition format (see
+// WritePrometheus()), e.g. with
+//   http.Handle("/metrics", metrics)
+func (cm *CountingMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	cm.WritePrometheus(w)
+
+	return
+}
+
+// Returns the keys of counts, sorted.
+func sortedCodes(counts map[uint8]uint64) (codes []int) {
+	for code := range counts {
+		codes	= append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	return
+}
@@ -0,0 +1,324 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewServerWithMetrics(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var metrics	*CountingMetrics
+	var err		error
+
+	_, err	= NewServerWithMetrics(&ServerConfiguration{
+		URL:	"tcp://localhost:5533",
+	}, NewDataStore(0, 0, 1, 0), nil)
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	metrics		= &CountingMetrics{}
+	server, err	= NewServerWithMetrics(&ServerConfiguration{
+		URL:	"tcp://localhost:5533",
+	}, NewDataStore(0, 0, 1, 0), metrics)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5533",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	_, err	= client.ReadRegister(1, HOLDING_REGISTER)
+	if err == nil {
+		t.Errorf("ReadRegister() should have failed")
+	}
+
+	if metrics.Requests() != 2 || metrics.Errors() != 1 {
+		t.Errorf("expected 2 requests and 1 error, got: %v and %v",
+			 metrics.Requests(), metrics.Errors())
+	}
+
+	// the server may still be returning from its last write
+	for i := 0; i < 100 && metrics.BytesWritten() < 20; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 2 requests of 12 bytes, 1 response of 11 bytes and 1 exception
+	// response of 9 bytes
+	if metrics.BytesRead() != 24 || metrics.BytesWritten() != 20 {
+		t.Errorf("expected 24 bytes read and 20 bytes written, got: %v and %v",
+			 metrics.BytesRead(), metrics.BytesWritten())
+	}
+
+	return
+}
+
+// timingMetrics is a CountingMetrics keeping connection timings.
+type timingMetrics struct {
+	CountingMetrics
+	timings		chan ConnectionMetric
+	lock		sync.Mutex
+	firstByte	time.Duration
+	lifetime	time.Duration
+}
+
+func (tm *timingMetrics) RecordConnection(metric ConnectionMetric, duration time.Duration) {
+	tm.lock.Lock()
+	switch metric {
+	case CONNECTION_FIRST_BYTE:	tm.firstByte = duration
+	case CONNECTION_LIFETIME:	tm.lifetime = duration
+	}
+	tm.lock.Unlock()
+
+	tm.timings <- metric
+
+	return
+}
+
+func TestServerConnectionTimingMetrics(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var tm		*timingMetrics
+	var err		error
+
+	tm		= &timingMetrics{timings: make(chan ConnectionMetric, 2)}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:				"tcp://localhost:5540",
+		ConnectionTimingMetrics:	tm,
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5540",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	// wait before sending the first request
+	time.Sleep(50 * time.Millisecond)
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	client.Close()
+
+	for _, expected := range []ConnectionMetric{CONNECTION_FIRST_BYTE, CONNECTION_LIFETIME} {
+		select {
+		case metric := <-tm.timings:
+			if metric != expected {
+				t.Errorf("expected metric %v, got: %v", expected, metric)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for metric %v", expected)
+		}
+	}
+
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	if tm.firstByte < 50 * time.Millisecond {
+		t.Errorf("expected a time to first byte of at least 50ms, got: %v", tm.firstByte)
+	}
+
+	if tm.lifetime < tm.firstByte {
+		t.Errorf("expected a lifetime of at least %v, got: %v", tm.firstByte, tm.lifetime)
+	}
+
+	return
+}
+
+func TestCountingMetrics(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var sm, cm	*CountingMetrics
+	var rec		*httptest.ResponseRecorder
+	var p1, p2	net.Conn
+	var err		error
+
+	sm		= &CountingMetrics{}
+	server, err	= NewServerWithMetrics(&ServerConfiguration{
+		URL:	"tcp://localhost:5574",
+	}, NewDataStore(0, 0, 1, 0), sm)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	cm		= &CountingMetrics{}
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5574",
+		Metrics:	cm,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	_, err	= client.ReadRegister(1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	for _, m := range []*CountingMetrics{sm, cm} {
+		if m.RequestsByFunctionCode()[FC_READ_HOLDING_REGISTERS] != 2 ||
+		   m.Exceptions()[EX_ILLEGAL_DATA_ADDRESS] != 1 || m.Errors() != 1 {
+			t.Errorf("unexpected counters: %v, %v, %v", m.RequestsByFunctionCode(),
+				 m.Exceptions(), m.Errors())
+		}
+	}
+
+	// 2 requests of 12 bytes, 1 response of 11 bytes and 1 exception
+	// response of 9 bytes
+	if cm.BytesWritten() != 24 || cm.BytesRead() != 20 {
+		t.Errorf("expected 24 bytes written and 20 bytes read, got: %v and %v",
+			 cm.BytesWritten(), cm.BytesRead())
+	}
+
+	if sm.ActiveConnections() != 1 {
+		t.Errorf("expected 1 active connection, got: %v", sm.ActiveConnections())
+	}
+
+	client.Close()
+	for i := 0; i < 100 && sm.ActiveConnections() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sm.ActiveConnections() != 0 {
+		t.Errorf("expected no active connection, got: %v", sm.ActiveConnections())
+	}
+
+	// Prometheus exposition
+	rec	= httptest.NewRecorder()
+	cm.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`modbus_requests_total{function_code="0x03"} 2`,
+		`modbus_exceptions_total{exception_code="0x02"} 1`,
+		`modbus_errors_total 1`,
+		`modbus_bytes_written_total 24`,
+		`modbus_request_duration_seconds_bucket{le="+Inf"} 2`,
+		`modbus_request_duration_seconds_count 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line + "\n") {
+			t.Errorf("expected %q in output:\n%s", line, rec.Body.String())
+		}
+	}
+
+	// timeouts and frame errors
+	cm		= &CountingMetrics{}
+	p1, p2		= net.Pipe()
+	defer p2.Close()
+	client, err	= NewRTUClientWithLink(p1, "pipe", &ClientConfiguration{
+		Timeout:	50 * time.Millisecond,
+		Metrics:	cm,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// answer the first request with a bad CRC, leave the second unanswered
+	go func() {
+		var buf	= make([]byte, 256)
+		var err	error
+
+		_, err	= p2.Read(buf)
+		if err == nil {
+			p2.Write([]byte{0x01, 0x03, 0x02, 0x12, 0x34, 0xff, 0xff})
+		}
+
+		for err == nil {
+			_, err	= p2.Read(buf)
+		}
+	}()
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != ErrBadCRC {
+		t.Errorf("expected ErrBadCRC, got: %v", err)
+	}
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err == nil {
+		t.Errorf("ReadRegister() should have failed")
+	}
+
+	if cm.FrameErrors() != 1 || cm.Timeouts() != 1 || cm.Errors() != 2 {
+		t.Errorf("expected 1 frame error, 1 timeout and 2 errors, got: %v, %v and %v",
+			 cm.FrameErrors(), cm.Timeouts(), cm.Errors())
+	}
+
+	rec	= httptest.NewRecorder()
+	cm.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !bytes.Contains(rec.Body.Bytes(), []byte("modbus_timeouts_total 1\n")) ||
+	   !bytes.Contains(rec.Body.Bytes(), []byte("modbus_frame_errors_total 1\n")) {
+		t.Errorf("unexpected output:\n%s", rec.Body.String())
+	}
+
+	return
+}
@@ -0,0 +1,238 @@
+package modbus
+
+import (
+	"sync"
+)
+
+// MirrorServer replicates writes made through either of two servers to the
+// handlers of both, e.g. to keep a hot standby in sync (see
+// NewMirrorServer()).
+type MirrorServer struct {
+	primary		*ModbusServer
+	mirror		*ModbusServer
+	handler		*mirrorHandler
+}
+
+// mirrorHandler is a request handler writing to two handlers and reading from
+// the primary one, until it fails.
+type mirrorHandler struct {
+	lock		sync.Mutex
+	primary		RequestHandler
+	mirror		RequestHandler
+	primaryServer	*ModbusServer
+	promoted	bool
+	logger		*logger
+}
+
+// Returns a new mirror server made of primary and mirror, which from then on
+// both serve requests through a common handler:
+// - writes are passed to the handlers of both servers. Should only one of
+//   them fail, a warning is logged and the outcome of the primary handler
+//   is returned,
+// - reads are passed to the handler of primary only.
+// Should primary be stopped, or its handler fail with an error other than
+// a modbus exception (or with a server device failure), the mirror is
+// promoted: all requests are then served by the handler of mirror alone
+// (see Promoted()).
+// Both servers must be created but not started yet.
+func NewMirrorServer(primary *ModbusServer, mirror *ModbusServer) (ms *MirrorServer, err error) {
+	if primary == nil || mirror == nil || primary == mirror {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ms	= &MirrorServer{
+		primary:	primary,
+		mirror:		mirror,
+		handler:	&mirrorHandler{
+			primary:	primary.handler,
+			mirror:		mirror.handler,
+			primaryServer:	primary,
+			logger:		newLogger("modbus-mirror"),
+		},
+	}
+
+	primary.lock.Lock()
+	primary.handler	= ms.handler
+	primary.lock.Unlock()
+
+	mirror.lock.Lock()
+	mirror.handler	= ms.handler
+	mirror.lock.Unlock()
+
+	return
+}
+
+// Starts both servers. If either fails to start, neither is left running.
+func (ms *MirrorServer) Start() (err error) {
+	err	= ms.primary.Start()
+	if err != nil {
+		return
+	}
+
+	err	= ms.mirror.Start()
+	if err != nil {
+		ms.primary.Stop()
+		return
+	}
+
+	return
+}
+
+// Stops both servers.
+func (ms *MirrorServer) Stop() (err error) {
+	var mirrorErr	error
+
+	err		= ms.primary.Stop()
+	mirrorErr	= ms.mirror.Stop()
+	if err == nil {
+		err	= mirrorErr
+	}
+
+	return
+}
+
+// Returns true once the mirror has taken over from the primary.
+func (ms *MirrorServer) Promoted() (promoted bool) {
+	ms.handler.lock.Lock()
+	defer ms.handler.lock.Unlock()
+
+	promoted	= ms.handler.promoted
+
+	return
+}
+
+func (mh *mirrorHandler) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var mirrorErr	error
+
+	if !isWrite {
+		if mh.readFromPrimary() {
+			res, err	= mh.primary.HandleCoils(unitId, addr, quantity, false, nil)
+			if !mh.primaryFailed(err) {
+				return
+			}
+		}
+
+		res, err	= mh.mirror.HandleCoils(unitId, addr, quantity, false, nil)
+		return
+	}
+
+	if mh.readFromPrimary() {
+		res, err	= mh.primary.HandleCoils(unitId, addr, quantity, true, args)
+		_, mirrorErr	= mh.mirror.HandleCoils(unitId, addr, quantity, true, args)
+		mh.checkWrite("coils", addr, err, mirrorErr)
+		return
+	}
+
+	res, err	= mh.mirror.HandleCoils(unitId, addr, quantity, true, args)
+
+	return
+}
+
+func (mh *mirrorHandler) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	if mh.readFromPrimary() {
+		res, err	= mh.primary.HandleDiscreteInputs(unitId, addr, quantity)
+		if !mh.primaryFailed(err) {
+			return
+		}
+	}
+
+	res, err	= mh.mirror.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (mh *mirrorHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var mirrorErr	error
+
+	if !isWrite {
+		if mh.readFromPrimary() {
+			res, err	= mh.primary.HandleHoldingRegisters(unitId, addr, quantity, false, nil)
+			if !mh.primaryFailed(err) {
+				return
+			}
+		}
+
+		res, err	= mh.mirror.HandleHoldingRegisters(unitId, addr, quantity, false, nil)
+		return
+	}
+
+	if mh.readFromPrimary() {
+		res, err	= mh.primary.HandleHoldingRegisters(unitId, addr, quantity, true, args)
+		_, mirrorErr	= mh.mirror.HandleHoldingRegisters(unitId, addr, quantity, true, args)
+		mh.checkWrite("holding registers", addr, err, mirrorErr)
+		return
+	}
+
+	res, err	= mh.mirror.HandleHoldingRegisters(unitId, addr, quantity, true, args)
+
+	return
+}
+
+func (mh *mirrorHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	if mh.readFromPrimary() {
+		res, err	= mh.primary.HandleInputRegisters(unitId, addr, quantity)
+		if !mh.primaryFailed(err) {
+			return
+		}
+	}
+
+	res, err	= mh.mirror.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
+
+// Returns true if the primary should still be used, promoting the mirror if
+// the primary server has been stopped.
+func (mh *mirrorHandler) readFromPrimary() (ok bool) {
+	var running	bool
+
+	mh.primaryServer.lock.Lock()
+	running	= mh.primaryServer.started
+	mh.primaryServer.lock.Unlock()
+
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+
+	if !running && !mh.promoted {
+		mh.promoted	= true
+		mh.logger.Warning("primary server stopped, promoting mirror")
+	}
+
+	ok	= !mh.promoted
+
+	return
+}
+
+// Returns true if err is a failure of the primary handler (rather than an
+// exception to pass on), in which case the mirror is promoted.
+func (mh *mirrorHandler) primaryFailed(err error) (failed bool) {
+	if err == nil || mapErrorToExceptionCode(err) != EX_SERVER_DEVICE_FAILURE {
+		return
+	}
+
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+
+	if !mh.promoted {
+		mh.promoted	= true
+		mh.logger.Warningf("primary handler failed (%v), promoting mirror", err)
+	}
+	failed	= true
+
+	return
+}
+
+// Logs a warning if only one of the primary and mirror writes failed.
+func (mh *mirrorHandler) checkWrite(what string, addr uint16, primaryErr error, mirrorErr error) {
+	switch {
+	case primaryErr == nil && mirrorErr != nil:
+		mh.logger.Warningf("failed to mirror write to %s at address %v: %v",
+				   what, addr, mirrorErr)
+	case primaryErr != nil && mirrorErr == nil:
+		mh.logger.Warningf("write to %s at address %v failed on the primary " +
+				   "only: %v", what, addr, primaryErr)
+	}
+
+	return
+}
@@ -0,0 +1,120 @@
+package modbus
+
+import (
+	"testing"
+)
+
+func TestMirrorServer(t *testing.T) {
+	var primary	*ModbusServer
+	var mirror	*ModbusServer
+	var ms		*MirrorServer
+	var primaryDs	*DataStore
+	var mirrorDs	*DataStore
+	var client	*ModbusClient
+	var err		error
+	var reg		uint16
+
+	primaryDs	= NewDataStore(0, 0, 10, 0)
+	mirrorDs	= NewDataStore(0, 0, 10, 0)
+
+	primary, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5544",
+	}, primaryDs)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	mirror, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5545",
+	}, mirrorDs)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	_, err	= NewMirrorServer(primary, primary)
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	ms, err	= NewMirrorServer(primary, mirror)
+	if err != nil {
+		t.Fatalf("failed to create mirror server: %v", err)
+	}
+
+	err	= ms.Start()
+	if err != nil {
+		t.Fatalf("failed to start mirror server: %v", err)
+	}
+	defer ms.Stop()
+
+	// writes to the primary should be mirrored
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5544",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	err	= client.WriteRegister(3, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+	client.Close()
+
+	reg, _	= primaryDs.GetHoldingRegister(3)
+	if reg != 0x1234 {
+		t.Errorf("expected 0x1234 on the primary, got: 0x%04x", reg)
+	}
+	reg, _	= mirrorDs.GetHoldingRegister(3)
+	if reg != 0x1234 {
+		t.Errorf("expected 0x1234 on the mirror, got: 0x%04x", reg)
+	}
+
+	if ms.Promoted() {
+		t.Errorf("the mirror should not have been promoted yet")
+	}
+
+	// shut the primary down (and make its data diverge), then read through
+	// the mirror
+	primary.Stop()
+	primaryDs.SetHoldingRegister(3, 0xdead)
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5545",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	reg, err	= client.ReadRegister(3, HOLDING_REGISTER)
+	if err != nil || reg != 0x1234 {
+		t.Errorf("expected the mirrored value (0x1234), got: 0x%04x, %v", reg, err)
+	}
+
+	if !ms.Promoted() {
+		t.Errorf("the mirror should have been promoted")
+	}
+
+	// writes should now only go to the mirror
+	err	= client.WriteRegister(4, 0x5678)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+	reg, _	= primaryDs.GetHoldingRegister(4)
+	if reg != 0 {
+		t.Errorf("expected the primary to be left untouched, got: 0x%04x", reg)
+	}
+
+	return
+}
@@ -1,6 +1,7 @@
 package modbus
 
 import (
+	"context"
 	"fmt"
 	"errors"
 )
@@ -9,6 +10,12 @@ type pdu struct {
 	unitId		uint8
 	functionCode	uint8
 	payload		[]byte
+	// role of the TLS client the request was received from, if any
+	// (see TLSClientRole())
+	clientRole	string
+	// context of the request being served, if any (see
+	// ContextRequestHandler)
+	ctx		context.Context
 }
 
 const (
@@ -33,6 +40,13 @@ const (
 	FC_READ_FILE_RECORD		uint8	= 0x14
 	FC_WRITE_FILE_RECORD		uint8	= 0x15
 
+	// diagnostics (see DIAG_* for FC_DIAGNOSTICS sub-function codes)
+	FC_READ_EXCEPTION_STATUS	uint8	= 0x07
+	FC_DIAGNOSTICS			uint8	= 0x08
+	FC_GET_COMM_EVENT_COUNTER	uint8	= 0x0b
+	FC_GET_COMM_EVENT_LOG		uint8	= 0x0c
+	FC_REPORT_SERVER_ID		uint8	= 0x11
+
 	// exception codes
 	EX_ILLEGAL_FUNCTION		uint8	= 0x01
 	EX_ILLEGAL_DATA_ADDRESS		uint8	= 0x02
@@ -64,8 +78,94 @@ var (
 	ErrBadTransactionId		error = errors.New("bad transaction id")
 	ErrUnknownProtocolId		error = errors.New("unknown protocol identifier")
 	ErrUnexpectedParameters		error = errors.New("unexpected parameters")
+	ErrNoHealthyClient		error = errors.New("no healthy client")
+	ErrServerNotStarted		error = errors.New("server not started")
 )
 
+// Returns a human-readable name for the given function code.
+func functionCodeName(functionCode uint8) (name string) {
+	switch functionCode {
+	case FC_READ_COILS:			name = "ReadCoils"
+	case FC_READ_DISCRETE_INPUTS:		name = "ReadDiscreteInputs"
+	case FC_READ_HOLDING_REGISTERS:		name = "ReadHoldingRegisters"
+	case FC_READ_INPUT_REGISTERS:		name = "ReadInputRegisters"
+	case FC_WRITE_SINGLE_COIL:		name = "WriteSingleCoil"
+	case FC_WRITE_MULTIPLE_COILS:		name = "WriteMultipleCoils"
+	case FC_WRITE_SINGLE_REGISTER:		name = "WriteSingleRegister"
+	case FC_WRITE_MULTIPLE_REGISTERS:	name = "WriteMultipleRegisters"
+	case FC_MASK_WRITE_REGISTER:		name = "MaskWriteRegister"
+	case FC_READ_WRITE_MULTILE_REGISTERS:	name = "ReadWriteMultipleRegisters"
+	case FC_READ_FIFO_QUEUE:		name = "ReadFIFOQueue"
+	case FC_READ_FILE_RECORD:		name = "ReadFileRecord"
+	case FC_WRITE_FILE_RECORD:		name = "WriteFileRecord"
+	case FC_READ_EXCEPTION_STATUS:		name = "ReadExceptionStatus"
+	case FC_DIAGNOSTICS:			name = "Diagnostics"
+	case FC_GET_COMM_EVENT_COUNTER:		name = "GetCommEventCounter"
+	case FC_GET_COMM_EVENT_LOG:		name = "GetCommEventLog"
+	case FC_REPORT_SERVER_ID:		name = "ReportServerId"
+	case FC_READ_DEVICE_IDENTIFICATION:	name = "ReadDeviceIdentification"
+	default:
+		name = fmt.Sprintf("0x%02x", functionCode)
+	}
+
+	return
+}
+
+// ErrExceptionResponse is returned by the client when the server answers a
+// request with an exception response.
+// It unwraps to the matching sentinel error (e.g. ErrIllegalDataAddress for
+// EX_ILLEGAL_DATA_ADDRESS), hence errors.Is(err, ErrIllegalDataAddress) holds
+// while errors.As() gives access to the raw exception code.
+type ErrExceptionResponse struct {
+	FunctionCode	uint8
+	ExceptionCode	uint8
+}
+
+func (ee ErrExceptionResponse) Error() (msg string) {
+	msg	= fmt.Sprintf("modbus exception: FC=%v (%s) exception code=%v (%s)",
+			      ee.FunctionCode, functionCodeName(ee.FunctionCode),
+			      ee.ExceptionCode, exceptionCodeName(ee.ExceptionCode))
+
+	return
+}
+
+// Returns the sentinel error matching the exception code.
+func (ee ErrExceptionResponse) Unwrap() (err error) {
+	err	= mapExceptionCodeToError(ee.ExceptionCode)
+
+	return
+}
+
+// Returns an ErrExceptionResponse error for an exception response to a
+// request of function code functionCode.
+func newExceptionResponseError(functionCode uint8, exceptionCode uint8) (err error) {
+	err	= ErrExceptionResponse{
+		FunctionCode:	functionCode & 0x7f,
+		ExceptionCode:	exceptionCode,
+	}
+
+	return
+}
+
+// Returns the name of an exception code.
+func exceptionCodeName(exceptionCode uint8) (name string) {
+	switch exceptionCode {
+	case EX_ILLEGAL_FUNCTION:		name = "IllegalFunction"
+	case EX_ILLEGAL_DATA_ADDRESS:		name = "IllegalDataAddress"
+	case EX_ILLEGAL_DATA_VALUE:		name = "IllegalDataValue"
+	case EX_SERVER_DEVICE_FAILURE:		name = "ServerDeviceFailure"
+	case EX_ACKNOWLEDGE:			name = "Acknowledge"
+	case EX_SERVER_DEVICE_BUSY:		name = "ServerDeviceBusy"
+	case EX_MEMORY_PARITY_ERROR:		name = "MemoryParityError"
+	case EX_GW_PATH_UNAVAILABLE:		name = "GatewayPathUnavailable"
+	case EX_GW_TARGET_FAILED_TO_RESPOND:	name = "GatewayTargetFailedToRespond"
+	default:
+		name = fmt.Sprintf("0x%02x", exceptionCode)
+	}
+
+	return
+}
+
 func mapExceptionCodeToError(exceptionCode uint8) (err error) {
 	switch exceptionCode {
 	case EX_ILLEGAL_FUNCTION:		err = ErrIllegalFunction
@@ -84,17 +184,20 @@ func mapExceptionCodeToError(exceptionCode uint8) (err error) {
 	return
 }
 
+// Returns the exception code matching err, which may wrap a modbus error
+// (e.g. a *ModbusError or fmt.Errorf("...: %w", ErrIllegalDataAddress)
+// returned by a request handler).
 func mapErrorToExceptionCode(err error) (exceptionCode uint8) {
-	switch err {
-	case ErrIllegalFunction:	exceptionCode = EX_ILLEGAL_FUNCTION
-	case ErrIllegalDataAddress:	exceptionCode = EX_ILLEGAL_DATA_ADDRESS
-	case ErrIllegalDataValue:	exceptionCode = EX_ILLEGAL_DATA_VALUE
-	case ErrServerDeviceFailure:    exceptionCode = EX_SERVER_DEVICE_FAILURE
-	case ErrAcknowledge:		exceptionCode = EX_ACKNOWLEDGE
-	case ErrMemoryParityError:      exceptionCode = EX_MEMORY_PARITY_ERROR
-	case ErrServerDeviceBusy:	exceptionCode = EX_SERVER_DEVICE_BUSY
-	case ErrGWPathUnavailable:	exceptionCode = EX_GW_PATH_UNAVAILABLE
-	case ErrGWTargetFailedToRespond:
+	switch {
+	case errors.Is(err, ErrIllegalFunction):	exceptionCode = EX_ILLEGAL_FUNCTION
+	case errors.Is(err, ErrIllegalDataAddress):	exceptionCode = EX_ILLEGAL_DATA_ADDRESS
+	case errors.Is(err, ErrIllegalDataValue):	exceptionCode = EX_ILLEGAL_DATA_VALUE
+	case errors.Is(err, ErrServerDeviceFailure):	exceptionCode = EX_SERVER_DEVICE_FAILURE
+	case errors.Is(err, ErrAcknowledge):		exceptionCode = EX_ACKNOWLEDGE
+	case errors.Is(err, ErrMemoryParityError):	exceptionCode = EX_MEMORY_PARITY_ERROR
+	case errors.Is(err, ErrServerDeviceBusy):	exceptionCode = EX_SERVER_DEVICE_BUSY
+	case errors.Is(err, ErrGWPathUnavailable):	exceptionCode = EX_GW_PATH_UNAVAILABLE
+	case errors.Is(err, ErrGWTargetFailedToRespond):
 		exceptionCode = EX_GW_TARGET_FAILED_TO_RESPOND
 	default:
 		exceptionCode = EX_SERVER_DEVICE_FAILURE
@@ -102,3 +205,35 @@ func mapErrorToExceptionCode(err error) (exceptionCode uint8) {
 
 	return
 }
+
+// ModbusError annotates an error (usually one of the Err* sentinels) with
+// the function code and unit id of the request it relates to, e.g. for
+// request handlers to return.
+// Sentinels should be checked for with errors.Is() rather than compared
+// directly, as in errors.Is(err, ErrIllegalDataAddress).
+type ModbusError struct {
+	FunctionCode	uint8
+	UnitId		uint8
+	Err		error
+}
+
+func (me *ModbusError) Error() (msg string) {
+	msg	= fmt.Sprintf("unit id %v, FC=%v (%s): %v", me.UnitId,
+			      me.FunctionCode, functionCodeName(me.FunctionCode), me.Err)
+
+	return
+}
+
+// Returns the wrapped error.
+func (me *ModbusError) Unwrap() (err error) {
+	err	= me.Err
+
+	return
+}
+
+// Returns true if target is the wrapped error.
+func (me *ModbusError) Is(target error) (is bool) {
+	is	= me.Err == target
+
+	return
+}
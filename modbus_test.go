@@ -0,0 +1,83 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestModbusError(t *testing.T) {
+	var err		error
+	var me		*ModbusError
+
+	err	= &ModbusError{
+		FunctionCode:	FC_READ_HOLDING_REGISTERS,
+		UnitId:		3,
+		Err:		ErrIllegalDataAddress,
+	}
+
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("errors.Is() should have matched ErrIllegalDataAddress")
+	}
+
+	if errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("errors.Is() should not have matched ErrIllegalDataValue")
+	}
+
+	// wrapped once more
+	err	= fmt.Errorf("polling failed: %w", err)
+
+	if !errors.As(err, &me) || me.UnitId != 3 || me.FunctionCode != FC_READ_HOLDING_REGISTERS {
+		t.Errorf("errors.As() should have returned the *ModbusError, got: %v", me)
+	}
+
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("errors.Is() should have matched ErrIllegalDataAddress")
+	}
+
+	if err.Error() != "polling failed: unit id 3, FC=3 (ReadHoldingRegisters): illegal data address" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	// handlers may return *ModbusError values
+	if mapErrorToExceptionCode(err) != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("expected EX_ILLEGAL_DATA_ADDRESS, got: %v", mapErrorToExceptionCode(err))
+	}
+
+	return
+}
+
+func TestWrappedErrors(t *testing.T) {
+	var err		error
+	var ee		ErrExceptionResponse
+
+	// handlers may return wrapped errors
+	err	= fmt.Errorf("register 3 is locked: %w", ErrIllegalDataAddress)
+	if mapErrorToExceptionCode(err) != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("expected EX_ILLEGAL_DATA_ADDRESS, got: %v", mapErrorToExceptionCode(err))
+	}
+
+	// exception responses match sentinels with errors.Is(), even once
+	// wrapped again by the caller
+	err	= fmt.Errorf("polling failed: %w",
+			     newExceptionResponseError(FC_READ_HOLDING_REGISTERS, EX_ILLEGAL_DATA_ADDRESS))
+
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("errors.Is() should have matched ErrIllegalDataAddress")
+	}
+
+	if errors.Is(err, ErrIllegalDataValue) {
+		t.Errorf("errors.Is() should not have matched ErrIllegalDataValue")
+	}
+
+	if !errors.As(err, &ee) || ee.FunctionCode != FC_READ_HOLDING_REGISTERS ||
+	   ee.ExceptionCode != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("errors.As() should have returned the ErrExceptionResponse, got: %v", ee)
+	}
+
+	if mapErrorToExceptionCode(err) != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("expected EX_ILLEGAL_DATA_ADDRESS, got: %v", mapErrorToExceptionCode(err))
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+// Package modbustest provides utilities for testing code built on top of the
+// modbus package.
+package modbustest
+
+import (
+	"sync"
+
+	"github.com/simonvetter/modbus"
+)
+
+// retryKey identifies the requests failures are tracked for.
+type retryKey struct {
+	unitId		uint8
+	functionCode	uint8
+	addr		uint16
+}
+
+// RetryableDataStore is a request handler failing every request a set number
+// of times before passing it to a data store (see NewRetryableDataStore()).
+type RetryableDataStore struct {
+	lock		sync.Mutex
+	ds		*modbus.DataStore
+	failures	int
+	remaining	map[retryKey]int
+}
+
+// Returns a new request handler answering the first maxRetries requests of
+// each (unit id, function code, address) tuple with a server device failure
+// exception, and passing subsequent ones to ds.
+// This allows checking that code under test retries failed requests the
+// expected number of times.
+// As handlers are not passed the function code of requests, single and
+// multiple writes are told apart by their quantity (e.g. a write multiple
+// registers request of quantity 1 is counted as a write single register one).
+func NewRetryableDataStore(ds *modbus.DataStore, maxRetries int) (rds *RetryableDataStore) {
+	rds	= &RetryableDataStore{
+		ds:		ds,
+		failures:	maxRetries,
+		remaining:	make(map[retryKey]int),
+	}
+
+	return
+}
+
+// Resets the failure counters of all tuples: the next n requests of each
+// tuple fail.
+func (rds *RetryableDataStore) FailAll(n int) {
+	rds.lock.Lock()
+	defer rds.lock.Unlock()
+
+	rds.failures	= n
+	rds.remaining	= make(map[retryKey]int)
+
+	return
+}
+
+func (rds *RetryableDataStore) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var fc	= modbus.FC_READ_COILS
+
+	if isWrite && quantity == 1 {
+		fc	= modbus.FC_WRITE_SINGLE_COIL
+	} else if isWrite {
+		fc	= modbus.FC_WRITE_MULTIPLE_COILS
+	}
+
+	err	= rds.fail(unitId, fc, addr)
+	if err != nil {
+		return
+	}
+
+	res, err	= rds.ds.HandleCoils(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (rds *RetryableDataStore) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	err	= rds.fail(unitId, modbus.FC_READ_DISCRETE_INPUTS, addr)
+	if err != nil {
+		return
+	}
+
+	res, err	= rds.ds.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (rds *RetryableDataStore) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var fc	= modbus.FC_READ_HOLDING_REGISTERS
+
+	if isWrite && quantity == 1 {
+		fc	= modbus.FC_WRITE_SINGLE_REGISTER
+	} else if isWrite {
+		fc	= modbus.FC_WRITE_MULTIPLE_REGISTERS
+	}
+
+	err	= rds.fail(unitId, fc, addr)
+	if err != nil {
+		return
+	}
+
+	res, err	= rds.ds.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (rds *RetryableDataStore) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	err	= rds.fail(unitId, modbus.FC_READ_INPUT_REGISTERS, addr)
+	if err != nil {
+		return
+	}
+
+	res, err	= rds.ds.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
+
+// Returns modbus.ErrServerDeviceFailure if the tuple still has failures
+// left, nil otherwise.
+func (rds *RetryableDataStore) fail(unitId uint8, fc uint8, addr uint16) (err error) {
+	var key		retryKey
+	var remaining	int
+	var ok		bool
+
+	rds.lock.Lock()
+	defer rds.lock.Unlock()
+
+	key	= retryKey{unitId: unitId, functionCode: fc, addr: addr}
+
+	remaining, ok	= rds.remaining[key]
+	if !ok {
+		remaining	= rds.failures
+	}
+
+	if remaining > 0 {
+		rds.remaining[key]	= remaining - 1
+		err			= modbus.ErrServerDeviceFailure
+	}
+
+	return
+}
@@ -0,0 +1,98 @@
+package modbustest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/simonvetter/modbus"
+)
+
+// Reads a holding register, retrying on server device failures up to
+// maxRetries times. Returns the number of retries made.
+func readWithRetries(client *modbus.ModbusClient, addr uint16, maxRetries int) (value uint16, retries int, err error) {
+	for {
+		value, err	= client.ReadRegister(addr, modbus.HOLDING_REGISTER)
+		if !errors.Is(err, modbus.ErrServerDeviceFailure) || retries == maxRetries {
+			return
+		}
+		retries++
+	}
+}
+
+func TestRetryableDataStore(t *testing.T) {
+	var server	*modbus.ModbusServer
+	var client	*modbus.ModbusClient
+	var ds		*modbus.DataStore
+	var rds		*RetryableDataStore
+	var err		error
+	var value	uint16
+	var retries	int
+
+	ds	= modbus.NewDataStore(0, 0, 10, 0)
+	ds.SetHoldingRegister(1, 0x1234)
+	ds.SetHoldingRegister(2, 0x5678)
+	rds	= NewRetryableDataStore(ds, 3)
+
+	server, err	= modbus.NewServer(&modbus.ServerConfiguration{
+		URL:	"tcp://localhost:5547",
+	}, rds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= modbus.NewClient(&modbus.ClientConfiguration{
+		URL:	"tcp://localhost:5547",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// the first 3 reads should fail
+	value, retries, err	= readWithRetries(client, 1, 5)
+	if err != nil || value != 0x1234 || retries != 3 {
+		t.Errorf("expected 0x1234 after 3 retries, got: 0x%04x after %v retries (%v)",
+			 value, retries, err)
+	}
+
+	// subsequent ones should succeed
+	value, retries, err	= readWithRetries(client, 1, 5)
+	if err != nil || value != 0x1234 || retries != 0 {
+		t.Errorf("expected 0x1234 without retries, got: 0x%04x after %v retries (%v)",
+			 value, retries, err)
+	}
+
+	// failures are tracked per address
+	_, retries, err	= readWithRetries(client, 2, 2)
+	if !errors.Is(err, modbus.ErrServerDeviceFailure) || retries != 2 {
+		t.Errorf("expected a failure after 2 retries, got: %v after %v retries",
+			 err, retries)
+	}
+
+	// and per function code
+	err	= client.WriteRegister(1, 0x4321)
+	if !errors.Is(err, modbus.ErrServerDeviceFailure) {
+		t.Errorf("expected ErrServerDeviceFailure, got: %v", err)
+	}
+
+	// FailAll() should reset all counters
+	rds.FailAll(1)
+	value, retries, err	= readWithRetries(client, 1, 5)
+	if err != nil || value != 0x1234 || retries != 1 {
+		t.Errorf("expected 0x1234 after 1 retry, got: 0x%04x after %v retries (%v)",
+			 value, retries, err)
+	}
+
+	return
+}
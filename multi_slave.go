@@ -0,0 +1,230 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SlaveConfig describes a virtual device served by a MultiSlaveListener.
+type SlaveConfig struct {
+	Handler		RequestHandler	// handler serving requests to this unit id
+	Timeout		time.Duration	// maximum time the handler may take to
+					// answer a request, after which a server
+					// device busy exception is returned
+					// (0 means no limit)
+	ReadOnly	bool		// reject write requests with an illegal
+					// function exception
+	AuditLog	io.Writer	// optional, logs every write request and
+					// its outcome
+}
+
+// MultiSlaveListener is a modbus server serving several virtual devices,
+// each identified by its unit id, on a single listening address.
+type MultiSlaveListener struct {
+	*ModbusServer
+}
+
+// unitDispatcher is a request handler dispatching requests to per-unit id
+// handlers.
+type unitDispatcher struct {
+	slaves		map[uint8]*slave
+}
+
+type slave struct {
+	conf		SlaveConfig
+	auditLock	sync.Mutex
+}
+
+// Returns a new multi-slave listener.
+// conf configures the listener (URL, connection timeout and MaxClients) while
+// slaves maps unit ids to virtual devices.
+// Requests to unit ids absent from slaves are answered with a gateway path
+// unavailable exception.
+func NewMultiSlaveListener(conf *ServerConfiguration, slaves map[uint8]*SlaveConfig) (msl *MultiSlaveListener, err error) {
+	var ud	*unitDispatcher
+
+	if len(slaves) == 0 {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ud	= &unitDispatcher{
+		slaves:	make(map[uint8]*slave, len(slaves)),
+	}
+
+	for unitId, sc := range slaves {
+		if sc == nil || sc.Handler == nil {
+			err	= fmt.Errorf("%w: no handler for unit id %v",
+					     ErrConfigurationError, unitId)
+			return
+		}
+		ud.slaves[unitId]	= &slave{conf: *sc}
+	}
+
+	msl	= &MultiSlaveListener{}
+	msl.ModbusServer, err	= NewServer(conf, ud)
+	if err != nil {
+		msl	= nil
+		return
+	}
+
+	return
+}
+
+func (ud *unitDispatcher) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var s	*slave
+	var r	[]bool
+
+	s, err	= ud.lookup(unitId, isWrite)
+	if err == nil {
+		err	= s.run(func() (e error) {
+			r, e = s.conf.Handler.HandleCoils(unitId, addr, quantity, isWrite, args)
+			return
+		})
+	}
+	if err == nil {
+		res	= r
+	}
+
+	if isWrite && s != nil {
+		s.audit(unitId, "coils", addr, quantity, args, err)
+	}
+
+	return
+}
+
+func (ud *unitDispatcher) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	var s	*slave
+	var r	[]bool
+
+	s, err	= ud.lookup(unitId, false)
+	if err != nil {
+		return
+	}
+
+	err	= s.run(func() (e error) {
+		r, e = s.conf.Handler.HandleDiscreteInputs(unitId, addr, quantity)
+		return
+	})
+	if err == nil {
+		res	= r
+	}
+
+	return
+}
+
+func (ud *unitDispatcher) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var s	*slave
+	var r	[]uint16
+
+	s, err	= ud.lookup(unitId, isWrite)
+	if err == nil {
+		err	= s.run(func() (e error) {
+			r, e = s.conf.Handler.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+			return
+		})
+	}
+	if err == nil {
+		res	= r
+	}
+
+	if isWrite && s != nil {
+		s.audit(unitId, "holding registers", addr, quantity, args, err)
+	}
+
+	return
+}
+
+func (ud *unitDispatcher) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	var s	*slave
+	var r	[]uint16
+
+	s, err	= ud.lookup(unitId, false)
+	if err != nil {
+		return
+	}
+
+	err	= s.run(func() (e error) {
+		r, e = s.conf.Handler.HandleInputRegisters(unitId, addr, quantity)
+		return
+	})
+	if err == nil {
+		res	= r
+	}
+
+	return
+}
+
+// Returns the slave serving unitId, or an error if the unit id is unknown or
+// if a write is attempted on a read-only slave (in which case the slave is
+// returned as well, for auditing).
+func (ud *unitDispatcher) lookup(unitId uint8, isWrite bool) (s *slave, err error) {
+	s	= ud.slaves[unitId]
+	if s == nil {
+		err	= ErrGWPathUnavailable
+		return
+	}
+
+	if isWrite && s.conf.ReadOnly {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	return
+}
+
+// Runs fn, bounded by the slave's timeout if any.
+// Note that fn keeps running in the background after a timeout, hence
+// callers must not use values set by fn unless it returned successfully.
+func (s *slave) run(fn func() error) (err error) {
+	var done	chan error
+	var timer	*time.Timer
+
+	if s.conf.Timeout == 0 {
+		err	= fn()
+		return
+	}
+
+	done	= make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer	= time.NewTimer(s.conf.Timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+	case <-timer.C:
+		err	= ErrServerDeviceBusy
+	}
+
+	return
+}
+
+// Writes an audit log line for a write request.
+func (s *slave) audit(unitId uint8, kind string, addr uint16, quantity uint16,
+		      args interface{}, result error) {
+	var status	string
+
+	if s.conf.AuditLog == nil {
+		return
+	}
+
+	if result == nil {
+		status	= "OK"
+	} else {
+		status	= result.Error()
+	}
+
+	s.auditLock.Lock()
+	defer s.auditLock.Unlock()
+
+	fmt.Fprintf(s.conf.AuditLog, "%s unitId=%v write %s addr=%v qty=%v values=%v status=%s\n",
+		    time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		    unitId, kind, addr, quantity, args, status)
+
+	return
+}
@@ -0,0 +1,147 @@
+package modbus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// remapHandler forwards requests to a testHandler, as unit id #9.
+type remapHandler struct {
+	th	*testHandler
+}
+
+func (rh *remapHandler) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	res, err = rh.th.HandleCoils(9, addr, quantity, isWrite, args)
+	return
+}
+
+func (rh *remapHandler) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	res, err = rh.th.HandleDiscreteInputs(9, addr, quantity)
+	return
+}
+
+func (rh *remapHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	res, err = rh.th.HandleHoldingRegisters(9, addr, quantity, isWrite, args)
+	return
+}
+
+func (rh *remapHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	res, err = rh.th.HandleInputRegisters(9, addr, quantity)
+	return
+}
+
+func TestMultiSlaveListener(t *testing.T) {
+	var msl		*MultiSlaveListener
+	var client	*ModbusClient
+	var err		error
+	var ro		*testHandler
+	var rw		*testHandler
+	var audit	syncBuffer
+	var regs	[]uint16
+
+	// a missing handler should be rejected
+	_, err	= NewMultiSlaveListener(&ServerConfiguration{
+		URL:	"tcp://localhost:5511",
+	}, map[uint8]*SlaveConfig{
+		1:	&SlaveConfig{},
+	})
+	if err == nil {
+		t.Errorf("NewMultiSlaveListener() should have failed")
+	}
+
+	ro	= &testHandler{}
+	ro.holding[0]	= 0x1111
+	rw	= &testHandler{}
+	rw.holding[0]	= 0x2222
+
+	msl, err	= NewMultiSlaveListener(&ServerConfiguration{
+		URL:	"tcp://localhost:5511",
+	}, map[uint8]*SlaveConfig{
+		1:	&SlaveConfig{
+			Handler:	&remapHandler{th: ro},
+			ReadOnly:	true,
+			AuditLog:	&audit,
+		},
+		2:	&SlaveConfig{
+			Handler:	&remapHandler{th: rw},
+			AuditLog:	&audit,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+
+	err	= msl.Start()
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer msl.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5511",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// reads should be dispatched to the right handler
+	client.SetUnitId(1)
+	regs, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if err != nil || regs[0] != 0x1111 {
+		t.Errorf("expected 0x1111 from unit 1, got: %v, %v", regs, err)
+	}
+
+	client.SetUnitId(2)
+	regs, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if err != nil || regs[0] != 0x2222 {
+		t.Errorf("expected 0x2222 from unit 2, got: %v, %v", regs, err)
+	}
+
+	// writes to the read-only unit should be rejected
+	client.SetUnitId(1)
+	err	= client.WriteRegister(1, 0x0101)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+	err	= client.WriteCoil(1, true)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+	if ro.holding[1] != 0 || ro.coils[1] {
+		t.Errorf("the read-only unit should not have been written to")
+	}
+
+	// writes to the read-write unit should succeed
+	client.SetUnitId(2)
+	err	= client.WriteRegister(1, 0x0202)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+	if rw.holding[1] != 0x0202 {
+		t.Errorf("expected 0x0202, got: 0x%04x", rw.holding[1])
+	}
+
+	// unknown unit ids should be answered with a gateway exception
+	client.SetUnitId(3)
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrGWPathUnavailable) {
+		t.Errorf("expected ErrGWPathUnavailable, got: %v", err)
+	}
+
+	// all writes should have been audited
+	if strings.Count(audit.String(), "\n") != 3 ||
+	   !strings.Contains(audit.String(), "unitId=1 write holding registers addr=1 qty=1 values=[257] status=illegal function") ||
+	   !strings.Contains(audit.String(), "unitId=1 write coils addr=1 qty=1 values=[true] status=illegal function") ||
+	   !strings.Contains(audit.String(), "unitId=2 write holding registers addr=1 qty=1 values=[514] status=OK") {
+		t.Errorf("unexpected audit log: %q", audit.String())
+	}
+
+	return
+}
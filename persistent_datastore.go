@@ -0,0 +1,244 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+const (
+	// journal record header: data type (1 byte), address (2 bytes) and
+	// value count (2 bytes)
+	journalHeaderLength	int	= 5
+	// maximum number of values per snapshot record
+	journalChunkLength	int	= 1024
+	// maximum number of values per record (as the count is a 16-bit field)
+	journalMaxRecordLength	int	= 0xffff
+)
+
+// PersistentDataStore is a DataStore persisting every change to a journal
+// file, so that its contents survive process restarts and crashes.
+// Changes are written to the journal and applied in memory within the same
+// write lock, before the corresponding request (or Set method call) returns.
+// Writes are handed over to the operating system but not synced to disk,
+// hence the most recent changes may still be lost on power loss.
+// All four tables cover the entire address space (0 to 0xffff).
+type PersistentDataStore struct {
+	*DataStore
+	path		string
+	file		*os.File
+}
+
+// Returns a new persistent data store backed by the journal file at path,
+// restoring values persisted by a previous instance if the file exists.
+// The journal is compacted on startup.
+func NewPersistentDataStore(path string) (pds *PersistentDataStore, err error) {
+	var p	*PersistentDataStore
+
+	p	= &PersistentDataStore{
+		DataStore:	newDataStore(0x10000, 0x10000, 0x10000, 0x10000),
+		path:		path,
+	}
+
+	err	= p.load()
+	if err != nil {
+		err	= fmt.Errorf("failed to load %s: %w", path, err)
+		return
+	}
+
+	err	= p.compact()
+	if err != nil {
+		err	= fmt.Errorf("failed to compact %s: %w", path, err)
+		return
+	}
+
+	p.file, err	= os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+
+	p.DataStore.persist	= p.appendRecord
+	pds			= p
+
+	return
+}
+
+// Closes the journal file.
+// Further changes fail with ErrServerDeviceFailure (requests) or
+// os.ErrClosed (Set methods).
+func (pds *PersistentDataStore) Close() (err error) {
+	pds.DataStore.lock.Lock()
+	defer pds.DataStore.lock.Unlock()
+
+	err	= pds.file.Close()
+
+	return
+}
+
+// Replays the journal into the in-memory tables.
+// A truncated trailing record (e.g. following a crash mid-write) is ignored.
+func (pds *PersistentDataStore) load() (err error) {
+	var buf		[]byte
+	var dataType	DataObjectType
+	var addr	uint16
+	var count	int
+
+	buf, err	= os.ReadFile(pds.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err	= nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	for len(buf) >= journalHeaderLength {
+		dataType	= DataObjectType(buf[0])
+		addr		= bytesToUint16(BIG_ENDIAN, buf[1:3])
+		count		= int(bytesToUint16(BIG_ENDIAN, buf[3:5]))
+
+		if len(buf) < journalHeaderLength + 2 * count {
+			break
+		}
+
+		err	= pds.apply(dataType, addr,
+			bytesToUint16s(BIG_ENDIAN, buf[journalHeaderLength:journalHeaderLength + 2 * count]))
+		if err != nil {
+			return
+		}
+
+		buf	= buf[journalHeaderLength + 2 * count:]
+	}
+
+	return
+}
+
+// Applies a journal record to the in-memory tables.
+func (pds *PersistentDataStore) apply(dataType DataObjectType, addr uint16, values []uint16) (err error) {
+	var ds	*DataStore
+
+	ds	= pds.DataStore
+
+	if int(addr) + len(values) > 0x10000 {
+		err	= fmt.Errorf("%w: record past address 0xffff", ErrProtocolError)
+		return
+	}
+
+	for i, value := range values {
+		switch dataType {
+		case COILS:		ds.coils[int(addr) + i]			= value != 0
+		case DISCRETE_INPUTS:	ds.discreteInputs[int(addr) + i]	= value != 0
+		case HOLDING_REGISTERS:	ds.holdingRegisters[int(addr) + i]	= value
+		case INPUT_REGISTERS:	ds.inputRegisters[int(addr) + i]	= value
+		default:
+			err	= fmt.Errorf("%w: unknown data type %v", ErrProtocolError, dataType)
+			return
+		}
+	}
+
+	return
+}
+
+// Rewrites the journal as a snapshot of the in-memory tables, skipping
+// all-zero chunks.
+func (pds *PersistentDataStore) compact() (err error) {
+	var buf		[]byte
+	var chunk	[]uint16
+	var tmpPath	string
+
+	for _, dataType := range []DataObjectType{
+		COILS, DISCRETE_INPUTS, HOLDING_REGISTERS, INPUT_REGISTERS,
+	} {
+		for addr := 0; addr < 0x10000; addr += journalChunkLength {
+			chunk	= pds.chunk(dataType, addr)
+			if chunk != nil {
+				buf	= append(buf, encodeJournalRecord(dataType, uint16(addr), chunk)...)
+			}
+		}
+	}
+
+	// write the snapshot to a temporary file first so that the journal
+	// is never left half-written
+	tmpPath	= pds.path + ".tmp"
+	err	= os.WriteFile(tmpPath, buf, 0644)
+	if err != nil {
+		return
+	}
+
+	err	= os.Rename(tmpPath, pds.path)
+
+	return
+}
+
+// Returns journalChunkLength values of a table starting at addr, or nil if
+// they're all zero.
+func (pds *PersistentDataStore) chunk(dataType DataObjectType, addr int) (values []uint16) {
+	var ds		*DataStore
+	var nonZero	bool
+
+	ds	= pds.DataStore
+	values	= make([]uint16, journalChunkLength)
+
+	for i := range values {
+		switch dataType {
+		case COILS:
+			if ds.coils[addr + i] {
+				values[i]	= 1
+			}
+		case DISCRETE_INPUTS:
+			if ds.discreteInputs[addr + i] {
+				values[i]	= 1
+			}
+		case HOLDING_REGISTERS:
+			values[i]	= ds.holdingRegisters[addr + i]
+		case INPUT_REGISTERS:
+			values[i]	= ds.inputRegisters[addr + i]
+		}
+
+		if values[i] != 0 {
+			nonZero	= true
+		}
+	}
+
+	if !nonZero {
+		values	= nil
+	}
+
+	return
+}
+
+// Appends a record to the journal.
+// Invoked by the data store with its lock held.
+func (pds *PersistentDataStore) appendRecord(dataType DataObjectType, addr uint16, values []uint16) (err error) {
+	_, err	= pds.file.Write(encodeJournalRecord(dataType, addr, values))
+
+	return
+}
+
+// Encodes a journal record, split into as many records as needed to keep
+// the value count of each under journalMaxRecordLength (e.g. when all 0x10000
+// values of a table change at once).
+func encodeJournalRecord(dataType DataObjectType, addr uint16, values []uint16) (rec []byte) {
+	var count	int
+
+	for {
+		count	= len(values)
+		if count > journalMaxRecordLength {
+			count	= journalMaxRecordLength
+		}
+
+		rec	= append(rec, byte(dataType))
+		rec	= append(rec, uint16ToBytes(BIG_ENDIAN, addr)...)
+		rec	= append(rec, uint16ToBytes(BIG_ENDIAN, uint16(count))...)
+		rec	= append(rec, uint16sToBytes(BIG_ENDIAN, values[0:count])...)
+
+		values	= values[count:]
+		if len(values) == 0 {
+			break
+		}
+		addr	+= uint16(count)
+	}
+
+	return
+}
@@ -0,0 +1,161 @@
+package modbus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistentDataStore(t *testing.T) {
+	var pds		*PersistentDataStore
+	var path	string
+	var err		error
+	var regs	[]uint16
+	var bools	[]bool
+	var reg		uint16
+	var f		*os.File
+
+	path	= filepath.Join(t.TempDir(), "store.journal")
+
+	pds, err	= NewPersistentDataStore(path)
+	if err != nil {
+		t.Fatalf("NewPersistentDataStore() should have succeeded, got: %v", err)
+	}
+
+	// write through the handler side and the application side
+	_, err	= pds.HandleHoldingRegisters(1, 100, 3, true, []uint16{0x1111, 0x2222, 0x3333})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	_, err	= pds.HandleHoldingRegisters(1, 0xffff, 1, true, []uint16{0xffff})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	_, err	= pds.HandleCoils(1, 5, 2, true, []bool{true, true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+	err	= pds.SetCoil(6, false)
+	if err != nil {
+		t.Errorf("SetCoil() should have succeeded, got: %v", err)
+	}
+	err	= pds.SetInputRegister(7, 0x7777)
+	if err != nil {
+		t.Errorf("SetInputRegister() should have succeeded, got: %v", err)
+	}
+	_, err	= pds.ReadAndClearRegister(101)
+	if err != nil {
+		t.Errorf("ReadAndClearRegister() should have succeeded, got: %v", err)
+	}
+
+	// simulate a crash: leave the first store as is and open a new one
+	// from the same path
+	pds, err	= NewPersistentDataStore(path)
+	if err != nil {
+		t.Fatalf("NewPersistentDataStore() should have succeeded, got: %v", err)
+	}
+
+	regs, err	= pds.HandleHoldingRegisters(1, 100, 3, false, nil)
+	if err != nil || regs[0] != 0x1111 || regs[1] != 0x0000 || regs[2] != 0x3333 {
+		t.Errorf("unexpected holding registers: %v, %v", regs, err)
+	}
+	reg, _	= pds.GetHoldingRegister(0xffff)
+	if reg != 0xffff {
+		t.Errorf("expected 0xffff, got: 0x%04x", reg)
+	}
+	bools, err	= pds.HandleCoils(1, 4, 3, false, nil)
+	if err != nil || bools[0] || !bools[1] || bools[2] {
+		t.Errorf("unexpected coils: %v, %v", bools, err)
+	}
+	reg, _	= pds.GetInputRegister(7)
+	if reg != 0x7777 {
+		t.Errorf("expected 0x7777, got: 0x%04x", reg)
+	}
+
+	// a record truncated by a crash mid-write should be ignored
+	err	= pds.Close()
+	if err != nil {
+		t.Errorf("Close() should have succeeded, got: %v", err)
+	}
+
+	f, err	= os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	f.Write(encodeJournalRecord(HOLDING_REGISTERS, 100, []uint16{0xdead, 0xbeef})[0:7])
+	f.Close()
+
+	pds, err	= NewPersistentDataStore(path)
+	if err != nil {
+		t.Fatalf("NewPersistentDataStore() should have succeeded, got: %v", err)
+	}
+
+	reg, _	= pds.GetHoldingRegister(100)
+	if reg != 0x1111 {
+		t.Errorf("expected 0x1111, got: 0x%04x", reg)
+	}
+
+	// writes should fail once the store is closed
+	pds.Close()
+	_, err	= pds.HandleHoldingRegisters(1, 100, 1, true, []uint16{0x4444})
+	if !errors.Is(err, ErrServerDeviceFailure) {
+		t.Errorf("expected ErrServerDeviceFailure, got: %v", err)
+	}
+	reg, _	= pds.GetHoldingRegister(100)
+	if reg != 0x1111 {
+		t.Errorf("expected 0x1111, got: 0x%04x", reg)
+	}
+
+	return
+}
+
+func TestPersistentDataStoreFullTableWrites(t *testing.T) {
+	var pds		*PersistentDataStore
+	var path	string
+	var snapshot	DataSnapshot
+	var reg		uint16
+	var coil	bool
+	var err		error
+
+	path	= filepath.Join(t.TempDir(), "store.journal")
+
+	pds, err	= NewPersistentDataStore(path)
+	if err != nil {
+		t.Fatalf("NewPersistentDataStore() should have succeeded, got: %v", err)
+	}
+
+	// change all 0x10000 values of two tables at once, which takes more
+	// values than a single journal record can hold
+	snapshot	= pds.GetAll()
+	for i := range snapshot.HoldingRegisters {
+		snapshot.HoldingRegisters[i]	= 7
+		snapshot.Coils[i]		= true
+	}
+
+	err	= pds.SetAll(snapshot)
+	if err != nil {
+		t.Fatalf("SetAll() should have succeeded, got: %v", err)
+	}
+	pds.Close()
+
+	pds, err	= NewPersistentDataStore(path)
+	if err != nil {
+		t.Fatalf("NewPersistentDataStore() should have succeeded, got: %v", err)
+	}
+	defer pds.Close()
+
+	for _, addr := range []uint16{0, 0x7fff, 0xfffe, 0xffff} {
+		reg, _	= pds.GetHoldingRegister(addr)
+		if reg != 7 {
+			t.Errorf("expected 7 at 0x%04x, got: %v", addr, reg)
+		}
+
+		coil, _	= pds.GetCoil(addr)
+		if !coil {
+			t.Errorf("expected coil 0x%04x to be set", addr)
+		}
+	}
+
+	return
+}
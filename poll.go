@@ -0,0 +1,110 @@
+package modbus
+
+import (
+	"context"
+	"time"
+)
+
+type PollDataType uint
+const (
+	POLL_HOLDING_REGISTERS	PollDataType	= 0
+	POLL_INPUT_REGISTERS	PollDataType	= 1
+	POLL_COILS		PollDataType	= 2
+	POLL_DISCRETE_INPUTS	PollDataType	= 3
+)
+
+// PollTarget describes a range of values to be read periodically by Poll().
+type PollTarget struct {
+	UnitId		uint8
+	Addr		uint16
+	Qty		uint16
+	DataType	PollDataType
+}
+
+// PollResult holds the outcome of a single read made by Poll().
+type PollResult struct {
+	Target		PollTarget
+	Values		[]uint16	// register values, or 0/1 for coils and
+					// discrete inputs
+	Err		error
+	Timestamp	time.Time
+}
+
+// Reads each target, sequentially and in order, every interval until ctx is
+// cancelled, and reports the outcome of each read (success or failure) on the
+// returned channel.
+// The channel is closed once ctx is cancelled.
+// Targets are read from their own unit id, regardless of SetUnitId().
+func (mc *ModbusClient) Poll(ctx context.Context, interval time.Duration, targets []PollTarget) (results <-chan PollResult) {
+	var ch	chan PollResult
+
+	ch	= make(chan PollResult, len(targets))
+	results	= ch
+
+	go func() {
+		var ticker	*time.Ticker
+
+		defer close(ch)
+
+		ticker	= time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for _, target := range targets {
+				select {
+				case ch <- mc.pollOnce(target):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return
+}
+
+// Reads a single poll target.
+func (mc *ModbusClient) pollOnce(target PollTarget) (res PollResult) {
+	var bools	[]bool
+	var buf		[]byte
+
+	res.Target	= target
+
+	mc.lock.Lock()
+	switch target.DataType {
+	case POLL_HOLDING_REGISTERS:
+		buf, res.Err	= mc.readRegistersFrom(target.UnitId, target.Addr, target.Qty, HOLDING_REGISTER)
+	case POLL_INPUT_REGISTERS:
+		buf, res.Err	= mc.readRegistersFrom(target.UnitId, target.Addr, target.Qty, INPUT_REGISTER)
+	case POLL_COILS:
+		bools, res.Err	= mc.readBoolsFrom(target.UnitId, target.Addr, target.Qty, false)
+	case POLL_DISCRETE_INPUTS:
+		bools, res.Err	= mc.readBoolsFrom(target.UnitId, target.Addr, target.Qty, true)
+	default:
+		res.Err	= ErrUnexpectedParameters
+	}
+
+	if res.Err == nil {
+		if buf != nil {
+			res.Values	= bytesToUint16s(mc.endianness, buf)
+		} else {
+			res.Values	= make([]uint16, len(bools))
+			for i := range bools {
+				if bools[i] {
+					res.Values[i]	= 1
+				}
+			}
+		}
+	}
+	mc.lock.Unlock()
+
+	res.Timestamp	= time.Now()
+
+	return
+}
@@ -0,0 +1,111 @@
+package modbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClientPoll(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ds		*DataStore
+	var err		error
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var results	<-chan PollResult
+	var res		PollResult
+	var timeout	<-chan time.Time
+	var ok		bool
+	var updated	bool
+
+	ds	= NewDataStore(4, 0, 4, 0)
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5517",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5517",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel	= context.WithCancel(context.Background())
+	defer cancel()
+
+	results	= client.Poll(ctx, 20 * time.Millisecond, []PollTarget{
+		{UnitId: 3, Addr: 1, Qty: 2, DataType: POLL_HOLDING_REGISTERS},
+		{UnitId: 3, Addr: 0, Qty: 4, DataType: POLL_COILS},
+		{UnitId: 3, Addr: 10, Qty: 1, DataType: POLL_HOLDING_REGISTERS},
+	})
+
+	// targets should be reported in order
+	for i := 0; i < 3; i++ {
+		res	= <-results
+		switch i {
+		case 0:
+			if res.Err != nil || len(res.Values) != 2 || res.Target.Addr != 1 {
+				t.Errorf("unexpected result #%v: %+v", i, res)
+			}
+		case 1:
+			if res.Err != nil || len(res.Values) != 4 || res.Target.DataType != POLL_COILS {
+				t.Errorf("unexpected result #%v: %+v", i, res)
+			}
+		case 2:
+			// out of range, should fail
+			if res.Err == nil || res.Target.Addr != 10 {
+				t.Errorf("unexpected result #%v: %+v", i, res)
+			}
+		}
+		if res.Timestamp.IsZero() {
+			t.Errorf("result #%v should have a timestamp", i)
+		}
+	}
+
+	// update values from the application side
+	ds.SetHoldingRegister(2, 42)
+	ds.SetCoil(3, true)
+
+	timeout	= time.After(1 * time.Second)
+	for !updated {
+		select {
+		case res = <-results:
+			if res.Target.DataType == POLL_HOLDING_REGISTERS && res.Err == nil &&
+			   res.Values[1] == 42 {
+				updated	= true
+			}
+		case <-timeout:
+			t.Fatalf("updated value not reported within 1s")
+		}
+	}
+
+	// the channel should be closed once the context is cancelled
+	cancel()
+	timeout	= time.After(1 * time.Second)
+	for {
+		select {
+		case _, ok = <-results:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("results channel not closed within 1s")
+		}
+	}
+}
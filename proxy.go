@@ -0,0 +1,86 @@
+package modbus
+
+import (
+	"sync"
+)
+
+// proxyHandler is a request handler forwarding every request to a client.
+type proxyHandler struct {
+	// serializes requests to the client, as its unit id is changed on
+	// every request
+	lock		sync.Mutex
+	client		Client
+}
+
+// Returns a request handler forwarding every request to client, on behalf of
+// the unit id of the request: reads are forwarded as reads and writes as
+// single (quantity of 1) or multiple writes.
+// Exceptions returned by the remote device are passed through, while any
+// other error (e.g. a timeout) is reported as a gateway target device failed
+// to respond exception.
+// client is expected to be open and is not closed by the handler.
+func NewProxyHandler(client Client) (rh RequestHandler) {
+	rh	= &proxyHandler{
+		client:	client,
+	}
+
+	return
+}
+
+func (ph *proxyHandler) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	ph.client.SetUnitId(unitId)
+	switch {
+	case isWrite && quantity == 1:
+		err	= ph.client.WriteCoil(addr, args[0])
+	case isWrite:
+		err	= ph.client.WriteCoils(addr, args)
+	default:
+		res, err	= ph.client.ReadCoils(addr, quantity)
+	}
+	err	= mapGatewayError(err)
+
+	return
+}
+
+func (ph *proxyHandler) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	ph.client.SetUnitId(unitId)
+	res, err	= ph.client.ReadDiscreteInputs(addr, quantity)
+	err		= mapGatewayError(err)
+
+	return
+}
+
+func (ph *proxyHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	ph.client.SetUnitId(unitId)
+	switch {
+	case isWrite && quantity == 1:
+		err	= ph.client.WriteRegister(addr, args[0])
+	case isWrite:
+		err	= ph.client.WriteRegisters(addr, args)
+	default:
+		res, err	= ph.client.ReadRegisters(addr, quantity, HOLDING_REGISTER)
+	}
+	err	= mapGatewayError(err)
+
+	return
+}
+
+func (ph *proxyHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	ph.client.SetUnitId(unitId)
+	res, err	= ph.client.ReadRegisters(addr, quantity, INPUT_REGISTER)
+	err		= mapGatewayError(err)
+
+	return
+}
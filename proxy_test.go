@@ -0,0 +1,125 @@
+package modbus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProxyHandler(t *testing.T) {
+	var server	*ModbusServer
+	var ds		*DataStore
+	var client	*ModbusClient
+	var ph		RequestHandler
+	var err		error
+	var regs	[]uint16
+	var bools	[]bool
+	var reg		uint16
+	var coil	bool
+
+	ds	= NewDataStore(8, 8, 8, 8)
+	ds.SetDiscreteInput(1, true)
+	ds.SetInputRegister(2, 0x4321)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5520",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5520",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	ph	= NewProxyHandler(client)
+
+	// write single coil (FC05)
+	_, err	= ph.HandleCoils(1, 0, 1, true, []bool{true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+	coil, _	= ds.GetCoil(0)
+	if !coil {
+		t.Errorf("expected coil #0 to be set")
+	}
+
+	// write multiple coils (FC15)
+	_, err	= ph.HandleCoils(1, 2, 2, true, []bool{true, true})
+	if err != nil {
+		t.Errorf("HandleCoils() should have succeeded, got: %v", err)
+	}
+
+	// read coils (FC01)
+	bools, err	= ph.HandleCoils(1, 0, 4, false, nil)
+	if err != nil || len(bools) != 4 || !bools[0] || bools[1] || !bools[2] || !bools[3] {
+		t.Errorf("unexpected coils: %v, %v", bools, err)
+	}
+
+	// read discrete inputs (FC02)
+	bools, err	= ph.HandleDiscreteInputs(1, 0, 2)
+	if err != nil || len(bools) != 2 || bools[0] || !bools[1] {
+		t.Errorf("unexpected discrete inputs: %v, %v", bools, err)
+	}
+
+	// write single register (FC06)
+	_, err	= ph.HandleHoldingRegisters(1, 0, 1, true, []uint16{0x1234})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+	reg, _	= ds.GetHoldingRegister(0)
+	if reg != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x", reg)
+	}
+
+	// write multiple registers (FC16)
+	_, err	= ph.HandleHoldingRegisters(1, 1, 2, true, []uint16{0x5678, 0x9abc})
+	if err != nil {
+		t.Errorf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+
+	// read holding registers (FC03)
+	regs, err	= ph.HandleHoldingRegisters(1, 0, 3, false, nil)
+	if err != nil || len(regs) != 3 ||
+	   regs[0] != 0x1234 || regs[1] != 0x5678 || regs[2] != 0x9abc {
+		t.Errorf("unexpected holding registers: %v, %v", regs, err)
+	}
+
+	// read input registers (FC04)
+	regs, err	= ph.HandleInputRegisters(1, 2, 1)
+	if err != nil || len(regs) != 1 || regs[0] != 0x4321 {
+		t.Errorf("unexpected input registers: %v, %v", regs, err)
+	}
+
+	// exceptions should be relayed as modbus errors
+	_, err	= ph.HandleHoldingRegisters(1, 7, 2, false, nil)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+	if mapErrorToExceptionCode(err) != EX_ILLEGAL_DATA_ADDRESS {
+		t.Errorf("expected an illegal data address exception code")
+	}
+
+	// transport errors should be reported as the target failing to respond
+	server.Stop()
+	_, err	= ph.HandleInputRegisters(1, 0, 1)
+	if !errors.Is(err, ErrGWTargetFailedToRespond) {
+		t.Errorf("expected ErrGWTargetFailedToRespond, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,54 @@
+package modbus
+
+// readOnlyDataStore is a RequestHandler exposing a DataStore without allowing
+// clients to modify it.
+type readOnlyDataStore struct {
+	ds	*DataStore
+}
+
+// Returns a request handler serving reads from ds and rejecting writes to
+// coils and holding registers with an illegal function exception.
+// The application side can still modify ds through its Set methods, and ds
+// can be served read-write by another handler, e.g. for a different unit id
+// or on a different server.
+func NewReadOnlyDataStore(ds *DataStore) (rh RequestHandler) {
+	rh	= &readOnlyDataStore{
+		ds:	ds,
+	}
+
+	return
+}
+
+func (ro *readOnlyDataStore) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	if isWrite {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	res, err	= ro.ds.HandleCoils(unitId, addr, quantity, false, nil)
+
+	return
+}
+
+func (ro *readOnlyDataStore) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	res, err	= ro.ds.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (ro *readOnlyDataStore) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	if isWrite {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	res, err	= ro.ds.HandleHoldingRegisters(unitId, addr, quantity, false, nil)
+
+	return
+}
+
+func (ro *readOnlyDataStore) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	res, err	= ro.ds.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
@@ -0,0 +1,66 @@
+package modbus
+
+import (
+	"testing"
+)
+
+func TestReadOnlyDataStore(t *testing.T) {
+	var ds		*DataStore
+	var rh		RequestHandler
+	var regs	[]uint16
+	var bools	[]bool
+	var value	uint16
+	var err		error
+
+	ds	= NewDataStore(2, 2, 2, 2)
+	ds.SetCoil(0, true)
+	ds.SetDiscreteInput(1, true)
+	ds.SetHoldingRegister(0, 0x1234)
+	ds.SetInputRegister(1, 0x5678)
+
+	rh	= NewReadOnlyDataStore(ds)
+
+	// writes should be rejected
+	_, err	= rh.HandleCoils(1, 0, 1, true, []bool{false})
+	if err != ErrIllegalFunction {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	_, err	= rh.HandleHoldingRegisters(1, 0, 1, true, []uint16{0xffff})
+	if err != ErrIllegalFunction {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	value, _	= ds.GetHoldingRegister(0)
+	if value != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x", value)
+	}
+
+	// reads should be passed through
+	bools, err	= rh.HandleCoils(1, 0, 2, false, nil)
+	if err != nil || len(bools) != 2 || !bools[0] || bools[1] {
+		t.Errorf("unexpected coils: %v, %v", bools, err)
+	}
+
+	bools, err	= rh.HandleDiscreteInputs(1, 0, 2)
+	if err != nil || len(bools) != 2 || bools[0] || !bools[1] {
+		t.Errorf("unexpected discrete inputs: %v, %v", bools, err)
+	}
+
+	regs, err	= rh.HandleHoldingRegisters(1, 0, 2, false, nil)
+	if err != nil || len(regs) != 2 || regs[0] != 0x1234 {
+		t.Errorf("unexpected holding registers: %v, %v", regs, err)
+	}
+
+	regs, err	= rh.HandleInputRegisters(1, 0, 2)
+	if err != nil || len(regs) != 2 || regs[1] != 0x5678 {
+		t.Errorf("unexpected input registers: %v, %v", regs, err)
+	}
+
+	_, err	= rh.HandleInputRegisters(1, 1, 2)
+	if err != ErrIllegalDataAddress {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	return
+}
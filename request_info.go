@@ -0,0 +1,83 @@
+package modbus
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+)
+
+// RequestInfo describes the client a request was received from, e.g. to
+// restrict writes from untrusted subnets.
+// Context-aware handlers (see ContextRequestHandler) retrieve it from the
+// context of the request with RequestInfoFromContext().
+type RequestInfo struct {
+	RemoteAddr	net.Addr		// address of the client (nil over
+						// serial links)
+	PeerCertificate	*x509.Certificate	// certificate presented by the
+						// client (tcp+tls only)
+	Role		string			// role of the client (tcp+tls only,
+						// see TLSClientRole())
+	Transport	string			// "tcp", "tcp+tls", "rtuovertcp",
+						// "rtu" or "ascii"
+	UnitId		uint8			// unit id the request is addressed to
+	Broadcast	bool			// true if the request is a broadcast,
+						// which is never answered (serial
+						// links only, see BroadcastUnitIds)
+}
+
+// requestInfoKey is the context key of request infos.
+type requestInfoKey struct{}
+
+// Returns the client information attached to the context of a request, if
+// any.
+func RequestInfoFromContext(ctx context.Context) (info *RequestInfo, ok bool) {
+	info, ok	= ctx.Value(requestInfoKey{}).(*RequestInfo)
+
+	return
+}
+
+// Returns a copy of ctx carrying the client information conn, completed with
+// the unit id and broadcast flag of the request.
+func withRequestInfo(ctx context.Context, conn *RequestInfo, unitId uint8,
+		     broadcast bool) (reqCtx context.Context) {
+	var info	RequestInfo
+
+	info		= *conn
+	info.UnitId	= unitId
+	info.Broadcast	= broadcast
+	reqCtx		= context.WithValue(ctx, requestInfoKey{}, &info)
+
+	return
+}
+
+// Returns the client information of requests received over sock.
+func (ms *ModbusServer) tcpRequestInfo(sock net.Conn) (info *RequestInfo) {
+	info	= &RequestInfo{
+		RemoteAddr:		sock.RemoteAddr(),
+		PeerCertificate:	TLSClientCertificate(sock),
+		Role:			TLSClientRole(sock),
+		Transport:		"tcp",
+	}
+
+	switch {
+	case ms.rtuOverTCP:		info.Transport = "rtuovertcp"
+	case ms.tlsConfig != nil:	info.Transport = "tcp+tls"
+	}
+
+	return
+}
+
+// Returns the client information of requests received over the serial link
+// (auto-detected framing is reported as rtu).
+func (ms *ModbusServer) serialRequestInfo() (info *RequestInfo) {
+	info	= &RequestInfo{
+		Transport:	"rtu",
+	}
+
+	switch {
+	case ms.transportType == TCP_TRANSPORT:	info.Transport = "tcp"
+	case ms.asciiFraming:			info.Transport = "ascii"
+	}
+
+	return
+}
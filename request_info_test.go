@@ -0,0 +1,134 @@
+package modbus
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// infoHandler is a ContextRequestHandler reporting the client information
+// attached to holding register requests.
+type infoHandler struct {
+	*requestHandlerAdapter
+	infos	chan *RequestInfo
+}
+
+func (ih *infoHandler) HandleHoldingRegistersContext(ctx context.Context, unitId uint8, addr uint16,
+						     quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var info	*RequestInfo
+	var ok		bool
+
+	info, ok	= RequestInfoFromContext(ctx)
+	if !ok {
+		err	= ErrServerDeviceFailure
+		return
+	}
+	ih.infos <- info
+
+	res	= make([]uint16, quantity)
+
+	return
+}
+
+func TestRequestInfo(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ih		*infoHandler
+	var info	*RequestInfo
+	var ok		bool
+	var p1, p2	net.Conn
+	var err		error
+
+	_, ok	= RequestInfoFromContext(context.Background())
+	if ok {
+		t.Errorf("expected no request info in a bare context")
+	}
+
+	ih	= &infoHandler{
+		requestHandlerAdapter:	&requestHandlerAdapter{handler: NewDataStore(0, 0, 0, 10)},
+		infos:			make(chan *RequestInfo, 1),
+	}
+
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"tcp://localhost:5570",
+	}, ih)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5570",
+		Timeout:	1 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	client.SetUnitId(7)
+	_, err	= client.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	info	= <-ih.infos
+	if info.Transport != "tcp" {
+		t.Errorf("expected tcp transport, got: %v", info.Transport)
+	}
+	if info.UnitId != 7 {
+		t.Errorf("expected unit id 7, got: %v", info.UnitId)
+	}
+	if info.RemoteAddr == nil ||
+	   !info.RemoteAddr.(*net.TCPAddr).IP.IsLoopback() {
+		t.Errorf("expected a loopback remote address, got: %v", info.RemoteAddr)
+	}
+	if info.PeerCertificate != nil || info.Role != "" {
+		t.Errorf("expected no peer certificate nor role, got: %v, %v",
+			 info.PeerCertificate, info.Role)
+	}
+
+	// requests received over serial links carry no remote address
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, ih)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go server.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	client.SetUnitId(3)
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisters() should have succeeded, got: %v", err)
+	}
+
+	info	= <-ih.infos
+	if info.Transport != "rtu" || info.UnitId != 3 || info.RemoteAddr != nil {
+		t.Errorf("unexpected request info: %+v", info)
+	}
+
+	return
+}
@@ -0,0 +1,91 @@
+package modbus
+
+import (
+	"time"
+)
+
+// loggingHandler logs every call made to the RequestHandler it wraps.
+type loggingHandler struct {
+	next	RequestHandler
+	l	Logger
+}
+
+// Returns a request handler wrapping next, logging every handler call with
+// its decoded arguments, duration and outcome to l, e.g.
+//   HandleCoils(unitId=1, addr=100, qty=2): ok (0.1ms)
+//   HandleHoldingRegisters(unitId=1, addr=100, qty=1, values=[42]): illegal data address (0.1ms)
+// Results of next are returned unmodified.
+// Unlike request logging at the transport level (see NewLoggingServer() and
+// NewDebugServer()), only requests reaching the handler are logged.
+func NewRequestLogger(l Logger, next RequestHandler) (rh RequestHandler) {
+	rh	= &loggingHandler{
+		next:	next,
+		l:	l,
+	}
+
+	return
+}
+
+func (lh *loggingHandler) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	var start	= time.Now()
+
+	res, err	= lh.next.HandleCoils(unitId, addr, quantity, isWrite, args)
+	if isWrite {
+		lh.log(start, err, "HandleCoils(unitId=%v, addr=%v, qty=%v, values=%v)",
+		       unitId, addr, quantity, args)
+	} else {
+		lh.log(start, err, "HandleCoils(unitId=%v, addr=%v, qty=%v)",
+		       unitId, addr, quantity)
+	}
+
+	return
+}
+
+func (lh *loggingHandler) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	var start	= time.Now()
+
+	res, err	= lh.next.HandleDiscreteInputs(unitId, addr, quantity)
+	lh.log(start, err, "HandleDiscreteInputs(unitId=%v, addr=%v, qty=%v)",
+	       unitId, addr, quantity)
+
+	return
+}
+
+func (lh *loggingHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var start	= time.Now()
+
+	res, err	= lh.next.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+	if isWrite {
+		lh.log(start, err, "HandleHoldingRegisters(unitId=%v, addr=%v, qty=%v, values=%v)",
+		       unitId, addr, quantity, args)
+	} else {
+		lh.log(start, err, "HandleHoldingRegisters(unitId=%v, addr=%v, qty=%v)",
+		       unitId, addr, quantity)
+	}
+
+	return
+}
+
+func (lh *loggingHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	var start	= time.Now()
+
+	res, err	= lh.next.HandleInputRegisters(unitId, addr, quantity)
+	lh.log(start, err, "HandleInputRegisters(unitId=%v, addr=%v, qty=%v)",
+	       unitId, addr, quantity)
+
+	return
+}
+
+// Writes a log line for a handler call.
+func (lh *loggingHandler) log(start time.Time, err error, format string, args ...interface{}) {
+	var outcome	= "ok"
+
+	if err != nil {
+		outcome	= err.Error()
+	}
+
+	lh.l.Printf(format + ": %s (%.1fms)", append(args, outcome,
+		    float64(time.Since(start)) / float64(time.Millisecond))...)
+
+	return
+}
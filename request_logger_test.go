@@ -0,0 +1,95 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger is a Logger keeping every line logged.
+type recordingLogger struct {
+	lock	sync.Mutex
+	lines	[]string
+}
+
+func (rl *recordingLogger) Printf(format string, v ...interface{}) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	rl.lines	= append(rl.lines, fmt.Sprintf(format, v...))
+
+	return
+}
+
+func TestRequestLogger(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var rl		*recordingLogger
+	var ds		*DataStore
+	var reg		uint16
+
+	rl	= &recordingLogger{}
+	ds	= NewDataStore(10, 0, 10, 0)
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5538",
+	}, NewRequestLogger(rl, ds))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5538",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadCoils(2, 3)
+	if err != nil {
+		t.Errorf("ReadCoils() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegister(4, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	// results should be passed through unmodified
+	reg, err	= ds.GetHoldingRegister(4)
+	if err != nil || reg != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x, %v", reg, err)
+	}
+
+	_, err	= client.ReadRegisters(20, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if len(rl.lines) != 3 ||
+	   !strings.HasPrefix(rl.lines[0], "HandleCoils(unitId=1, addr=2, qty=3): ok (") ||
+	   !strings.HasPrefix(rl.lines[1], "HandleHoldingRegisters(unitId=1, addr=4, qty=1, values=[4660]): ok (") ||
+	   !strings.HasPrefix(rl.lines[2], "HandleHoldingRegisters(unitId=1, addr=20, qty=1): illegal data address (") {
+		t.Errorf("unexpected log output: %q", rl.lines)
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package modbus
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Returns a smoothed estimate of the number of requests per second the server
+// is processing, as an exponential moving average of the instantaneous rates
+// observed between consecutive requests (see the EMAAlpha configuration
+// setting).
+// Once requests stop, the estimate decays towards 0 as time passes.
+// This is meant as a cheap input for adaptive throttling rather than an
+// accurate metric.
+func (ms *ModbusServer) EstimateRequestRate() (rate float64) {
+	var last	int64
+	var elapsed	float64
+
+	last	= atomic.LoadInt64(&ms.lastRequestNanos)
+	if last == 0 {
+		return
+	}
+
+	rate	= math.Float64frombits(atomic.LoadUint64(&ms.requestRateBits))
+
+	// never report more than one request per elapsed interval since the
+	// last request, so that the estimate decays when traffic stops
+	elapsed	= float64(time.Now().UnixNano() - last) / float64(time.Second)
+	if elapsed > 0 && 1 / elapsed < rate {
+		rate	= 1 / elapsed
+	}
+
+	return
+}
+
+// Accounts for a request in the request rate estimate.
+// Safe for concurrent use by multiple client sessions.
+func (ms *ModbusServer) recordRequest() {
+	var now		int64
+	var last	int64
+	var instant	float64
+	var oldBits	uint64
+	var newRate	float64
+
+	now	= time.Now().UnixNano()
+	last	= atomic.SwapInt64(&ms.lastRequestNanos, now)
+	if last == 0 || now <= last {
+		// no interval to measure yet
+		return
+	}
+
+	instant	= float64(time.Second) / float64(now - last)
+
+	for {
+		oldBits	= atomic.LoadUint64(&ms.requestRateBits)
+		newRate	= ms.conf.EMAAlpha * instant +
+			  (1 - ms.conf.EMAAlpha) * math.Float64frombits(oldBits)
+
+		if atomic.CompareAndSwapUint64(&ms.requestRateBits, oldBits,
+					       math.Float64bits(newRate)) {
+			break
+		}
+	}
+
+	return
+}
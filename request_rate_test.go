@@ -0,0 +1,80 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateRequestRate(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ticker	*time.Ticker
+	var rate	float64
+	var err		error
+
+	_, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5530",
+		EMAAlpha:	1.5,
+	}, NewDataStore(0, 0, 1, 0))
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5530",
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if server.EstimateRequestRate() != 0 {
+		t.Errorf("expected a rate of 0 before any request")
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5530",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// send 50 requests at 50 req/s
+	ticker	= time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 0; i < 50; i++ {
+		<-ticker.C
+
+		_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+		if err != nil {
+			t.Fatalf("ReadRegister() should have succeeded, got: %v", err)
+		}
+	}
+
+	rate	= server.EstimateRequestRate()
+	if rate < 40 || rate > 60 {
+		t.Errorf("expected a rate between 40 and 60 req/s, got: %v", rate)
+	}
+
+	// the estimate should decay once requests stop
+	time.Sleep(250 * time.Millisecond)
+
+	rate	= server.EstimateRequestRate()
+	if rate > 5 {
+		t.Errorf("expected a rate below 5 req/s, got: %v", rate)
+	}
+
+	return
+}
@@ -1,13 +1,20 @@
 package modbus
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"time"
+
+	"github.com/goburrow/serial"
 )
 
 const (
 	maxRTUFrameLength	int = 256
+	// maximum time to receive a complete RTU frame over TCP (rtuovertcp://
+	// servers) once its first bytes have been received
+	rtuOverTCPFrameTimeout	time.Duration = 1 * time.Second
 )
 
 type rtuTransport struct {
@@ -15,6 +22,9 @@ type rtuTransport struct {
 	link		rtuLink
 	timeout		time.Duration
 	speed		uint
+	// how long to wait for the next request before giving up, forever
+	// if zero (see ServerConfiguration for rtuovertcp:// servers)
+	idleTimeout	time.Duration
 }
 
 type rtuLink interface {
@@ -67,19 +77,46 @@ func (rt *rtuTransport) ExecuteRequest(req *pdu) (res *pdu, err error) {
 	return
 }
 
-// Reads a request from the rtu link.
+// Waits for, reads and decodes a request from the rtu link.
+// Blocks until a request is received or the link is closed.
+// Malformed frames (bad CRC, short frames or unsupported function codes) are
+// discarded and reported as ErrBadCRC, ErrShortFrame or ErrProtocolError.
 func (rt *rtuTransport) ReadRequest() (req *pdu, err error) {
-	// reading requests from RTU links is currently unsupported
-	err	= fmt.Errorf("unimplemented")
+	req, err	= rt.readRTURequestFrame()
+	if err == ErrBadCRC || err == ErrShortFrame || err == ErrProtocolError {
+		// drop whatever is left of the frame
+		discard(rt.link)
+	}
 
 	return
 }
 
 // Writes a response to the rtu link.
 func (rt *rtuTransport) WriteResponse(res *pdu) (err error) {
-	// build an RTU ADU out of the request object and
+	err	= rt.writeRTUFrame(res)
+
+	return
+}
+
+// Writes a request to the rtu link without waiting for a response, as
+// required for broadcast requests.
+func (rt *rtuTransport) WriteRequest(req *pdu) (err error) {
+	err	= rt.writeRTUFrame(req)
+
+	return
+}
+
+// Writes a frame to the rtu link and observes the inter-frame delay.
+func (rt *rtuTransport) writeRTUFrame(p *pdu) (err error) {
+	// set an i/o deadline on the link
+	err	= rt.link.SetDeadline(time.Now().Add(rt.timeout))
+	if err != nil {
+		return
+	}
+
+	// build an RTU ADU out of the pdu object and
 	// send the final ADU+CRC on the wire
-	_, err	= rt.link.Write(rt.assembleRTUFrame(res))
+	_, err	= rt.link.Write(rt.assembleRTUFrame(p))
 	if err != nil {
 		return
 	}
@@ -109,6 +146,7 @@ func (rt *rtuTransport) readRTUFrame() (res *pdu, err error) {
 	var rxbuf	[]byte
 	var byteCount	int
 	var bytesNeeded	int
+	var offset	int
 	var crc		crc
 
 	rxbuf		= make([]byte, maxRTUFrameLength)
@@ -124,8 +162,18 @@ func (rt *rtuTransport) readRTUFrame() (res *pdu, err error) {
 		return
 	}
 
+	offset	= 3
+
 	// figure out how many further bytes to read
-	bytesNeeded, err = expectedResponseLenth(uint8(rxbuf[1]), uint8(rxbuf[2]))
+	if rxbuf[1] == FC_READ_DEVICE_IDENTIFICATION {
+		// device identification responses have no byte count field
+		offset, err	= rt.readDeviceIdentificationFrame(rxbuf)
+	} else if rxbuf[1] == FC_READ_FIFO_QUEUE {
+		// FIFO queue responses carry a 2-byte byte count field
+		offset, bytesNeeded, err	= rt.readFIFOQueueFrame(rxbuf)
+	} else {
+		bytesNeeded, err = expectedResponseLenth(uint8(rxbuf[1]), uint8(rxbuf[2]))
+	}
 	if err != nil {
 		return
 	}
@@ -134,12 +182,12 @@ func (rt *rtuTransport) readRTUFrame() (res *pdu, err error) {
 	bytesNeeded	+= 2
 
 	// never read more than the max allowed frame length
-	if byteCount + bytesNeeded > maxRTUFrameLength {
+	if offset + bytesNeeded > maxRTUFrameLength {
 		err	= ErrProtocolError
 		return
 	}
 
-	byteCount, err	= io.ReadFull(rt.link, rxbuf[3:3 + bytesNeeded])
+	byteCount, err	= io.ReadFull(rt.link, rxbuf[offset:offset + bytesNeeded])
 	if err != nil && err != io.ErrUnexpectedEOF {
 		return
 	}
@@ -151,10 +199,10 @@ func (rt *rtuTransport) readRTUFrame() (res *pdu, err error) {
 
 	// compute the CRC on the entire frame, excluding the CRC
 	crc.init()
-	crc.add(rxbuf[0:3 + bytesNeeded - 2])
+	crc.add(rxbuf[0:offset + bytesNeeded - 2])
 
 	// compare CRC values
-	if !crc.isEqual(rxbuf[3 + bytesNeeded - 2], rxbuf[3 + bytesNeeded - 1]) {
+	if !crc.isEqual(rxbuf[offset + bytesNeeded - 2], rxbuf[offset + bytesNeeded - 1]) {
 		err = ErrBadCRC
 		return
 	}
@@ -163,12 +211,145 @@ func (rt *rtuTransport) readRTUFrame() (res *pdu, err error) {
 		unitId:		rxbuf[0],
 		functionCode:	rxbuf[1],
 		// pass the byte count + trailing data as payload, withtout the CRC
-		payload:	rxbuf[2:3 + bytesNeeded  - 2],
+		payload:	rxbuf[2:offset + bytesNeeded  - 2],
+	}
+
+	return
+}
+
+// Waits for, reads and decodes a request frame from the rtu link.
+func (rt *rtuTransport) readRTURequestFrame() (req *pdu, err error) {
+	var rxbuf		[]byte
+	var byteCount		int
+	var payloadLength	int
+	var bytesNeeded		int
+	var byteCountOffset	int
+	var crc			crc
+	var idleSince		time.Time
+
+	rxbuf		= make([]byte, maxRTUFrameLength)
+	idleSince	= time.Now()
+
+	// wait for the unit id and function code of the next request: the line
+	// may stay idle for any amount of time, hence read timeouts are retried
+	// as long as no byte was received (and the idle timeout, if any, is not
+	// reached)
+	for {
+		err	= rt.link.SetDeadline(time.Now().Add(rt.timeout))
+		if err != nil {
+			return
+		}
+
+		byteCount, err	= io.ReadFull(rt.link, rxbuf[0:2])
+		if byteCount == 0 && isTimeoutError(err) {
+			if rt.idleTimeout > 0 && time.Since(idleSince) >= rt.idleTimeout {
+				return
+			}
+			continue
+		}
+		break
+	}
+
+	err	= shortFrameError(byteCount, 2, err)
+	if err != nil {
+		return
+	}
+
+	// give the rest of the frame up to timeout to arrive
+	err	= rt.link.SetDeadline(time.Now().Add(rt.timeout))
+	if err != nil {
+		return
+	}
+
+	// figure out how many further bytes to read
+	payloadLength, byteCountOffset, err = expectedRequestLength(rxbuf[1])
+	if err != nil {
+		return
+	}
+
+	// read the fixed part of the payload, from the first byte of the
+	// payload (offset 2)
+	byteCount, err	= io.ReadFull(rt.link, rxbuf[2:2 + payloadLength])
+	err		= shortFrameError(byteCount, payloadLength, err)
+	if err != nil {
+		return
+	}
+
+	// read the variable part of the payload, if any
+	if byteCountOffset >= 0 {
+		bytesNeeded	= int(rxbuf[2 + byteCountOffset])
+
+		// never read more than the max allowed frame length
+		if 2 + payloadLength + bytesNeeded + 2 > maxRTUFrameLength {
+			err	= ErrProtocolError
+			return
+		}
+
+		byteCount, err	= io.ReadFull(rt.link,
+					      rxbuf[2 + payloadLength:2 + payloadLength + bytesNeeded])
+		err		= shortFrameError(byteCount, bytesNeeded, err)
+		if err != nil {
+			return
+		}
+
+		payloadLength	+= bytesNeeded
+	}
+
+	// read the CRC
+	byteCount, err	= io.ReadFull(rt.link, rxbuf[2 + payloadLength:2 + payloadLength + 2])
+	err		= shortFrameError(byteCount, 2, err)
+	if err != nil {
+		return
+	}
+
+	// compute the CRC on the entire frame, excluding the CRC
+	crc.init()
+	crc.add(rxbuf[0:2 + payloadLength])
+
+	// compare CRC values
+	if !crc.isEqual(rxbuf[2 + payloadLength], rxbuf[2 + payloadLength + 1]) {
+		err = ErrBadCRC
+		return
+	}
+
+	req	= &pdu{
+		unitId:		rxbuf[0],
+		functionCode:	rxbuf[1],
+		payload:	rxbuf[2:2 + payloadLength],
+	}
+
+	return
+}
+
+// Maps incomplete reads to ErrShortFrame.
+func shortFrameError(byteCount int, expected int, in error) (err error) {
+	switch {
+	case byteCount == expected:
+		err	= nil
+	case in == nil || in == io.ErrUnexpectedEOF || isTimeoutError(in):
+		err	= ErrShortFrame
+	default:
+		err	= in
 	}
 
 	return
 }
 
+// Returns true if err is a read timeout, either from a serial port or from
+// a network connection.
+func isTimeoutError(err error) (ok bool) {
+	var netErr	net.Error
+
+	if err == serial.ErrTimeout {
+		ok	= true
+		return
+	}
+
+	ok	= errors.As(err, &netErr) && netErr.Timeout()
+
+	return
+}
+
 // Turns a PDU object into bytes.
 func (rt *rtuTransport) assembleRTUFrame(p *pdu) (adu []byte) {
 	var crc		crc
@@ -193,12 +374,20 @@ func expectedResponseLenth(responseCode uint8, responseLength uint8) (byteCount
 	case FC_READ_HOLDING_REGISTERS,
 	     FC_READ_INPUT_REGISTERS,
 	     FC_READ_COILS,
-	     FC_READ_DISCRETE_INPUTS:		byteCount = int(responseLength)
+	     FC_READ_DISCRETE_INPUTS,
+	     FC_READ_WRITE_MULTILE_REGISTERS,
+	     FC_READ_FILE_RECORD,
+	     FC_WRITE_FILE_RECORD,
+	     FC_GET_COMM_EVENT_LOG,
+	     FC_REPORT_SERVER_ID:		byteCount = int(responseLength)
 	case FC_WRITE_SINGLE_REGISTER,
 	     FC_WRITE_MULTIPLE_REGISTERS,
 	     FC_WRITE_SINGLE_COIL,
-	     FC_WRITE_MULTIPLE_COILS:		byteCount = 3
+	     FC_WRITE_MULTIPLE_COILS,
+	     FC_DIAGNOSTICS,
+	     FC_GET_COMM_EVENT_COUNTER:		byteCount = 3
 	case FC_MASK_WRITE_REGISTER:		byteCount = 5
+	case FC_READ_EXCEPTION_STATUS:		byteCount = 0
 	case FC_READ_HOLDING_REGISTERS | 0x80,
 	     FC_READ_INPUT_REGISTERS | 0x80,
 	     FC_READ_COILS | 0x80,
@@ -207,8 +396,52 @@ func expectedResponseLenth(responseCode uint8, responseLength uint8) (byteCount
 	     FC_WRITE_MULTIPLE_REGISTERS | 0x80,
 	     FC_WRITE_SINGLE_COIL | 0x80,
 	     FC_WRITE_MULTIPLE_COILS | 0x80,
-	     FC_MASK_WRITE_REGISTER | 0x80:	byteCount = 0
-	default: err = fmt.Errorf("unexpected response code (%v)", responseCode)
+	     FC_MASK_WRITE_REGISTER | 0x80,
+	     FC_READ_WRITE_MULTILE_REGISTERS | 0x80,
+	     FC_READ_FIFO_QUEUE | 0x80,
+	     FC_READ_EXCEPTION_STATUS | 0x80,
+	     FC_DIAGNOSTICS | 0x80,
+	     FC_GET_COMM_EVENT_COUNTER | 0x80,
+	     FC_GET_COMM_EVENT_LOG | 0x80,
+	     FC_REPORT_SERVER_ID | 0x80,
+	     FC_READ_FILE_RECORD | 0x80,
+	     FC_WRITE_FILE_RECORD | 0x80,
+	     FC_READ_DEVICE_IDENTIFICATION | 0x80:	byteCount = 0
+	default: err = fmt.Errorf("%w: unexpected response code (%v)", ErrProtocolError, responseCode)
+	}
+
+	return
+}
+
+// Computes the expected length of a modbus RTU request payload, as a fixed
+// length (following the function code) and the offset of the byte count field
+// within the payload when the request carries variable length data
+// (-1 otherwise).
+func expectedRequestLength(functionCode uint8) (fixedLength int, byteCountOffset int, err error) {
+	byteCountOffset	= -1
+
+	switch functionCode {
+	case FC_READ_COILS,
+	     FC_READ_DISCRETE_INPUTS,
+	     FC_READ_HOLDING_REGISTERS,
+	     FC_READ_INPUT_REGISTERS,
+	     FC_WRITE_SINGLE_COIL,
+	     FC_WRITE_SINGLE_REGISTER,
+	     FC_DIAGNOSTICS:			fixedLength = 4
+	case FC_WRITE_MULTIPLE_COILS,
+	     FC_WRITE_MULTIPLE_REGISTERS:	fixedLength = 5; byteCountOffset = 4
+	case FC_MASK_WRITE_REGISTER:		fixedLength = 6
+	case FC_READ_DEVICE_IDENTIFICATION:	fixedLength = 3
+	case FC_READ_FIFO_QUEUE:		fixedLength = 2
+	case FC_READ_EXCEPTION_STATUS,
+	     FC_GET_COMM_EVENT_COUNTER,
+	     FC_GET_COMM_EVENT_LOG,
+	     FC_REPORT_SERVER_ID:		fixedLength = 0
+	case FC_READ_FILE_RECORD,
+	     FC_WRITE_FILE_RECORD:		fixedLength = 1; byteCountOffset = 0
+	case FC_READ_WRITE_MULTILE_REGISTERS:	fixedLength = 9; byteCountOffset = 8
+	default:
+		err = ErrProtocolError
 	}
 
 	return
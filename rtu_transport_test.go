@@ -145,6 +145,81 @@ func TestRTUTransportReadRTUFrame(t *testing.T) {
 	return
 }
 
+func TestRTUTransportReadRequest(t *testing.T) {
+	var rt		*rtuTransport
+	var p1, p2	net.Conn
+	var txchan	chan []byte
+	var err		error
+	var req		*pdu
+	var frame	[]byte
+
+	txchan		= make(chan []byte, 2)
+	p1, p2		= net.Pipe()
+	go feedTestPipe(t, txchan, p1)
+
+	rt		= newRTUTransport(p2, "", 19200, 10 * time.Millisecond)
+
+	// a read holding registers request, sent after the line stayed idle
+	// for longer than the timeout
+	frame	= rt.assembleRTUFrame(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x6b, 0x00, 0x03},
+	})
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		txchan	<- frame
+	}()
+
+	req, err	= rt.ReadRequest()
+	if err != nil {
+		t.Fatalf("ReadRequest() should have succeeded, got %v", err)
+	}
+	if req.unitId != 0x11 || req.functionCode != FC_READ_HOLDING_REGISTERS ||
+	   len(req.payload) != 4 || req.payload[1] != 0x6b || req.payload[3] != 0x03 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// a variable length write multiple registers request
+	txchan		<- rt.assembleRTUFrame(&pdu{
+		unitId:		0x12,
+		functionCode:	FC_WRITE_MULTIPLE_REGISTERS,
+		payload:	[]byte{0x00, 0x01, 0x00, 0x02, 0x04, 0xde, 0xad, 0xbe, 0xef},
+	})
+	req, err	= rt.ReadRequest()
+	if err != nil {
+		t.Fatalf("ReadRequest() should have succeeded, got %v", err)
+	}
+	if req.unitId != 0x12 || len(req.payload) != 9 || req.payload[8] != 0xef {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// a request with a bad crc
+	frame		= rt.assembleRTUFrame(&pdu{
+		unitId:		0x13,
+		functionCode:	FC_WRITE_SINGLE_COIL,
+		payload:	[]byte{0x00, 0x01, 0xff, 0x00},
+	})
+	frame[len(frame) - 1]++
+	txchan		<- frame
+	_, err		= rt.ReadRequest()
+	if err != ErrBadCRC {
+		t.Errorf("ReadRequest() should have returned ErrBadCRC, got %v", err)
+	}
+
+	// a truncated request
+	txchan		<- []byte{0x14, FC_READ_COILS, 0x00}
+	_, err		= rt.ReadRequest()
+	if err != ErrShortFrame {
+		t.Errorf("ReadRequest() should have returned ErrShortFrame, got %v", err)
+	}
+
+	p1.Close()
+	p2.Close()
+
+	return
+}
+
 func feedTestPipe(t *testing.T, in chan []byte, out io.WriteCloser) {
 	var err		error
 	var txbuf	[]byte
@@ -163,3 +238,87 @@ func feedTestPipe(t *testing.T, in chan []byte, out io.WriteCloser) {
 
 	return
 }
+
+func FuzzReadRTUFrame(f *testing.F) {
+	var rt	*rtuTransport
+
+	rt	= &rtuTransport{}
+
+	f.Add([]byte{0x31, 0x82, 0x02, 0xc1, 0x6e})
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x01,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x04, 0x12, 0x34, 0x56, 0x78},
+	}))
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x01,
+		functionCode:	FC_WRITE_SINGLE_COIL,
+		payload:	[]byte{0x00, 0x01, 0xff, 0x00},
+	}))
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x01,
+		functionCode:	FC_READ_COILS,
+		payload:	[]byte{0xff},
+	}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var rt	*rtuTransport
+		var res	*pdu
+		var err	error
+
+		rt		= newRTUTransport(newFuzzConn(data), "", 19200, time.Second)
+		res, err	= rt.readRTUFrame()
+		if err != nil {
+			if !isKnownFrameError(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		// unit id, function code, payload and crc
+		if 2 + len(res.payload) + 2 > maxRTUFrameLength {
+			t.Errorf("frame exceeds %v bytes: %v", maxRTUFrameLength, len(res.payload))
+		}
+	})
+}
+
+func FuzzReadRTURequest(f *testing.F) {
+	var rt	*rtuTransport
+
+	rt	= &rtuTransport{}
+
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x6b, 0x00, 0x03},
+	}))
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_WRITE_MULTIPLE_REGISTERS,
+		payload:	[]byte{0x00, 0x01, 0x00, 0x02, 0x04, 0x00, 0x0a, 0x01, 0x02},
+	}))
+	f.Add(rt.assembleRTUFrame(&pdu{
+		unitId:		0x11,
+		functionCode:	FC_MASK_WRITE_REGISTER,
+		payload:	[]byte{0x00, 0x04, 0x00, 0xf2, 0x00, 0x25},
+	}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var rt	*rtuTransport
+		var req	*pdu
+		var err	error
+
+		rt		= newRTUTransport(newFuzzConn(data), "", 19200, time.Second)
+		req, err	= rt.ReadRequest()
+		if err != nil {
+			if !isKnownFrameError(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		if 2 + len(req.payload) + 2 > maxRTUFrameLength {
+			t.Errorf("frame exceeds %v bytes: %v", maxRTUFrameLength, len(req.payload))
+		}
+	})
+}
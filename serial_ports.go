@@ -0,0 +1,9 @@
+package modbus
+
+// SerialPortInfo describes a serial port found by ListSerialPorts().
+type SerialPortInfo struct {
+	Path		string	// device path, e.g. /dev/ttyUSB0 or COM3
+	Description	string	// human readable description, when available
+	HardwareID	string	// hardware identifier (e.g. USB VID:PID),
+				// when available
+}
@@ -0,0 +1,31 @@
+//go:build darwin
+
+package modbus
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Returns the serial ports available on the system, as the /dev/cu.* callout
+// devices registered by IOKit serial drivers.
+// Note that the IOKit registry is not queried (as it would require cgo),
+// hence Description is derived from the device name and HardwareID is left
+// empty.
+func ListSerialPorts() (ports []SerialPortInfo, err error) {
+	var paths	[]string
+
+	paths, err	= filepath.Glob("/dev/cu.*")
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		ports	= append(ports, SerialPortInfo{
+			Path:		path,
+			Description:	strings.TrimPrefix(filepath.Base(path), "cu."),
+		})
+	}
+
+	return
+}
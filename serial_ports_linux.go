@@ -0,0 +1,85 @@
+//go:build linux
+
+package modbus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sysClassTTY	string	= "/sys/class/tty"
+)
+
+// Returns the serial ports available on the system, as listed under
+// /sys/class/tty.
+// Virtual terminals and pseudo terminals (ttys without an underlying
+// device) are skipped.
+func ListSerialPorts() (ports []SerialPortInfo, err error) {
+	var entries	[]os.DirEntry
+	var devPath	string
+	var dir		string
+	var port	SerialPortInfo
+
+	entries, err	= os.ReadDir(sysClassTTY)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		// only keep ttys backed by a device
+		devPath, err	= filepath.EvalSymlinks(
+			filepath.Join(sysClassTTY, entry.Name(), "device"))
+		if err != nil {
+			err	= nil
+			continue
+		}
+
+		port	= SerialPortInfo{
+			Path:	"/dev/" + entry.Name(),
+		}
+
+		// USB adapters expose their product name and ids a few levels
+		// up the device tree (at the interface or device level)
+		dir	= devPath
+		for i := 0; i < 3; i++ {
+			if port.Description == "" {
+				port.Description	= readSysfsAttr(dir, "product")
+			}
+			if port.HardwareID == "" && readSysfsAttr(dir, "idVendor") != "" {
+				port.HardwareID	= "USB VID:PID=" +
+						  readSysfsAttr(dir, "idVendor") + ":" +
+						  readSysfsAttr(dir, "idProduct")
+			}
+			dir	= filepath.Dir(dir)
+		}
+
+		// fall back to the name of the driver
+		if port.Description == "" {
+			devPath, err	= filepath.EvalSymlinks(filepath.Join(devPath, "driver"))
+			if err == nil {
+				port.Description	= filepath.Base(devPath)
+			}
+			err	= nil
+		}
+
+		ports	= append(ports, port)
+	}
+
+	return
+}
+
+// Returns the trimmed contents of a sysfs attribute, or an empty string if
+// it cannot be read.
+func readSysfsAttr(dir string, name string) (value string) {
+	var buf	[]byte
+	var err	error
+
+	buf, err	= os.ReadFile(filepath.Join(dir, name))
+	if err == nil {
+		value	= strings.TrimSpace(string(buf))
+	}
+
+	return
+}
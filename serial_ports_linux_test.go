@@ -0,0 +1,40 @@
+//go:build linux
+
+package modbus
+
+import (
+	"os"
+	"testing"
+)
+
+func TestListSerialPorts(t *testing.T) {
+	var ports	[]SerialPortInfo
+	var err		error
+	var found	bool
+
+	ports, err	= ListSerialPorts()
+	if err != nil {
+		t.Fatalf("ListSerialPorts() should have succeeded, got: %v", err)
+	}
+
+	for _, port := range ports {
+		if port.Path == "" {
+			t.Errorf("unexpected empty port path: %+v", port)
+		}
+		// virtual terminals should be skipped
+		if port.Path == "/dev/tty" || port.Path == "/dev/ptmx" {
+			t.Errorf("unexpected port %v", port.Path)
+		}
+		if port.Path == "/dev/ttyS0" {
+			found	= true
+		}
+	}
+
+	// ttyS0 should be listed whenever the kernel exposes it
+	_, err	= os.Stat(sysClassTTY + "/ttyS0/device")
+	if err == nil && !found {
+		t.Errorf("expected /dev/ttyS0 to be listed, got: %+v", ports)
+	}
+
+	return
+}
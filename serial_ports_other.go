@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package modbus
+
+// Serial port enumeration is not supported on this platform.
+func ListSerialPorts() (ports []SerialPortInfo, err error) {
+	err	= ErrConfigurationError
+
+	return
+}
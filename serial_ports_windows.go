@@ -0,0 +1,139 @@
+//go:build windows
+
+package modbus
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	digcfPresent		uintptr	= 0x00000002
+	spdrpHardwareID		uint32	= 0x00000001
+	spdrpFriendlyName	uint32	= 0x0000000c
+	diregDev		uint32	= 0x00000001
+	dicsFlagGlobal		uint32	= 0x00000001
+	errorNoMoreItems	syscall.Errno	= 259
+)
+
+var (
+	// GUID_DEVCLASS_PORTS, the device setup class of serial and parallel ports
+	guidDevClassPorts	= syscall.GUID{
+		Data1:	0x4d36e978,
+		Data2:	0xe325,
+		Data3:	0x11ce,
+		Data4:	[8]byte{0xbf, 0xc1, 0x08, 0x00, 0x2b, 0xe1, 0x03, 0x18},
+	}
+
+	setupapi				= syscall.NewLazyDLL("setupapi.dll")
+	procSetupDiGetClassDevsW		= setupapi.NewProc("SetupDiGetClassDevsW")
+	procSetupDiEnumDeviceInfo		= setupapi.NewProc("SetupDiEnumDeviceInfo")
+	procSetupDiGetDeviceRegistryPropertyW	= setupapi.NewProc("SetupDiGetDeviceRegistryPropertyW")
+	procSetupDiOpenDevRegKey		= setupapi.NewProc("SetupDiOpenDevRegKey")
+	procSetupDiDestroyDeviceInfoList	= setupapi.NewProc("SetupDiDestroyDeviceInfoList")
+)
+
+// SP_DEVINFO_DATA
+type spDevInfoData struct {
+	cbSize		uint32
+	classGuid	syscall.GUID
+	devInst		uint32
+	reserved	uintptr
+}
+
+// Returns the serial ports available on the system, as enumerated by the
+// setup API (ports device class).
+// Ports without a COM port name (e.g. parallel ports) are skipped.
+func ListSerialPorts() (ports []SerialPortInfo, err error) {
+	var devInfoSet	uintptr
+	var devInfo	spDevInfoData
+	var r1		uintptr
+	var e1		error
+	var path	string
+
+	r1, _, e1	= procSetupDiGetClassDevsW.Call(
+		uintptr(unsafe.Pointer(&guidDevClassPorts)), 0, 0, digcfPresent)
+	if syscall.Handle(r1) == syscall.InvalidHandle {
+		err	= e1
+		return
+	}
+	devInfoSet	= r1
+	defer procSetupDiDestroyDeviceInfoList.Call(devInfoSet)
+
+	for i := uintptr(0); ; i++ {
+		devInfo.cbSize	= uint32(unsafe.Sizeof(devInfo))
+
+		r1, _, e1	= procSetupDiEnumDeviceInfo.Call(
+			devInfoSet, i, uintptr(unsafe.Pointer(&devInfo)))
+		if r1 == 0 {
+			if e1 != errorNoMoreItems {
+				err	= e1
+			}
+			break
+		}
+
+		path	= readPortName(devInfoSet, &devInfo)
+		if len(path) < 3 || path[0:3] != "COM" {
+			continue
+		}
+
+		ports	= append(ports, SerialPortInfo{
+			Path:		path,
+			Description:	readDeviceProperty(devInfoSet, &devInfo, spdrpFriendlyName),
+			HardwareID:	readDeviceProperty(devInfoSet, &devInfo, spdrpHardwareID),
+		})
+	}
+
+	return
+}
+
+// Returns the PortName value of the device's registry key, or an empty
+// string if it cannot be read.
+func readPortName(devInfoSet uintptr, devInfo *spDevInfoData) (name string) {
+	var key		syscall.Handle
+	var r1		uintptr
+	var buf		[256]uint16
+	var bufLen	uint32
+	var valType	uint32
+	var err		error
+
+	r1, _, _	= procSetupDiOpenDevRegKey.Call(
+		devInfoSet, uintptr(unsafe.Pointer(devInfo)),
+		uintptr(dicsFlagGlobal), 0, uintptr(diregDev), uintptr(syscall.KEY_READ))
+	key		= syscall.Handle(r1)
+	if key == syscall.InvalidHandle {
+		return
+	}
+	defer syscall.RegCloseKey(key)
+
+	bufLen	= uint32(len(buf) * 2)
+	err	= syscall.RegQueryValueEx(key, syscall.StringToUTF16Ptr("PortName"),
+					  nil, &valType, (*byte)(unsafe.Pointer(&buf[0])), &bufLen)
+	if err != nil || valType != syscall.REG_SZ {
+		return
+	}
+
+	name	= syscall.UTF16ToString(buf[:])
+
+	return
+}
+
+// Returns a string registry property of a device, or an empty string if
+// it cannot be read.
+// Multi-string properties (e.g. hardware ids) are truncated to their first
+// element.
+func readDeviceProperty(devInfoSet uintptr, devInfo *spDevInfoData, property uint32) (value string) {
+	var buf	[512]uint16
+	var r1	uintptr
+
+	r1, _, _	= procSetupDiGetDeviceRegistryPropertyW.Call(
+		devInfoSet, uintptr(unsafe.Pointer(devInfo)), uintptr(property),
+		0, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf) * 2), 0)
+	if r1 == 0 {
+		return
+	}
+
+	value	= syscall.UTF16ToString(buf[:])
+
+	return
+}
@@ -1,19 +1,85 @@
 package modbus
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"time"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Server configuration object.
 type ServerConfiguration struct {
-	URL		string		// where to listen at e.g. tcp://[::]:502
+	URL		string		// where to listen at e.g. tcp://[::]:502,
+					// tcp+tls://[::]:802 (modbus/TCP security),
+					// rtuovertcp://[::]:502 (raw RTU frames over
+					// TCP), rtu:///dev/ttyUSB0 or
+					// ascii:///dev/ttyUSB0
 	Timeout		time.Duration	// idle session timeout (client connection will be
 					// closed if idle for this long)
 	MaxClients	uint		// maximum number of concurrent client connections
+	ShutdownTimeout	time.Duration	// maximum time Shutdown() waits for in-flight
+					// requests to complete (defaults to 30s)
+	SLATimeout	time.Duration	// maximum time to answer a request, past which
+					// a server device failure exception is sent
+					// while the handler is left to complete
+					// (0 means no limit)
+	MaxResponseLatency time.Duration // response time past which OnSLABreach
+					// is called (0 means no limit)
+	OnSLABreach	func(unitId uint8, fc uint8, duration time.Duration)
+					// called once a response taking longer
+					// than MaxResponseLatency has been sent
+	EMAAlpha	float64		// smoothing factor of the request rate
+					// estimate, between 0 and 1 (defaults
+					// to 0.1, see EstimateRequestRate())
+	ConnectionTimingMetrics MetricsCollector
+					// receives client connection timings
+					// (see RecordConnection()), defaults to
+					// the collector of NewServerWithMetrics()
+	Tracer		Tracer		// if set, starts a span around each
+					// request (see Tracer)
+	Logger		Logger		// if set, receives the log lines of the
+					// server and its transports rather than
+					// stdout (see LevelLogger)
+	DumpFrames	bool		// log every ADU received and sent as a
+					// timestamped hex dump, at the info level
+					// (malformed frames included)
+
+	// TLS only settings
+	TLSServerCert	*tls.Certificate // server certificate and key (required
+					// with tcp+tls:// URLs)
+	TLSClientCAs	*x509.CertPool	// authorities client certificates must be
+					// signed by (required with tcp+tls:// URLs)
+	OnTLSHandshakeError func(addr net.Addr, err error)
+					// called when a client fails the TLS
+					// handshake (see
+					// NewTCPServerWithTLSAndClientAuth())
+	TLSOperatorRole	string		// if set, write requests from clients
+					// whose certificate lacks this role are
+					// rejected (see TLSClientRole())
+
+	// RTU only settings
+	Speed		uint		// serial speed (defaults to 9600)
+	HighSpeedSerial	bool		// allow speeds past 115200, up to 4000000
+					// (see ValidateServerConfiguration())
+	DataBits	uint		// defaults to 8
+	Parity		uint		// defaults to PARITY_NONE
+	StopBits	uint		// defaults to 2 with no parity, 1 otherwise
+	AcceptedUnitIds	[]uint8		// unit ids to answer to, requests to other
+					// unit ids are ignored (all unit ids are
+					// accepted if left empty)
+	IsAccepted	func(unitId uint8) bool
+					// if set, decides which unit ids to
+					// answer to in place of AcceptedUnitIds
+					// (e.g. for ranges or sparse ids)
+	BroadcastUnitIds []uint8	// accepted unit ids for which requests are
+					// processed but never answered
+					// (defaults to [0, 255])
 }
 
 // The RequestHandler interface should be implemented by the handler
@@ -67,6 +133,8 @@ type RequestHandler interface {
 	// HandleHoldingRegisters handles the read holding registers (0x03),
 	// write single register (0x06) and write multiple registers (0x10)
 	// function codes.
+	// Mask write register (0x16) requests are handled as a read of the
+	// register followed by a write of the masked value.
 	// Arguments passed to the handler:
 	// - unitId:	the unit id (slave id) requested,
 	// - addr:	the base holding register address requested,
@@ -107,25 +175,77 @@ type RequestHandler interface {
 
 // Modbus server object.
 type ModbusServer struct {
+	// request rate estimate (see EstimateRequestRate()), accessed atomically
+	// and kept first for 64-bit alignment on 32-bit platforms
+	requestRateBits		uint64
+	lastRequestNanos	int64
+
 	conf		ServerConfiguration
 	logger		*logger
 	lock		sync.Mutex
 	started		bool
+	startedAt	time.Time
+	// closed once the server is ready to serve requests (see WaitReady()),
+	// replaced when the server is stopped
+	readyCh		chan struct{}
 	handler		RequestHandler
 	tcpListener	net.Listener
 	tcpClients	[]net.Conn
+	rtuTransport	transport
 	transportType	transportType
+	requestLogger	*requestLogger
+	shuttingDown	bool
+	inFlight	uint
+	configPath	string
+	configWatchStop	chan struct{}
+	paused		uint32
+	// listener passed to NewTCPServerWithListener(), consumed by Start()
+	preboundListener	net.Listener
+	hasPreboundListener	bool
+	// detect RTU and ASCII framing (see NewAutoDetectServer())
+	autoDetectFraming	bool
+	// use ASCII rather than RTU framing (ascii:// URLs)
+	asciiFraming		bool
+	// use RTU rather than TCP framing over TCP (rtuovertcp:// URLs)
+	rtuOverTCP		bool
+	// TLS settings (see NewTCPServerWithTLSAndClientAuth())
+	tlsConfig		*tls.Config
+	// metrics collector (see NewServerWithMetrics())
+	metrics			MetricsCollector
+	// device identification objects (see SetDeviceIdentification())
+	deviceIdObjects		map[uint8]string
+	// diagnostics function counters (see DiagnosticCounters())
+	diag			diagnosticCounters
+	// per-unit comm event counters and logs (function codes 0x0b and 0x0c)
+	commEvents		commEventTracker
+	// server id and run indicator status (see SetServerId())
+	serverId		[]byte
+	serverRunning		bool
+	// custom function code handlers (see RegisterFunctionHandler())
+	functionHandlers	map[uint8]FunctionHandler
+	// request middlewares, outermost first (see Use())
+	middlewares		[]ServerMiddleware
+	// traffic log output of debug servers (see NewDebugServer())
+	debugOut		io.Writer
+	// parent context of requests, canceled when the server is stopped
+	// (see ContextRequestHandler)
+	ctx			context.Context
+	cancel			context.CancelFunc
 }
 
 // Returns a new modbus server.
 // reqHandler should be a user-provided handler object satisfying the RequestHandler
 // interface.
 func NewServer(conf *ServerConfiguration, reqHandler RequestHandler) (ms *ModbusServer, err error) {
+	var warnings	[]string
+
 	ms = &ModbusServer{
 		conf:		*conf,
 		handler:	reqHandler,
 		logger:		newLogger("modbus-server"),
+		readyCh:	make(chan struct{}),
 	}
+	ms.logger.out	= ms.conf.Logger
 
 	switch {
 	case strings.HasPrefix(ms.conf.URL, "tcp://"):
@@ -141,12 +261,158 @@ func NewServer(conf *ServerConfiguration, reqHandler RequestHandler) (ms *Modbus
 
 		ms.transportType	= TCP_TRANSPORT
 
+	case strings.HasPrefix(ms.conf.URL, "tcp+tls://"):
+		ms.conf.URL	= strings.TrimPrefix(ms.conf.URL, "tcp+tls://")
+
+		// use the same defaults as tcp://
+		if ms.conf.Timeout == 0 {
+			ms.conf.Timeout = 120 * time.Second
+		}
+
+		if ms.conf.MaxClients == 0 {
+			ms.conf.MaxClients = 10
+		}
+
+		// require mutual TLS authentication
+		ms.tlsConfig, err	= newSecurityTLSConfig(ms.conf.TLSServerCert,
+							       ms.conf.TLSClientCAs)
+		if err != nil {
+			ms.logger.Error(err.Error())
+			ms	= nil
+			return
+		}
+
+		ms.transportType	= TCP_TRANSPORT
+
+	case strings.HasPrefix(ms.conf.URL, "rtuovertcp://"):
+		ms.conf.URL	= strings.TrimPrefix(ms.conf.URL, "rtuovertcp://")
+
+		// use the same defaults as tcp://
+		if ms.conf.Timeout == 0 {
+			ms.conf.Timeout = 120 * time.Second
+		}
+
+		if ms.conf.MaxClients == 0 {
+			ms.conf.MaxClients = 10
+		}
+
+		ms.transportType	= TCP_TRANSPORT
+		ms.rtuOverTCP		= true
+
+	case strings.HasPrefix(ms.conf.URL, "rtu://"),
+	     strings.HasPrefix(ms.conf.URL, "ascii://"):
+		// ASCII is served with the same serial settings as RTU
+		if strings.HasPrefix(ms.conf.URL, "ascii://") {
+			ms.conf.URL		= strings.TrimPrefix(ms.conf.URL, "ascii://")
+			ms.asciiFraming		= true
+		} else {
+			ms.conf.URL		= strings.TrimPrefix(ms.conf.URL, "rtu://")
+		}
+
+		// use the same defaults as the client (see NewClient())
+		if ms.conf.Speed == 0 {
+			ms.conf.Speed	= 9600
+		}
+
+		warnings, err	= validateSerialSpeed(ms.conf.Speed, ms.conf.HighSpeedSerial)
+		if err != nil {
+			ms.logger.Error(err.Error())
+			ms	= nil
+			return
+		}
+		for _, warning := range warnings {
+			ms.logger.Warning(warning)
+		}
+
+		if ms.conf.DataBits == 0 {
+			ms.conf.DataBits = 8
+		}
+
+		if ms.conf.StopBits == 0 {
+			if ms.conf.Parity == PARITY_NONE {
+				ms.conf.StopBits = 2
+			} else {
+				ms.conf.StopBits = 1
+			}
+		}
+
+		// maximum time to receive a complete frame once its first
+		// bytes have been received (ASCII allows up to a second between
+		// characters)
+		if ms.conf.Timeout == 0 && ms.asciiFraming {
+			ms.conf.Timeout = 1 * time.Second
+		}
+
+		if ms.conf.Timeout == 0 {
+			ms.conf.Timeout = 300 * time.Millisecond
+		}
+
+		if ms.conf.BroadcastUnitIds == nil {
+			ms.conf.BroadcastUnitIds	= []uint8{0, 255}
+		}
+
+		ms.transportType	= RTU_TRANSPORT
+
 	default:
 		err	= ErrConfigurationError
 		return
 	}
 
-	ms.logger	= newLogger(fmt.Sprintf("modbus-server(%s)", ms.conf.URL))
+	if ms.conf.ShutdownTimeout == 0 {
+		ms.conf.ShutdownTimeout = 30 * time.Second
+	}
+
+	if ms.conf.EMAAlpha == 0 {
+		ms.conf.EMAAlpha = 0.1
+	}
+
+	if ms.conf.EMAAlpha < 0 || ms.conf.EMAAlpha > 1 {
+		ms	= nil
+		err	= ErrConfigurationError
+		return
+	}
+
+	err	= validateUnitIds(ms.conf.AcceptedUnitIds)
+	if err != nil {
+		ms.logger.Error(err.Error())
+		ms	= nil
+		return
+	}
+
+	ms.logger.prefix	= fmt.Sprintf("modbus-server(%s)", ms.conf.URL)
+
+	return
+}
+
+// Returns a new modbus TCP server accepting client connections on l, an
+// already bound listener (e.g. passed by systemd socket activation), rather
+// than binding conf.URL.
+// conf.URL is only used for logging and can be left empty.
+// Since l is closed when the server is stopped, the server cannot be
+// restarted.
+func NewTCPServerWithListener(l net.Listener, conf *ServerConfiguration, reqHandler RequestHandler) (ms *ModbusServer, err error) {
+	var c	ServerConfiguration
+
+	if l == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	if conf != nil {
+		c	= *conf
+	}
+
+	if c.URL == "" {
+		c.URL	= "tcp://" + l.Addr().String()
+	}
+
+	ms, err	= NewServer(&c, reqHandler)
+	if err != nil {
+		return
+	}
+
+	ms.preboundListener	= l
+	ms.hasPreboundListener	= true
 
 	return
 }
@@ -162,21 +428,181 @@ func (ms *ModbusServer) Start() (err error) {
 
 	switch ms.transportType {
 	case TCP_TRANSPORT:
-		// bind to a TCP socket
-		ms.tcpListener, err	= net.Listen("tcp", ms.conf.URL)
-		if err != nil {
+		switch {
+		case ms.preboundListener != nil:
+			// use the listener we were given
+			ms.tcpListener		= ms.preboundListener
+			ms.preboundListener	= nil
+
+		case ms.hasPreboundListener:
+			ms.logger.Error("pre-bound listener already closed, cannot restart")
+			err	= ErrConfigurationError
 			return
+
+		default:
+			// bind to a TCP socket
+			ms.tcpListener, err	= net.Listen("tcp", ms.conf.URL)
+			if err != nil {
+				return
+			}
+		}
+
+		// require TLS if configured to
+		if ms.tlsConfig != nil {
+			ms.tcpListener	= tls.NewListener(ms.tcpListener, ms.tlsConfig)
 		}
 
 		// accept client connections in a goroutine
-		go ms.acceptTCPClients()
+		go ms.acceptTCPClients(ms.tcpListener, ms.readyCh)
+
+	case RTU_TRANSPORT:
+		var spw		*serialPortWrapper
+		var link	rtuLink
+		var tap		*aduTap
+
+		spw	= newSerialPortWrapper(&serialPortConfig{
+			Device:		ms.conf.URL,
+			Speed:		ms.conf.Speed,
+			DataBits:	ms.conf.DataBits,
+			Parity:		ms.conf.Parity,
+			StopBits:	ms.conf.StopBits,
+		})
+
+		// open the serial device
+		err	= spw.Open()
+		if err != nil {
+			return
+		}
+
+		// discard potentially stale serial data
+		discard(spw)
+
+		// count traffic if metrics are enabled
+		link	= spw
+		if ms.metrics != nil {
+			link	= &countingLink{rtuLink: spw, metrics: ms.metrics}
+		}
+
+		// record traffic if frames are to be dumped
+		if ms.conf.DumpFrames {
+			tap	= &aduTap{}
+			link	= &tappedLink{rtuLink: link, tap: tap}
+		}
+
+		if ms.autoDetectFraming {
+			ms.rtuTransport	= newAutoDetectTransport(
+				link, ms.conf.URL, ms.conf.Speed, ms.conf.Timeout)
+		} else if ms.asciiFraming {
+			ms.rtuTransport	= newASCIITransport(
+				link, ms.conf.URL, ms.conf.Timeout)
+		} else {
+			ms.rtuTransport	= newRTUTransport(
+				link, ms.conf.URL, ms.conf.Speed, ms.conf.Timeout)
+		}
+		setTransportLogger(ms.rtuTransport, ms.logger.out)
+
+		if tap != nil {
+			ms.rtuTransport	= newFrameDumpTransport(ms.rtuTransport, tap, ms.logger,
+								ms.serialRequestInfo().Transport)
+		}
+
+		// serve requests in a goroutine
+		go ms.handleTransport(ms.rtuTransport)
+		close(ms.readyCh)
 
 	default:
 		err = ErrConfigurationError
 		return
 	}
 
-	ms.started = true
+	ms.started	= true
+	ms.ctx, ms.cancel	= context.WithCancel(context.Background())
+	ms.startedAt	= time.Now()
+	ms.shuttingDown	= false
+
+	ms.warnIfDebugInProduction()
+
+	return
+}
+
+// Blocks until the server is started and ready to accept client connections
+// (or to serve requests over RTU), or until ctx is done, in which case
+// ctx.Err() is returned.
+// May be called before Start(), e.g. from another goroutine.
+func (ms *ModbusServer) WaitReady(ctx context.Context) (err error) {
+	var ready	chan struct{}
+
+	for {
+		ms.lock.Lock()
+		ready	= ms.readyCh
+		ms.lock.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			err	= ctx.Err()
+			return
+		}
+
+		// the server may have been stopped in the meantime, in which
+		// case wait for the next start
+		ms.lock.Lock()
+		if ms.started && ms.readyCh == ready {
+			ms.lock.Unlock()
+			return
+		}
+		ms.lock.Unlock()
+	}
+}
+
+// Returns the time at which the server was last started, or the zero time
+// if it is not running.
+func (ms *ModbusServer) UpSince() (t time.Time) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.started {
+		t	= ms.startedAt
+	}
+
+	return
+}
+
+// Returns for how long the server has been running, or zero if it is not
+// running.
+func (ms *ModbusServer) Uptime() (d time.Duration) {
+	var since	time.Time
+
+	since	= ms.UpSince()
+	if !since.IsZero() {
+		d	= time.Since(since)
+	}
+
+	return
+}
+
+// Returns the address the server is listening on: over TCP, the local
+// address of the listener (e.g. with the port picked by the OS when
+// configured with tcp://:0), over RTU, the serial device path.
+// Returns ErrServerNotStarted if the server is not listening over TCP.
+func (ms *ModbusServer) BoundAddr() (addr string, err error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	switch ms.transportType {
+	case TCP_TRANSPORT:
+		if !ms.started || ms.tcpListener == nil {
+			err	= ErrServerNotStarted
+			return
+		}
+		addr	= ms.tcpListener.Addr().String()
+
+	case RTU_TRANSPORT:
+		addr	= ms.conf.URL
+
+	default:
+		err	= ErrConfigurationError
+	}
 
 	return
 }
@@ -186,11 +612,19 @@ func (ms *ModbusServer) Stop() (err error) {
 	ms.lock.Lock()
 	defer ms.lock.Unlock()
 
+	ms.stopConfigWatch()
+
 	if !ms.started {
 		return
 	}
 
 	ms.started = false
+	ms.readyCh = make(chan struct{})
+
+	// cancel requests in flight
+	if ms.cancel != nil {
+		ms.cancel()
+	}
 
 	if ms.transportType == TCP_TRANSPORT {
 		// close the server socket if we're listening over TCP
@@ -202,22 +636,109 @@ func (ms *ModbusServer) Stop() (err error) {
 		}
 	}
 
+	if ms.transportType == RTU_TRANSPORT {
+		// close the serial port
+		err	= ms.rtuTransport.Close()
+	}
+
+	return
+}
+
+// Gracefully stops the server: stops accepting new client connections and
+// new requests, waits for in-flight requests to complete, then closes all
+// active sessions.
+// The wait is bounded by both ctx and the ShutdownTimeout configuration
+// setting, whichever expires first. Once expired, active sessions are closed
+// regardless and the context error is returned.
+func (ms *ModbusServer) Shutdown(ctx context.Context) (err error) {
+	var cancel		context.CancelFunc
+	var ticker		*time.Ticker
+	var inFlight		uint
+	var shutdownTimeout	time.Duration
+
+	ms.lock.Lock()
+	ms.stopConfigWatch()
+
+	if !ms.started {
+		ms.lock.Unlock()
+		return
+	}
+
+	ms.started	= false
+	ms.readyCh	= make(chan struct{})
+	ms.shuttingDown	= true
+
+	if ms.transportType == TCP_TRANSPORT {
+		// stop accepting new client connections
+		err	= ms.tcpListener.Close()
+	}
+	// may be changed by a configuration reload (see WatchFile())
+	shutdownTimeout	= ms.conf.ShutdownTimeout
+	ms.lock.Unlock()
+
+	ctx, cancel	= context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	// wait for in-flight requests to complete
+	ticker	= time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for inFlight = ms.inFlightRequests(); inFlight > 0; inFlight = ms.inFlightRequests() {
+		select {
+		case <-ctx.Done():
+			ms.logger.Warningf("shutdown timed out with %v request(s) in flight",
+					   inFlight)
+			err	= ctx.Err()
+		case <-ticker.C:
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	ms.lock.Lock()
+	// cancel requests still in flight
+	if ms.cancel != nil {
+		ms.cancel()
+	}
+
+	// close all active TCP clients
+	for _, sock := range ms.tcpClients {
+		sock.Close()
+	}
+
+	// close the serial port
+	if ms.transportType == RTU_TRANSPORT {
+		ms.rtuTransport.Close()
+	}
+	ms.lock.Unlock()
+
 	return
 }
 
 // Accepts new client connections if the configured connection limit allows it.
 // Each connection is served from a dedicated goroutine to allow for concurrent
 // connections.
-func (ms *ModbusServer) acceptTCPClients() {
+func (ms *ModbusServer) acceptTCPClients(l net.Listener, ready chan struct{}) {
 	var sock	net.Conn
 	var err		error
 	var accepted	bool
+	var count	int
+	var stopped	bool
+
+	close(ready)
 
 	for {
-		sock, err = ms.tcpListener.Accept()
+		sock, err = l.Accept()
 		if err != nil {
-			// if the server has just been stopped, return here
-			if !ms.started {
+			// if the server has just been stopped (and possibly
+			// restarted on another listener since), return here
+			ms.lock.Lock()
+			stopped	= !ms.started || ms.tcpListener != l
+			ms.lock.Unlock()
+
+			if stopped {
 				return
 			}
 			ms.logger.Warningf("failed to accept client connection: %v", err)
@@ -233,9 +754,11 @@ func (ms *ModbusServer) acceptTCPClients() {
 		} else {
 			accepted	= false
 		}
+		count	= len(ms.tcpClients)
 		ms.lock.Unlock()
 
 		if accepted {
+			ms.recordActiveConnections(count)
 			// spin a client handler goroutine to serve the new client
 			go ms.handleTCPClient(sock)
 		} else {
@@ -254,14 +777,116 @@ func (ms *ModbusServer) acceptTCPClients() {
 // out, or an unrecoverable error happened), the TCP socket is closed and removed
 // from the list of active client connections.
 func (ms *ModbusServer) handleTCPClient(sock net.Conn) {
-	var tt	*tcpTransport
+	var t		transport
+	var link	net.Conn
+	var rt		*rtuTransport
+	var rl		*requestLogger
+	var timeout	time.Duration
+	var cm		MetricsCollector
+	var dw		*disconnectWatcher
+	var tap		*aduTap
+	var info	*RequestInfo
+	var connected	= time.Now()
+
+	ms.lock.Lock()
+	timeout	= ms.conf.Timeout
+	rl	= ms.requestLogger
+	cm	= ms.conf.ConnectionTimingMetrics
+	ms.lock.Unlock()
+
+	if cm == nil {
+		cm	= ms.metrics
+	}
+
+	// authenticate TLS clients before serving any request
+	if !ms.handshakeTLSClient(sock, timeout) {
+		ms.removeTCPClient(sock)
+		return
+	}
+
+	// create a new transport, counting traffic if metrics are enabled
+	link	= sock
+	if ms.metrics != nil {
+		link	= &countingConn{Conn: sock, metrics: ms.metrics}
+	}
+
+	// cancel requests in progress if the client goes away
+	dw	= newDisconnectWatcher(link)
+	link	= dw
+
+	// record traffic if frames are to be dumped
+	if ms.conf.DumpFrames {
+		tap	= &aduTap{}
+		link	= &tappedConn{Conn: link, tap: tap}
+	}
+
+	if ms.rtuOverTCP {
+		// frames are expected to arrive in one go over TCP, use the
+		// session timeout to close idle connections
+		rt	= newRTUTransport(link, sock.RemoteAddr().String(),
+					  ms.conf.Speed, rtuOverTCPFrameTimeout)
+		rt.idleTimeout	= timeout
+		t	= rt
+	} else {
+		t	= newTCPTransport(link, timeout)
+	}
+	setTransportLogger(t, ms.logger.out)
+
+	info	= ms.tcpRequestInfo(sock)
+	if tap != nil {
+		t	= newFrameDumpTransport(t, tap, ms.logger, info.Transport)
+	}
+
+	// tag requests with the role of TLS clients
+	if ms.tlsConfig != nil {
+		var role	= TLSClientRole(sock)
+
+		t = NewInterceptingTransport(t, TransportInterceptor{
+			OnReadRequest:	func(req *pdu, err error) (*pdu, error) {
+				if req != nil {
+					req.clientRole	= role
+				}
+				return req, err
+			},
+		})
+	}
+
+	// wrap it into a logging transport if request logging is enabled
+	if rl != nil {
+		t = newLoggingTransport(t, rl, sock.RemoteAddr().String())
+	}
+
+	// time the first request if connection metrics are enabled
+	if cm != nil {
+		var firstByte	bool
+
+		t = NewInterceptingTransport(t, TransportInterceptor{
+			OnReadRequest:	func(req *pdu, err error) (*pdu, error) {
+				if err == nil && !firstByte {
+					firstByte	= true
+					cm.RecordConnection(CONNECTION_FIRST_BYTE,
+							    time.Since(connected))
+				}
+				return req, err
+			},
+		})
+	}
+
+	ms.serveTransport(t, dw, info)
 
-	// create a new transport
-	tt = newTCPTransport(sock, ms.conf.Timeout)
+	ms.removeTCPClient(sock)
 
-	ms.handleTransport(tt)
+	if cm != nil {
+		cm.RecordConnection(CONNECTION_LIFETIME, time.Since(connected))
+	}
+
+	return
+}
+
+// Removes sock from the list of active client connections and closes it.
+func (ms *ModbusServer) removeTCPClient(sock net.Conn) {
+	var count	int
 
-	// once done, remove our connection from the list of active client conns
 	ms.lock.Lock()
 	for i := range ms.tcpClients {
 		if ms.tcpClients[i] == sock {
@@ -270,8 +895,11 @@ func (ms *ModbusServer) handleTCPClient(sock net.Conn) {
 			break
 		}
 	}
+	count	= len(ms.tcpClients)
 	ms.lock.Unlock()
 
+	ms.recordActiveConnections(count)
+
 	// close the connection
 	sock.Close()
 
@@ -282,389 +910,838 @@ func (ms *ModbusServer) handleTCPClient(sock net.Conn) {
 // calls the user-provided handler, then encodes and writes the response
 // to the transport.
 func (ms *ModbusServer) handleTransport(t transport) {
+	var rl	*requestLogger
+
+	ms.lock.Lock()
+	rl	= ms.requestLogger
+	ms.lock.Unlock()
+
+	// wrap it into a logging transport if request logging is enabled,
+	// using the serial device as remote address
+	if rl != nil {
+		t = newLoggingTransport(t, rl, ms.conf.URL)
+	}
+
+	ms.serveTransport(t, nil, ms.serialRequestInfo())
+
+	return
+}
+
+// Serves requests read from t (see handleTransport()), attaching client
+// information conn to their context. If dw is not nil, requests in progress
+// are canceled when the client disconnects.
+func (ms *ModbusServer) serveTransport(t transport, dw *disconnectWatcher, conn *RequestInfo) {
 	var req		*pdu
 	var res		*pdu
 	var err		error
-	var addr	uint16
-	var quantity	uint16
+
+	var broadcast	bool
+	var start	time.Time
+	var parent	context.Context
+	var cancel	context.CancelFunc
+	var stopWatch	func()
+
+	parent	= ms.serverContext()
 
 	for {
 		req, err = t.ReadRequest()
 		if err != nil {
+			// keep serving requests over serial links after framing
+			// errors
+			if ms.transportType == RTU_TRANSPORT &&
+			   (err == ErrBadCRC || err == ErrShortFrame || err == ErrProtocolError) {
+				ms.logger.Warningf("dropping malformed frame: %v", err)
+				ms.recordFrameError(err)
+				if err == ErrBadCRC {
+					atomic.AddUint32(&ms.diag.busCommErrors, 1)
+				}
+				continue
+			}
 			return
 		}
-
-		switch req.functionCode {
-		case FC_READ_COILS, FC_READ_DISCRETE_INPUTS:
-			var coils	[]bool
-			var resCount	int
-
-			if len(req.payload) != 4 {
-				err = ErrProtocolError
-				break
+		atomic.AddUint32(&ms.diag.busMessages, 1)
+
+		// on serial links, ignore requests to other devices and
+		// never answer broadcasts
+		broadcast	= false
+		if ms.transportType == RTU_TRANSPORT {
+			if !ms.acceptsUnitId(req.unitId) {
+				continue
 			}
+			broadcast	= unitIdIn(req.unitId, ms.conf.BroadcastUnitIds)
+		}
+		atomic.AddUint32(&ms.diag.serverMessages, 1)
+		ms.commEvents.recordReceive(req.unitId, broadcast)
 
-			// decode address and quantity fields
-			addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
-			quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		// hold the request while the server is paused
+		if !ms.waitWhilePaused() {
+			return
+		}
 
-			// ensure the reply never exceeds the maximum PDU length and we
-			// never read past 0xffff
-			if quantity > 2000 || quantity == 0 {
-				err	= ErrProtocolError
-				break
-			}
-			if uint32(addr) + uint32(quantity) - 1 > 0xffff {
-				err	= ErrIllegalDataAddress
-				break
-			}
+		// drop the request if the server is shutting down
+		if !ms.beginRequest() {
+			return
+		}
 
-			// invoke the appropriate handler
-			if req.functionCode == FC_READ_COILS {
-				coils, err	= ms.handler.HandleCoils(
-					req.unitId,
-					addr, quantity,
-					false, nil)
-			} else {
-				coils, err	= ms.handler.HandleDiscreteInputs(
-					req.unitId, addr, quantity)
-			}
-			resCount	= len(coils)
-
-			// make sure the handler returned the expected number of items
-			if err == nil && resCount != int(quantity) {
-				ms.logger.Errorf("handler returned %v bools, " +
-					         "expected %v", resCount, quantity)
-				err = ErrServerDeviceFailure
-				break
-			}
+		req.ctx, cancel	= context.WithCancel(
+			withRequestInfo(parent, conn, req.unitId, broadcast))
+		if dw != nil {
+			stopWatch	= dw.watch(cancel)
+		}
 
-			if err != nil {
-				break
-			}
+		// decode the request and call the handler through middlewares,
+		// bounded by the SLA timeout if any
+		start	= time.Now()
+		res, err	= ms.dispatchRequest(req)
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-				payload:	[]byte{0},
-			}
+		if dw != nil {
+			stopWatch()
+		}
+		cancel()
 
-			// byte count (1 byte for 8 coils)
-			res.payload[0]	= uint8(resCount / 8)
-			if resCount % 8 != 0 {
-				res.payload[0]++
-			}
+		ms.recordRequest()
+		if ms.metrics != nil {
+			ms.metrics.RecordRequest(req.unitId, req.functionCode,
+						 time.Since(start), err)
+		}
 
-			// coil values
-			res.payload	= append(res.payload, encodeBools(coils)...)
+		// if there was no error processing the request but the response is nil
+		// (which should never happen), emit a server failure exception code
+		// and log an error
+		if err == nil && res == nil {
+			err = ErrServerDeviceFailure
+			ms.logger.Errorf("internal server error (req: %v, res: %v, err: %v)",
+					 req, res, err)
+		}
 
-		case FC_WRITE_SINGLE_COIL:
-			if len(req.payload) != 4 {
-				err = ErrProtocolError
-				break
+		// map go errors to modbus errors, unless the error is a protocol error,
+		// in which case close the transport and return.
+		if err != nil {
+			if err == ErrProtocolError && ms.transportType == RTU_TRANSPORT {
+				// serial links are shared, drop the request but keep
+				// the link open
+				ms.logger.Warningf("protocol error, dropping request")
+				ms.endRequest()
+				continue
+			} else if err == ErrProtocolError {
+				ms.logger.Warningf("protocol error, closing link")
+				t.Close()
+				ms.endRequest()
+				return
+			} else {
+				res = &pdu{
+					unitId:		req.unitId,
+					functionCode:	(0x80 | req.functionCode),
+					payload:	[]byte{mapErrorToExceptionCode(err)},
+				}
 			}
+		}
 
-			// decode the address field
-			addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		ms.commEvents.recordCompletion(req, res, !broadcast)
 
-			// validate the value field (should be either 0xff00 or 0x0000)
-			if ((req.payload[2] != 0xff && req.payload[2] != 0x00) ||
-			    req.payload[3] != 0x00) {
-				err = ErrProtocolError
-				break
-			}
+		// broadcast requests are processed but never answered
+		if broadcast {
+			atomic.AddUint32(&ms.diag.serverNoResponses, 1)
+			ms.endRequest()
+			continue
+		}
 
-			// invoke the coil handler
-			_, err	= ms.handler.HandleCoils(
-				req.unitId,
-				addr, 1,	// quantity is 1
-				true,		// this is a write request
-				[]bool{(req.payload[2] == 0xff)})
+		if res.functionCode & 0x80 != 0 {
+			atomic.AddUint32(&ms.diag.busExceptionErrors, 1)
+		}
 
-			if err != nil {
-				break
-			}
+		// write the response to the transport
+		err	= t.WriteResponse(res)
+		if err != nil {
+			ms.logger.Warningf("failed to write response: %v", err)
+		}
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-			}
+		// report slow responses once the client has its answer
+		if ms.conf.MaxResponseLatency > 0 && ms.conf.OnSLABreach != nil &&
+		   time.Since(start) > ms.conf.MaxResponseLatency {
+			ms.conf.OnSLABreach(req.unitId, req.functionCode, time.Since(start))
+		}
 
-			// echo the address and value in the response
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, addr)...)
-			res.payload	= append(res.payload,
-						 req.payload[2], req.payload[3])
+		ms.endRequest()
 
-		case FC_WRITE_MULTIPLE_COILS:
-			var expectedLen	int
+		// avoid holding on to stale data
+		req	= nil
+		res	= nil
+	}
 
-			if len(req.payload) < 6 {
-				err = ErrProtocolError
-				break
-			}
+	return
+}
 
-			// decode address and quantity fields
-			addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
-			quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+// Decodes and validates a request, calls the user-provided handler and
+// encodes its response.
+func (ms *ModbusServer) processRequest(req *pdu) (res *pdu, err error) {
+	var addr	uint16
+	var quantity	uint16
+	var custom	FunctionHandler
+	var handler	ContextRequestHandler
+	var ctx		context.Context
 
-			// ensure the reply never exceeds the maximum PDU length and we
-			// never read past 0xffff
-			if quantity > 0x7b0 || quantity == 0 {
-				err	= ErrProtocolError
-				break
-			}
-			if uint32(addr) + uint32(quantity) - 1 > 0xffff {
-				err	= ErrIllegalDataAddress
-				break
-			}
+	// enforce role based authorization of TLS clients
+	err	= ms.authorizeRequest(req)
+	if err != nil {
+		return
+	}
 
-			// validate the byte count field (1 byte for 8 coils)
-			expectedLen	= int(quantity) / 8
-			if quantity % 8 != 0 {
-				expectedLen++
-			}
+	// custom function handlers take precedence over built-in ones
+	custom	= ms.functionHandler(req.functionCode)
+	if custom != nil {
+		res, err	= ms.processCustomFunction(custom, req)
+		return
+	}
 
-			if req.payload[4] != uint8(expectedLen) {
-				err	= ErrProtocolError
-				break
-			}
+	handler	= ms.contextHandler()
+	ctx	= requestContext(req)
 
-			// make sure we have enough bytes
-			if len(req.payload) - 5 != expectedLen {
-				err	= ErrProtocolError
-				break
-			}
+	switch req.functionCode {
+	case FC_READ_COILS, FC_READ_DISCRETE_INPUTS:
+		var coils	[]bool
+		var resCount	int
+
+		if len(req.payload) != 4 {
+			err = ErrProtocolError
+			break
+		}
+
+		// decode address and quantity fields
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
 
-			// invoke the coil handler
-			_, err		= ms.handler.HandleCoils(
+		// ensure the reply never exceeds the maximum PDU length and we
+		// never read past 0xffff
+		if quantity > 2000 || quantity == 0 {
+			err	= ErrProtocolError
+			break
+		}
+		if uint32(addr) + uint32(quantity) - 1 > 0xffff {
+			err	= ErrIllegalDataAddress
+			break
+		}
+
+		// invoke the appropriate handler
+		if req.functionCode == FC_READ_COILS {
+			coils, err	= handler.HandleCoilsContext(ctx,
 				req.unitId,
 				addr, quantity,
-				true,		// this is a write request
-				decodeBools(quantity, req.payload[5:]))
+				false, nil)
+		} else {
+			coils, err	= handler.HandleDiscreteInputsContext(ctx,
+				req.unitId, addr, quantity)
+		}
+		resCount	= len(coils)
 
-			if err != nil {
-				break
-			}
+		// make sure the handler returned the expected number of items
+		if err == nil && resCount != int(quantity) {
+			ms.logger.Errorf("handler returned %v bools, " +
+				         "expected %v", resCount, quantity)
+			err = ErrServerDeviceFailure
+			break
+		}
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-			}
+		if err != nil {
+			break
+		}
 
-			// echo the address and quantity in the response
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, addr)...)
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, quantity)...)
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+			payload:	[]byte{0},
+		}
 
-		case FC_READ_HOLDING_REGISTERS, FC_READ_INPUT_REGISTERS:
-			var regs	[]uint16
-			var resCount	int
+		// byte count (1 byte for 8 coils)
+		res.payload[0]	= uint8(resCount / 8)
+		if resCount % 8 != 0 {
+			res.payload[0]++
+		}
 
-			if len(req.payload) != 4 {
-				err = ErrProtocolError
-				break
-			}
+		// coil values
+		res.payload	= append(res.payload, encodeBools(coils)...)
+
+	case FC_WRITE_SINGLE_COIL:
+		if len(req.payload) != 4 {
+			err = ErrProtocolError
+			break
+		}
 
-			// decode address and quantity fields
-			addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
-			quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		// decode the address field
+		addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
 
-			// ensure the reply never exceeds the maximum PDU length and we
-			// never read past 0xffff
-			if quantity > 0x007d || quantity == 0 {
-				err	= ErrProtocolError
-				break
-			}
-			if uint32(addr) + uint32(quantity) - 1 > 0xffff {
-				err	= ErrIllegalDataAddress
-				break
-			}
+		// validate the value field (should be either 0xff00 or 0x0000)
+		if ((req.payload[2] != 0xff && req.payload[2] != 0x00) ||
+		    req.payload[3] != 0x00) {
+			err = ErrProtocolError
+			break
+		}
 
-			// invoke the appropriate handler
-			if req.functionCode == FC_READ_HOLDING_REGISTERS {
-				regs, err	= ms.handler.HandleHoldingRegisters(
-					req.unitId,
-					addr, quantity,
-					false, nil)
-			} else {
-				regs, err	= ms.handler.HandleInputRegisters(
-					req.unitId, addr, quantity)
-			}
-			resCount	= len(regs)
-
-			// make sure the handler returned the expected number of items
-			if err == nil && resCount != int(quantity) {
-				ms.logger.Errorf("handler returned %v 16-bit values, " +
-					         "expected %v", resCount, quantity)
-				err = ErrServerDeviceFailure
-				break
-			}
+		// invoke the coil handler
+		_, err	= handler.HandleCoilsContext(ctx,
+			req.unitId,
+			addr, 1,	// quantity is 1
+			true,		// this is a write request
+			[]bool{(req.payload[2] == 0xff)})
 
-			if err != nil {
-				break
-			}
+		if err != nil {
+			break
+		}
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-				payload:	[]byte{0},
-			}
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+		}
 
-			// byte count (2 bytes per register)
-			res.payload[0]	= uint8(resCount * 2)
+		// echo the address and value in the response
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, addr)...)
+		res.payload	= append(res.payload,
+					 req.payload[2], req.payload[3])
 
-			// register values
-			res.payload	= append(res.payload,
-						 uint16sToBytes(BIG_ENDIAN, regs)...)
+	case FC_WRITE_MULTIPLE_COILS:
+		var expectedLen	int
 
-		case FC_WRITE_SINGLE_REGISTER:
-			var value	uint16
+		if len(req.payload) < 6 {
+			err = ErrProtocolError
+			break
+		}
 
-			if len(req.payload) != 4 {
-				err = ErrProtocolError
-				break
-			}
+		// decode address and quantity fields
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
 
-			// decode address and value fields
-			addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
-			value	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		// ensure the reply never exceeds the maximum PDU length and we
+		// never read past 0xffff
+		if quantity > 0x7b0 || quantity == 0 {
+			err	= ErrProtocolError
+			break
+		}
+		if uint32(addr) + uint32(quantity) - 1 > 0xffff {
+			err	= ErrIllegalDataAddress
+			break
+		}
 
-			// invoke the handler
-			_, err	= ms.handler.HandleHoldingRegisters(
-				req.unitId,
-				addr, 1,	// quantity is 1
-				true,		// this is a write request
-				[]uint16{value})
+		// validate the byte count field (1 byte for 8 coils)
+		expectedLen	= int(quantity) / 8
+		if quantity % 8 != 0 {
+			expectedLen++
+		}
 
-			if err != nil {
-				break
-			}
+		if req.payload[4] != uint8(expectedLen) {
+			err	= ErrProtocolError
+			break
+		}
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-			}
+		// make sure we have enough bytes
+		if len(req.payload) - 5 != expectedLen {
+			err	= ErrProtocolError
+			break
+		}
 
-			// echo the address and value in the response
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, addr)...)
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, value)...)
+		// invoke the coil handler
+		_, err		= handler.HandleCoilsContext(ctx,
+			req.unitId,
+			addr, quantity,
+			true,		// this is a write request
+			decodeBools(quantity, req.payload[5:]))
 
-		case FC_WRITE_MULTIPLE_REGISTERS:
-			var expectedLen	int
+		if err != nil {
+			break
+		}
 
-			if len(req.payload) < 6 {
-				err = ErrProtocolError
-				break
-			}
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+		}
 
-			// decode address and quantity fields
-			addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
-			quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		// echo the address and quantity in the response
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, addr)...)
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, quantity)...)
 
-			// ensure the reply never exceeds the maximum PDU length and we
-			// never read past 0xffff
-			if quantity > 0x007b || quantity == 0 {
-				err	= ErrProtocolError
-				break
-			}
-			if uint32(addr) + uint32(quantity) - 1 > 0xffff {
-				err	= ErrIllegalDataAddress
-				break
-			}
+	case FC_READ_HOLDING_REGISTERS, FC_READ_INPUT_REGISTERS:
+		var regs	[]uint16
+		var resCount	int
 
-			// validate the byte count field (2 bytes per register)
-			expectedLen	= int(quantity) * 2
+		if len(req.payload) != 4 {
+			err = ErrProtocolError
+			break
+		}
 
-			if req.payload[4] != uint8(expectedLen) {
-				err	= ErrProtocolError
-				break
-			}
+		// decode address and quantity fields
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
 
-			// make sure we have enough bytes
-			if len(req.payload) - 5 != expectedLen {
-				err	= ErrProtocolError
-				break
-			}
+		// ensure the reply never exceeds the maximum PDU length and we
+		// never read past 0xffff
+		if quantity > 0x007d || quantity == 0 {
+			err	= ErrProtocolError
+			break
+		}
+		if uint32(addr) + uint32(quantity) - 1 > 0xffff {
+			err	= ErrIllegalDataAddress
+			break
+		}
 
-			// invoke the holding register handler
-			_, err		= ms.handler.HandleHoldingRegisters(
+		// invoke the appropriate handler
+		if req.functionCode == FC_READ_HOLDING_REGISTERS {
+			regs, err	= handler.HandleHoldingRegistersContext(ctx,
 				req.unitId,
 				addr, quantity,
-				true,		// this is a write request
-				bytesToUint16s(BIG_ENDIAN, req.payload[5:]))
+				false, nil)
+		} else {
+			regs, err	= handler.HandleInputRegistersContext(ctx,
+				req.unitId, addr, quantity)
+		}
+		resCount	= len(regs)
 
-			if err != nil {
-				break
-			}
+		// make sure the handler returned the expected number of items
+		if err == nil && resCount != int(quantity) {
+			ms.logger.Errorf("handler returned %v 16-bit values, " +
+				         "expected %v", resCount, quantity)
+			err = ErrServerDeviceFailure
+			break
+		}
 
-			// assemble a response PDU
-			res = &pdu{
-				unitId:		req.unitId,
-				functionCode:	req.functionCode,
-			}
+		if err != nil {
+			break
+		}
 
-			// echo the address and quantity in the response
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, addr)...)
-			res.payload	= append(res.payload,
-						 uint16ToBytes(BIG_ENDIAN, quantity)...)
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+			payload:	[]byte{0},
+		}
 
-		default:
-			res = &pdu{
-				// reply with the request target unit ID
-				unitId:		req.unitId,
-				// set the error bit
-				functionCode:	(0x80 | req.functionCode),
-				// set the exception code to illegal function to indicate that
-				// the server does not know how to handle this function code.
-				payload:	[]byte{EX_ILLEGAL_FUNCTION},
-			}
+		// byte count (2 bytes per register)
+		res.payload[0]	= uint8(resCount * 2)
+
+		// register values
+		res.payload	= append(res.payload,
+					 uint16sToBytes(BIG_ENDIAN, regs)...)
+
+	case FC_WRITE_SINGLE_REGISTER:
+		var value	uint16
+
+		if len(req.payload) != 4 {
+			err = ErrProtocolError
+			break
 		}
 
-		// if there was no error processing the request but the response is nil
-		// (which should never happen), emit a server failure exception code
-		// and log an error
-		if err == nil && res == nil {
+		// decode address and value fields
+		addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		value	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+
+		// invoke the handler
+		_, err	= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			addr, 1,	// quantity is 1
+			true,		// this is a write request
+			[]uint16{value})
+
+		if err != nil {
+			break
+		}
+
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+		}
+
+		// echo the address and value in the response
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, addr)...)
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, value)...)
+
+	case FC_MASK_WRITE_REGISTER:
+		var andMask	uint16
+		var orMask	uint16
+		var regs	[]uint16
+
+		if len(req.payload) != 6 {
+			err = ErrProtocolError
+			break
+		}
+
+		// decode address and mask fields
+		addr	= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		andMask	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		orMask	= bytesToUint16(BIG_ENDIAN, req.payload[4:6])
+
+		// read the current value of the register
+		regs, err	= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			addr, 1,	// quantity is 1
+			false,		// this is a read request
+			nil)
+
+		if err != nil {
+			break
+		}
+
+		if len(regs) != 1 {
+			ms.logger.Errorf("handler returned %v 16-bit values, " +
+				         "expected 1", len(regs))
 			err = ErrServerDeviceFailure
-			ms.logger.Errorf("internal server error (req: %v, res: %v, err: %v)",
-					 req, res, err)
+			break
 		}
 
-		// map go errors to modbus errors, unless the error is a protocol error,
-		// in which case close the transport and return.
+		// apply the masks and write the result back
+		_, err	= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			addr, 1,	// quantity is 1
+			true,		// this is a write request
+			[]uint16{(regs[0] & andMask) | (orMask & ^andMask)})
+
 		if err != nil {
-			if err == ErrProtocolError {
-				ms.logger.Warningf("protocol error, closing link")
-				t.Close()
-				return
-			} else {
-				res = &pdu{
-					unitId:		req.unitId,
-					functionCode:	(0x80 | req.functionCode),
-					payload:	[]byte{mapErrorToExceptionCode(err)},
-				}
-			}
+			break
 		}
 
-		// write the response to the transport
-		err	= t.WriteResponse(res)
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+		}
+
+		// echo the address and both masks in the response
+		res.payload	= append(res.payload, req.payload[0:6]...)
+
+	case FC_WRITE_MULTIPLE_REGISTERS:
+		var expectedLen	int
+
+		if len(req.payload) < 6 {
+			err = ErrProtocolError
+			break
+		}
+
+		// decode address and quantity fields
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+
+		// ensure the reply never exceeds the maximum PDU length and we
+		// never read past 0xffff
+		if quantity > 0x007b || quantity == 0 {
+			err	= ErrProtocolError
+			break
+		}
+		if uint32(addr) + uint32(quantity) - 1 > 0xffff {
+			err	= ErrIllegalDataAddress
+			break
+		}
+
+		// validate the byte count field (2 bytes per register)
+		expectedLen	= int(quantity) * 2
+
+		if req.payload[4] != uint8(expectedLen) {
+			err	= ErrProtocolError
+			break
+		}
+
+		// make sure we have enough bytes
+		if len(req.payload) - 5 != expectedLen {
+			err	= ErrProtocolError
+			break
+		}
+
+		// invoke the holding register handler
+		_, err		= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			addr, quantity,
+			true,		// this is a write request
+			bytesToUint16s(BIG_ENDIAN, req.payload[5:]))
+
 		if err != nil {
-			ms.logger.Warningf("failed to write response: %v", err)
+			break
 		}
 
-		// avoid holding on to stale data
-		req	= nil
-		res	= nil
+		// assemble a response PDU
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+		}
+
+		// echo the address and quantity in the response
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, addr)...)
+		res.payload	= append(res.payload,
+					 uint16ToBytes(BIG_ENDIAN, quantity)...)
+
+	case FC_READ_WRITE_MULTILE_REGISTERS:
+		var writeAddr		uint16
+		var writeQuantity	uint16
+		var regs		[]uint16
+
+		if len(req.payload) < 9 {
+			err = ErrProtocolError
+			break
+		}
+
+		// decode read address, read quantity, write address and
+		// write quantity fields
+		addr		= bytesToUint16(BIG_ENDIAN, req.payload[0:2])
+		quantity	= bytesToUint16(BIG_ENDIAN, req.payload[2:4])
+		writeAddr	= bytesToUint16(BIG_ENDIAN, req.payload[4:6])
+		writeQuantity	= bytesToUint16(BIG_ENDIAN, req.payload[6:8])
+
+		// ensure the reply never exceeds the maximum PDU length and we
+		// never read or write past 0xffff
+		if quantity > 0x007d || quantity == 0 ||
+		   writeQuantity > 0x0079 || writeQuantity == 0 {
+			err	= ErrProtocolError
+			break
+		}
+		if uint32(addr) + uint32(quantity) - 1 > 0xffff ||
+		   uint32(writeAddr) + uint32(writeQuantity) - 1 > 0xffff {
+			err	= ErrIllegalDataAddress
+			break
+		}
+
+		// validate the byte count field (2 bytes per register) and
+		// make sure we have enough bytes
+		if req.payload[8] != uint8(writeQuantity * 2) ||
+		   len(req.payload) - 9 != int(writeQuantity) * 2 {
+			err	= ErrProtocolError
+			break
+		}
+
+		// the write operation is performed before the read
+		_, err		= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			writeAddr, writeQuantity,
+			true,		// this is a write request
+			bytesToUint16s(BIG_ENDIAN, req.payload[9:]))
+		if err != nil {
+			break
+		}
+
+		regs, err	= handler.HandleHoldingRegistersContext(ctx,
+			req.unitId,
+			addr, quantity,
+			false, nil)
+
+		// make sure the handler returned the expected number of items
+		if err == nil && len(regs) != int(quantity) {
+			ms.logger.Errorf("handler returned %v 16-bit values, " +
+				         "expected %v", len(regs), quantity)
+			err = ErrServerDeviceFailure
+			break
+		}
+
+		if err != nil {
+			break
+		}
+
+		// assemble a response PDU, with a byte count (2 bytes per
+		// register) and register values
+		res = &pdu{
+			unitId:		req.unitId,
+			functionCode:	req.functionCode,
+			payload:	[]byte{uint8(len(regs) * 2)},
+		}
+		res.payload	= append(res.payload,
+					 uint16sToBytes(BIG_ENDIAN, regs)...)
+
+	case FC_READ_DEVICE_IDENTIFICATION:
+		res, err	= ms.processDeviceIdentification(req)
+
+	case FC_READ_FIFO_QUEUE:
+		res, err	= ms.processFIFOQueue(req)
+
+	case FC_READ_FILE_RECORD, FC_WRITE_FILE_RECORD:
+		res, err	= ms.processFileRecord(req)
+
+	case FC_READ_EXCEPTION_STATUS:
+		res, err	= ms.processExceptionStatus(req)
+
+	case FC_DIAGNOSTICS:
+		res, err	= ms.processDiagnostics(req)
+
+	case FC_GET_COMM_EVENT_COUNTER, FC_GET_COMM_EVENT_LOG:
+		res, err	= ms.processCommEvents(req)
+
+	case FC_REPORT_SERVER_ID:
+		res, err	= ms.processReportServerId(req)
+
+	default:
+		res = &pdu{
+			// reply with the request target unit ID
+			unitId:		req.unitId,
+			// set the error bit
+			functionCode:	(0x80 | req.functionCode),
+			// set the exception code to illegal function to indicate that
+			// the server does not know how to handle this function code.
+			payload:	[]byte{EX_ILLEGAL_FUNCTION},
+		}
+	}
+
+	return
+}
+
+// slaResult holds the outcome of a request processed by
+// processRequestWithSLA().
+type slaResult struct {
+	res	*pdu
+	err	error
+	elapsed	time.Duration
+}
+
+// Processes a request with process in a goroutine, waiting up to SLATimeout
+// for it to complete. Past that delay (or if the request is canceled first), a server
+// device failure exception is returned and the result of the handler is
+// discarded once it completes.
+// The context of the request carries the SLA deadline.
+func (ms *ModbusServer) processRequestWithSLA(req *pdu,
+					      process func(*pdu) (*pdu, error)) (res *pdu, err error) {
+	var done	chan slaResult
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var start	time.Time
+	var sr		slaResult
+
+	done	= make(chan slaResult, 1)
+	start	= time.Now()
+
+	ctx, cancel	= context.WithTimeout(requestContext(req), ms.conf.SLATimeout)
+	defer cancel()
+	req.ctx		= ctx
+
+	go func() {
+		var sr	slaResult
+
+		sr.res, sr.err	= process(req)
+		sr.elapsed	= time.Since(start)
+		done <- sr
+	}()
+
+	select {
+	case sr = <-done:
+		res, err	= sr.res, sr.err
+
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			ms.logger.Warningf("request (unit id: %v, fc: 0x%02x) exceeded the SLA " +
+					   "timeout of %v", req.unitId, req.functionCode,
+					   ms.conf.SLATimeout)
+		}
+		err	= ErrServerDeviceFailure
+
+		// log how long the handler eventually took
+		go func() {
+			sr := <-done
+			ms.logger.Warningf("late request (unit id: %v, fc: 0x%02x) completed " +
+					   "after %v, result discarded", req.unitId,
+					   req.functionCode, sr.elapsed)
+		}()
+	}
+
+	return
+}
+
+// Returns true if requests to unitId should be answered (RTU only).
+func (ms *ModbusServer) acceptsUnitId(unitId uint8) (ok bool) {
+	if ms.conf.IsAccepted != nil {
+		ok	= ms.conf.IsAccepted(unitId)
+		return
+	}
+
+	ok	= len(ms.conf.AcceptedUnitIds) == 0 ||
+		  unitIdIn(unitId, ms.conf.AcceptedUnitIds)
+
+	return
+}
+
+// Returns true if unitId is part of unitIds.
+func unitIdIn(unitId uint8, unitIds []uint8) (ok bool) {
+	for _, id := range unitIds {
+		if id == unitId {
+			ok	= true
+			return
+		}
 	}
 
 	return
 }
+
+// Pauses request processing: requests already being processed are completed,
+// then each client connection holds its next request until Resume() is
+// called.
+// Client connections are left open and new connections are still accepted.
+func (ms *ModbusServer) Pause() {
+	atomic.StoreUint32(&ms.paused, 1)
+	ms.logger.Info("paused")
+
+	return
+}
+
+// Resumes request processing after a call to Pause().
+func (ms *ModbusServer) Resume() {
+	atomic.StoreUint32(&ms.paused, 0)
+	ms.logger.Info("resumed")
+
+	return
+}
+
+// Blocks while the server is paused.
+// Returns false if the server was stopped in the meantime.
+func (ms *ModbusServer) waitWhilePaused() (ok bool) {
+	for atomic.LoadUint32(&ms.paused) == 1 {
+		ms.lock.Lock()
+		ok	= ms.started
+		ms.lock.Unlock()
+
+		if !ok {
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	ok	= true
+
+	return
+}
+
+// Registers the start of a request.
+// Returns false if the server is shutting down, in which case the request
+// should be dropped.
+func (ms *ModbusServer) beginRequest() (ok bool) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.shuttingDown {
+		return
+	}
+
+	ms.inFlight++
+	ok	= true
+
+	return
+}
+
+// Registers the end of a request.
+func (ms *ModbusServer) endRequest() {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.inFlight--
+
+	return
+}
+
+// Returns the number of requests currently being processed.
+func (ms *ModbusServer) inFlightRequests() (count uint) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	count	= ms.inFlight
+
+	return
+}
@@ -0,0 +1,114 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// ServerBuilder builds a modbus server step by step, as an alternative to
+// filling a ServerConfiguration for NewServer() (see NewServerBuilder()).
+type ServerBuilder struct {
+	conf		ServerConfiguration
+	handler		RequestHandler
+	logger		Logger
+	tlsConfig	*tls.Config
+}
+
+// Returns a new server builder for a server listening at url, e.g.
+//   ms, err := NewServerBuilder("tcp://[::]:502").
+//                  Timeout(30 * time.Second).
+//                  Handler(NewDataStore(0, 0, 100, 0)).
+//                  Build()
+// Options left unset take the defaults of NewServer().
+func NewServerBuilder(url string) (sb *ServerBuilder) {
+	sb	= &ServerBuilder{
+		conf:	ServerConfiguration{
+			URL:	url,
+		},
+	}
+
+	return
+}
+
+// Sets the idle session timeout (see ServerConfiguration.Timeout).
+func (sb *ServerBuilder) Timeout(d time.Duration) (self *ServerBuilder) {
+	sb.conf.Timeout	= d
+	self		= sb
+
+	return
+}
+
+// Sets the maximum number of concurrent client connections.
+func (sb *ServerBuilder) MaxClients(n uint) (self *ServerBuilder) {
+	sb.conf.MaxClients	= n
+	self			= sb
+
+	return
+}
+
+// Sets the unit ids to answer to (see ServerConfiguration.AcceptedUnitIds).
+func (sb *ServerBuilder) AcceptedUnitIds(ids ...uint8) (self *ServerBuilder) {
+	sb.conf.AcceptedUnitIds	= append([]uint8{}, ids...)
+	self			= sb
+
+	return
+}
+
+// Sets the request handler (required).
+func (sb *ServerBuilder) Handler(h RequestHandler) (self *ServerBuilder) {
+	sb.handler	= h
+	self		= sb
+
+	return
+}
+
+// Sets the logger the server writes its log lines to, instead of stdout.
+func (sb *ServerBuilder) Logger(l Logger) (self *ServerBuilder) {
+	sb.logger	= l
+	self		= sb
+
+	return
+}
+
+// Enables TLS on TCP servers, with c holding the server certificate(s).
+// c is cloned by Build().
+func (sb *ServerBuilder) TLS(c *tls.Config) (self *ServerBuilder) {
+	sb.tlsConfig	= c
+	self		= sb
+
+	return
+}
+
+// Returns a new modbus server built out of the options set so far.
+// Returns an error wrapping ErrConfigurationError if a required option is
+// missing or if options are inconsistent.
+func (sb *ServerBuilder) Build() (ms *ModbusServer, err error) {
+	if sb.handler == nil {
+		err	= fmt.Errorf("%w: no request handler set (see Handler())",
+				     ErrConfigurationError)
+		return
+	}
+
+	ms, err	= NewServer(&sb.conf, sb.handler)
+	if err != nil {
+		return
+	}
+
+	if sb.tlsConfig != nil {
+		if ms.transportType != TCP_TRANSPORT {
+			ms	= nil
+			err	= fmt.Errorf("%w: TLS is only supported over TCP",
+					     ErrConfigurationError)
+			return
+		}
+
+		ms.tlsConfig	= sb.tlsConfig.Clone()
+	}
+
+	if sb.logger != nil {
+		ms.logger.out	= sb.logger
+	}
+
+	return
+}
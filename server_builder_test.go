@@ -0,0 +1,77 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerBuilder(t *testing.T) {
+	var ms		*ModbusServer
+	var expected	*ModbusServer
+	var err		error
+	var ds		*DataStore
+	var rl		*recordingLogger
+	var tlsConf	*tls.Config
+
+	ds	= NewDataStore(0, 0, 10, 0)
+	rl	= &recordingLogger{}
+	tlsConf	= &tls.Config{ServerName: "test"}
+
+	ms, err	= NewServerBuilder("tcp://localhost:5539").
+			Timeout(30 * time.Second).
+			MaxClients(3).
+			AcceptedUnitIds(1, 2).
+			Handler(ds).
+			Logger(rl).
+			TLS(tlsConf).
+			Build()
+	if err != nil {
+		t.Fatalf("Build() should have succeeded, got: %v", err)
+	}
+
+	expected, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5539",
+		Timeout:	30 * time.Second,
+		MaxClients:	3,
+		AcceptedUnitIds: []uint8{1, 2},
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if !reflect.DeepEqual(ms.conf, expected.conf) {
+		t.Errorf("expected %+v, got: %+v", expected.conf, ms.conf)
+	}
+
+	if ms.handler != RequestHandler(ds) {
+		t.Errorf("unexpected handler: %v", ms.handler)
+	}
+
+	if ms.tlsConfig == nil || ms.tlsConfig == tlsConf || ms.tlsConfig.ServerName != "test" {
+		t.Errorf("expected a copy of the TLS config, got: %v", ms.tlsConfig)
+	}
+
+	// log lines should go to the configured logger
+	ms.logger.Warning("hello")
+	if len(rl.lines) != 1 || !strings.HasSuffix(rl.lines[0], "[warn]: hello") {
+		t.Errorf("unexpected log lines: %q", rl.lines)
+	}
+
+	// the handler is required
+	_, err	= NewServerBuilder("tcp://localhost:5539").Build()
+	if !errors.Is(err, ErrConfigurationError) || !strings.Contains(err.Error(), "handler") {
+		t.Errorf("expected a configuration error about the handler, got: %v", err)
+	}
+
+	// TLS is not supported over RTU
+	_, err	= NewServerBuilder("rtu:///dev/ttyUSB0").Handler(ds).TLS(tlsConf).Build()
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
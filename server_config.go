@@ -0,0 +1,359 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serverConfigFile is the on-disk (JSON) representation of a
+// ServerConfiguration object. Durations are expressed as strings
+// parsed by time.ParseDuration(), e.g. "30s".
+type serverConfigFile struct {
+	URL		string	`json:"url"`
+	Timeout		string	`json:"timeout"`
+	MaxClients	uint	`json:"maxClients"`
+	ShutdownTimeout	string	`json:"shutdownTimeout"`
+	SLATimeout	string	`json:"slaTimeout"`
+
+	// TLS only settings, as paths to PEM files (relative to the
+	// directory of the configuration file)
+	TLSCertFile	string	`json:"tlsCertFile"`
+	TLSKeyFile	string	`json:"tlsKeyFile"`
+	TLSClientCAFile	string	`json:"tlsClientCAFile"`
+	TLSOperatorRole	string	`json:"tlsOperatorRole"`
+
+	// RTU only settings
+	Speed		uint	`json:"speed"`
+	HighSpeedSerial	bool	`json:"highSpeedSerial"`
+	DataBits	uint	`json:"dataBits"`
+	Parity		string	`json:"parity"`	// none, even or odd
+	StopBits	uint	`json:"stopBits"`
+	// unit ids are decoded as []uint since []uint8 values are expected
+	// as base64 strings by encoding/json
+	AcceptedUnitIds	[]uint	`json:"acceptedUnitIds"`
+	BroadcastUnitIds []uint	`json:"broadcastUnitIds"`
+}
+
+// Returns a new modbus server configured from the JSON file at path, e.g.
+//   {
+//     "url":             "tcp+tls://[::]:802",
+//     "timeout":         "30s",
+//     "maxClients":      5,
+//     "shutdownTimeout": "10s",
+//     "slaTimeout":      "2s",
+//     "tlsCertFile":     "/etc/modbus/server.crt",
+//     "tlsKeyFile":      "/etc/modbus/server.key",
+//     "tlsClientCAFile": "/etc/modbus/clients-ca.crt",
+//     "tlsOperatorRole": "operator"
+//   }
+// or, for a serial server,
+//   {
+//     "url":              "rtu:///dev/ttyUSB0",
+//     "speed":            19200,
+//     "dataBits":         8,
+//     "parity":           "even",
+//     "stopBits":         1,
+//     "acceptedUnitIds":  [1, 2, 3],
+//     "broadcastUnitIds": [0]
+//   }
+// Omitted fields take the same defaults as with NewServer().
+// Settings holding functions or Go objects (OnSLABreach, IsAccepted,
+// OnTLSHandshakeError, MaxResponseLatency, EMAAlpha, Tracer, Logger,
+// metrics collectors...) cannot be set from a file: set them on the
+// returned server's configuration in code if needed, before Start().
+// YAML files are not supported.
+// Errors include path, whether the file is missing, malformed or
+// fails validation.
+func NewServerFromConfig(path string, handler RequestHandler) (ms *ModbusServer, err error) {
+	var conf	*ServerConfiguration
+
+	conf, err	= loadServerConfiguration(path)
+	if err != nil {
+		return
+	}
+
+	ms, err		= NewServer(conf, handler)
+	if err != nil {
+		err	= fmt.Errorf("%s: %w", path, err)
+		ms	= nil
+		return
+	}
+
+	ms.configPath	= path
+
+	return
+}
+
+// Watches the configuration file the server was created from (see
+// NewServerFromConfig()) for changes, checking its modification time every
+// interval.
+// On change, non-transport settings (Timeout, MaxClients and
+// ShutdownTimeout) are reloaded. Changes to other settings are ignored
+// until the server is re-created.
+// Watching stops when the server is stopped.
+func (ms *ModbusServer) WatchFile(interval time.Duration) (err error) {
+	var fi		os.FileInfo
+	var stopCh	chan struct{}
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.configPath == "" {
+		ms.logger.Error("server was not created from a configuration file")
+		err	= ErrConfigurationError
+		return
+	}
+
+	fi, err	= os.Stat(ms.configPath)
+	if err != nil {
+		return
+	}
+
+	// stop any previous watcher
+	ms.stopConfigWatch()
+
+	stopCh			= make(chan struct{})
+	ms.configWatchStop	= stopCh
+
+	go ms.watchConfig(interval, fi.ModTime(), stopCh)
+
+	return
+}
+
+// Polls the configuration file for changes until stopCh is closed.
+func (ms *ModbusServer) watchConfig(interval time.Duration, lastMod time.Time, stopCh chan struct{}) {
+	var ticker	*time.Ticker
+	var fi		os.FileInfo
+	var err		error
+
+	ticker	= time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		fi, err	= os.Stat(ms.configPath)
+		if err != nil {
+			ms.logger.Warningf("failed to stat configuration file: %v", err)
+			continue
+		}
+
+		if fi.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod	= fi.ModTime()
+
+		err	= ms.reloadConfig()
+		if err != nil {
+			ms.logger.Warningf("failed to reload configuration: %v", err)
+		}
+	}
+}
+
+// Stops the configuration file watcher, if any.
+// Must be called with ms.lock held.
+func (ms *ModbusServer) stopConfigWatch() {
+	if ms.configWatchStop != nil {
+		close(ms.configWatchStop)
+		ms.configWatchStop	= nil
+	}
+
+	return
+}
+
+// Reloads non-transport settings from the configuration file.
+func (ms *ModbusServer) reloadConfig() (err error) {
+	var conf	*ServerConfiguration
+
+	conf, err	= loadServerConfiguration(ms.configPath)
+	if err != nil {
+		return
+	}
+
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if conf.URL != "" && !strings.HasSuffix(conf.URL, "://" + ms.conf.URL) {
+		ms.logger.Warningf("ignoring url change to %s (requires a restart)", conf.URL)
+	}
+
+	if conf.Timeout != 0 {
+		ms.conf.Timeout		= conf.Timeout
+	}
+
+	if conf.MaxClients != 0 {
+		ms.conf.MaxClients	= conf.MaxClients
+	}
+
+	if conf.ShutdownTimeout != 0 {
+		ms.conf.ShutdownTimeout	= conf.ShutdownTimeout
+	}
+
+	ms.logger.Infof("reloaded configuration from %s", ms.configPath)
+
+	return
+}
+
+// Reads and decodes a server configuration file.
+func loadServerConfiguration(path string) (conf *ServerConfiguration, err error) {
+	var buf		[]byte
+	var cf		serverConfigFile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err	= fmt.Errorf("%s: YAML configuration files are not supported, " +
+				     "use JSON instead", path)
+		return
+	}
+
+	buf, err	= os.ReadFile(path)
+	if err != nil {
+		err	= fmt.Errorf("failed to read configuration file %s: %w", path, err)
+		return
+	}
+
+	err		= json.Unmarshal(buf, &cf)
+	if err != nil {
+		err	= fmt.Errorf("%s: malformed configuration: %w", path, err)
+		return
+	}
+
+	conf	= &ServerConfiguration{
+		URL:			cf.URL,
+		MaxClients:		cf.MaxClients,
+		TLSOperatorRole:	cf.TLSOperatorRole,
+		Speed:			cf.Speed,
+		HighSpeedSerial:	cf.HighSpeedSerial,
+		DataBits:		cf.DataBits,
+		StopBits:		cf.StopBits,
+	}
+
+	switch strings.ToLower(cf.Parity) {
+	case "", "none":	conf.Parity	= PARITY_NONE
+	case "even":		conf.Parity	= PARITY_EVEN
+	case "odd":		conf.Parity	= PARITY_ODD
+	default:
+		err	= fmt.Errorf("%s: invalid parity %q (expected none, even or odd)",
+				     path, cf.Parity)
+		return
+	}
+
+	conf.AcceptedUnitIds, err	= configUnitIds(path, "acceptedUnitIds", cf.AcceptedUnitIds)
+	if err != nil {
+		return
+	}
+
+	conf.BroadcastUnitIds, err	= configUnitIds(path, "broadcastUnitIds", cf.BroadcastUnitIds)
+	if err != nil {
+		return
+	}
+
+	err	= loadTLSConfigFiles(path, &cf, conf)
+	if err != nil {
+		return
+	}
+
+	if cf.Timeout != "" {
+		conf.Timeout, err	= time.ParseDuration(cf.Timeout)
+		if err != nil {
+			err	= fmt.Errorf("%s: invalid timeout: %w", path, err)
+			return
+		}
+	}
+
+	if cf.ShutdownTimeout != "" {
+		conf.ShutdownTimeout, err	= time.ParseDuration(cf.ShutdownTimeout)
+		if err != nil {
+			err	= fmt.Errorf("%s: invalid shutdownTimeout: %w", path, err)
+			return
+		}
+	}
+
+	if cf.SLATimeout != "" {
+		conf.SLATimeout, err	= time.ParseDuration(cf.SLATimeout)
+		if err != nil {
+			err	= fmt.Errorf("%s: invalid slaTimeout: %w", path, err)
+			return
+		}
+	}
+
+	return
+}
+
+// Converts the unit ids of setting name to []uint8, keeping nil (omitted)
+// and empty lists apart.
+func configUnitIds(path string, name string, ids []uint) (unitIds []uint8, err error) {
+	if ids == nil {
+		return
+	}
+
+	unitIds	= make([]uint8, 0, len(ids))
+	for _, id := range ids {
+		if id > 255 {
+			err	= fmt.Errorf("%s: invalid unit id %v in %s", path, id, name)
+			return
+		}
+		unitIds	= append(unitIds, uint8(id))
+	}
+
+	return
+}
+
+// Loads the server certificate, key and client CAs referenced by cf into
+// conf.
+func loadTLSConfigFiles(path string, cf *serverConfigFile, conf *ServerConfiguration) (err error) {
+	var cert	tls.Certificate
+	var buf		[]byte
+
+	if (cf.TLSCertFile == "") != (cf.TLSKeyFile == "") {
+		err	= fmt.Errorf("%s: tlsCertFile and tlsKeyFile must be set together", path)
+		return
+	}
+
+	if cf.TLSCertFile != "" {
+		cert, err	= tls.LoadX509KeyPair(configFilePath(path, cf.TLSCertFile),
+						  configFilePath(path, cf.TLSKeyFile))
+		if err != nil {
+			err	= fmt.Errorf("%s: failed to load server certificate: %w", path, err)
+			return
+		}
+		conf.TLSServerCert	= &cert
+	}
+
+	if cf.TLSClientCAFile != "" {
+		buf, err	= os.ReadFile(configFilePath(path, cf.TLSClientCAFile))
+		if err != nil {
+			err	= fmt.Errorf("%s: failed to read client CAs: %w", path, err)
+			return
+		}
+
+		conf.TLSClientCAs	= x509.NewCertPool()
+		if !conf.TLSClientCAs.AppendCertsFromPEM(buf) {
+			err	= fmt.Errorf("%s: no certificate found in %s", path, cf.TLSClientCAFile)
+			return
+		}
+	}
+
+	return
+}
+
+// Returns file, relative to the directory of the configuration file at path
+// unless absolute.
+func configFilePath(path string, file string) (p string) {
+	p	= file
+	if !filepath.IsAbs(p) {
+		p	= filepath.Join(filepath.Dir(path), p)
+	}
+
+	return
+}
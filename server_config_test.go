@@ -0,0 +1,261 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewServerFromConfig(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var dir		string
+	var path	string
+	var maxClients	uint
+
+	dir, err	= os.MkdirTemp("", "modbus-config")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// missing file
+	path		= filepath.Join(dir, "missing.json")
+	_, err		= NewServerFromConfig(path, &testHandler{})
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error mentioning %s, got: %v", path, err)
+	}
+
+	// YAML files are rejected
+	path		= filepath.Join(dir, "server.yaml")
+	err		= os.WriteFile(path, []byte("url: tcp://localhost:5509\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	_, err		= NewServerFromConfig(path, &testHandler{})
+	if err == nil || !strings.Contains(err.Error(), "YAML") {
+		t.Errorf("expected a YAML error, got: %v", err)
+	}
+
+	// malformed JSON
+	path		= filepath.Join(dir, "malformed.json")
+	err		= os.WriteFile(path, []byte(`{"url": `), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	_, err		= NewServerFromConfig(path, &testHandler{})
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error mentioning %s, got: %v", path, err)
+	}
+
+	// invalid duration
+	path		= filepath.Join(dir, "duration.json")
+	err		= os.WriteFile(path, []byte(`{"url": "tcp://localhost:5509", "timeout": "soon"}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	_, err		= NewServerFromConfig(path, &testHandler{})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected a timeout error, got: %v", err)
+	}
+
+	// unsupported scheme (rejected by NewServer())
+	path		= filepath.Join(dir, "scheme.json")
+	err		= os.WriteFile(path, []byte(`{"url": "udp://localhost:5509"}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	_, err		= NewServerFromConfig(path, &testHandler{})
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error mentioning %s, got: %v", path, err)
+	}
+
+	// valid config
+	path		= filepath.Join(dir, "server.json")
+	err		= os.WriteFile(path, []byte(`{
+		"url":		"tcp://localhost:5509",
+		"timeout":	"5s",
+		"maxClients":	2
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	server, err	= NewServerFromConfig(path, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if server.conf.Timeout != 5 * time.Second {
+		t.Errorf("expected a 5s timeout, got: %v", server.conf.Timeout)
+	}
+	if server.conf.MaxClients != 2 {
+		t.Errorf("expected MaxClients to be 2, got: %v", server.conf.MaxClients)
+	}
+	if server.conf.ShutdownTimeout != 30 * time.Second {
+		t.Errorf("expected the default shutdown timeout, got: %v", server.conf.ShutdownTimeout)
+	}
+
+	err		= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	err		= server.WatchFile(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchFile() should have succeeded, got: %v", err)
+	}
+
+	// update the file and make sure its modification time changes
+	err		= os.WriteFile(path, []byte(
+		`{"url": "tcp://localhost:5509", "timeout": "5s", "maxClients": 7}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	err		= os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to update mtime: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		server.lock.Lock()
+		maxClients	= server.conf.MaxClients
+		server.lock.Unlock()
+
+		if maxClients == 7 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if maxClients != 7 {
+		t.Errorf("expected MaxClients to be reloaded to 7, got: %v", maxClients)
+	}
+
+	// servers not created from a file cannot be watched
+	server, err	= NewServer(&ServerConfiguration{URL: "tcp://localhost:5509"}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	err		= server.WatchFile(time.Second)
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
+
+func TestServerConfigFileSettings(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var dir		string
+	var path	string
+	var ca		tls.Certificate
+	var cert	tls.Certificate
+	var der		[]byte
+
+	dir	= t.TempDir()
+
+	// serial settings
+	path	= filepath.Join(dir, "rtu.json")
+	err	= os.WriteFile(path, []byte(`{
+		"url":			"rtu:///dev/ttyUSB0",
+		"speed":		19200,
+		"dataBits":		7,
+		"parity":		"even",
+		"stopBits":		1,
+		"slaTimeout":		"2s",
+		"acceptedUnitIds":	[1, 2, 3],
+		"broadcastUnitIds":	[]
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	server, err	= NewServerFromConfig(path, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if server.conf.Speed != 19200 || server.conf.DataBits != 7 ||
+	   server.conf.Parity != PARITY_EVEN || server.conf.StopBits != 1 ||
+	   server.conf.SLATimeout != 2 * time.Second {
+		t.Errorf("unexpected serial settings: %+v", server.conf)
+	}
+	if len(server.conf.AcceptedUnitIds) != 3 || server.conf.AcceptedUnitIds[2] != 3 {
+		t.Errorf("expected accepted unit ids [1 2 3], got: %v", server.conf.AcceptedUnitIds)
+	}
+	// an empty list should disable broadcasts rather than select the default
+	if server.conf.BroadcastUnitIds == nil || len(server.conf.BroadcastUnitIds) != 0 {
+		t.Errorf("expected no broadcast unit ids, got: %v", server.conf.BroadcastUnitIds)
+	}
+
+	// invalid values
+	for _, tc := range []struct {
+		contents	string
+		expected	string
+	}{
+		{`{"url": "rtu:///dev/ttyUSB0", "parity": "mark"}`,		"parity"},
+		{`{"url": "rtu:///dev/ttyUSB0", "acceptedUnitIds": [1, 256]}`,	"acceptedUnitIds"},
+		{`{"url": "tcp://localhost:5509", "slaTimeout": "soon"}`,	"slaTimeout"},
+		{`{"url": "tcp+tls://localhost:5509", "tlsCertFile": "cert.pem"}`,	"tlsKeyFile"},
+		{`{"url": "tcp+tls://localhost:5509", "tlsClientCAFile": "missing.pem"}`, "client CAs"},
+	} {
+		path	= filepath.Join(dir, "invalid.json")
+		err	= os.WriteFile(path, []byte(tc.contents), 0644)
+		if err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+
+		_, err	= NewServerFromConfig(path, &testHandler{})
+		if err == nil || !strings.Contains(err.Error(), tc.expected) ||
+		   !strings.Contains(err.Error(), path) {
+			t.Errorf("%s: expected an error about %s, got: %v", tc.contents, tc.expected, err)
+		}
+	}
+
+	// TLS settings, with paths relative to the configuration file
+	ca	= newTestCert(t, "test-ca", true, nil)
+	cert	= newTestCert(t, "localhost", false, &ca)
+	der, err	= x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "ca.pem"),
+		     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0600)
+	os.WriteFile(filepath.Join(dir, "cert.pem"),
+		     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	os.WriteFile(filepath.Join(dir, "key.pem"),
+		     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	path	= filepath.Join(dir, "tls.json")
+	err	= os.WriteFile(path, []byte(`{
+		"url":			"tcp+tls://localhost:5509",
+		"tlsCertFile":		"cert.pem",
+		"tlsKeyFile":		"key.pem",
+		"tlsClientCAFile":	"ca.pem",
+		"tlsOperatorRole":	"operator"
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	server, err	= NewServerFromConfig(path, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if server.tlsConfig == nil || len(server.tlsConfig.Certificates) != 1 ||
+	   server.tlsConfig.ClientCAs == nil || server.conf.TLSOperatorRole != "operator" {
+		t.Errorf("unexpected TLS settings: %+v", server.conf)
+	}
+
+	return
+}
@@ -0,0 +1,247 @@
+package modbus
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// The ContextRequestHandler interface is the context-aware counterpart of
+// RequestHandler: each method receives a context carrying the deadline of
+// the request (see SLATimeout) and canceled when the server is stopped or
+// when the client disconnects while the request is being processed
+// (TCP, TLS and RTU over TCP only).
+// Servers using such a handler are created with
+// NewServerWithContextHandler(). Existing RequestHandler implementations can
+// be turned into a ContextRequestHandler with NewContextRequestHandler().
+type ContextRequestHandler interface {
+	// See RequestHandler.HandleCoils().
+	HandleCoilsContext		(ctx context.Context, unitId uint8, addr uint16,
+					 quantity uint16, isWrite bool, args []bool) (
+					 res []bool, err error)
+
+	// See RequestHandler.HandleDiscreteInputs().
+	HandleDiscreteInputsContext	(ctx context.Context, unitId uint8, addr uint16,
+					 quantity uint16) (
+					 res []bool, err error)
+
+	// See RequestHandler.HandleHoldingRegisters().
+	HandleHoldingRegistersContext	(ctx context.Context, unitId uint8, addr uint16,
+					 quantity uint16, isWrite bool, args []uint16) (
+					 res []uint16, err error)
+
+	// See RequestHandler.HandleInputRegisters().
+	HandleInputRegistersContext	(ctx context.Context, unitId uint8, addr uint16,
+					 quantity uint16) (
+					 res []uint16, err error)
+}
+
+// requestHandlerAdapter turns a RequestHandler into a ContextRequestHandler,
+// ignoring contexts.
+type requestHandlerAdapter struct {
+	handler	RequestHandler
+}
+
+// contextHandlerAdapter turns a ContextRequestHandler into a RequestHandler,
+// serving requests with a background context when called as such.
+type contextHandlerAdapter struct {
+	handler	ContextRequestHandler
+}
+
+// Returns a ContextRequestHandler calling h, for use where a context-aware
+// handler is expected. Contexts are not passed on to h.
+func NewContextRequestHandler(h RequestHandler) (ch ContextRequestHandler) {
+	ch	= &requestHandlerAdapter{handler: h}
+
+	return
+}
+
+// Returns a new modbus server serving requests with the context-aware
+// handler reqHandler (see ContextRequestHandler).
+// Optional handler interfaces (e.g. DeviceIdentificationHandler) are
+// looked up on reqHandler as with NewServer().
+func NewServerWithContextHandler(conf *ServerConfiguration, reqHandler ContextRequestHandler) (ms *ModbusServer, err error) {
+	if reqHandler == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ms, err	= NewServer(conf, &contextHandlerAdapter{handler: reqHandler})
+
+	return
+}
+
+func (rha *requestHandlerAdapter) HandleCoilsContext(ctx context.Context, unitId uint8, addr uint16,
+						     quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	res, err	= rha.handler.HandleCoils(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (rha *requestHandlerAdapter) HandleDiscreteInputsContext(ctx context.Context, unitId uint8, addr uint16,
+							      quantity uint16) (res []bool, err error) {
+	res, err	= rha.handler.HandleDiscreteInputs(unitId, addr, quantity)
+
+	return
+}
+
+func (rha *requestHandlerAdapter) HandleHoldingRegistersContext(ctx context.Context, unitId uint8, addr uint16,
+								quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	res, err	= rha.handler.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (rha *requestHandlerAdapter) HandleInputRegistersContext(ctx context.Context, unitId uint8, addr uint16,
+							      quantity uint16) (res []uint16, err error) {
+	res, err	= rha.handler.HandleInputRegisters(unitId, addr, quantity)
+
+	return
+}
+
+func (cha *contextHandlerAdapter) HandleCoils(unitId uint8, addr uint16, quantity uint16,
+					      isWrite bool, args []bool) (res []bool, err error) {
+	res, err	= cha.handler.HandleCoilsContext(context.Background(), unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (cha *contextHandlerAdapter) HandleDiscreteInputs(unitId uint8, addr uint16, quantity uint16) (res []bool, err error) {
+	res, err	= cha.handler.HandleDiscreteInputsContext(context.Background(), unitId, addr, quantity)
+
+	return
+}
+
+func (cha *contextHandlerAdapter) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16,
+							 isWrite bool, args []uint16) (res []uint16, err error) {
+	res, err	= cha.handler.HandleHoldingRegistersContext(context.Background(), unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (cha *contextHandlerAdapter) HandleInputRegisters(unitId uint8, addr uint16, quantity uint16) (res []uint16, err error) {
+	res, err	= cha.handler.HandleInputRegistersContext(context.Background(), unitId, addr, quantity)
+
+	return
+}
+
+// Returns the handler of the server as a ContextRequestHandler.
+func (ms *ModbusServer) contextHandler() (ch ContextRequestHandler) {
+	var cha	*contextHandlerAdapter
+	var ok	bool
+
+	cha, ok	= ms.handler.(*contextHandlerAdapter)
+	if ok {
+		ch	= cha.handler
+		return
+	}
+
+	ch	= &requestHandlerAdapter{handler: ms.handler}
+
+	return
+}
+
+// Returns the handler object passed by the user, on which optional handler
+// interfaces (e.g. DeviceIdentificationHandler) are looked up.
+func (ms *ModbusServer) userHandler() (h interface{}) {
+	var cha	*contextHandlerAdapter
+	var ok	bool
+
+	cha, ok	= ms.handler.(*contextHandlerAdapter)
+	if ok {
+		h	= cha.handler
+		return
+	}
+
+	h	= ms.handler
+
+	return
+}
+
+// Returns the context requests are derived from, canceled once the server
+// is stopped.
+func (ms *ModbusServer) serverContext() (ctx context.Context) {
+	ms.lock.Lock()
+	ctx	= ms.ctx
+	ms.lock.Unlock()
+
+	if ctx == nil {
+		ctx	= context.Background()
+	}
+
+	return
+}
+
+// Returns the context of req, defaulting to a background context.
+func requestContext(req *pdu) (ctx context.Context) {
+	ctx	= req.ctx
+	if ctx == nil {
+		ctx	= context.Background()
+	}
+
+	return
+}
+
+// disconnectWatcher wraps the connection of a TCP client to detect the
+// client going away while a request is being processed, i.e. while the
+// transport is not reading from the connection.
+// Bytes read while watching (e.g. pipelined requests) are handed back to the
+// transport on its next reads.
+type disconnectWatcher struct {
+	net.Conn
+	readAhead	[]byte
+}
+
+func newDisconnectWatcher(conn net.Conn) (dw *disconnectWatcher) {
+	dw	= &disconnectWatcher{
+		Conn:	conn,
+	}
+
+	return
+}
+
+func (dw *disconnectWatcher) Read(buf []byte) (n int, err error) {
+	if len(dw.readAhead) > 0 {
+		n		= copy(buf, dw.readAhead)
+		dw.readAhead	= dw.readAhead[n:]
+		return
+	}
+
+	n, err	= dw.Conn.Read(buf)
+
+	return
+}
+
+// Watches the connection until the returned function is called, calling
+// cancel if the client disconnects in the meantime.
+func (dw *disconnectWatcher) watch(cancel context.CancelFunc) (stop func()) {
+	var done	chan struct{}
+
+	done	= make(chan struct{})
+
+	go func() {
+		var buf	[maxTCPFrameLength]byte
+		var n	int
+		var err	error
+
+		defer close(done)
+
+		n, err		= dw.Conn.Read(buf[:])
+		dw.readAhead	= append(dw.readAhead, buf[:n]...)
+
+		// anything but a timeout (caused by stop()) means the
+		// connection is gone
+		if err != nil && !isTimeoutError(err) {
+			cancel()
+		}
+	}()
+
+	stop	= func() {
+		// interrupt the pending read, the transport sets its own
+		// deadline on its next read
+		dw.Conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+	}
+
+	return
+}
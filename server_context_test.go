@@ -0,0 +1,196 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ctxHandler is a ContextRequestHandler blocking on holding register reads
+// until the context of the request is done, reporting the context error.
+type ctxHandler struct {
+	*requestHandlerAdapter
+	started	chan struct{}
+	ctxErr	chan error
+}
+
+func (ch *ctxHandler) HandleHoldingRegistersContext(ctx context.Context, unitId uint8, addr uint16,
+						    quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	ch.started <- struct{}{}
+
+	<-ctx.Done()
+	ch.ctxErr <- ctx.Err()
+	err	= ErrServerDeviceBusy
+
+	return
+}
+
+func (ch *ctxHandler) HandleExceptionStatus(unitId uint8) (status uint8, err error) {
+	status	= 0x5a
+
+	return
+}
+
+func TestServerWithContextHandler(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ch		*ctxHandler
+	var regs	[]uint16
+	var status	uint8
+	var err		error
+
+	ch	= &ctxHandler{
+		requestHandlerAdapter:	&requestHandlerAdapter{handler: NewDataStore(0, 0, 0, 10)},
+		started:		make(chan struct{}, 1),
+		ctxErr:			make(chan error, 1),
+	}
+
+	_, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"tcp://localhost:5568",
+	}, nil)
+	if err != ErrConfigurationError {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"tcp://localhost:5568",
+	}, ch)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5568",
+		Timeout:	200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	// requests not overridden by the handler should be served as usual
+	regs, err	= client.ReadRegisters(0, 2, INPUT_REGISTER)
+	if err != nil || len(regs) != 2 {
+		t.Errorf("unexpected registers: %v (%v)", regs, err)
+	}
+
+	// optional interfaces should be looked up on the user handler
+	status, err	= client.ReadExceptionStatus()
+	if err != nil || status != 0x5a {
+		t.Errorf("expected 0x5a, got: 0x%02x (%v)", status, err)
+	}
+
+	// the context of the request should be canceled when the client
+	// goes away (Close() waits for the request to time out)
+	go client.ReadRegisters(0, 1, HOLDING_REGISTER)
+
+	select {
+	case <-ch.started:
+	case <-time.After(time.Second):
+		t.Fatalf("handler not called")
+	}
+
+	client.Close()
+
+	select {
+	case err = <-ch.ctxErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("context not canceled after client disconnection")
+	}
+
+	return
+}
+
+func TestServerContextSLADeadline(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var ch		*ctxHandler
+	var err		error
+
+	ch	= &ctxHandler{
+		requestHandlerAdapter:	&requestHandlerAdapter{handler: NewDataStore(0, 0, 0, 0)},
+		started:		make(chan struct{}, 1),
+		ctxErr:			make(chan error, 1),
+	}
+
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:		"tcp://localhost:5569",
+		SLATimeout:	50 * time.Millisecond,
+	}, ch)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5569",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// the context of the request should expire with the SLA timeout
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if !errors.Is(err, ErrServerDeviceFailure) {
+		t.Errorf("expected ErrServerDeviceFailure, got: %v", err)
+	}
+
+	<-ch.started
+	select {
+	case err = <-ch.ctxErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("context not done past the SLA timeout")
+	}
+
+	return
+}
+
+func TestNewContextRequestHandler(t *testing.T) {
+	var ds		*DataStore
+	var h		ContextRequestHandler
+	var regs	[]uint16
+	var err		error
+
+	ds	= NewDataStore(0, 0, 4, 0)
+	h	= NewContextRequestHandler(ds)
+
+	_, err	= h.HandleHoldingRegistersContext(context.Background(), 1, 2, 1, true, []uint16{0xbeef})
+	if err != nil {
+		t.Fatalf("failed to write register: %v", err)
+	}
+
+	regs, err	= ds.HandleHoldingRegisters(1, 0, 4, false, nil)
+	if err != nil || len(regs) != 4 || regs[2] != 0xbeef {
+		t.Errorf("unexpected registers: %v (%v)", regs, err)
+	}
+
+	return
+}
@@ -0,0 +1,183 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment options (see NewServerFromEnvironment()).
+type EnvOptions struct {
+	EnvPrefix	string	// prefix of variable names (defaults to MODBUS_)
+}
+
+// Returns a new modbus server configured from environment variables:
+// - MODBUS_URL:			where to listen at (required),
+// - MODBUS_TIMEOUT:		idle session timeout, either as a number of
+//				seconds or as a duration (e.g. "90s"),
+// - MODBUS_MAX_CLIENTS:	maximum number of concurrent client connections,
+// - MODBUS_SPEED:		serial speed (RTU only),
+// - MODBUS_UNIT_IDS:		comma-separated list of unit ids to answer to
+//				(RTU only),
+// - MODBUS_TLS_CERT_FILE and MODBUS_TLS_KEY_FILE: PEM-encoded certificate and
+//				key files, enabling TLS (TCP only, both
+//				must be set).
+// The MODBUS_ prefix can be changed with opts.EnvPrefix (opts may be nil).
+// Unset variables take the same defaults as with NewServer().
+// Malformed variables are reported by name and value.
+func NewServerFromEnvironment(handler RequestHandler, opts *EnvOptions) (ms *ModbusServer, err error) {
+	var prefix	string
+	var conf	ServerConfiguration
+	var certFile	string
+	var keyFile	string
+	var cert	tls.Certificate
+
+	prefix	= "MODBUS_"
+	if opts != nil && opts.EnvPrefix != "" {
+		prefix	= opts.EnvPrefix
+	}
+
+	conf.URL	= os.Getenv(prefix + "URL")
+	if conf.URL == "" {
+		err	= fmt.Errorf("%w: %sURL is not set", ErrConfigurationError, prefix)
+		return
+	}
+
+	conf.Timeout, err	= envDuration(prefix + "TIMEOUT")
+	if err != nil {
+		return
+	}
+
+	conf.MaxClients, err	= envUint(prefix + "MAX_CLIENTS")
+	if err != nil {
+		return
+	}
+
+	conf.Speed, err		= envUint(prefix + "SPEED")
+	if err != nil {
+		return
+	}
+
+	conf.AcceptedUnitIds, err	= envUnitIds(prefix + "UNIT_IDS")
+	if err != nil {
+		return
+	}
+
+	certFile	= os.Getenv(prefix + "TLS_CERT_FILE")
+	keyFile		= os.Getenv(prefix + "TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		err	= fmt.Errorf("%w: %sTLS_CERT_FILE and %sTLS_KEY_FILE must be set together",
+				     ErrConfigurationError, prefix, prefix)
+		return
+	}
+
+	if certFile != "" {
+		cert, err	= tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			err	= fmt.Errorf("%w: failed to load %sTLS_CERT_FILE (%s) and %sTLS_KEY_FILE (%s): %v",
+					     ErrConfigurationError, prefix, certFile, prefix, keyFile, err)
+			return
+		}
+	}
+
+	ms, err	= NewServer(&conf, handler)
+	if err != nil {
+		err	= fmt.Errorf("%w (%sURL: %q)", err, prefix, conf.URL)
+		ms	= nil
+		return
+	}
+
+	if certFile != "" {
+		if ms.transportType != TCP_TRANSPORT {
+			ms	= nil
+			err	= fmt.Errorf("%w: TLS requires a tcp:// %sURL", ErrConfigurationError, prefix)
+			return
+		}
+
+		ms.tlsConfig	= &tls.Config{
+			Certificates:	[]tls.Certificate{cert},
+		}
+	}
+
+	return
+}
+
+// Parses the duration held by the environment variable name, either as a
+// number of seconds or as a time.ParseDuration() string.
+// Returns 0 if the variable is unset.
+func envDuration(name string) (d time.Duration, err error) {
+	var value	string
+	var secs	uint64
+
+	value	= os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	secs, err	= strconv.ParseUint(value, 10, 32)
+	if err == nil {
+		d	= time.Duration(secs) * time.Second
+		return
+	}
+
+	d, err	= time.ParseDuration(value)
+	if err != nil || d < 0 {
+		d	= 0
+		err	= fmt.Errorf("%w: invalid %s value %q (expected seconds or a duration)",
+				     ErrConfigurationError, name, value)
+		return
+	}
+
+	return
+}
+
+// Parses the unsigned integer held by the environment variable name.
+// Returns 0 if the variable is unset.
+func envUint(name string) (u uint, err error) {
+	var value	string
+	var parsed	uint64
+
+	value	= os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	parsed, err	= strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		err	= fmt.Errorf("%w: invalid %s value %q (expected an unsigned integer)",
+				     ErrConfigurationError, name, value)
+		return
+	}
+	u	= uint(parsed)
+
+	return
+}
+
+// Parses the comma-separated list of unit ids held by the environment
+// variable name.
+// Returns nil if the variable is unset.
+func envUnitIds(name string) (ids []uint8, err error) {
+	var value	string
+	var parsed	uint64
+
+	value	= os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	for _, field := range strings.Split(value, ",") {
+		parsed, err	= strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil {
+			ids	= nil
+			err	= fmt.Errorf("%w: invalid %s value %q (expected comma-separated unit ids)",
+					     ErrConfigurationError, name, value)
+			return
+		}
+		ids	= append(ids, uint8(parsed))
+	}
+
+	return
+}
@@ -0,0 +1,95 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewServerFromEnvironment(t *testing.T) {
+	var ms		*ModbusServer
+	var ds		*DataStore
+	var cert	tls.Certificate
+	var der		[]byte
+	var dir		string
+	var err		error
+
+	ds	= NewDataStore(0, 0, 1, 0)
+
+	// the url is required
+	_, err	= NewServerFromEnvironment(ds, &EnvOptions{EnvPrefix: "TEST_MODBUS_"})
+	if !errors.Is(err, ErrConfigurationError) || !strings.Contains(err.Error(), "TEST_MODBUS_URL") {
+		t.Errorf("expected a configuration error naming TEST_MODBUS_URL, got: %v", err)
+	}
+
+	t.Setenv("TEST_MODBUS_URL", "rtu:///dev/ttyUSB0")
+	t.Setenv("TEST_MODBUS_TIMEOUT", "2")
+	t.Setenv("TEST_MODBUS_SPEED", "19200")
+	t.Setenv("TEST_MODBUS_UNIT_IDS", "1, 2,17")
+
+	ms, err	= NewServerFromEnvironment(ds, &EnvOptions{EnvPrefix: "TEST_MODBUS_"})
+	if err != nil {
+		t.Fatalf("NewServerFromEnvironment() should have succeeded, got: %v", err)
+	}
+
+	if ms.conf.URL != "/dev/ttyUSB0" || ms.conf.Timeout != 2 * time.Second ||
+	   ms.conf.Speed != 19200 || ms.conf.StopBits != 2 ||
+	   len(ms.conf.AcceptedUnitIds) != 3 || ms.conf.AcceptedUnitIds[2] != 17 {
+		t.Errorf("unexpected configuration: %+v", ms.conf)
+	}
+
+	// malformed variables should be reported by name and value
+	for name, value := range map[string]string{
+		"TEST_MODBUS_TIMEOUT":		"soon",
+		"TEST_MODBUS_MAX_CLIENTS":	"-1",
+		"TEST_MODBUS_UNIT_IDS":		"1,256",
+	} {
+		t.Setenv(name, value)
+
+		_, err	= NewServerFromEnvironment(ds, &EnvOptions{EnvPrefix: "TEST_MODBUS_"})
+		if !errors.Is(err, ErrConfigurationError) ||
+		   !strings.Contains(err.Error(), name) || !strings.Contains(err.Error(), value) {
+			t.Errorf("expected a configuration error naming %s and %q, got: %v",
+				 name, value, err)
+		}
+
+		os.Unsetenv(name)
+	}
+
+	// TLS over TCP, with the default prefix
+	dir	= t.TempDir()
+	cert	= newTestCert(t, "localhost", false, nil)
+	der, err	= x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "cert.pem"),
+		     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	os.WriteFile(filepath.Join(dir, "key.pem"),
+		     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	t.Setenv("MODBUS_URL", "tcp://localhost:5531")
+	t.Setenv("MODBUS_TIMEOUT", "90s")
+	t.Setenv("MODBUS_MAX_CLIENTS", "3")
+	t.Setenv("MODBUS_TLS_CERT_FILE", filepath.Join(dir, "cert.pem"))
+	t.Setenv("MODBUS_TLS_KEY_FILE", filepath.Join(dir, "key.pem"))
+
+	ms, err	= NewServerFromEnvironment(ds, nil)
+	if err != nil {
+		t.Fatalf("NewServerFromEnvironment() should have succeeded, got: %v", err)
+	}
+
+	if ms.conf.URL != "localhost:5531" || ms.conf.Timeout != 90 * time.Second ||
+	   ms.conf.MaxClients != 3 || ms.tlsConfig == nil || len(ms.tlsConfig.Certificates) != 1 {
+		t.Errorf("unexpected configuration: %+v", ms.conf)
+	}
+
+	return
+}
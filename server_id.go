@@ -0,0 +1,131 @@
+package modbus
+
+import (
+	"context"
+)
+
+const (
+	// run indicator status values of report server id responses
+	RUN_INDICATOR_OFF		uint8	= 0x00
+	RUN_INDICATOR_ON		uint8	= 0xff
+
+	// room left for the server id in a report server id response (253 bytes,
+	// minus the function code, byte count and run indicator fields)
+	maxServerIdLength		int	= 253 - 3
+)
+
+// Sets the server id and run indicator status returned to report server id
+// (0x11) requests, for all unit ids. The server id is device specific and
+// may carry additional data past the id itself.
+// Until called, report server id requests are answered with an illegal
+// function exception. Passing a nil id restores that behaviour.
+func (ms *ModbusServer) SetServerId(id []byte, running bool) (err error) {
+	if len(id) > maxServerIdLength {
+		err	= ErrUnexpectedParameters
+		ms.logger.Errorf("server id too long (%v bytes, max %v)",
+				 len(id), maxServerIdLength)
+		return
+	}
+
+	ms.lock.Lock()
+	if id != nil {
+		ms.serverId	= append([]byte{}, id...)
+	} else {
+		ms.serverId	= nil
+	}
+	ms.serverRunning	= running
+	ms.lock.Unlock()
+
+	return
+}
+
+// Reports the id of the remote device (function code 0x11).
+// Returns the raw response data following the byte count field: the server
+// id, whose length and format are device specific, followed by the run
+// indicator status (RUN_INDICATOR_OFF or RUN_INDICATOR_ON) and any
+// additional data.
+func (mc *ModbusClient) ReportServerId() (data []byte, err error) {
+	data, err	= mc.ReportServerIdContext(context.Background())
+
+	return
+}
+
+// Same as ReportServerId(), but returns ctx.Err() as soon as ctx is done.
+func (mc *ModbusClient) ReportServerIdContext(ctx context.Context) (data []byte, err error) {
+	var req		*pdu
+	var res		*pdu
+
+	mc.lockContext(ctx)
+	defer mc.unlockContext()
+
+	req	= &pdu{
+		unitId:		mc.unitId,
+		functionCode:	FC_REPORT_SERVER_ID,
+	}
+
+	res, err	= mc.executeRequest(req)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case res.functionCode == req.functionCode:
+		// byte count, at least one byte of server id and run indicator
+		if len(res.payload) < 3 || int(res.payload[0]) != len(res.payload) - 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		data	= res.payload[1:]
+
+	case res.functionCode == (req.functionCode | 0x80):
+		if len(res.payload) != 1 {
+			err	= ErrProtocolError
+			return
+		}
+
+		err	= newExceptionResponseError(req.functionCode, res.payload[0])
+
+	default:
+		err	= ErrProtocolError
+		mc.logger.Warningf("unexpected response code (%v)", res.functionCode)
+	}
+
+	return
+}
+
+// Handles a report server id request.
+func (ms *ModbusServer) processReportServerId(req *pdu) (res *pdu, err error) {
+	var id		[]byte
+	var running	bool
+
+	ms.lock.Lock()
+	id	= ms.serverId
+	running	= ms.serverRunning
+	ms.lock.Unlock()
+
+	if id == nil {
+		err	= ErrIllegalFunction
+		return
+	}
+
+	if len(req.payload) != 0 {
+		err	= ErrProtocolError
+		return
+	}
+
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	req.functionCode,
+		payload:	[]byte{uint8(len(id) + 1)},
+	}
+	res.payload	= append(res.payload, id...)
+
+	if running {
+		res.payload	= append(res.payload, RUN_INDICATOR_ON)
+	} else {
+		res.payload	= append(res.payload, RUN_INDICATOR_OFF)
+	}
+
+	return
+}
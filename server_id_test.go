@@ -0,0 +1,101 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReportServerId(t *testing.T) {
+	var server	*ModbusServer
+	var rtuServer	*ModbusServer
+	var client	*ModbusClient
+	var p1, p2	net.Conn
+	var data	[]byte
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5564",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5564",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// no server id set yet
+	_, err	= client.ReportServerId()
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	err	= server.SetServerId([]byte{0x2a, 'p', 'l', 'c'}, true)
+	if err != nil {
+		t.Fatalf("failed to set server id: %v", err)
+	}
+
+	data, err	= client.ReportServerId()
+	if err != nil {
+		t.Fatalf("failed to report server id: %v", err)
+	}
+
+	if len(data) != 5 || data[0] != 0x2a || string(data[1:4]) != "plc" ||
+	   data[4] != RUN_INDICATOR_ON {
+		t.Errorf("unexpected server id: % x", data)
+	}
+
+	err	= server.SetServerId(make([]byte, 251), true)
+	if err != ErrUnexpectedParameters {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	// over RTU
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= rtuServer.SetServerId([]byte{0x01}, false)
+	if err != nil {
+		t.Fatalf("failed to set server id: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	client.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	data, err	= client.ReportServerId()
+	if err != nil || len(data) != 2 || data[0] != 0x01 || data[1] != RUN_INDICATOR_OFF {
+		t.Errorf("unexpected server id: % x (%v)", data, err)
+	}
+
+	return
+}
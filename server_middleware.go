@@ -0,0 +1,135 @@
+package modbus
+
+import (
+	"context"
+)
+
+// ServerRequest is a request as seen by server middlewares (see Use()).
+type ServerRequest struct {
+	UnitId		uint8
+	FunctionCode	uint8
+	Payload		[]byte	// request payload, following the function code
+}
+
+// ServerResponse is a response as seen by server middlewares (see Use()).
+type ServerResponse struct {
+	FunctionCode	uint8	// with bit 0x80 set on exception responses
+	Payload		[]byte	// response payload, following the function code
+}
+
+// RequestProcessor processes a request and returns its response, or an
+// error mapped to an exception response (see ErrIllegalDataAddress,
+// ErrIllegalFunction, etc.). ErrProtocolError drops the request instead,
+// closing TCP connections.
+// ctx carries the client information of the request (see
+// RequestInfoFromContext()) and is passed down to context-aware handlers
+// (see ContextRequestHandler).
+type RequestProcessor func(ctx context.Context, req *ServerRequest) (res *ServerResponse, err error)
+
+// ServerMiddleware wraps a RequestProcessor into another, e.g. to check
+// permissions, log or audit requests or collect metrics (see Use()).
+// Middlewares may call next with a modified request or context, return
+// without calling next, or alter the response it returns.
+type ServerMiddleware func(next RequestProcessor) RequestProcessor
+
+// Adds mws to the middlewares requests are dispatched through, applied
+// outermost-first in registration order: requests go through the first
+// registered middleware, then the next one and so on down to the server's
+// own processing (function handlers, request handler and built-in function
+// codes), and responses return the other way around.
+// Middlewares run within the SLA timeout, if any, and apply to requests
+// received after the call.
+func (ms *ModbusServer) Use(mws ...ServerMiddleware) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.middlewares	= append(append([]ServerMiddleware{}, ms.middlewares...), mws...)
+
+	return
+}
+
+// Processes a request within its span if tracing is enabled, through
+// middlewares if any, bounded by the SLA timeout if any.
+func (ms *ModbusServer) dispatchRequest(req *pdu) (res *pdu, err error) {
+	var mws		[]ServerMiddleware
+	var process	func(*pdu) (*pdu, error)
+	var endSpan	func(error)
+
+	if ms.conf.Tracer != nil {
+		endSpan	= ms.startSpan(req)
+		defer func() {
+			endSpan(responseError(res, err))
+		}()
+	}
+
+	ms.lock.Lock()
+	mws	= ms.middlewares
+	ms.lock.Unlock()
+
+	process	= ms.processRequest
+	if len(mws) > 0 {
+		process	= func(req *pdu) (res *pdu, err error) {
+			res, err	= ms.processThroughMiddlewares(mws, req)
+
+			return
+		}
+	}
+
+	if ms.conf.SLATimeout > 0 {
+		res, err	= ms.processRequestWithSLA(req, process)
+	} else {
+		res, err	= process(req)
+	}
+
+	return
+}
+
+// Runs req through mws, down to processRequest().
+func (ms *ModbusServer) processThroughMiddlewares(mws []ServerMiddleware, req *pdu) (res *pdu, err error) {
+	var chain	RequestProcessor
+	var sres	*ServerResponse
+
+	chain	= func(ctx context.Context, sreq *ServerRequest) (sres *ServerResponse, err error) {
+		var res	*pdu
+
+		res, err	= ms.processRequest(&pdu{
+			unitId:		sreq.UnitId,
+			functionCode:	sreq.FunctionCode,
+			payload:	sreq.Payload,
+			clientRole:	req.clientRole,
+			ctx:		ctx,
+		})
+		if err != nil || res == nil {
+			return
+		}
+
+		sres	= &ServerResponse{
+			FunctionCode:	res.functionCode,
+			Payload:	res.payload,
+		}
+
+		return
+	}
+
+	for i := len(mws) - 1; i >= 0; i-- {
+		chain	= mws[i](chain)
+	}
+
+	sres, err	= chain(requestContext(req), &ServerRequest{
+		UnitId:		req.unitId,
+		FunctionCode:	req.functionCode,
+		Payload:	req.payload,
+	})
+	if err != nil || sres == nil {
+		return
+	}
+
+	// responses always go back to the unit id the request was sent to
+	res	= &pdu{
+		unitId:		req.unitId,
+		functionCode:	sres.FunctionCode,
+		payload:	sres.Payload,
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServerMiddleware(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var lock	sync.Mutex
+	var trace	[]string
+	var transports	[]string
+	var regs	[]uint16
+	var err		error
+
+	// records its name on the way in and out
+	var tracer	= func(name string) (mw ServerMiddleware) {
+		mw	= func(next RequestProcessor) RequestProcessor {
+			return func(ctx context.Context, req *ServerRequest) (res *ServerResponse, err error) {
+				var info	*RequestInfo
+
+				lock.Lock()
+				trace	= append(trace, name + ">")
+				info, _	= RequestInfoFromContext(ctx)
+				if info != nil {
+					transports	= append(transports, info.Transport)
+				}
+				lock.Unlock()
+
+				res, err	= next(ctx, req)
+
+				lock.Lock()
+				trace	= append(trace, "<" + name)
+				lock.Unlock()
+
+				return
+			}
+		}
+
+		return
+	}
+
+	// rejects writes to holding registers
+	var readOnly	= func(next RequestProcessor) RequestProcessor {
+		return func(ctx context.Context, req *ServerRequest) (res *ServerResponse, err error) {
+			if req.FunctionCode == FC_WRITE_SINGLE_REGISTER ||
+			   req.FunctionCode == FC_WRITE_MULTIPLE_REGISTERS {
+				err	= ErrIllegalFunction
+				return
+			}
+
+			res, err	= next(ctx, req)
+
+			return
+		}
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5571",
+	}, NewDataStore(0, 0, 4, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	server.Use(tracer("a"), tracer("b"))
+	server.Use(readOnly)
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5571",
+		Timeout:	1 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	regs, err	= client.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil || len(regs) != 2 {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v (%v)", regs, err)
+	}
+
+	lock.Lock()
+	if len(trace) != 4 || trace[0] != "a>" || trace[1] != "b>" ||
+	   trace[2] != "<b" || trace[3] != "<a" {
+		t.Errorf("unexpected middleware order: %v", trace)
+	}
+	if len(transports) != 2 || transports[0] != "tcp" {
+		t.Errorf("expected request infos in middleware contexts, got: %v", transports)
+	}
+	lock.Unlock()
+
+	// errors returned by middlewares are mapped to exceptions
+	err	= client.WriteRegister(0, 0x1234)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	// exception responses of the server go through middlewares untouched
+	_, err	= client.ExecuteRaw(1, 0x41, nil)
+	if !errors.Is(err, ErrIllegalFunction) {
+		t.Errorf("expected ErrIllegalFunction, got: %v", err)
+	}
+
+	return
+}
+
+func TestServerMiddlewareWithSLA(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var reg		uint16
+	var err		error
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5572",
+		SLATimeout:	50 * time.Millisecond,
+	}, NewDataStore(0, 0, 4, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// answers register reads itself, slowly for address 3
+	server.Use(func(next RequestProcessor) RequestProcessor {
+		return func(ctx context.Context, req *ServerRequest) (res *ServerResponse, err error) {
+			if req.FunctionCode != FC_READ_HOLDING_REGISTERS {
+				res, err	= next(ctx, req)
+				return
+			}
+
+			if req.Payload[1] == 3 {
+				<-ctx.Done()
+			}
+
+			res	= &ServerResponse{
+				FunctionCode:	req.FunctionCode,
+				Payload:	[]byte{0x02, 0xbe, 0xef},
+			}
+
+			return
+		}
+	})
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5572",
+		Timeout:	1 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	reg, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil || reg != 0xbeef {
+		t.Errorf("expected 0xbeef, got: 0x%04x (%v)", reg, err)
+	}
+
+	// middlewares are bound by the SLA timeout
+	_, err	= client.ReadRegister(3, HOLDING_REGISTER)
+	if !errors.Is(err, ErrServerDeviceFailure) {
+		t.Errorf("expected ErrServerDeviceFailure, got: %v", err)
+	}
+
+	return
+}
@@ -0,0 +1,297 @@
+package modbus
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerKey identifies a server registered with a ServerMux.
+type ServerKey string
+
+// ServerMux accepts TCP connections on a single address and dispatches them
+// to servers, based on a routing function.
+type ServerMux struct {
+	// Router returns the key of the server a new connection should be
+	// dispatched to. It may read from (but should not write to) the
+	// connection, e.g. to consume a header. Connections for which
+	// Router returns an error or an unknown key are closed.
+	// Must be set before Start(), e.g. to ProxyProtocolRouter when the mux
+	// sits behind a load balancer or reverse proxy sending PROXY headers.
+	Router		func(net.Conn) (ServerKey, error)
+
+	addr		string
+	logger		*logger
+	lock		sync.Mutex
+	started		bool
+	listener	net.Listener
+	routes		map[ServerKey]*muxRoute
+}
+
+type muxRoute struct {
+	server		*ModbusServer
+	listener	*muxListener
+}
+
+// muxListener is a net.Listener accepting the connections dispatched to a
+// server by a ServerMux.
+type muxListener struct {
+	addr		net.Addr
+	conns		chan net.Conn
+	closed		chan struct{}
+	closeOnce	sync.Once
+}
+
+const (
+	// maximum time allowed for routing a new connection (e.g. to receive
+	// a PROXY protocol header)
+	muxRoutingTimeout	time.Duration	= 5 * time.Second
+	// maximum length of a PROXY protocol v1 header, CRLF included
+	maxProxyHeaderLength	int		= 107
+)
+
+// Returns a new server mux listening on addr (either a tcp://host:port URL
+// or a bare host:port address).
+func NewServerMux(addr string) (mux *ServerMux) {
+	addr	= strings.TrimPrefix(addr, "tcp://")
+
+	mux	= &ServerMux{
+		addr:	addr,
+		logger:	newLogger(fmt.Sprintf("modbus-server-mux(%s)", addr)),
+		routes:	make(map[ServerKey]*muxRoute),
+	}
+
+	return
+}
+
+// Dispatches connections routed to key to server.
+// server should be a TCP server which has not been started: it is started
+// and stopped along with the mux and its own listening address is ignored.
+// Must be called before Start().
+func (mux *ServerMux) Handle(key ServerKey, server *ModbusServer) {
+	var route	*muxRoute
+
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+
+	route	= &muxRoute{
+		server:	server,
+	}
+	route.bind()
+
+	mux.routes[key]	= route
+
+	return
+}
+
+// Starts all registered servers, then starts accepting connections.
+func (mux *ServerMux) Start() (err error) {
+	var started	[]*ModbusServer
+
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+
+	if mux.started {
+		return
+	}
+
+	if mux.Router == nil {
+		mux.logger.Error("no router set")
+		err	= ErrConfigurationError
+		return
+	}
+
+	mux.listener, err	= net.Listen("tcp", mux.addr)
+	if err != nil {
+		return
+	}
+
+	for key, route := range mux.routes {
+		// listeners are closed along with their server, hand out fresh
+		// ones so that the mux can be restarted after a Stop()
+		route.bind()
+		route.listener.addr	= mux.listener.Addr()
+
+		err	= route.server.Start()
+		if err != nil {
+			mux.logger.Errorf("failed to start server %q: %v", key, err)
+
+			for _, server := range started {
+				server.Stop()
+			}
+			mux.listener.Close()
+			return
+		}
+		started	= append(started, route.server)
+	}
+
+	mux.started	= true
+
+	go mux.acceptConns(mux.listener)
+
+	return
+}
+
+// Stops accepting connections and stops all registered servers.
+func (mux *ServerMux) Stop() (err error) {
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+
+	if !mux.started {
+		return
+	}
+
+	mux.started	= false
+	err		= mux.listener.Close()
+
+	for _, route := range mux.routes {
+		route.server.Stop()
+	}
+
+	return
+}
+
+// Accepts connections and routes them from dedicated goroutines.
+func (mux *ServerMux) acceptConns(l net.Listener) {
+	var conn	net.Conn
+	var err		error
+
+	for {
+		conn, err	= l.Accept()
+		if err != nil {
+			// stop on Stop(), including when the mux has been
+			// restarted on a new listener since
+			mux.lock.Lock()
+			if !mux.started || mux.listener != l {
+				mux.lock.Unlock()
+				return
+			}
+			mux.lock.Unlock()
+
+			mux.logger.Warningf("failed to accept client connection: %v", err)
+			continue
+		}
+
+		go mux.route(conn)
+	}
+}
+
+// Hands a connection over to the server its key maps to.
+func (mux *ServerMux) route(conn net.Conn) {
+	var key		ServerKey
+	var ml		*muxListener
+	var err		error
+
+	conn.SetDeadline(time.Now().Add(muxRoutingTimeout))
+	key, err	= mux.Router(conn)
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		mux.logger.Warningf("failed to route connection from %v: %v",
+				    conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	mux.lock.Lock()
+	if mux.routes[key] != nil {
+		ml	= mux.routes[key].listener
+	}
+	mux.lock.Unlock()
+
+	if ml == nil {
+		mux.logger.Warningf("no server for key %q, rejecting %v", key, conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	select {
+	case ml.conns <- conn:
+	case <-ml.closed:
+		conn.Close()
+	}
+
+	return
+}
+
+// Reads a PROXY protocol (v1) header from conn and returns the destination
+// port it carries (e.g. "502") as key, allowing connections forwarded by a
+// load balancer or reverse proxy to be routed by their original destination
+// port.
+func ProxyProtocolRouter(conn net.Conn) (key ServerKey, err error) {
+	var header	[]byte
+	var b		[]byte
+	var fields	[]string
+
+	b	= make([]byte, 1)
+
+	// the header is terminated by CRLF
+	for !strings.HasSuffix(string(header), "\r\n") {
+		if len(header) >= maxProxyHeaderLength {
+			err	= fmt.Errorf("%w: PROXY header too long", ErrProtocolError)
+			return
+		}
+
+		_, err	= io.ReadFull(conn, b)
+		if err != nil {
+			return
+		}
+		header	= append(header, b[0])
+	}
+
+	// PROXY TCP4|TCP6 <src addr> <dst addr> <src port> <dst port>
+	fields	= strings.Fields(string(header))
+	if len(fields) != 6 || fields[0] != "PROXY" ||
+	   (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		err	= fmt.Errorf("%w: invalid PROXY header %q", ErrProtocolError,
+				     strings.TrimSpace(string(header)))
+		return
+	}
+
+	key	= ServerKey(fields[5])
+
+	return
+}
+
+// Has the server of the route accept connections from a new mux listener
+// rather than from its own socket.
+// Must be called with the mux lock held.
+func (route *muxRoute) bind() {
+	route.listener	= &muxListener{
+		conns:	make(chan net.Conn),
+		closed:	make(chan struct{}),
+	}
+
+	route.server.lock.Lock()
+	route.server.preboundListener		= route.listener
+	route.server.hasPreboundListener	= true
+	route.server.lock.Unlock()
+
+	return
+}
+
+func (ml *muxListener) Accept() (conn net.Conn, err error) {
+	select {
+	case conn = <-ml.conns:
+	case <-ml.closed:
+		err	= net.ErrClosed
+	}
+
+	return
+}
+
+func (ml *muxListener) Close() (err error) {
+	ml.closeOnce.Do(func() {
+		close(ml.closed)
+	})
+
+	return
+}
+
+func (ml *muxListener) Addr() (addr net.Addr) {
+	addr	= ml.addr
+
+	return
+}
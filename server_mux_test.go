@@ -0,0 +1,136 @@
+package modbus
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerMux(t *testing.T) {
+	var mux		*ServerMux
+	var serverA	*ModbusServer
+	var serverB	*ModbusServer
+	var dsA		*DataStore
+	var dsB		*DataStore
+	var err		error
+
+	dsA	= NewDataStore(0, 0, 1, 0)
+	dsA.SetHoldingRegister(0, 0xaaaa)
+	dsB	= NewDataStore(0, 0, 1, 0)
+	dsB.SetHoldingRegister(0, 0xbbbb)
+
+	// listening addresses of routed servers are ignored
+	serverA, err	= NewServer(&ServerConfiguration{URL: "tcp://localhost:1502"}, dsA)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	serverB, err	= NewServer(&ServerConfiguration{URL: "tcp://localhost:2502"}, dsB)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	mux	= NewServerMux("localhost:5526")
+	mux.Handle("1502", serverA)
+	mux.Handle("2502", serverB)
+
+	// PROXY header parsing is opt-in: a router must be set
+	err	= mux.Start()
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Fatalf("expected %v without a router, got: %v", ErrConfigurationError, err)
+	}
+
+	mux.Router	= ProxyProtocolRouter
+
+	err	= mux.Start()
+	if err != nil {
+		t.Fatalf("failed to start mux: %v", err)
+	}
+	defer mux.Stop()
+
+	for _, tc := range []struct {
+		header		string
+		expected	uint16
+	}{
+		{"PROXY TCP4 192.168.1.10 192.168.1.1 40001 1502\r\n", 0xaaaa},
+		{"PROXY TCP4 192.168.1.10 192.168.1.1 40002 2502\r\n", 0xbbbb},
+		{"PROXY TCP6 fe80::1 fe80::2 40003 2502\r\n", 0xbbbb},
+	} {
+		muxReadRegister(t, tc.header, tc.expected)
+	}
+
+	// connections without a route should be closed
+	for _, header := range []string{
+		"PROXY TCP4 192.168.1.10 192.168.1.1 40004 3502\r\n",
+		"GET / HTTP/1.1\r\n",
+	} {
+		var conn	net.Conn
+		var n		int
+
+		conn, err	= net.Dial("tcp", "localhost:5526")
+		if err != nil {
+			t.Fatalf("failed to dial mux: %v", err)
+		}
+
+		conn.Write([]byte(header))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err	= conn.Read(make([]byte, 16))
+		if n != 0 || err == nil {
+			t.Errorf("%q: expected the connection to be closed, got: %v, %v",
+				 header, n, err)
+		}
+
+		conn.Close()
+	}
+
+	// the mux should be able to restart after being stopped
+	err	= mux.Stop()
+	if err != nil {
+		t.Fatalf("failed to stop mux: %v", err)
+	}
+
+	err	= mux.Start()
+	if err != nil {
+		t.Fatalf("failed to restart mux: %v", err)
+	}
+
+	muxReadRegister(t, "PROXY TCP4 192.168.1.10 192.168.1.1 40005 1502\r\n", 0xaaaa)
+	muxReadRegister(t, "PROXY TCP4 192.168.1.10 192.168.1.1 40006 2502\r\n", 0xbbbb)
+
+	return
+}
+
+// Reads holding register 0 through the mux on localhost:5526, after sending
+// header, and checks that its value is expected.
+func muxReadRegister(t *testing.T, header string, expected uint16) {
+	var conn	net.Conn
+	var tt		*tcpTransport
+	var res		*pdu
+	var err		error
+
+	conn, err	= net.Dial("tcp", "localhost:5526")
+	if err != nil {
+		t.Fatalf("failed to dial mux: %v", err)
+	}
+	defer conn.Close()
+
+	_, err	= conn.Write([]byte(header))
+	if err != nil {
+		t.Fatalf("failed to write PROXY header: %v", err)
+	}
+
+	tt		= newTCPTransport(conn, time.Second)
+	res, err	= tt.ExecuteRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+	})
+	if err != nil {
+		t.Errorf("%q: request should have succeeded, got: %v", header, err)
+	} else if len(res.payload) != 3 ||
+		  bytesToUint16(BIG_ENDIAN, res.payload[1:3]) != expected {
+		t.Errorf("%q: expected 0x%04x, got: %v", header, expected, res.payload)
+	}
+
+	return
+}
@@ -1,6 +1,11 @@
 package modbus
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -257,19 +262,19 @@ func TestServerCoilsAndDiscreteInputs(t *testing.T) {
 
 	// reading past the array size should return ErrIllegalDataAddress
 	_, err		= client.ReadDiscreteInputs(0x000a, 1)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
 	}
 	_, err		= client.ReadCoils(0x000a, 1)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
 	}
 	_, err		= client.ReadDiscreteInputs(0x8, 3)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
 	}
 	_, err		= client.ReadCoils(0x8, 3)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
 	}
 
@@ -326,19 +331,19 @@ func TestServerCoilsAndDiscreteInputs(t *testing.T) {
 	err		= client.WriteCoils(0x0005, []bool{
 		true, false, true, true,
 	})
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.WriteCoils() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	err		= client.WriteCoil(0x0005, false)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.WriteCoil() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	coils, err	= client.ReadCoils(0x0005, 1)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.ReadCoils() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	coils, err	= client.ReadDiscreteInputs(0x0005, 1)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.ReadDiscreteInputs() should have returned ErrIllegalFunction, got: %v", err)
 	}
 
@@ -421,11 +426,11 @@ func TestServerHoldingAndInputRegisters(t *testing.T) {
 
 	// reading past address 0x000a should fail
 	regs, err	= client.ReadRegisters(0x0001, 10, INPUT_REGISTER)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalDataAddress, got: %v", err)
 	}
 	regs, err	= client.ReadRegisters(0x0000, 11, INPUT_REGISTER)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalDataAddress, got: %v", err)
 	}
 
@@ -516,11 +521,11 @@ func TestServerHoldingAndInputRegisters(t *testing.T) {
 
 	// reading past address 0x000a should fail
 	regs, err	= client.ReadRegisters(0x0001, 10, HOLDING_REGISTER)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalDataAddress, got: %v", err)
 	}
 	regs, err	= client.ReadRegisters(0x0000, 11, HOLDING_REGISTER)
-	if err != ErrIllegalDataAddress {
+	if !errors.Is(err, ErrIllegalDataAddress) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalDataAddress, got: %v", err)
 	}
 
@@ -530,19 +535,19 @@ func TestServerHoldingAndInputRegisters(t *testing.T) {
 	err		= client.WriteRegisters(0x0005, []uint16{
 		0x0000, 0x0001,
 	})
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.WriteRegisters() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	err		= client.WriteRegister(0x0001, 0xffff)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.WriteRegister() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	regs, err	= client.ReadRegisters(0x0005, 1, HOLDING_REGISTER)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalFunction, got: %v", err)
 	}
 	regs, err	= client.ReadRegisters(0x0005, 1, INPUT_REGISTER)
-	if err != ErrIllegalFunction {
+	if !errors.Is(err, ErrIllegalFunction) {
 		t.Errorf("client.ReadRegisters() should have returned ErrIllegalFunction, got: %v", err)
 	}
 
@@ -552,6 +557,298 @@ func TestServerHoldingAndInputRegisters(t *testing.T) {
 	return
 }
 
+func TestServerShutdownTimeout(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var sh		*slowHandler
+	var start	time.Time
+	var elapsed	time.Duration
+
+	sh	= &slowHandler{
+		delay:		500 * time.Millisecond,
+		called:		make(chan struct{}, 1),
+	}
+
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5508",
+		ShutdownTimeout:	50 * time.Millisecond,
+	}, sh)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	client, err = NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5508",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	// issue a request and wait until it reaches the handler
+	go client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	<-sh.called
+
+	start	= time.Now()
+	err	= server.Shutdown(context.Background())
+	elapsed	= time.Since(start)
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() should have returned context.DeadlineExceeded, got: %v", err)
+	}
+
+	if elapsed < 50 * time.Millisecond || elapsed > 200 * time.Millisecond {
+		t.Errorf("Shutdown() should have returned after about 50ms, took %v", elapsed)
+	}
+
+	// the server should be stopped
+	_, err = client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	if err == nil {
+		t.Errorf("ReadRegisters() should have failed")
+	}
+
+	client.Close()
+
+	return
+}
+
+func TestServerSLATimeout(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var start	time.Time
+	var elapsed	time.Duration
+	var regs	[]uint16
+
+	server, err = NewServer(&ServerConfiguration{
+		URL:		"tcp://localhost:5518",
+		SLATimeout:	20 * time.Millisecond,
+	}, &slowHandler{
+		delay:		100 * time.Millisecond,
+		called:		make(chan struct{}, 1),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err = server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err = NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5518",
+		UnitId:		9,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// the slow handler should be cut short by the SLA timeout
+	start	= time.Now()
+	_, err	= client.ReadRegisters(0, 1, HOLDING_REGISTER)
+	elapsed	= time.Since(start)
+
+	if !errors.Is(err, ErrServerDeviceFailure) {
+		t.Errorf("expected ErrServerDeviceFailure, got: %v", err)
+	}
+
+	if elapsed > 25 * time.Millisecond {
+		t.Errorf("exception should have been received within 25ms, took %v", elapsed)
+	}
+
+	// fast handlers should not be affected
+	regs, err	= client.ReadRegisters(0, 2, INPUT_REGISTER)
+	if err != nil || len(regs) != 2 {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v, %v", regs, err)
+	}
+
+	return
+}
+
+func TestNewTCPServerWithListener(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var listener	net.Listener
+	var err		error
+	var regs	[]uint16
+
+	listener, err	= net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server, err	= NewTCPServerWithListener(listener, &ServerConfiguration{}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://" + listener.Addr().String(),
+		UnitId:	9,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	regs, err	= client.ReadRegisters(0, 2, HOLDING_REGISTER)
+	if err != nil || len(regs) != 2 {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v, %v", regs, err)
+	}
+
+	client.Close()
+	server.Stop()
+
+	// the listener is closed on stop, hence the server cannot be restarted
+	err	= server.Start()
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	return
+}
+
+func TestRTUServerBroadcast(t *testing.T) {
+	var server	*ModbusServer
+	var ds		*DataStore
+	var p1, p2	net.Conn
+	var ct		*rtuTransport
+	var err		error
+	var res		*pdu
+	var rxbuf	[]byte
+	var n		int
+	var reg		uint16
+
+	ds	= NewDataStore(0, 0, 4, 0)
+	server, err	= NewServer(&ServerConfiguration{
+		URL:			"rtu:///dev/null",
+		Speed:			19200,
+		AcceptedUnitIds:	[]uint8{1, 255},
+		BroadcastUnitIds:	[]uint8{255},
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// serve requests over a pipe rather than a serial port
+	p1, p2	= net.Pipe()
+	server.lock.Lock()
+	server.started		= true
+	server.rtuTransport	= newRTUTransport(p2, "", 19200, 50 * time.Millisecond)
+	server.lock.Unlock()
+	go server.handleTransport(server.rtuTransport)
+	defer server.Stop()
+
+	// client side of the link
+	ct	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	// broadcast a write multiple registers request
+	_, err	= p1.Write(ct.assembleRTUFrame(&pdu{
+		unitId:		255,
+		functionCode:	FC_WRITE_MULTIPLE_REGISTERS,
+		payload:	[]byte{
+			0x00, 0x01, // address
+			0x00, 0x02, // quantity
+			0x04,       // byte count
+			0x12, 0x34, 0x56, 0x78,
+		},
+	}))
+	if err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+
+	// no byte should be sent back
+	rxbuf	= make([]byte, 32)
+	p1.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err	= p1.Read(rxbuf)
+	if n != 0 || err == nil {
+		t.Errorf("expected no response to a broadcast, got %v bytes (%v)", n, err)
+	}
+
+	// yet the request should have been processed
+	reg, _	= ds.GetHoldingRegister(2)
+	if reg != 0x5678 {
+		t.Errorf("expected 0x5678, got 0x%04x", reg)
+	}
+
+	// unit ids not accepted should be ignored
+	_, err	= p1.Write(ct.assembleRTUFrame(&pdu{
+		unitId:		7,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+	}))
+	if err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	p1.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err	= p1.Read(rxbuf)
+	if n != 0 || err == nil {
+		t.Errorf("expected no response for unit id 7, got %v bytes (%v)", n, err)
+	}
+
+	// accepted, non-broadcast unit ids should be answered
+	res, err	= ct.ExecuteRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x01, 0x00, 0x02},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteRequest() should have succeeded, got: %v", err)
+	}
+	if res.unitId != 1 || res.functionCode != FC_READ_HOLDING_REGISTERS ||
+	   len(res.payload) != 5 || res.payload[1] != 0x12 || res.payload[4] != 0x78 {
+		t.Errorf("unexpected response: %+v", res)
+	}
+
+	return
+}
+
+// slowHandler delays every holding register request by a fixed duration.
+type slowHandler struct {
+	testHandler
+	delay	time.Duration
+	called	chan struct{}
+}
+
+func (sh *slowHandler) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	select {
+	case sh.called <- struct{}{}:
+	default:
+	}
+
+	time.Sleep(sh.delay)
+	res	= make([]uint16, quantity)
+
+	return
+}
+
 type testHandler struct {
 	coils	[10]bool
 	di	[10]bool
@@ -640,3 +937,558 @@ func (th *testHandler) HandleInputRegisters(unitId uint8, addr uint16, quantity
 
 	return
 }
+
+func TestServerPauseResume(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var start	time.Time
+	var done	chan error
+	var elapsed	time.Duration
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5512",
+	}, &testHandler{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5512",
+		UnitId:		9,
+		Timeout:	2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	server.Pause()
+
+	done	= make(chan error, 1)
+	start	= time.Now()
+	go func() {
+		_, err := client.ReadRegisters(0, 2, HOLDING_REGISTER)
+		done <- err
+	}()
+
+	// the request should be held while the server is paused
+	select {
+	case err = <-done:
+		t.Fatalf("request should not have been processed while paused (err: %v)", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	server.Resume()
+
+	select {
+	case err = <-done:
+		elapsed	= time.Since(start)
+		if err != nil {
+			t.Errorf("ReadRegisters() should have succeeded, got: %v", err)
+		}
+		if elapsed < 100 * time.Millisecond {
+			t.Errorf("request should have been held for at least 100ms, got %v", elapsed)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Errorf("response should have arrived within 200ms of Resume()")
+	}
+
+	return
+}
+
+func TestServerBoundAddr(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var addr	string
+	var regs	[]uint16
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://:0",
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	_, err	= server.BoundAddr()
+	if err != ErrServerNotStarted {
+		t.Errorf("expected ErrServerNotStarted, got: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// the OS should have picked a port for us
+	addr, err	= server.BoundAddr()
+	if err != nil || strings.HasSuffix(addr, ":0") {
+		t.Fatalf("expected an address with a non-zero port, got: %q, %v", addr, err)
+	}
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://" + addr,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	err	= client.WriteRegister(3, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	regs, err	= client.ReadRegisters(3, 1, HOLDING_REGISTER)
+	if err != nil || len(regs) != 1 || regs[0] != 0x1234 {
+		t.Errorf("expected [0x1234], got: %v, %v", regs, err)
+	}
+
+	// RTU servers should return their serial device
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/ttyUSB0",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	addr, err	= server.BoundAddr()
+	if err != nil || addr != "/dev/ttyUSB0" {
+		t.Errorf("expected /dev/ttyUSB0, got: %q, %v", addr, err)
+	}
+
+	return
+}
+
+// unitIdRecorder is a data store recording the unit id of every coil and
+// holding register request.
+type unitIdRecorder struct {
+	*DataStore
+	unitIds	[]uint8
+}
+
+func (uir *unitIdRecorder) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	uir.unitIds	= append(uir.unitIds, unitId)
+	res, err	= uir.DataStore.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func (uir *unitIdRecorder) HandleCoils(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []bool) (res []bool, err error) {
+	uir.unitIds	= append(uir.unitIds, unitId)
+	res, err	= uir.DataStore.HandleCoils(unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func TestRTUServerIsAccepted(t *testing.T) {
+	var server	*ModbusServer
+	var uir		*unitIdRecorder
+	var qt		*queueTransport
+	var err		error
+
+	uir	= &unitIdRecorder{DataStore: NewDataStore(0, 0, 4, 0)}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:			"rtu:///dev/null",
+		// the predicate should take precedence over the list
+		AcceptedUnitIds:	[]uint8{1, 3},
+		IsAccepted:		func(unitId uint8) bool {
+			return unitId % 2 == 0
+		},
+	}, uir)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	qt	= &queueTransport{}
+	for id := uint8(1); id <= 4; id++ {
+		qt.requests	= append(qt.requests, &pdu{
+			unitId:		id,
+			functionCode:	FC_READ_HOLDING_REGISTERS,
+			payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+		})
+	}
+
+	server.handleTransport(qt)
+
+	if len(uir.unitIds) != 2 || uir.unitIds[0] != 2 || uir.unitIds[1] != 4 {
+		t.Errorf("expected unit ids 2 and 4 to be dispatched, got: %v", uir.unitIds)
+	}
+
+	if len(qt.responses) != 2 || qt.responses[0].unitId != 2 || qt.responses[1].unitId != 4 {
+		t.Errorf("expected responses for unit ids 2 and 4, got: %v", qt.responses)
+	}
+
+	return
+}
+
+func TestServerSLABreach(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var breaches	chan time.Duration
+	var d		time.Duration
+
+	breaches	= make(chan time.Duration, 4)
+	server, err	= NewServer(&ServerConfiguration{
+		URL:			"tcp://localhost:5541",
+		MaxResponseLatency:	10 * time.Millisecond,
+		OnSLABreach:		func(unitId uint8, fc uint8, duration time.Duration) {
+			if unitId != 1 || fc != FC_READ_HOLDING_REGISTERS {
+				t.Errorf("unexpected unit id/fc: %v/%v", unitId, fc)
+			}
+			breaches <- duration
+		},
+	}, &slowHandler{
+		delay:	50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5541",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	select {
+	case d = <-breaches:
+		if d < 50 * time.Millisecond {
+			t.Errorf("expected a duration of at least 50ms, got: %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for the SLA breach callback")
+	}
+
+	// fast responses should not trigger the callback
+	client.SetUnitId(9)
+	_, err	= client.ReadCoils(0, 1)
+	if err != nil {
+		t.Errorf("ReadCoils() should have succeeded, got: %v", err)
+	}
+
+	select {
+	case d = <-breaches:
+		t.Errorf("unexpected SLA breach (%v)", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	return
+}
+
+func TestServerUptime(t *testing.T) {
+	var server	*ModbusServer
+	var err		error
+	var before	time.Time
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5548",
+	}, NewDataStore(0, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if !server.UpSince().IsZero() || server.Uptime() != 0 {
+		t.Errorf("expected no uptime before Start(), got: %v", server.Uptime())
+	}
+
+	before	= time.Now()
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	if server.UpSince().Sub(before) < 0 || server.UpSince().Sub(before) > 10 * time.Millisecond {
+		t.Errorf("expected UpSince() to be within 10ms of %v, got: %v",
+			 before, server.UpSince())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if server.Uptime() < 20 * time.Millisecond {
+		t.Errorf("expected an uptime of at least 20ms, got: %v", server.Uptime())
+	}
+
+	server.Stop()
+	if !server.UpSince().IsZero() || server.Uptime() != 0 {
+		t.Errorf("expected no uptime after Stop(), got: %v", server.Uptime())
+	}
+
+	return
+}
+
+func TestServerWaitReady(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var err		error
+	var ready	chan error
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5549",
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// waiting on a server which is not started should time out
+	ctx, cancel	= context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+	err	= server.WaitReady(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	// waiters should be released once the server is started
+	ready	= make(chan error, 1)
+	go func() {
+		ready <- server.WaitReady(context.Background())
+	}()
+
+	select {
+	case err = <-ready:
+		t.Fatalf("WaitReady() returned before Start(): %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	select {
+	case err = <-ready:
+		if err != nil {
+			t.Errorf("WaitReady() should have succeeded, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for WaitReady() to return")
+	}
+
+	// the server should now accept connections
+	client, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5549",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+
+	// stopped servers are no longer ready
+	server.Stop()
+	ctx, cancel	= context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	defer cancel()
+	err	= server.WaitReady(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	return
+}
+
+func TestRTUOverTCPServer(t *testing.T) {
+	var ms		*ModbusServer
+	var mc		*ModbusClient
+	var sock	net.Conn
+	var regs	[]uint16
+	var err		error
+
+	ms, err	= NewServer(&ServerConfiguration{
+		URL:		"rtuovertcp://localhost:5553",
+		Timeout:	200 * time.Millisecond,
+	}, NewDataStore(0, 0, 10, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= ms.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer ms.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"rtuovertcp://localhost:5553",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= mc.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+
+	err	= mc.WriteRegisters(1, []uint16{0x1001, 0x1002})
+	if err != nil {
+		t.Errorf("WriteRegisters() should have succeeded, got: %v", err)
+	}
+
+	regs, err	= mc.ReadRegisters(1, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Errorf("ReadRegisters() should have succeeded, got: %v", err)
+	} else if regs[0] != 0x1001 || regs[1] != 0x1002 {
+		t.Errorf("unexpected values: %v", regs)
+	}
+	mc.Close()
+
+	// idle connections should be closed after the session timeout
+	sock, err	= net.Dial("tcp", "localhost:5553")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer sock.Close()
+
+	sock.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err	= sock.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("expected io.EOF, got: %v", err)
+	}
+
+	return
+}
+
+func TestServerReadWriteMultipleRegisters(t *testing.T) {
+	var ms		*ModbusServer
+	var rtuServer	*ModbusServer
+	var ds		*DataStore
+	var mc		*ModbusClient
+	var p1, p2	net.Conn
+	var regs	[]uint16
+	var err		error
+
+	ds	= NewDataStore(0, 0, 10, 0)
+	ds.SetHoldingRegister(1, 0x0101)
+	ds.SetHoldingRegister(4, 0x0404)
+
+	ms, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5557",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= ms.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer ms.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5557",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= mc.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer mc.Close()
+
+	// the write should be performed before the read
+	regs, err	= mc.ReadWriteMultipleRegisters(1, 4, 2, []uint16{0x0202, 0x0303})
+	if err != nil {
+		t.Fatalf("ReadWriteMultipleRegisters() should have succeeded, got: %v", err)
+	}
+	if len(regs) != 4 || regs[0] != 0x0101 || regs[1] != 0x0202 ||
+	   regs[2] != 0x0303 || regs[3] != 0x0404 {
+		t.Errorf("unexpected values: %v", regs)
+	}
+
+	// out of range reads should yield an exception, out of range writes
+	// should not be applied
+	_, err	= mc.ReadWriteMultipleRegisters(8, 4, 0, []uint16{0xffff})
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	_, err	= mc.ReadWriteMultipleRegisters(0, 1, 9, []uint16{0xffff, 0xffff})
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	_, err	= mc.ReadWriteMultipleRegisters(0, 126, 0, []uint16{0})
+	if !errors.Is(err, ErrUnexpectedParameters) {
+		t.Errorf("expected ErrUnexpectedParameters, got: %v", err)
+	}
+
+	// RTU framing should cope with FC23 requests and responses
+	rtuServer, err	= NewServer(&ServerConfiguration{
+		URL:	"rtu:///dev/null",
+	}, ds)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"rtu:///dev/null",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	p1, p2	= net.Pipe()
+	defer p1.Close()
+	go rtuServer.handleTransport(newRTUTransport(p2, "", 19200, 100 * time.Millisecond))
+	mc.transport	= newRTUTransport(p1, "", 19200, 100 * time.Millisecond)
+
+	regs, err	= mc.ReadWriteMultipleRegisters(3, 2, 4, []uint16{0x4444})
+	if err != nil {
+		t.Fatalf("ReadWriteMultipleRegisters() should have succeeded, got: %v", err)
+	}
+	if len(regs) != 2 || regs[0] != 0x0303 || regs[1] != 0x4444 {
+		t.Errorf("unexpected values: %v", regs)
+	}
+
+	return
+}
@@ -0,0 +1,234 @@
+package modbus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Returns a new modbus TCP server only accepting clients presenting a
+// certificate signed by one of the authorities listed in tlsConf.ClientCAs
+// (mutual TLS authentication).
+// tlsConf must hold the server certificate(s); its ClientAuth field is
+// forced to tls.RequireAndVerifyClientCert.
+// Failed handshakes are passed to conf.OnTLSHandshakeError if set, and
+// logged otherwise. See TLSClientName() to identify authenticated clients.
+func NewTCPServerWithTLSAndClientAuth(conf *ServerConfiguration, tlsConf *tls.Config,
+				      handler RequestHandler) (ms *ModbusServer, err error) {
+	if tlsConf == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ms, err	= NewServer(conf, handler)
+	if err != nil {
+		return
+	}
+
+	if ms.transportType != TCP_TRANSPORT {
+		ms	= nil
+		err	= ErrConfigurationError
+		return
+	}
+
+	ms.tlsConfig		= tlsConf.Clone()
+	ms.tlsConfig.ClientAuth	= tls.RequireAndVerifyClientCert
+
+	return
+}
+
+// OID of the role certificate extension defined by the modbus/TCP security
+// specification, holding the role of the client as an UTF8String.
+var modbusRoleOID	= asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+// The AuthorizationHandler interface can optionally be implemented by
+// request handlers of TLS servers to authorize requests based on the role of
+// the client (see TLSClientRole()).
+// AuthorizeRequest is called before any other handler method. Returning an
+// error (e.g. ErrIllegalFunction, as suggested by the modbus/TCP security
+// specification) rejects the request with the matching exception code.
+type AuthorizationHandler interface {
+	AuthorizeRequest(role string, unitId uint8, functionCode uint8) (err error)
+}
+
+// Returns the TLS configuration of tcp+tls:// servers, as mandated by the
+// modbus/TCP security specification: TLS 1.2 or later, with clients required
+// to present a certificate signed by one of clientCAs.
+func newSecurityTLSConfig(cert *tls.Certificate, clientCAs *x509.CertPool) (tlsConf *tls.Config, err error) {
+	if cert == nil || clientCAs == nil {
+		err	= fmt.Errorf("%w: tcp+tls:// requires TLSServerCert and TLSClientCAs",
+				     ErrConfigurationError)
+		return
+	}
+
+	tlsConf	= &tls.Config{
+		Certificates:	[]tls.Certificate{*cert},
+		ClientCAs:	clientCAs,
+		ClientAuth:	tls.RequireAndVerifyClientCert,
+		MinVersion:	tls.VersionTLS12,
+	}
+
+	return
+}
+
+// Returns the common name of the certificate presented by the client on the
+// other end of conn, or an empty string if conn is not a TLS connection or
+// if the client has not been authenticated (yet).
+func TLSClientName(conn net.Conn) (name string) {
+	var tlsConn	*tls.Conn
+	var ok		bool
+	var state	tls.ConnectionState
+
+	tlsConn, ok	= conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+
+	state	= tlsConn.ConnectionState()
+	if !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	name	= state.PeerCertificates[0].Subject.CommonName
+
+	return
+}
+
+// Returns the certificate presented by the client on the other end of conn,
+// or nil if conn is not a TLS connection or if the client has not been
+// authenticated (yet).
+func TLSClientCertificate(conn net.Conn) (cert *x509.Certificate) {
+	var tlsConn	*tls.Conn
+	var ok		bool
+	var state	tls.ConnectionState
+
+	tlsConn, ok	= conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+
+	state	= tlsConn.ConnectionState()
+	if !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert	= state.PeerCertificates[0]
+
+	return
+}
+
+// Returns the role found in the modbus role extension of the certificate
+// presented by the client on the other end of conn, or an empty string if
+// conn is not a TLS connection, if the client has not been authenticated
+// (yet) or if its certificate carries no role.
+func TLSClientRole(conn net.Conn) (role string) {
+	var tlsConn	*tls.Conn
+	var ok		bool
+	var state	tls.ConnectionState
+	var err		error
+
+	tlsConn, ok	= conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+
+	state	= tlsConn.ConnectionState()
+	if !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if !ext.Id.Equal(modbusRoleOID) {
+			continue
+		}
+
+		// ignore malformed extensions
+		_, err	= asn1.Unmarshal(ext.Value, &role)
+		if err != nil {
+			role	= ""
+		}
+		break
+	}
+
+	return
+}
+
+// Rejects requests from TLS clients lacking the role required by the
+// server configuration or the handler (see AuthorizationHandler).
+// Requests received over plain TCP or serial links are always authorized.
+func (ms *ModbusServer) authorizeRequest(req *pdu) (err error) {
+	var ah	AuthorizationHandler
+	var ok	bool
+
+	if ms.tlsConfig == nil {
+		return
+	}
+
+	if ms.conf.TLSOperatorRole != "" && isWriteFunctionCode(req.functionCode) &&
+	   req.clientRole != ms.conf.TLSOperatorRole {
+		ms.logger.Warningf("rejecting write request (fc: 0x%02x) from client " +
+				   "with role '%s'", req.functionCode, req.clientRole)
+		err	= ErrIllegalFunction
+		return
+	}
+
+	ah, ok	= ms.userHandler().(AuthorizationHandler)
+	if ok {
+		err	= ah.AuthorizeRequest(req.clientRole, req.unitId, req.functionCode)
+	}
+
+	return
+}
+
+// Returns true if functionCode modifies coils, registers or files.
+func isWriteFunctionCode(functionCode uint8) (ok bool) {
+	switch functionCode {
+	case FC_WRITE_SINGLE_COIL, FC_WRITE_MULTIPLE_COILS,
+	     FC_WRITE_SINGLE_REGISTER, FC_WRITE_MULTIPLE_REGISTERS,
+	     FC_MASK_WRITE_REGISTER, FC_READ_WRITE_MULTILE_REGISTERS,
+	     FC_WRITE_FILE_RECORD:
+		ok	= true
+	}
+
+	return
+}
+
+// Runs the TLS handshake on sock if it is a TLS connection, bounded by
+// the session timeout.
+// Returns false if the handshake failed, in which case the connection
+// should be dropped.
+func (ms *ModbusServer) handshakeTLSClient(sock net.Conn, timeout time.Duration) (ok bool) {
+	var tlsConn	*tls.Conn
+	var err		error
+
+	tlsConn, ok	= sock.(*tls.Conn)
+	if !ok {
+		// plain TCP connection, nothing to do
+		ok	= true
+		return
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	err	= tlsConn.Handshake()
+	tlsConn.SetDeadline(time.Time{})
+
+	if err != nil {
+		ok	= false
+
+		if ms.conf.OnTLSHandshakeError != nil {
+			ms.conf.OnTLSHandshakeError(sock.RemoteAddr(), err)
+		} else {
+			ms.logger.Warningf("TLS handshake with %v failed: %v",
+					   sock.RemoteAddr(), err)
+		}
+		return
+	}
+
+	ms.logger.Infof("accepted TLS client %v (%s)",
+			sock.RemoteAddr(), TLSClientName(sock))
+
+	return
+}
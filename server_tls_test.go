@@ -0,0 +1,378 @@
+package modbus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns a certificate for cn, signed by parent (self-signed if parent is nil).
+func newTestCert(t *testing.T, cn string, isCA bool, parent *tls.Certificate) (cert tls.Certificate) {
+	cert	= newTestCertWithExtensions(t, cn, isCA, parent, nil)
+
+	return
+}
+
+// Returns a certificate for cn carrying exts, signed by parent (self-signed
+// if parent is nil).
+func newTestCertWithExtensions(t *testing.T, cn string, isCA bool, parent *tls.Certificate,
+			       exts []pkix.Extension) (cert tls.Certificate) {
+	var key		*ecdsa.PrivateKey
+	var tmpl	x509.Certificate
+	var issuer	*x509.Certificate
+	var signer	interface{}
+	var der		[]byte
+	var err		error
+
+	key, err	= ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl	= x509.Certificate{
+		SerialNumber:		big.NewInt(time.Now().UnixNano()),
+		Subject:		pkix.Name{CommonName: cn},
+		NotBefore:		time.Now().Add(-1 * time.Hour),
+		NotAfter:		time.Now().Add(1 * time.Hour),
+		KeyUsage:		x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:		[]x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth,
+		},
+		BasicConstraintsValid:	true,
+		IsCA:			isCA,
+		DNSNames:		[]string{"localhost"},
+		IPAddresses:		[]net.IP{net.ParseIP("127.0.0.1")},
+		ExtraExtensions:	exts,
+	}
+
+	issuer	= &tmpl
+	signer	= key
+	if parent != nil {
+		issuer	= parent.Leaf
+		signer	= parent.PrivateKey
+	}
+
+	der, err	= x509.CreateCertificate(rand.Reader, &tmpl, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert.Certificate	= [][]byte{der}
+	cert.PrivateKey		= key
+	cert.Leaf, err		= x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return
+}
+
+func TestTCPServerWithTLSAndClientAuth(t *testing.T) {
+	var server		*ModbusServer
+	var ca			tls.Certificate
+	var rogueCA		tls.Certificate
+	var pool		*x509.CertPool
+	var handshakeErrs	chan error
+	var conn		*tls.Conn
+	var tt			*tcpTransport
+	var res			*pdu
+	var clientName		string
+	var err			error
+
+	ca		= newTestCert(t, "test-ca", true, nil)
+	rogueCA		= newTestCert(t, "rogue-ca", true, nil)
+	pool		= x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	handshakeErrs	= make(chan error, 1)
+
+	server, err	= NewTCPServerWithTLSAndClientAuth(&ServerConfiguration{
+		URL:			"tcp://localhost:5528",
+		OnTLSHandshakeError:	func(addr net.Addr, err error) {
+			handshakeErrs <- err
+		},
+	}, &tls.Config{
+		Certificates:	[]tls.Certificate{newTestCert(t, "localhost", false, &ca)},
+		ClientCAs:	pool,
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// a client with a certificate signed by the CA should be served
+	conn, err	= tls.Dial("tcp", "localhost:5528", &tls.Config{
+		Certificates:	[]tls.Certificate{newTestCert(t, "scada-1", false, &ca)},
+		RootCAs:	pool,
+	})
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+
+	tt	= newTCPTransport(conn, 1 * time.Second)
+	res, err	= tt.ExecuteRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteRequest() should have succeeded, got: %v", err)
+	}
+	if res.functionCode != FC_READ_HOLDING_REGISTERS {
+		t.Errorf("expected a positive response, got: %+v", res)
+	}
+
+	server.lock.Lock()
+	if len(server.tcpClients) == 1 {
+		clientName	= TLSClientName(server.tcpClients[0])
+	}
+	server.lock.Unlock()
+
+	if clientName != "scada-1" {
+		t.Errorf("expected client name 'scada-1', got: '%s'", clientName)
+	}
+	tt.Close()
+
+	// a client with a certificate signed by another CA should be rejected
+	conn, err	= tls.Dial("tcp", "localhost:5528", &tls.Config{
+		Certificates:	[]tls.Certificate{newTestCert(t, "intruder", false, &rogueCA)},
+		RootCAs:	pool,
+	})
+	if err == nil {
+		// with TLS 1.3, the client may learn about the rejection on
+		// its first read only
+		conn.SetDeadline(time.Now().Add(1 * time.Second))
+		_, err	= conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Errorf("unauthorised client should have been rejected")
+	}
+
+	select {
+	case err = <-handshakeErrs:
+		if err == nil {
+			t.Errorf("expected a handshake error")
+		}
+	case <-time.After(1 * time.Second):
+		t.Errorf("OnTLSHandshakeError should have been called")
+	}
+
+	// plain TCP connections carry no client name
+	if TLSClientName(&net.TCPConn{}) != "" {
+		t.Errorf("expected an empty client name for plain TCP connections")
+	}
+
+	return
+}
+
+func TestTCPTLSServerURL(t *testing.T) {
+	var server	*ModbusServer
+	var ca		tls.Certificate
+	var serverCert	tls.Certificate
+	var pool	*x509.CertPool
+	var conn	*tls.Conn
+	var tt		*tcpTransport
+	var res		*pdu
+	var err		error
+
+	ca		= newTestCert(t, "test-ca", true, nil)
+	serverCert	= newTestCert(t, "localhost", false, &ca)
+	pool		= x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	// both the server certificate and client CAs are required
+	_, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp+tls://localhost:5554",
+		TLSServerCert:	&serverCert,
+	}, NewDataStore(0, 0, 1, 0))
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:		"tcp+tls://localhost:5554",
+		TLSServerCert:	&serverCert,
+		TLSClientCAs:	pool,
+	}, NewDataStore(0, 0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	conn, err	= tls.Dial("tcp", "localhost:5554", &tls.Config{
+		Certificates:	[]tls.Certificate{newTestCert(t, "scada-1", false, &ca)},
+		RootCAs:	pool,
+	})
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+
+	tt		= newTCPTransport(conn, 1 * time.Second)
+	res, err	= tt.ExecuteRequest(&pdu{
+		unitId:		1,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x00, 0x00, 0x01},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteRequest() should have succeeded, got: %v", err)
+	}
+	if res.functionCode != FC_READ_HOLDING_REGISTERS {
+		t.Errorf("expected a positive response, got: %+v", res)
+	}
+	tt.Close()
+
+	// clients without a certificate should be rejected
+	conn, err	= tls.Dial("tcp", "localhost:5554", &tls.Config{
+		RootCAs:	pool,
+	})
+	if err == nil {
+		conn.SetDeadline(time.Now().Add(1 * time.Second))
+		_, err	= conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Errorf("client without a certificate should have been rejected")
+	}
+
+	return
+}
+
+// Request handler recording the roles passed to AuthorizeRequest(), and
+// rejecting requests from clients with the "viewer" role.
+type roleRecorder struct {
+	*DataStore
+	lock	sync.Mutex
+	roles	[]string
+}
+
+func (rr *roleRecorder) AuthorizeRequest(role string, unitId uint8, functionCode uint8) (err error) {
+	rr.lock.Lock()
+	rr.roles	= append(rr.roles, role)
+	rr.lock.Unlock()
+
+	if role == "viewer" {
+		err	= ErrIllegalDataAddress
+	}
+
+	return
+}
+
+func TestTLSServerRoleAuthorization(t *testing.T) {
+	var server	*ModbusServer
+	var rr		*roleRecorder
+	var ca		tls.Certificate
+	var serverCert	tls.Certificate
+	var pool	*x509.CertPool
+	var client	*ModbusClient
+	var err		error
+
+	ca		= newTestCert(t, "test-ca", true, nil)
+	serverCert	= newTestCert(t, "localhost", false, &ca)
+	pool		= x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	rr		= &roleRecorder{DataStore: NewDataStore(0, 0, 1, 0)}
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:			"tcp+tls://localhost:5556",
+		TLSServerCert:		&serverCert,
+		TLSClientCAs:		pool,
+		TLSOperatorRole:	"operator",
+	}, rr)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	for _, tc := range []struct {
+		role		string
+		expectReadErr	error
+		expectWriteErr	error
+	}{
+		{role: "operator"},
+		{role: "", expectWriteErr: ErrIllegalFunction},
+		{role: "engineer", expectWriteErr: ErrIllegalFunction},
+		{
+			role:		"viewer",
+			expectReadErr:	ErrIllegalDataAddress,
+			expectWriteErr:	ErrIllegalFunction,
+		},
+	} {
+		var exts	[]pkix.Extension
+		var clientCert	tls.Certificate
+		var value	[]byte
+
+		if tc.role != "" {
+			value, err	= asn1.MarshalWithParams(tc.role, "utf8")
+			if err != nil {
+				t.Fatalf("failed to marshal role: %v", err)
+			}
+			exts	= []pkix.Extension{{Id: modbusRoleOID, Value: value}}
+		}
+		clientCert	= newTestCertWithExtensions(t, "scada-1", false, &ca, exts)
+
+		client, err	= NewClient(&ClientConfiguration{
+			URL:		"tcp+tls://localhost:5556",
+			TLSClientCert:	&clientCert,
+			TLSRootCAs:	pool,
+		})
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		err	= client.Open()
+		if err != nil {
+			t.Fatalf("failed to open client: %v", err)
+		}
+
+		_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+		if (tc.expectReadErr == nil && err != nil) ||
+		   (tc.expectReadErr != nil && !errors.Is(err, tc.expectReadErr)) {
+			t.Errorf("role '%s': expected read error %v, got: %v",
+				 tc.role, tc.expectReadErr, err)
+		}
+
+		err	= client.WriteRegister(0, 0x1234)
+		if (tc.expectWriteErr == nil && err != nil) ||
+		   (tc.expectWriteErr != nil && !errors.Is(err, tc.expectWriteErr)) {
+			t.Errorf("role '%s': expected write error %v, got: %v",
+				 tc.role, tc.expectWriteErr, err)
+		}
+		client.Close()
+	}
+
+	// the handler should have seen the role of every read, and of the
+	// write allowed by the built-in policy
+	rr.lock.Lock()
+	if len(rr.roles) != 5 || rr.roles[0] != "operator" || rr.roles[1] != "operator" ||
+	   rr.roles[2] != "" || rr.roles[3] != "engineer" || rr.roles[4] != "viewer" {
+		t.Errorf("unexpected roles: %q", rr.roles)
+	}
+	rr.lock.Unlock()
+
+	return
+}
@@ -0,0 +1,125 @@
+package modbus
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// serial speed limits of standard UARTs, and with HighSpeedSerial set
+	minSerialSpeed		uint	= 300
+	maxSerialSpeed		uint	= 115200
+	maxHighSerialSpeed	uint	= 4000000
+)
+
+// standard serial speeds, in ascending order
+var standardSerialSpeeds	= []uint{
+	300, 600, 1200, 2400, 4800, 9600, 14400, 19200, 38400, 57600, 115200,
+	230400, 460800, 500000, 576000, 921600, 1000000, 1152000, 1500000,
+	2000000, 2500000, 3000000, 3500000, 4000000,
+}
+
+// Validates conf, as NewServer() does, without creating a server.
+// Over RTU, Speed must lie within [300, 115200], or within [300, 4000000] if
+// HighSpeedSerial is set: errors suggest the nearest supported speed.
+// Speeds within range but not among standard ones (e.g. 9601) are accepted
+// with a warning, as they are likely typos.
+// AcceptedUnitIds must not hold duplicates.
+// Returns any warning along with an error wrapping ErrConfigurationError if
+// conf is invalid.
+func ValidateServerConfiguration(conf *ServerConfiguration) (warnings []string, err error) {
+	err	= validateUnitIds(conf.AcceptedUnitIds)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(conf.URL, "tcp://"),
+	     strings.HasPrefix(conf.URL, "rtuovertcp://"):
+	case strings.HasPrefix(conf.URL, "tcp+tls://"):
+		_, err	= newSecurityTLSConfig(conf.TLSServerCert, conf.TLSClientCAs)
+	case strings.HasPrefix(conf.URL, "rtu://"),
+	     strings.HasPrefix(conf.URL, "ascii://"):
+		if conf.Speed != 0 {
+			warnings, err	= validateSerialSpeed(conf.Speed, conf.HighSpeedSerial)
+		}
+	default:
+		err	= fmt.Errorf("%w: unsupported url %q (expected tcp://, tcp+tls://, " +
+				     "rtuovertcp://, rtu:// or ascii://)", ErrConfigurationError, conf.URL)
+	}
+
+	return
+}
+
+// Checks that unitIds holds no duplicate.
+// Unit ids are uint8s, hence always within the valid 0-255 range.
+func validateUnitIds(unitIds []uint8) (err error) {
+	var seen	[256]bool
+
+	for _, id := range unitIds {
+		if seen[id] {
+			err	= fmt.Errorf("%w: duplicate unit ID %v in AcceptedUnitIds",
+					     ErrConfigurationError, id)
+			return
+		}
+		seen[id]	= true
+	}
+
+	return
+}
+
+// Checks that speed is within the supported range and warns about
+// non-standard speeds.
+func validateSerialSpeed(speed uint, highSpeed bool) (warnings []string, err error) {
+	var max		uint
+	var nearest	uint
+
+	max	= maxSerialSpeed
+	if highSpeed {
+		max	= maxHighSerialSpeed
+	}
+
+	nearest	= nearestSerialSpeed(speed, max)
+
+	if speed < minSerialSpeed || speed > max {
+		err	= fmt.Errorf("%w: serial speed %v out of range [%v, %v] (nearest supported speed: %v)",
+				     ErrConfigurationError, speed, minSerialSpeed, max, nearest)
+		if !highSpeed && speed <= maxHighSerialSpeed {
+			err	= fmt.Errorf("%w, set HighSpeedSerial to allow speeds up to %v",
+					     err, maxHighSerialSpeed)
+		}
+		return
+	}
+
+	if nearest != speed {
+		warnings	= append(warnings,
+			fmt.Sprintf("non-standard serial speed %v, did you mean %v?", speed, nearest))
+	}
+
+	return
+}
+
+// Returns the standard serial speed closest to speed, up to max.
+func nearestSerialSpeed(speed uint, max uint) (nearest uint) {
+	var dist	uint
+	var best	uint
+
+	for i, s := range standardSerialSpeeds {
+		if s > max {
+			break
+		}
+
+		if s > speed {
+			dist	= s - speed
+		} else {
+			dist	= speed - s
+		}
+
+		if i == 0 || dist < best {
+			best	= dist
+			nearest	= s
+		}
+	}
+
+	return
+}
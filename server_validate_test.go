@@ -0,0 +1,96 @@
+package modbus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateServerConfiguration(t *testing.T) {
+	var warnings	[]string
+	var err		error
+
+	// standard speeds should pass silently
+	warnings, err	= ValidateServerConfiguration(&ServerConfiguration{
+		URL:	"rtu:///dev/ttyUSB0",
+		Speed:	9600,
+	})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected no error and no warning, got: %v, %v", err, warnings)
+	}
+
+	// non-standard speeds should pass with a warning
+	warnings, err	= ValidateServerConfiguration(&ServerConfiguration{
+		URL:	"rtu:///dev/ttyUSB0",
+		Speed:	9601,
+	})
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "did you mean 9600") {
+		t.Errorf("expected a warning suggesting 9600, got: %v, %v", err, warnings)
+	}
+
+	// out of range speeds should fail, suggesting the nearest supported one
+	for _, tc := range []struct {
+		speed		uint
+		highSpeed	bool
+		suggestion	string
+	}{
+		{1, false, "nearest supported speed: 300"},
+		{230400, false, "set HighSpeedSerial"},
+		{1000000000, true, "nearest supported speed: 4000000"},
+	} {
+		_, err	= ValidateServerConfiguration(&ServerConfiguration{
+			URL:			"rtu:///dev/ttyUSB0",
+			Speed:			tc.speed,
+			HighSpeedSerial:	tc.highSpeed,
+		})
+		if !errors.Is(err, ErrConfigurationError) || !strings.Contains(err.Error(), tc.suggestion) {
+			t.Errorf("speed %v: expected a configuration error with %q, got: %v",
+				 tc.speed, tc.suggestion, err)
+		}
+
+		_, err	= NewServer(&ServerConfiguration{
+			URL:			"rtu:///dev/ttyUSB0",
+			Speed:			tc.speed,
+			HighSpeedSerial:	tc.highSpeed,
+		}, NewDataStore(0, 0, 0, 0))
+		if !errors.Is(err, ErrConfigurationError) {
+			t.Errorf("speed %v: NewServer() should have failed, got: %v", tc.speed, err)
+		}
+	}
+
+	// high speeds should pass when allowed
+	warnings, err	= ValidateServerConfiguration(&ServerConfiguration{
+		URL:			"rtu:///dev/ttyUSB0",
+		Speed:			921600,
+		HighSpeedSerial:	true,
+	})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected no error and no warning, got: %v, %v", err, warnings)
+	}
+
+	_, err	= ValidateServerConfiguration(&ServerConfiguration{URL: "udp://localhost:502"})
+	if !errors.Is(err, ErrConfigurationError) {
+		t.Errorf("expected ErrConfigurationError, got: %v", err)
+	}
+
+	// duplicate unit ids should be rejected
+	_, err	= ValidateServerConfiguration(&ServerConfiguration{
+		URL:			"rtu:///dev/ttyUSB0",
+		AcceptedUnitIds:	[]uint8{1, 2, 1},
+	})
+	if !errors.Is(err, ErrConfigurationError) ||
+	   !strings.Contains(err.Error(), "duplicate unit ID 1") {
+		t.Errorf("expected an error naming unit id 1, got: %v", err)
+	}
+
+	_, err	= NewServer(&ServerConfiguration{
+		URL:			"tcp://localhost:502",
+		AcceptedUnitIds:	[]uint8{1, 2, 1},
+	}, NewDataStore(0, 0, 0, 0))
+	if !errors.Is(err, ErrConfigurationError) ||
+	   !strings.Contains(err.Error(), "duplicate unit ID 1") {
+		t.Errorf("expected an error naming unit id 1, got: %v", err)
+	}
+
+	return
+}
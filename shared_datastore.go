@@ -0,0 +1,49 @@
+package modbus
+
+import (
+	"context"
+	"time"
+)
+
+// Returns a started server for each of urls, all serving ds, e.g. to expose
+// the same registers over both a serial port and TCP.
+// Servers use the defaults of NewServer() and are ready to serve requests
+// when returned. Should any server fail to be created or started, the ones
+// already started are stopped and the error is returned.
+// Stopping the returned servers is left to the caller.
+func NewServerWithSharedDataStore(urls []string, ds *DataStore) (servers []*ModbusServer, err error) {
+	var ms		*ModbusServer
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	if len(urls) == 0 || ds == nil {
+		err	= ErrConfigurationError
+		return
+	}
+
+	ctx, cancel	= context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	for _, url := range urls {
+		ms, err	= NewServer(&ServerConfiguration{
+			URL:	url,
+		}, ds)
+		if err == nil {
+			err	= ms.Start()
+		}
+		if err == nil {
+			servers	= append(servers, ms)
+			err	= ms.WaitReady(ctx)
+		}
+
+		if err != nil {
+			for _, started := range servers {
+				started.Stop()
+			}
+			servers	= nil
+			return
+		}
+	}
+
+	return
+}
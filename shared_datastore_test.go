@@ -0,0 +1,75 @@
+package modbus
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNewServerWithSharedDataStore(t *testing.T) {
+	var servers	[]*ModbusServer
+	var ds		*DataStore
+	var c1		*ModbusClient
+	var c2		*ModbusClient
+	var err		error
+	var reg		uint16
+	var l		net.Listener
+
+	ds	= NewDataStore(0, 0, 10, 0)
+	servers, err	= NewServerWithSharedDataStore([]string{
+		"tcp://localhost:5550",
+		"tcp://localhost:5551",
+	}, ds)
+	if err != nil || len(servers) != 2 {
+		t.Fatalf("expected 2 servers, got: %v, %v", len(servers), err)
+	}
+	for _, server := range servers {
+		defer server.Stop()
+	}
+
+	c1, err	= NewClient(&ClientConfiguration{URL: "tcp://localhost:5550"})
+	if err == nil {
+		err	= c1.Open()
+	}
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c1.Close()
+
+	c2, err	= NewClient(&ClientConfiguration{URL: "tcp://localhost:5551"})
+	if err == nil {
+		err	= c2.Open()
+	}
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer c2.Close()
+
+	// writes through one server should be visible through the other
+	err	= c1.WriteRegister(4, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	reg, err	= c2.ReadRegister(4, HOLDING_REGISTER)
+	if err != nil || reg != 0x1234 {
+		t.Errorf("expected 0x1234, got: 0x%04x, %v", reg, err)
+	}
+
+	// should any server fail to start, none should be left running
+	servers, err	= NewServerWithSharedDataStore([]string{
+		"tcp://localhost:5552",
+		"rtu:///dev/this-device-does-not-exist",
+	}, ds)
+	if err == nil || servers != nil {
+		t.Fatalf("expected an error, got: %v, %v", servers, err)
+	}
+
+	l, err	= net.Listen("tcp", "localhost:5552")
+	if err != nil {
+		t.Errorf("expected port 5552 to be free, got: %v", err)
+	} else {
+		l.Close()
+	}
+
+	return
+}
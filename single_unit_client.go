@@ -0,0 +1,113 @@
+package modbus
+
+import (
+	"context"
+)
+
+// SingleUnitClient is a modbus client bound to a single unit id, set at
+// construction time (see NewClientWithUnitId()).
+type SingleUnitClient struct {
+	client	*ModbusClient
+}
+
+// Returns a new client sending all requests to unitId, e.g. for PLC
+// integrations where every request targets the same device.
+// conf.UnitId is ignored. The unit id cannot be changed afterwards: use
+// separate clients (or ModbusClient and SetUnitId()) to talk to several
+// devices.
+func NewClientWithUnitId(conf *ClientConfiguration, unitId uint8) (suc *SingleUnitClient, err error) {
+	var mc	*ModbusClient
+
+	mc, err	= NewClient(conf)
+	if err != nil {
+		return
+	}
+
+	mc.SetUnitId(unitId)
+
+	suc	= &SingleUnitClient{
+		client:	mc,
+	}
+
+	return
+}
+
+// Opens the underlying transport (see ModbusClient.Open()).
+func (suc *SingleUnitClient) Open() (err error) {
+	err	= suc.client.Open()
+
+	return
+}
+
+// Closes the underlying transport (see ModbusClient.Close()).
+func (suc *SingleUnitClient) Close() (err error) {
+	err	= suc.client.Close()
+
+	return
+}
+
+// Returns the unit id requests are sent to.
+func (suc *SingleUnitClient) UnitId() (unitId uint8) {
+	suc.client.lock.Lock()
+	defer suc.client.lock.Unlock()
+
+	unitId	= suc.client.unitId
+
+	return
+}
+
+// Reads multiple coils (function code 01).
+func (suc *SingleUnitClient) ReadCoils(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= suc.client.ReadCoilsContext(ctx, addr, quantity)
+
+	return
+}
+
+// Reads multiple discrete inputs (function code 02).
+func (suc *SingleUnitClient) ReadDiscreteInputs(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	values, err	= suc.client.ReadDiscreteInputsContext(ctx, addr, quantity)
+
+	return
+}
+
+// Reads multiple holding registers (function code 03).
+func (suc *SingleUnitClient) ReadHoldingRegisters(ctx context.Context, addr uint16, quantity uint16) (values []uint16, err error) {
+	values, err	= suc.client.ReadRegistersContext(ctx, addr, quantity, HOLDING_REGISTER)
+
+	return
+}
+
+// Reads multiple input registers (function code 04).
+func (suc *SingleUnitClient) ReadInputRegisters(ctx context.Context, addr uint16, quantity uint16) (values []uint16, err error) {
+	values, err	= suc.client.ReadRegistersContext(ctx, addr, quantity, INPUT_REGISTER)
+
+	return
+}
+
+// Writes a single coil (function code 05).
+func (suc *SingleUnitClient) WriteCoil(ctx context.Context, addr uint16, value bool) (err error) {
+	err	= suc.client.WriteCoilContext(ctx, addr, value)
+
+	return
+}
+
+// Writes multiple coils (function code 15).
+func (suc *SingleUnitClient) WriteCoils(ctx context.Context, addr uint16, values []bool) (err error) {
+	err	= suc.client.WriteCoilsContext(ctx, addr, values)
+
+	return
+}
+
+// Writes a single holding register (function code 06).
+func (suc *SingleUnitClient) WriteRegister(ctx context.Context, addr uint16, value uint16) (err error) {
+	err	= suc.client.WriteRegisterContext(ctx, addr, value)
+
+	return
+}
+
+// Writes multiple holding registers (function code 16).
+func (suc *SingleUnitClient) WriteRegisters(ctx context.Context, addr uint16, values []uint16) (err error) {
+	err	= suc.client.WriteRegistersContext(ctx, addr, values)
+
+	return
+}
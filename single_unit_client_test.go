@@ -0,0 +1,74 @@
+package modbus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSingleUnitClient(t *testing.T) {
+	var server	*ModbusServer
+	var suc		*SingleUnitClient
+	var uir		*unitIdRecorder
+	var err		error
+	var regs	[]uint16
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+
+	uir	= &unitIdRecorder{DataStore: NewDataStore(0, 0, 4, 0)}
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5546",
+	}, uir)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	// conf.UnitId should be overridden
+	suc, err	= NewClientWithUnitId(&ClientConfiguration{
+		URL:	"tcp://localhost:5546",
+		UnitId:	9,
+	}, 5)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if suc.UnitId() != 5 {
+		t.Errorf("expected unit id 5, got: %v", suc.UnitId())
+	}
+
+	err	= suc.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer suc.Close()
+
+	err	= suc.WriteRegister(context.Background(), 1, 0x1234)
+	if err != nil {
+		t.Errorf("WriteRegister() should have succeeded, got: %v", err)
+	}
+
+	regs, err	= suc.ReadHoldingRegisters(context.Background(), 1, 1)
+	if err != nil || len(regs) != 1 || regs[0] != 0x1234 {
+		t.Errorf("expected [0x1234], got: %v, %v", regs, err)
+	}
+
+	if len(uir.unitIds) != 2 || uir.unitIds[0] != 5 || uir.unitIds[1] != 5 {
+		t.Errorf("expected requests to unit id 5, got: %v", uir.unitIds)
+	}
+
+	// done contexts should not cause any request
+	ctx, cancel	= context.WithCancel(context.Background())
+	cancel()
+
+	_, err	= suc.ReadHoldingRegisters(ctx, 1, 1)
+	if err != context.Canceled || len(uir.unitIds) != 2 {
+		t.Errorf("expected context.Canceled and no request, got: %v", err)
+	}
+
+	return
+}
@@ -1,6 +1,8 @@
 package modbus
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"net"
 	"testing"
@@ -371,3 +373,93 @@ func TestTCPTransportWriteResponse(t *testing.T) {
 
 	return
 }
+
+// fuzzConn is a net.Conn (and rtuLink) reading from a fixed byte slice and
+// discarding writes.
+type fuzzConn struct {
+	r	*bytes.Reader
+}
+
+func newFuzzConn(data []byte) (fc *fuzzConn) {
+	fc	= &fuzzConn{r: bytes.NewReader(data)}
+
+	return
+}
+
+func (fc *fuzzConn) Read(buf []byte) (n int, err error) {
+	n, err	= fc.r.Read(buf)
+
+	return
+}
+
+func (fc *fuzzConn) Write(buf []byte) (n int, err error) {
+	n	= len(buf)
+
+	return
+}
+
+func (fc *fuzzConn) Close() (err error)					{ return }
+func (fc *fuzzConn) LocalAddr() (addr net.Addr)				{ return &net.TCPAddr{} }
+func (fc *fuzzConn) RemoteAddr() (addr net.Addr)			{ return &net.TCPAddr{} }
+func (fc *fuzzConn) SetDeadline(deadline time.Time) (err error)		{ return }
+func (fc *fuzzConn) SetReadDeadline(deadline time.Time) (err error)	{ return }
+func (fc *fuzzConn) SetWriteDeadline(deadline time.Time) (err error)	{ return }
+
+// Returns true if err is one of the errors the frame parsers are expected
+// to return on malformed or truncated input.
+func isKnownFrameError(err error) (ok bool) {
+	for _, known := range []error{
+		ErrShortFrame, ErrBadCRC, ErrProtocolError, ErrUnknownProtocolId,
+		io.EOF, io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, known) {
+			ok	= true
+			return
+		}
+	}
+
+	return
+}
+
+func FuzzReadMBAPFrame(f *testing.F) {
+	var tt	*tcpTransport
+
+	tt	= &tcpTransport{}
+
+	f.Add(tt.assembleMBAPFrame(0x0001, &pdu{
+		unitId:		0x01,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x00, 0x6b, 0x00, 0x03},
+	}))
+	f.Add(tt.assembleMBAPFrame(0x0002, &pdu{
+		unitId:		0x01,
+		functionCode:	FC_READ_HOLDING_REGISTERS,
+		payload:	[]byte{0x04, 0x12, 0x34, 0x56, 0x78},
+	}))
+	f.Add(tt.assembleMBAPFrame(0x0003, &pdu{
+		unitId:		0x01,
+		functionCode:	FC_READ_HOLDING_REGISTERS | 0x80,
+		payload:	[]byte{EX_ILLEGAL_DATA_ADDRESS},
+	}))
+	f.Add([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01})
+	f.Add([]byte{0x00, 0x01, 0x12, 0x34, 0x00, 0x02, 0x01, 0x03})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tt	*tcpTransport
+		var p	*pdu
+		var err	error
+
+		tt		= newTCPTransport(newFuzzConn(data), time.Second)
+		p, _, err	= tt.readMBAPFrame()
+		if err != nil {
+			if !isKnownFrameError(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		if len(p.payload) + 1 + mbapHeaderLength > maxTCPFrameLength {
+			t.Errorf("frame exceeds %v bytes: %v", maxTCPFrameLength, len(p.payload))
+		}
+	})
+}
@@ -0,0 +1,379 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// throttlingClient wraps a Client and limits its request rate with a token
+// bucket.
+type throttlingClient struct {
+	inner		Client
+	ctxInner	ContextClient	// inner, if it is context-aware
+	err		error		// configuration error, returned by all calls
+	lock		sync.Mutex
+	rate		float64		// tokens added per second
+	burst		float64		// bucket capacity
+	tokens		float64
+	last		time.Time	// last time tokens were added
+}
+
+// Returns a client wrapping inner, which sends at most maxReqPerSecond
+// requests per second.
+// Requests exceeding the rate block until they are allowed to proceed.
+// The returned client also implements ContextClient: its *Context() methods
+// stop waiting as soon as the context is done, and fail right away with
+// context.DeadlineExceeded if the deadline of the context would pass before
+// the request is allowed to proceed. The context is passed on to inner if it
+// implements ContextClient as well.
+// Open(), Close(), SetUnitId() and SetEncoding() calls are not throttled.
+// If maxReqPerSecond is not a positive number, all calls (Open() included)
+// fail with ErrConfigurationError.
+func NewThrottlingClient(inner Client, maxReqPerSecond float64) (c Client) {
+	c = NewThrottlingClientWithBurst(inner, maxReqPerSecond, 1)
+
+	return
+}
+
+// Returns a throttling client (see NewThrottlingClient()) allowing up to
+// maxBurst requests to be sent back-to-back after an idle period, while still
+// averaging at most maxReqPerSecond requests per second.
+func NewThrottlingClientWithBurst(inner Client, maxReqPerSecond float64, maxBurst int) (c Client) {
+	var tc	*throttlingClient
+
+	if maxBurst < 1 {
+		maxBurst	= 1
+	}
+
+	tc	= &throttlingClient{
+		inner:	inner,
+		rate:	maxReqPerSecond,
+		burst:	float64(maxBurst),
+		tokens:	float64(maxBurst),
+		last:	time.Now(),
+	}
+	tc.ctxInner, _	= inner.(ContextClient)
+
+	if math.IsNaN(maxReqPerSecond) || maxReqPerSecond <= 0 {
+		tc.err	= fmt.Errorf("%w: invalid request rate (%v req/s)",
+				     ErrConfigurationError, maxReqPerSecond)
+	}
+
+	c	= tc
+
+	return
+}
+
+func (tc *throttlingClient) Open() (err error) {
+	if tc.err != nil {
+		err	= tc.err
+		return
+	}
+
+	err = tc.inner.Open()
+
+	return
+}
+
+func (tc *throttlingClient) Close() (err error) {
+	err = tc.inner.Close()
+
+	return
+}
+
+func (tc *throttlingClient) SetUnitId(id uint8) (err error) {
+	err = tc.inner.SetUnitId(id)
+
+	return
+}
+
+func (tc *throttlingClient) SetEncoding(endianness Endianness, wordOrder WordOrder) (err error) {
+	err = tc.inner.SetEncoding(endianness, wordOrder)
+
+	return
+}
+
+func (tc *throttlingClient) ReadCoils(addr uint16, quantity uint16) (values []bool, err error) {
+	values, err = tc.ReadCoilsContext(context.Background(), addr, quantity)
+
+	return
+}
+
+func (tc *throttlingClient) ReadCoil(addr uint16) (value bool, err error) {
+	value, err = tc.ReadCoilContext(context.Background(), addr)
+
+	return
+}
+
+func (tc *throttlingClient) ReadDiscreteInputs(addr uint16, quantity uint16) (values []bool, err error) {
+	values, err = tc.ReadDiscreteInputsContext(context.Background(), addr, quantity)
+
+	return
+}
+
+func (tc *throttlingClient) ReadDiscreteInput(addr uint16) (value bool, err error) {
+	value, err = tc.ReadDiscreteInputContext(context.Background(), addr)
+
+	return
+}
+
+func (tc *throttlingClient) ReadRegisters(addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	values, err = tc.ReadRegistersContext(context.Background(), addr, quantity, regType)
+
+	return
+}
+
+func (tc *throttlingClient) ReadRegister(addr uint16, regType RegType) (value uint16, err error) {
+	value, err = tc.ReadRegisterContext(context.Background(), addr, regType)
+
+	return
+}
+
+func (tc *throttlingClient) WriteCoil(addr uint16, value bool) (err error) {
+	err = tc.WriteCoilContext(context.Background(), addr, value)
+
+	return
+}
+
+func (tc *throttlingClient) WriteCoils(addr uint16, values []bool) (err error) {
+	err = tc.WriteCoilsContext(context.Background(), addr, values)
+
+	return
+}
+
+func (tc *throttlingClient) WriteRegister(addr uint16, value uint16) (err error) {
+	err = tc.WriteRegisterContext(context.Background(), addr, value)
+
+	return
+}
+
+func (tc *throttlingClient) WriteRegisters(addr uint16, values []uint16) (err error) {
+	err = tc.WriteRegistersContext(context.Background(), addr, values)
+
+	return
+}
+
+func (tc *throttlingClient) ReadCoilsContext(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		values, err = tc.ctxInner.ReadCoilsContext(ctx, addr, quantity)
+	} else {
+		values, err = tc.inner.ReadCoils(addr, quantity)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) ReadCoilContext(ctx context.Context, addr uint16) (value bool, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		value, err = tc.ctxInner.ReadCoilContext(ctx, addr)
+	} else {
+		value, err = tc.inner.ReadCoil(addr)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) ReadDiscreteInputsContext(ctx context.Context, addr uint16, quantity uint16) (values []bool, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		values, err = tc.ctxInner.ReadDiscreteInputsContext(ctx, addr, quantity)
+	} else {
+		values, err = tc.inner.ReadDiscreteInputs(addr, quantity)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) ReadDiscreteInputContext(ctx context.Context, addr uint16) (value bool, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		value, err = tc.ctxInner.ReadDiscreteInputContext(ctx, addr)
+	} else {
+		value, err = tc.inner.ReadDiscreteInput(addr)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) ReadRegistersContext(ctx context.Context, addr uint16, quantity uint16, regType RegType) (values []uint16, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		values, err = tc.ctxInner.ReadRegistersContext(ctx, addr, quantity, regType)
+	} else {
+		values, err = tc.inner.ReadRegisters(addr, quantity, regType)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) ReadRegisterContext(ctx context.Context, addr uint16, regType RegType) (value uint16, err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		value, err = tc.ctxInner.ReadRegisterContext(ctx, addr, regType)
+	} else {
+		value, err = tc.inner.ReadRegister(addr, regType)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) WriteCoilContext(ctx context.Context, addr uint16, value bool) (err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		err = tc.ctxInner.WriteCoilContext(ctx, addr, value)
+	} else {
+		err = tc.inner.WriteCoil(addr, value)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) WriteCoilsContext(ctx context.Context, addr uint16, values []bool) (err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		err = tc.ctxInner.WriteCoilsContext(ctx, addr, values)
+	} else {
+		err = tc.inner.WriteCoils(addr, values)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) WriteRegisterContext(ctx context.Context, addr uint16, value uint16) (err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		err = tc.ctxInner.WriteRegisterContext(ctx, addr, value)
+	} else {
+		err = tc.inner.WriteRegister(addr, value)
+	}
+
+	return
+}
+
+func (tc *throttlingClient) WriteRegistersContext(ctx context.Context, addr uint16, values []uint16) (err error) {
+	err = tc.wait(ctx)
+	if err != nil {
+		return
+	}
+
+	if tc.ctxInner != nil {
+		err = tc.ctxInner.WriteRegistersContext(ctx, addr, values)
+	} else {
+		err = tc.inner.WriteRegisters(addr, values)
+	}
+
+	return
+}
+
+// Takes a token from the bucket, blocking until one is available or ctx is
+// done.
+// Tokens are reserved in call order: concurrent callers are released one
+// after the other at the configured rate.
+// If ctx expires before a token would be available, the token is given back
+// and context.DeadlineExceeded is returned right away rather than after
+// sleeping until the deadline.
+func (tc *throttlingClient) wait(ctx context.Context) (err error) {
+	var now		time.Time
+	var deadline	time.Time
+	var ok		bool
+	var delay	time.Duration
+	var timer	*time.Timer
+
+	if tc.err != nil {
+		err	= tc.err
+		return
+	}
+
+	err	= ctx.Err()
+	if err != nil {
+		return
+	}
+
+	tc.lock.Lock()
+
+	// refill the bucket
+	now		= time.Now()
+	tc.tokens	+= now.Sub(tc.last).Seconds() * tc.rate
+	if tc.tokens > tc.burst {
+		tc.tokens	= tc.burst
+	}
+	tc.last		= now
+
+	// take a token, possibly ahead of time (the balance then goes negative
+	// and later callers wait for longer)
+	tc.tokens	-= 1
+	if tc.tokens < 0 {
+		delay	= time.Duration(-tc.tokens / tc.rate * float64(time.Second))
+	}
+
+	deadline, ok	= ctx.Deadline()
+	if ok && now.Add(delay).After(deadline) {
+		tc.tokens	+= 1
+		tc.lock.Unlock()
+		err	= context.DeadlineExceeded
+		return
+	}
+
+	tc.lock.Unlock()
+
+	if delay <= 0 {
+		return
+	}
+
+	timer	= time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		// give the token back
+		tc.lock.Lock()
+		tc.tokens	+= 1
+		tc.lock.Unlock()
+
+		err	= ctx.Err()
+	}
+
+	return
+}
@@ -0,0 +1,174 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestThrottlingClient(t *testing.T) {
+	var server	*ModbusServer
+	var mc		*ModbusClient
+	var client	Client
+	var err		error
+	var start	time.Time
+	var elapsed	time.Duration
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5521",
+	}, NewDataStore(16, 16, 16, 16))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5521",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// 100 requests at 500 req/s: the first request goes through
+	// immediately, the 99 others should take about 200ms
+	client	= NewThrottlingClient(mc, 500)
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	start	= time.Now()
+	for i := 0; i < 100; i++ {
+		_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+		if err != nil {
+			t.Fatalf("ReadRegister() should have succeeded, got: %v", err)
+		}
+	}
+	elapsed	= time.Since(start)
+
+	if elapsed < 180 * time.Millisecond || elapsed > 400 * time.Millisecond {
+		t.Errorf("expected 100 requests to take about 200ms, took: %v", elapsed)
+	}
+
+	// with a burst of 50, the first 50 requests should go through
+	// immediately and the 50 others should take about 100ms
+	client	= NewThrottlingClientWithBurst(mc, 500, 50)
+
+	start	= time.Now()
+	for i := 0; i < 100; i++ {
+		err	= client.WriteRegister(0, uint16(i))
+		if err != nil {
+			t.Fatalf("WriteRegister() should have succeeded, got: %v", err)
+		}
+	}
+	elapsed	= time.Since(start)
+
+	if elapsed < 90 * time.Millisecond || elapsed > 300 * time.Millisecond {
+		t.Errorf("expected 100 requests to take about 100ms, took: %v", elapsed)
+	}
+
+	return
+}
+
+func TestThrottlingClientContext(t *testing.T) {
+	var server	*ModbusServer
+	var mc		*ModbusClient
+	var client	ContextClient
+	var ctx		context.Context
+	var cancel	context.CancelFunc
+	var err		error
+	var start	time.Time
+	var elapsed	time.Duration
+
+	server, err	= NewServer(&ServerConfiguration{
+		URL:	"tcp://localhost:5578",
+	}, NewDataStore(16, 16, 16, 16))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	mc, err	= NewClient(&ClientConfiguration{
+		URL:	"tcp://localhost:5578",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// invalid rates should be rejected
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		err	= NewThrottlingClient(mc, rate).Open()
+		if !errors.Is(err, ErrConfigurationError) {
+			t.Errorf("rate %v: expected ErrConfigurationError, got: %v", rate, err)
+		}
+	}
+
+	// at 10 req/s, a token is available every 100ms
+	client	= NewThrottlingClient(mc, 10).(ContextClient)
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	_, err	= client.ReadRegisterContext(context.Background(), 0, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegisterContext() should have succeeded, got: %v", err)
+	}
+
+	// deadlines passing before the next token should fail right away
+	ctx, cancel	= context.WithTimeout(context.Background(), 20 * time.Millisecond)
+	start		= time.Now()
+	err		= client.WriteRegisterContext(ctx, 0, 1)
+	elapsed		= time.Since(start)
+	cancel()
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed > 10 * time.Millisecond {
+		t.Errorf("expected to fail right away, took: %v", elapsed)
+	}
+
+	// cancelled contexts should stop the wait
+	ctx, cancel	= context.WithCancel(context.Background())
+	time.AfterFunc(20 * time.Millisecond, cancel)
+	start		= time.Now()
+	_, err		= client.ReadRegistersContext(ctx, 0, 2, HOLDING_REGISTER)
+	elapsed		= time.Since(start)
+
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if elapsed > 60 * time.Millisecond {
+		t.Errorf("expected to stop waiting once cancelled, took: %v", elapsed)
+	}
+
+	// tokens of failed waits should have been given back: the next
+	// request should only wait for the token following the first request
+	start	= time.Now()
+	_, err	= client.ReadRegister(0, HOLDING_REGISTER)
+	elapsed	= time.Since(start)
+
+	if err != nil {
+		t.Errorf("ReadRegister() should have succeeded, got: %v", err)
+	}
+	if elapsed > 150 * time.Millisecond {
+		t.Errorf("expected to wait for less than 100ms, took: %v", elapsed)
+	}
+
+	return
+}
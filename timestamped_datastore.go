@@ -0,0 +1,70 @@
+package modbus
+
+import (
+	"sync"
+	"time"
+)
+
+// TimestampedDataStore is a request handler recording when each holding
+// register was last written by a client (see NewTimestampedDataStore()).
+type TimestampedDataStore struct {
+	*DataStore
+	lock		sync.Mutex
+	lastWrites	map[uint16]time.Time
+}
+
+// Returns a request handler serving ds and recording the time of the last
+// client write to each holding register, e.g. to tell fresh values from
+// stale ones (see LastWriteTime() and IsStale()).
+// Writes made through the Set methods of ds are not recorded.
+func NewTimestampedDataStore(ds *DataStore) (tds *TimestampedDataStore) {
+	tds	= &TimestampedDataStore{
+		DataStore:	ds,
+		lastWrites:	make(map[uint16]time.Time),
+	}
+
+	return
+}
+
+func (tds *TimestampedDataStore) HandleHoldingRegisters(unitId uint8, addr uint16, quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	var now	time.Time
+
+	res, err	= tds.DataStore.HandleHoldingRegisters(unitId, addr, quantity, isWrite, args)
+	if err != nil || !isWrite {
+		return
+	}
+
+	now	= time.Now()
+
+	tds.lock.Lock()
+	defer tds.lock.Unlock()
+
+	for i := 0; i < int(quantity); i++ {
+		tds.lastWrites[addr + uint16(i)]	= now
+	}
+
+	return
+}
+
+// Returns the time holding register addr was last written by a client, and
+// false if it never was.
+func (tds *TimestampedDataStore) LastWriteTime(addr uint16) (t time.Time, found bool) {
+	tds.lock.Lock()
+	defer tds.lock.Unlock()
+
+	t, found	= tds.lastWrites[addr]
+
+	return
+}
+
+// Returns true if holding register addr has not been written by a client
+// within maxAge (including if it never was).
+func (tds *TimestampedDataStore) IsStale(addr uint16, maxAge time.Duration) (stale bool) {
+	var t		time.Time
+	var found	bool
+
+	t, found	= tds.LastWriteTime(addr)
+	stale		= !found || time.Since(t) > maxAge
+
+	return
+}
@@ -0,0 +1,53 @@
+package modbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampedDataStore(t *testing.T) {
+	var tds		*TimestampedDataStore
+	var err		error
+	var before	time.Time
+	var ts		time.Time
+	var found	bool
+
+	tds	= NewTimestampedDataStore(NewDataStore(0, 0, 10, 0))
+
+	_, found	= tds.LastWriteTime(3)
+	if found || !tds.IsStale(3, time.Hour) {
+		t.Errorf("registers never written should be stale")
+	}
+
+	before	= time.Now()
+	_, err	= tds.HandleHoldingRegisters(1, 3, 2, true, []uint16{1, 2})
+	if err != nil {
+		t.Fatalf("HandleHoldingRegisters() should have succeeded, got: %v", err)
+	}
+
+	ts, found	= tds.LastWriteTime(4)
+	if !found || ts.Before(before) {
+		t.Errorf("expected a last write time past %v, got: %v (%v)", before, ts, found)
+	}
+
+	if tds.IsStale(3, time.Hour) {
+		t.Errorf("register 3 should be fresh")
+	}
+
+	// reads, failed writes and application side writes are not recorded
+	tds.HandleHoldingRegisters(1, 5, 1, false, nil)
+	tds.HandleHoldingRegisters(1, 9, 2, true, []uint16{1, 2})
+	tds.SetHoldingRegister(6, 1)
+	for _, addr := range []uint16{5, 6, 9} {
+		if _, found = tds.LastWriteTime(addr); found {
+			t.Errorf("register %v should not have been recorded", addr)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !tds.IsStale(3, 10 * time.Millisecond) {
+		t.Errorf("register 3 should be stale")
+	}
+
+	return
+}
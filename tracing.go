@@ -0,0 +1,114 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// Tracer starts spans around client and server requests, e.g. to make modbus
+// calls show up in OpenTelemetry traces (see ClientConfiguration.Tracer and
+// ServerConfiguration.Tracer). A minimal OpenTelemetry bridge looks like
+//   func (b *otelBridge) Start(ctx context.Context, name string,
+//                              attrs SpanAttributes) (context.Context, func(error)) {
+//       ctx, span := b.tracer.Start(ctx, name, trace.WithAttributes(
+//           attribute.Int("modbus.unit_id", int(attrs.UnitId)),
+//           attribute.Int("modbus.function_code", int(attrs.FunctionCode)),
+//           attribute.Int("modbus.address", int(attrs.Addr)),
+//           attribute.Int("modbus.quantity", int(attrs.Quantity))))
+//       return ctx, func(err error) {
+//           if err != nil {
+//               span.RecordError(err)
+//               span.SetStatus(codes.Error, err.Error())
+//           }
+//           span.End()
+//       }
+//   }
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name (e.g. "modbus.client/ReadHoldingRegisters")
+	// as a child of the span carried by ctx, if any, and returns a context
+	// carrying the new span along with a function ending it with the
+	// outcome of the request: nil on success, an ErrExceptionResponse on
+	// exception responses or any other error.
+	// On servers, the returned context is passed down to context-aware
+	// handlers (see ContextRequestHandler) so that their own spans nest.
+	Start(ctx context.Context, name string, attrs SpanAttributes) (context.Context, func(err error))
+}
+
+// SpanAttributes describes the request a span covers.
+// Addr and Quantity are only set for function codes addressing coils or
+// registers (0x01 to 0x06, 0x0f, 0x10, 0x16 and 0x17, where they describe the
+// read part), as flagged by HasAddr.
+type SpanAttributes struct {
+	UnitId		uint8
+	FunctionCode	uint8
+	HasAddr		bool
+	Addr		uint16
+	Quantity	uint16
+}
+
+// Returns the span attributes of req.
+func spanAttributes(req *pdu) (attrs SpanAttributes) {
+	attrs	= SpanAttributes{
+		UnitId:		req.unitId,
+		FunctionCode:	req.functionCode,
+	}
+
+	switch req.functionCode {
+	case FC_READ_COILS, FC_READ_DISCRETE_INPUTS,
+	     FC_READ_HOLDING_REGISTERS, FC_READ_INPUT_REGISTERS,
+	     FC_WRITE_MULTIPLE_COILS, FC_WRITE_MULTIPLE_REGISTERS,
+	     FC_READ_WRITE_MULTILE_REGISTERS:
+		if len(req.payload) >= 4 {
+			attrs.HasAddr	= true
+			attrs.Addr	= binary.BigEndian.Uint16(req.payload[0:2])
+			attrs.Quantity	= binary.BigEndian.Uint16(req.payload[2:4])
+		}
+
+	case FC_WRITE_SINGLE_COIL, FC_WRITE_SINGLE_REGISTER, FC_MASK_WRITE_REGISTER:
+		if len(req.payload) >= 2 {
+			attrs.HasAddr	= true
+			attrs.Addr	= binary.BigEndian.Uint16(req.payload[0:2])
+			attrs.Quantity	= 1
+		}
+	}
+
+	return
+}
+
+// Returns err, or an ErrExceptionResponse error if res is an exception
+// response.
+func responseError(res *pdu, err error) (out error) {
+	out	= err
+	if err == nil && res != nil && res.functionCode & 0x80 != 0 && len(res.payload) == 1 {
+		out	= newExceptionResponseError(res.functionCode, res.payload[0])
+	}
+
+	return
+}
+
+// Starts a span around a client request, as a child of the context of the
+// request in progress if any. Must be called with mc.lock held.
+func (mc *ModbusClient) startSpan(req *pdu) (end func(error)) {
+	var ctx	context.Context
+
+	ctx	= mc.ctx
+	if ctx == nil {
+		ctx	= context.Background()
+	}
+
+	_, end	= mc.conf.Tracer.Start(ctx, "modbus.client/" + functionCodeName(req.functionCode),
+				       spanAttributes(req))
+
+	return
+}
+
+// Starts a span around a server request, attaching it to the context of the
+// request.
+func (ms *ModbusServer) startSpan(req *pdu) (end func(error)) {
+	req.ctx, end	= ms.conf.Tracer.Start(requestContext(req),
+					       "modbus.server/" + functionCodeName(req.functionCode),
+					       spanAttributes(req))
+
+	return
+}
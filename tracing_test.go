@@ -0,0 +1,180 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+// recordedSpan is a span recorded by testTracer.
+type recordedSpan struct {
+	name	string
+	parent	interface{}
+	attrs	SpanAttributes
+	ended	bool
+	err	error
+}
+
+// testTracer records spans, tagging the contexts it returns with the span
+// name.
+type testTracer struct {
+	lock	sync.Mutex
+	spans	[]*recordedSpan
+}
+
+func (tt *testTracer) Start(ctx context.Context, name string,
+			    attrs SpanAttributes) (context.Context, func(error)) {
+	var span	= &recordedSpan{
+		name:	name,
+		parent:	ctx.Value(traceKey{}),
+		attrs:	attrs,
+	}
+
+	tt.lock.Lock()
+	tt.spans	= append(tt.spans, span)
+	tt.lock.Unlock()
+
+	return context.WithValue(ctx, traceKey{}, name), func(err error) {
+		tt.lock.Lock()
+		span.ended	= true
+		span.err	= err
+		tt.lock.Unlock()
+	}
+}
+
+// Returns the recorded spans, once count of them have ended.
+func (tt *testTracer) waitForSpans(count int) (spans []recordedSpan) {
+	for i := 0; i < 100; i++ {
+		tt.lock.Lock()
+		spans	= nil
+		for _, span := range tt.spans {
+			if span.ended {
+				spans	= append(spans, *span)
+			}
+		}
+		tt.lock.Unlock()
+
+		if len(spans) >= count {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return
+}
+
+// spanHandler is a ContextRequestHandler reporting the span its holding
+// register requests were handled in.
+type spanHandler struct {
+	*requestHandlerAdapter
+	parents	chan interface{}
+}
+
+func (sh *spanHandler) HandleHoldingRegistersContext(ctx context.Context, unitId uint8, addr uint16,
+						     quantity uint16, isWrite bool, args []uint16) (res []uint16, err error) {
+	sh.parents <- ctx.Value(traceKey{})
+
+	res, err	= sh.requestHandlerAdapter.HandleHoldingRegistersContext(
+				ctx, unitId, addr, quantity, isWrite, args)
+
+	return
+}
+
+func TestTracing(t *testing.T) {
+	var server	*ModbusServer
+	var client	*ModbusClient
+	var st, ct	*testTracer
+	var sh		*spanHandler
+	var spans	[]recordedSpan
+	var err		error
+
+	st	= &testTracer{}
+	sh	= &spanHandler{
+		requestHandlerAdapter:	&requestHandlerAdapter{handler: NewDataStore(0, 0, 4, 0)},
+		parents:		make(chan interface{}, 2),
+	}
+
+	server, err	= NewServerWithContextHandler(&ServerConfiguration{
+		URL:	"tcp://localhost:5575",
+		Tracer:	st,
+	}, sh)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	err	= server.Start()
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	ct		= &testTracer{}
+	client, err	= NewClient(&ClientConfiguration{
+		URL:		"tcp://localhost:5575",
+		Timeout:	1 * time.Second,
+		Tracer:		ct,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	err	= client.Open()
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	defer client.Close()
+
+	// client spans are children of the span of the request context
+	_, err	= client.ReadRegistersContext(
+			context.WithValue(context.Background(), traceKey{}, "parent"),
+			1, 2, HOLDING_REGISTER)
+	if err != nil {
+		t.Fatalf("ReadRegistersContext() should have succeeded, got: %v", err)
+	}
+
+	err	= client.WriteRegister(5, 0x1234)
+	if !errors.Is(err, ErrIllegalDataAddress) {
+		t.Errorf("expected ErrIllegalDataAddress, got: %v", err)
+	}
+
+	spans	= ct.waitForSpans(2)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 client spans, got: %v", len(spans))
+	}
+
+	if spans[0].name != "modbus.client/ReadHoldingRegisters" ||
+	   spans[0].parent != "parent" || spans[0].err != nil ||
+	   spans[0].attrs != (SpanAttributes{
+		UnitId: 1, FunctionCode: FC_READ_HOLDING_REGISTERS,
+		HasAddr: true, Addr: 1, Quantity: 2,
+	   }) {
+		t.Errorf("unexpected span: %+v", spans[0])
+	}
+
+	if spans[1].name != "modbus.client/WriteSingleRegister" || spans[1].parent != nil ||
+	   !errors.Is(spans[1].err, ErrIllegalDataAddress) ||
+	   spans[1].attrs.Addr != 5 || spans[1].attrs.Quantity != 1 {
+		t.Errorf("unexpected span: %+v", spans[1])
+	}
+
+	// server spans wrap handlers
+	if <-sh.parents != "modbus.server/ReadHoldingRegisters" {
+		t.Errorf("expected the handler to run within the server span")
+	}
+
+	spans	= st.waitForSpans(2)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 server spans, got: %v", len(spans))
+	}
+
+	if spans[0].err != nil || spans[0].attrs.Quantity != 2 ||
+	   !errors.Is(spans[1].err, ErrIllegalDataAddress) {
+		t.Errorf("unexpected spans: %+v", spans)
+	}
+
+	return
+}
@@ -5,6 +5,7 @@ const (
 	RTU_TRANSPORT		transportType	= 1
 	RTU_OVER_TCP_TRANSPORT	transportType	= 2
 	TCP_TRANSPORT		transportType	= 3
+	ASCII_TRANSPORT		transportType	= 4
 )
 
 type transport interface {
@@ -13,3 +14,9 @@ type transport interface {
 	ReadRequest()			(*pdu, error)
 	WriteResponse(*pdu)		(error)
 }
+
+// requestWriter is implemented by serial transports, which can send requests
+// without waiting for a response (broadcasts).
+type requestWriter interface {
+	WriteRequest(*pdu)		(error)
+}